@@ -3,67 +3,241 @@
 //
 // The server can be configured with the following options:
 //
+//   - `--config`: The path to a YAML or JSON configuration file.
 //   - `--address`: The address to listen on.
 //   - `--server-cert`: The path to the server's certificate file.
 //   - `--server-key`: The path to the server's key file.
 //   - `--client-ca-cert`: The path to the client CA certificate file.
+//   - `--server-intermediate`: The paths of intermediate CA certificate files
+//     presented with the server certificate.
+//   - `--listen-timeout`: Retry listening on an address in use for up to the given duration.
+//   - `--require-client-eku`: Require client certificates with client auth EKU.
+//   - `--client-eku-oid`: Additional extended key usage OIDs required on client
+//     certificates, ex.: 1.3.6.1.4.1.99999.1
+//   - `--operator`: Client certificate common names with the operator role.
+//   - `--session-ticket-keys`: The file of hex-encoded TLS session ticket keys,
+//     one per line, to resume sessions across server replicas.
+//   - `--no-session-resumption`: Disable TLS session resumption.
+//   - `--cgroup`: The parent cgroup for all jobs.
+//   - `--owner-cgroups`: Group job cgroups in a cgroup per owner.
+//   - `--reap-orphans`: Reuse an existing parent cgroup and reap orphan job
+//     cgroups in it, ex.: after a crash.
+//   - `--strict-controllers`: Reject limits of unavailable cgroup controllers.
+//   - `--host-limit-check`: Warn about or reject limits exceeding the host's CPUs or memory.
 //   - `--cpu-limit`: The number of CPUs per job.
 //   - `--memory-limit`: The memory limit in KiB per job.
-//   - `--io-limit`: The I/O limit per job. ex: 252:1 rbps=1000000
+//   - `--memory-high`: The memory throttling limit in KiB per job.
+//   - `--memory-min`: The guaranteed memory in KiB per job.
+//   - `--oom-group`: Kill all processes of a job together on OOM.
+//   - `--io-limit`: The I/O limit per job. ex: 252:1 rbps=1000000. Multiple
+//     limits can be separated by "," or ";", or read from a file of io.max
+//     lines with "@path".
+//   - `--max-cpu-seconds`: The CPU time budget in seconds per job.
+//   - `--rlimit`: The per-process resource limits of jobs, ex: nofile=1024
+//   - `--max-jobs`: The maximum number of concurrently running jobs.
+//   - `--setup-timeout`: The maximum duration of a job's cgroup and process setup.
+//   - `--shutdown-timeout`: The maximum time to wait for jobs to terminate on shutdown.
+//   - `--max-log-bytes`: The maximum number of output bytes buffered per job.
+//   - `--run-as`: The UID:GID jobs run as.
+//   - `--groups`: The supplementary group IDs of jobs, requires `--run-as`.
+//   - `--allowed-groups`: The supplementary group IDs `--groups` may contain.
+//   - `--umask`: The file mode creation mask of jobs, ex.: 0077.
+//   - `--rootfs`: The directory used as root directory of jobs.
+//   - `--mount-source`: A host path allowed as source of job bind mounts.
+//   - `--output-digest`: Report a SHA-256 digest of each job's output in its status.
+//   - `--discard-output`: Discard the output of all jobs without buffering it.
+//   - `--close-fds`: Close all inherited file descriptors other than stdio in jobs.
+//   - `--inherit-env`: Names of server environment variables inherited by jobs,
+//     ex.: PATH. Jobs inherit no server environment by default.
+//   - `--command-wrapper`: The command, then each of its arguments, prefixed to the command
+//     of every job, ex.: `--command-wrapper nice --command-wrapper=-n --command-wrapper 10`.
+//   - `--seccomp`: Kill jobs making syscalls blocked by the given seccomp profile.
+//   - `--tee-output`: Mirror all job output to the given file, or stdout with "-".
+//   - `--event-log`: Write job lifecycle events as JSON lines to the given file, or stdout with "-".
+//   - `--log-heartbeat`: The interval of heartbeats on idle log streams.
+//   - `--max-log-streams`: The maximum number of concurrently open log streams.
+//   - `--max-uptime`: The duration after which the server shuts down, ex.: 1h.
+//   - `--debug`: Enable the operator-only Debug RPC reporting internal counters.
+//   - `--http-gateway`: The address of a read-only HTTPS/JSON gateway for job status.
+//   - `--check`: Validate the host's cgroup setup with a trivial job and exit.
 //
 // The server can also be configured using environment variables:
 //
+//   - TELEJOB_CONFIG: The path to a YAML or JSON configuration file.
 //   - TELEJOB_ADDRESS: The address to listen on.
 //   - TELEJOB_SERVER_CERT: The path to the server's certificate file.
 //   - TELEJOB_SERVER_KEY: The path to the server's key file.
 //   - TELEJOB_CLIENT_CA_CERT: The path to the client CA certificate file.
 //
+// The configuration file uses flag names as keys, for example:
+//
+//	address: localhost:8443
+//	server-cert: certs/server.crt
+//	cpu-limit: 0.5
+//	io-limit:
+//	  - "252:1 rbps=1000000"
+//
+// Flags take precedence over environment variables, which take precedence
+// over the configuration file. Unknown keys in the configuration file are
+// rejected.
+//
 // Sample usage after environment setup:
 //
 //	telejob-server --cpu-limit 0.5 --memory-limit 2000
+//
+// With `--check`, the server creates its cgroup, runs `true` as job under the
+// configured limits, prints a report including the available cgroup
+// controllers, removes the cgroup again and exits. Use it to validate cgroup
+// delegation and limit support of a host before going live.
 package main
 
 import (
+	"cmp"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
-	"net"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/juliaogris/telejob/pkg/job"
 	"github.com/juliaogris/telejob/pkg/telejob"
+	"gopkg.in/yaml.v3"
 )
 
 const description = "Telejob-server is a gRPC server that runs and manages jobs in a restricted environment."
 
 type app struct {
+	Config kong.ConfigFlag `short:"C" help:"YAML or JSON configuration file, keys are flag names." env:"TELEJOB_CONFIG"`
+
 	Address      string `required:"" short:"A" help:"Address to listen on." env:"TELEJOB_ADDRESS"`
 	ServerCert   string `required:"" help:"Server certificate file." env:"TELEJOB_SERVER_CERT"`
 	ServerKey    string `required:"" help:"Server private key file." env:"TELEJOB_SERVER_KEY"`
 	ClientCACert string `required:"" help:"Client CA certificate file." env:"TELEJOB_CLIENT_CA_CERT"`
 
-	CPULimit    float64  `short:"c" help:"Number of CPUs per job."`
-	MemoryLimit uint64   `short:"m" help:"Memory limit in KiB per job."`
-	IOLimit     []string `short:"i" help:"I/O Limit per job, ex.: \"252:1 rbps=1000000\"."`
+	ServerIntermediate []string `help:"Intermediate CA certificate file presented with the server certificate, in order from the server certificate towards the CA."`
+
+	ListenTimeout time.Duration `help:"Retry listening on an address already in use for up to the given duration, ex.: \"10s\", such as during rolling restarts."`
+
+	RequireClientEKU bool     `help:"Require the client authentication extended key usage on client certificates."`
+	ClientEKUOID     []string `help:"Custom extended key usage OID required on client certificates, ex.: \"1.3.6.1.4.1.99999.1\". Implies --require-client-eku."`
+	Operator         []string `help:"Client certificate common name with the operator role, allowing to stop jobs of all owners."`
+
+	SessionTicketKeys   string `help:"File of hex-encoded 32-byte TLS session ticket keys, one per line, the first encrypts new tickets. Share it between replicas to resume sessions across them. Defaults to automatically rotated keys." type:"path"`
+	NoSessionResumption bool   `help:"Disable TLS session resumption, so that each connection performs a full handshake, for forward secrecy per connection."`
+
+	Cgroup       string `help:"Parent cgroup for all jobs." default:"/sys/fs/cgroup/telejob"`
+	OwnerCgroups bool   `help:"Create job cgroups in a cgroup per owner, <cgroup>/<owner>/<id>, for host-side accounting per owner."`
+	ReapOrphans  bool   `help:"Reuse an existing parent cgroup, ex.: after a crash, killing and deleting the job cgroups left in it."`
+
+	StrictControllers bool   `help:"Fail if a limit requires a cgroup controller not delegated to the cgroup, rather than skipping the limit with a warning."`
+	HostLimitCheck    string `help:"Compare CPU and memory limits with the host's CPUs and total memory: off, warn or reject limits exceeding them." enum:"off,warn,reject" default:"off"`
+
+	CPULimit    float64           `short:"c" help:"Number of CPUs per job."`
+	MemoryLimit uint64            `short:"m" help:"Memory limit in KiB per job, jobs exceeding it are killed."`
+	MemoryHigh  uint64            `help:"Memory throttling limit in KiB per job, jobs exceeding it are throttled."`
+	MemoryMin   uint64            `help:"Guaranteed memory in KiB per job, not reclaimed by the kernel. Must not exceed --memory-limit."`
+	OOMGroup    bool              `help:"Kill all processes of a job together when the OOM killer kills one of them." name:"oom-group"`
+	IOLimit     []string          `short:"i" sep:"none" help:"I/O Limit per job, ex.: \"252:1 rbps=1000000\". Separate multiple limits with \",\" or \";\", or read them from a file of io.max lines with \"@path\"."`
+	Rlimit      map[string]uint64 `help:"Per-process resource limit of jobs, ex.: \"nofile=1024\". Supported: core, nofile, nproc."`
+
+	MaxCPUSeconds float64 `help:"CPU time budget in seconds per job, jobs exceeding it are stopped. Unlike --cpu-limit, it bounds the total CPU time. 0 is unlimited."`
+
+	MaxJobs      int           `help:"Maximum number of concurrently running jobs, further starts are rejected with a retry hint. 0 is unlimited."`
+	MaxLogBytes  int           `help:"Maximum number of output bytes buffered per job, older output is discarded. 0 is unlimited."`
+	SetupTimeout time.Duration `help:"Abort job starts whose cgroup and process setup takes longer than the given duration, ex.: \"10s\". 0 is unlimited."`
+
+	ShutdownTimeout time.Duration `help:"Maximum time to wait for stopped jobs to terminate on shutdown, ex.: \"30s\". Jobs still running then are killed once more and reported, and the server exits regardless. 0 waits indefinitely."`
+
+	RunAs         string   `help:"Run jobs as UID:GID, ex.: \"1000:1000\"."`
+	Groups        []uint32 `help:"Supplementary group IDs of jobs, requires --run-as."`
+	AllowedGroups []uint32 `help:"Supplementary group IDs that --groups may contain, guarding against misconfiguration. Any group is allowed by default."`
+	Umask         string   `help:"Octal file mode creation mask of jobs, ex.: \"0077\". Defaults to the server's umask."`
+	Rootfs        string   `help:"Absolute path of a directory used as root directory of jobs, confining their file access."`
+
+	MountSource []string `help:"Absolute host path that jobs may bind mount, including everything below it, ex.: \"/srv/data\"."`
+
+	OutputDigest   bool     `help:"Report the SHA-256 digest of each job's total output in its status, for integrity verification."`
+	DiscardOutput  bool     `help:"Discard the output of all jobs without buffering it, for fire-and-forget batch jobs. Logs of jobs cannot be read."`
+	CloseFDs       bool     `help:"Close all file descriptors of the server other than stdin, stdout and stderr in jobs, even ones not marked close-on-exec." name:"close-fds"`
+	InheritEnv     []string `help:"Name of a server environment variable inherited by jobs, ex.: \"PATH\". By default, jobs inherit no server environment, which may hold secrets."`
+	CommandWrapper []string `sep:"none" help:"Command, then each of its arguments in a repeated flag, prefixed to the command of every job, ex.: \"--command-wrapper nice --command-wrapper=-n --command-wrapper 10\". Job statuses report the command without it."`
+	Seccomp        string   `help:"JSON seccomp profile file of syscalls blocked in jobs, ex.: {\"blocked\": [\"mount\", \"ptrace\"]}."`
+	TeeOutput      string   `help:"Mirror the output of all jobs, prefixed with the job ID, to the given file or to stdout with \"-\", for debugging."`
+	EventLog       string   `help:"Write job lifecycle events, such as started, failed or oom, as JSON lines to the given file or to stdout with \"-\", for monitoring."`
+
+	LogHeartbeat  time.Duration `help:"Send a heartbeat on log streams idle for the given duration, ex.: \"30s\". 0 disables heartbeats."`
+	MaxLogStreams int           `help:"Reject log streams beyond the given number of concurrently open streams of all clients, to bound the server's goroutines. 0 is unlimited."`
+	MaxUptime     time.Duration `help:"Gracefully shut down the server after the given duration, ex.: \"1h\". 0 is unlimited."`
+	Debug         bool          `help:"Enable the operator-only Debug RPC reporting internal counters, such as log readers."`
+	HTTPGateway   string        `help:"Serve job status and list as JSON over HTTPS with the same mTLS on the given address, ex.: \":8444\"." name:"http-gateway"`
+
+	Check bool `help:"Validate the cgroup setup by running a trivial job with the configured limits, then exit."`
+
+	out io.Writer // output of --check, defaults to os.Stdout.
 }
 
 func main() {
-	opts := []kong.Option{kong.Description(description)}
+	opts := []kong.Option{
+		kong.Description(description),
+		kong.Configuration(yamlConfig),
+	}
 	kctx := kong.Parse(&app{}, opts...)
 	kctx.FatalIfErrorf(kctx.Run())
 }
 
 // Run is called by [kong] after flags have been validated and parsed.
 func (a *app) Run() error {
-	opts := []job.Option{
-		job.WithLimits(job.Limits{CPUs: a.CPULimit, MemoryKiB: a.MemoryLimit, IO: a.IOLimit}),
+	opts, err := a.jobOptions()
+	if err != nil {
+		return err
+	}
+	if a.Check {
+		return a.check(opts)
+	}
+	serverOpts := []telejob.ServerOption{
+		telejob.WithJobOptions(opts...),
+		telejob.WithOperators(a.Operator...),
+		telejob.WithLogHeartbeat(a.LogHeartbeat),
+		telejob.WithMaxLogStreams(a.MaxLogStreams),
+		telejob.WithServerIntermediates(a.ServerIntermediate...),
+	}
+	if a.RequireClientEKU || len(a.ClientEKUOID) > 0 {
+		oids, err := parseOIDs(a.ClientEKUOID)
+		if err != nil {
+			return err
+		}
+		serverOpts = append(serverOpts, telejob.WithRequiredClientEKU(oids...))
 	}
-	server, err := telejob.NewServer(a.ServerCert, a.ServerKey, a.ClientCACert, opts...)
+	if a.HTTPGateway != "" {
+		serverOpts = append(serverOpts, telejob.WithHTTPGateway(a.HTTPGateway))
+	}
+	if a.Debug {
+		serverOpts = append(serverOpts, telejob.WithDebug())
+	}
+	if a.SessionTicketKeys != "" {
+		keys, err := readSessionTicketKeys(a.SessionTicketKeys)
+		if err != nil {
+			return err
+		}
+		serverOpts = append(serverOpts, telejob.WithSessionTicketKeys(keys...))
+	}
+	if a.NoSessionResumption {
+		serverOpts = append(serverOpts, telejob.WithoutSessionResumption())
+	}
+	server, err := telejob.NewServerWithOptions(a.ServerCert, a.ServerKey, a.ClientCACert, serverOpts...)
 	if err != nil {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
 	server.StopOnSignals(os.Interrupt)
-	lis, err := net.Listen("tcp", a.Address)
+	server.StopAfter(a.MaxUptime)
+	lis, err := telejob.ListenWithRetry(a.Address, a.ListenTimeout)
 	if err != nil {
 		return fmt.Errorf("failed to listen: %w", err)
 	}
@@ -73,3 +247,294 @@ func (a *app) Run() error {
 	}
 	return nil
 }
+
+// jobOptions returns the job controller options configured by the flags.
+func (a *app) jobOptions() ([]job.Option, error) {
+	ioLimits, err := parseIOLimits(a.IOLimit)
+	if err != nil {
+		return nil, err
+	}
+	opts := []job.Option{
+		job.WithCgroup(a.Cgroup),
+		job.WithLimits(job.Limits{CPUs: a.CPULimit, MemoryKiB: a.MemoryLimit, MemoryHighKiB: a.MemoryHigh, MemoryMinKiB: a.MemoryMin, OOMGroup: a.OOMGroup, IO: ioLimits, Rlimits: a.Rlimit, MaxCPUSeconds: a.MaxCPUSeconds}),
+		job.WithMaxLogBytes(a.MaxLogBytes),
+		job.WithMaxJobs(a.MaxJobs),
+		job.WithSetupTimeout(a.SetupTimeout),
+		job.WithStopAllTimeout(a.ShutdownTimeout),
+	}
+	if a.RunAs != "" {
+		cred, err := parseCredential(a.RunAs, a.Groups)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, job.WithCredential(cred))
+		if len(a.AllowedGroups) > 0 {
+			opts = append(opts, job.WithAllowedGroups(a.AllowedGroups...))
+		}
+	} else if len(a.Groups) > 0 {
+		return nil, errors.New("--groups requires --run-as")
+	}
+	if a.Umask != "" {
+		mask, err := strconv.ParseUint(a.Umask, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --umask %q: %w", a.Umask, err)
+		}
+		opts = append(opts, job.WithUmask(int(mask))) //nolint:gosec // parsed with bitSize 32.
+	}
+	if a.Rootfs != "" {
+		opts = append(opts, job.WithRootfs(a.Rootfs))
+	}
+	if len(a.MountSource) > 0 {
+		opts = append(opts, job.WithMountSources(a.MountSource...))
+	}
+	if a.OwnerCgroups {
+		opts = append(opts, job.WithOwnerCgroups())
+	}
+	if a.ReapOrphans {
+		opts = append(opts, job.WithReapOrphans())
+	}
+	if a.HostLimitCheck != "off" {
+		opts = append(opts, job.WithHostLimitCheck(a.HostLimitCheck == "reject"))
+	}
+	if a.StrictControllers {
+		opts = append(opts, job.WithStrictControllers())
+	}
+	if a.OutputDigest {
+		opts = append(opts, job.WithOutputDigest())
+	}
+	if a.DiscardOutput {
+		opts = append(opts, job.WithDiscardOutput())
+	}
+	if a.CloseFDs {
+		opts = append(opts, job.WithCloseFDs())
+	}
+	if len(a.CommandWrapper) > 0 {
+		opts = append(opts, job.WithCommandWrapper(a.CommandWrapper))
+	}
+	if len(a.InheritEnv) > 0 {
+		opts = append(opts, job.WithInheritEnv(a.InheritEnv))
+	}
+	if a.Seccomp != "" {
+		opts = append(opts, job.WithSeccompProfile(a.Seccomp))
+	}
+	if a.TeeOutput != "" {
+		w, err := openOutput("tee-output", a.TeeOutput)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, job.WithTeeOutput(w))
+	}
+	if a.EventLog != "" {
+		w, err := openOutput("event-log", a.EventLog)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, job.WithEventLog(w))
+	}
+	return opts, nil
+}
+
+// openOutput returns stdout for "-", otherwise it opens the file at path of
+// the flag with the given name for appending. The file stays open for the
+// lifetime of the server.
+func openOutput(flag, path string) (io.Writer, error) {
+	if path == "-" {
+		return os.Stdout, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open --%s: %w", flag, err)
+	}
+	return f, nil
+}
+
+// check runs the host check of the --check flag with the given job options
+// and prints its report.
+func (a *app) check(opts []job.Option) error {
+	report, err := job.Check(opts...)
+	if err != nil {
+		return fmt.Errorf("check failed: %w", err)
+	}
+	out := cmp.Or(a.out, io.Writer(os.Stdout))
+	_, err = fmt.Fprintf(out, "cgroup: %s\ncontrollers: %s\ncheck job: ok (%v)\n",
+		report.Cgroup, strings.Join(report.Controllers, " "), report.JobDuration.Round(time.Millisecond))
+	if err != nil {
+		return fmt.Errorf("cannot write check report: %w", err)
+	}
+	return nil
+}
+
+// readSessionTicketKeys reads hex-encoded 32-byte session ticket keys, one
+// per line, from the file at path. Empty lines are ignored.
+func readSessionTicketKeys(path string) ([][32]byte, error) {
+	b, err := os.ReadFile(path) //nolint:gosec // G304: Potential file inclusion via variable
+	if err != nil {
+		return nil, fmt.Errorf("cannot read --session-ticket-keys: %w", err)
+	}
+	var keys [][32]byte
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var key [32]byte
+		if len(line) != hex.EncodedLen(len(key)) {
+			return nil, fmt.Errorf("invalid --session-ticket-keys line %d: expected %d hex digits", i+1, hex.EncodedLen(len(key)))
+		}
+		if _, err := hex.Decode(key[:], []byte(line)); err != nil {
+			return nil, fmt.Errorf("invalid --session-ticket-keys line %d: %w", i+1, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys in --session-ticket-keys %q", path)
+	}
+	return keys, nil
+}
+
+// parseIOLimits parses --io-limit values into io.max lines. A value
+// starting with "@" is the path of a file of io.max lines, ignoring empty
+// lines and comments starting with "#". Other values may contain multiple
+// lines separated by "," or ";". Each line is validated with
+// validateIOLimit.
+func parseIOLimits(values []string) ([]string, error) {
+	var limits []string
+	for _, value := range values {
+		var lines []string
+		if path, ok := strings.CutPrefix(value, "@"); ok {
+			b, err := os.ReadFile(path) //nolint:gosec // G304: Potential file inclusion via variable
+			if err != nil {
+				return nil, fmt.Errorf("cannot read --io-limit file: %w", err)
+			}
+			lines = strings.Split(string(b), "\n")
+		} else {
+			lines = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' })
+		}
+		for _, line := range lines {
+			line, _, _ = strings.Cut(line, "#")
+			line = strings.Join(strings.Fields(line), " ")
+			if line == "" {
+				continue
+			}
+			if err := validateIOLimit(line); err != nil {
+				return nil, err
+			}
+			limits = append(limits, line)
+		}
+	}
+	return limits, nil
+}
+
+// validateIOLimit checks that line is an io.max line of the form
+// "MAJ:MIN key=value...", with the keys rbps, wbps, riops and wiops and
+// values that are unsigned integers or "max".
+func validateIOLimit(line string) error {
+	fields := strings.Fields(line)
+	major, minor, ok := strings.Cut(fields[0], ":")
+	if !ok || !isUint(major) || !isUint(minor) {
+		return fmt.Errorf("invalid --io-limit %q: expected MAJ:MIN device", line)
+	}
+	if len(fields) == 1 {
+		return fmt.Errorf("invalid --io-limit %q: no limits", line)
+	}
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "rbps", "wbps", "riops", "wiops":
+		default:
+			return fmt.Errorf("invalid --io-limit %q: unknown key %q", line, key)
+		}
+		if value != "max" && !isUint(value) {
+			return fmt.Errorf("invalid --io-limit %q: invalid value of %s", line, key)
+		}
+	}
+	return nil
+}
+
+// isUint reports whether s is a decimal unsigned integer.
+func isUint(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
+
+// parseOIDs parses dotted object identifiers, such as "1.3.6.1.4.1.99999.1".
+func parseOIDs(strs []string) ([]asn1.ObjectIdentifier, error) {
+	oids := make([]asn1.ObjectIdentifier, 0, len(strs))
+	for _, str := range strs {
+		parts := strings.Split(str, ".")
+		oid := make(asn1.ObjectIdentifier, len(parts))
+		for i, part := range parts {
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid OID %q", str)
+			}
+			oid[i] = n
+		}
+		oids = append(oids, oid)
+	}
+	return oids, nil
+}
+
+// parseCredential parses a "UID:GID" string and supplementary groups into a
+// job.Credential.
+func parseCredential(runAs string, groups []uint32) (job.Credential, error) {
+	uidStr, gidStr, ok := strings.Cut(runAs, ":")
+	if !ok {
+		return job.Credential{}, fmt.Errorf("invalid --run-as %q: expected UID:GID", runAs)
+	}
+	uid, err := strconv.ParseUint(uidStr, 10, 32)
+	if err != nil {
+		return job.Credential{}, fmt.Errorf("invalid --run-as UID %q: %w", uidStr, err)
+	}
+	gid, err := strconv.ParseUint(gidStr, 10, 32)
+	if err != nil {
+		return job.Credential{}, fmt.Errorf("invalid --run-as GID %q: %w", gidStr, err)
+	}
+	return job.Credential{UID: uint32(uid), GID: uint32(gid), Groups: groups}, nil //nolint:gosec // parsed with bitSize 32.
+}
+
+// configResolver is a [kong.Resolver] resolving flag values from a parsed
+// configuration file, keyed by flag name.
+type configResolver map[string]any
+
+// yamlConfig is a [kong.ConfigurationLoader] for YAML configuration files.
+// As YAML is a superset of JSON, JSON configuration files are supported too.
+func yamlConfig(r io.Reader) (kong.Resolver, error) {
+	config := configResolver{}
+	if err := yaml.NewDecoder(r).Decode(&config); err != nil && !errors.Is(err, io.EOF) { // io.EOF: empty file
+		return nil, fmt.Errorf("cannot decode config file: %w", err)
+	}
+	return config, nil
+}
+
+// Validate implements [kong.Resolver] and rejects configuration keys that
+// don't match any flag name.
+func (c configResolver) Validate(app *kong.Application) error {
+	names := make([]string, 0, len(app.Flags))
+	for _, flag := range app.Flags {
+		names = append(names, flag.Name)
+	}
+	var unknown []string
+	for key := range c {
+		if !slices.Contains(names, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		return fmt.Errorf("unknown config file keys: %v", unknown)
+	}
+	return nil
+}
+
+// Resolve implements [kong.Resolver] and returns the configured value for the
+// given flag. Flags with a value set by environment variable are not resolved
+// so that environment variables take precedence over the configuration file.
+func (c configResolver) Resolve(_ *kong.Context, _ *kong.Path, flag *kong.Flag) (any, error) {
+	for _, env := range flag.Envs {
+		if _, ok := os.LookupEnv(env); ok {
+			return nil, nil //nolint:nilnil // nil value means unresolved.
+		}
+	}
+	return c[flag.Name], nil
+}
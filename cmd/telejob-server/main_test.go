@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/juliaogris/telejob/pkg/job"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+address: localhost:9443
+server-cert: server.crt
+server-key: server.key
+client-ca-cert: client-ca.crt
+cgroup: /sys/fs/cgroup/telejob-test
+cpu-limit: 0.5
+memory-limit: 2000
+io-limit:
+  - "252:1 rbps=1000000"
+  - "252:2 wbps=1000000"
+max-log-bytes: 4096
+`
+
+func TestConfigFile(t *testing.T) {
+	fname := writeConfig(t, testConfig)
+	t.Setenv("TELEJOB_SERVER_KEY", "env.key")
+
+	got := &app{}
+	parser := newTestParser(t, got)
+	_, err := parser.Parse([]string{"--config", fname, "--memory-limit", "3000"})
+	require.NoError(t, err)
+	want := &app{
+		Config:         kong.ConfigFlag(fname),
+		Address:        "localhost:9443",
+		ServerCert:     "server.crt",
+		ServerKey:      "env.key", // env > file
+		ClientCACert:   "client-ca.crt",
+		Cgroup:         "/sys/fs/cgroup/telejob-test",
+		HostLimitCheck: "off",
+		CPULimit:       0.5,
+		MemoryLimit:    3000, // flag > file
+		IOLimit:        []string{"252:1 rbps=1000000", "252:2 wbps=1000000"},
+		MaxLogBytes:    4096,
+	}
+	require.Equal(t, want, got)
+}
+
+func TestCommandWrapperFlag(t *testing.T) {
+	t.Parallel()
+	got := &app{}
+	parser := newTestParser(t, got)
+	required := []string{"--address", ":8443", "--server-cert", "s.crt", "--server-key", "s.key", "--client-ca-cert", "ca.crt"}
+	args := []string{"--command-wrapper", "nice", "--command-wrapper=-n", "--command-wrapper", "10", "--command-wrapper", "a b,c"}
+	_, err := parser.Parse(append(required, args...))
+	require.NoError(t, err)
+	require.Equal(t, []string{"nice", "-n", "10", "a b,c"}, got.CommandWrapper)
+}
+
+func TestAllowedGroups(t *testing.T) {
+	t.Parallel()
+	a := &app{RunAs: "1000:1000", Groups: []uint32{5, 6}, AllowedGroups: []uint32{5}}
+	opts, err := a.jobOptions()
+	require.NoError(t, err)
+	_, err = job.NewController(opts...)
+	require.ErrorIs(t, err, job.ErrCredential)
+	require.ErrorContains(t, err, "supplementary group 6 not allowed")
+}
+
+func TestConfigFileUnknownKey(t *testing.T) {
+	t.Parallel()
+	fname := writeConfig(t, testConfig+"memory-limt: 1000\n")
+	parser := newTestParser(t, &app{})
+	_, err := parser.Parse([]string{"--config", fname})
+	require.ErrorContains(t, err, "unknown config file keys: [memory-limt]")
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+	buf := &bytes.Buffer{}
+	a := &app{
+		Cgroup:      fmt.Sprintf("/sys/fs/cgroup/telejob-%d", rand.Uint64()), //nolint:gosec // G404: Use of weak random number generator
+		CPULimit:    0.5,
+		MemoryLimit: 2000,
+		Check:       true,
+		out:         buf,
+	}
+	require.NoError(t, a.Run())
+	require.Contains(t, buf.String(), "controllers: cpu io memory\n")
+	require.Contains(t, buf.String(), "check job: ok")
+	require.NoDirExists(t, a.Cgroup)
+}
+
+func TestReadSessionTicketKeys(t *testing.T) {
+	t.Parallel()
+	key1 := strings.Repeat("01", 32)
+	key2 := strings.Repeat("ff", 32)
+	fname := writeConfig(t, key1+"\n\n"+key2+"\n")
+	keys, err := readSessionTicketKeys(fname)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	require.Equal(t, byte(0x01), keys[0][31])
+	require.Equal(t, byte(0xff), keys[1][0])
+
+	for _, content := range []string{"", "0102\n", key1 + "00\n", strings.Repeat("zz", 32)} {
+		fname := writeConfig(t, content)
+		_, err := readSessionTicketKeys(fname)
+		require.Error(t, err, content)
+	}
+}
+
+func TestParseIOLimits(t *testing.T) {
+	t.Parallel()
+	fname := writeConfig(t, "# io.max lines\n252:1 rbps=1000000 wbps=max\n\n  252:2   riops=100 # slow disk\n")
+	got, err := parseIOLimits([]string{
+		"8:0 wiops=10",
+		"8:16 rbps=1, 8:32 wbps=2;8:48 rbps=3",
+		"@" + fname,
+	})
+	require.NoError(t, err)
+	want := []string{
+		"8:0 wiops=10",
+		"8:16 rbps=1", "8:32 wbps=2", "8:48 rbps=3",
+		"252:1 rbps=1000000 wbps=max", "252:2 riops=100",
+	}
+	require.Equal(t, want, got)
+
+	// Multiple entries in a single flag value are not split by the parser.
+	a := &app{}
+	_, err = newTestParser(t, a).Parse([]string{"--address", ":0", "--server-cert", "s.crt", "--server-key", "s.key", "--client-ca-cert", "ca.crt", "--io-limit", "8:0 rbps=1,8:16 wbps=2", "-i", "@" + fname})
+	require.NoError(t, err)
+	require.Equal(t, []string{"8:0 rbps=1,8:16 wbps=2", "@" + fname}, a.IOLimit)
+
+	for _, value := range []string{"8:0", "8 rbps=1", "a:0 rbps=1", "8:0 rbps", "8:0 rbps=-1", "8:0 bps=1", "8:0 rbps=1; 8:0", "@" + fname + ".missing"} {
+		_, err := parseIOLimits([]string{value})
+		require.Error(t, err, value)
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	fname := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(fname, []byte(content), 0o600))
+	return fname
+}
+
+func newTestParser(t *testing.T, a *app) *kong.Kong {
+	t.Helper()
+	opts := []kong.Option{
+		kong.Configuration(yamlConfig),
+		kong.Exit(func(int) { t.Fatalf("unexpected exit by arg parser") }),
+	}
+	parser, err := kong.New(a, opts...)
+	require.NoError(t, err)
+	return parser
+}
@@ -3,16 +3,37 @@
 // It communicates with a Telejob server over gRPC. The CLI supports the
 // following commands:
 //
-//   - start: starts a new job.
-//   - stop: stops a running job.
-//   - status: retrieves the status of a job.
+//   - start: starts a new job, or prints its effective limits with --explain.
+//   - stop: stops a running job, or all running jobs matching a label selector.
+//   - resume: resumes a job started with --paused.
+//   - status: retrieves the status of one or more jobs.
+//   - wait: waits for a job to terminate and prints its status.
+//   - stats: shows memory, CPU, I/O and process usage of a running job.
+//   - describe: shows the environment, limits and namespaces of a job, also once terminated.
+//   - list: lists jobs, or counts running jobs with --count, optionally filtered by labels.
 //   - logs: stream logs of a job.
+//   - attach: stream logs of a job started with --tty and send it standard input.
+//   - doctor: check connectivity and permissions end-to-end.
+//   - server-cert: print the server's certificate to debug mTLS trust problems.
+//   - cert-check: print the client certificate's validity, fail if it expires soon.
+//   - admin stop: stops a job of any owner, requires the operator role.
+//   - admin usage: shows the resource usage of all jobs, requires the operator role.
+//   - admin debug: shows internal server counters, requires the operator role.
+//   - admin watch: streams job starts and terminations of all owners, requires the operator role.
+//
+// Flags of the start command must precede the job's command: all arguments
+// after it, including flags such as -n, are passed to the job. A "--" before
+// the command is optional.
 //
 // Each command requires the address of the Telejob server and the client's
 // certificate and key for mTLS authentication. The server's CA certificate
 // can also be provided if it's not available as part of the system's trust
 // store.
 //
+// Before running commands that rely on RPCs added after the initial release,
+// such as list or admin watch, the CLI asks the server for its capabilities
+// and fails with "server too old for this command" if the RPC is missing.
+//
 // The CLI optionally uses environment variables to configure the server address
 // and certificate paths. The following environment variables are supported:
 //
@@ -20,47 +41,100 @@
 //   - TELEJOB_CLIENT_CERT: the path to the client's certificate file.
 //   - TELEJOB_CLIENT_KEY: the path to the client's key file.
 //   - TELEJOB_SERVER_CA_CERT: the path to the server's CA certificate file.
+//   - TELEJOB_CLIENT_INTERMEDIATES: comma-separated paths of intermediate CA
+//     certificate files presented with the client certificate.
+//   - TELEJOB_TIME_FORMAT: the layout of timestamps in status output.
+//   - TELEJOB_TIMEZONE: the IANA timezone of timestamps in status output,
+//     such as "UTC" or "Europe/Berlin". Defaults to the local timezone.
+//   - TELEJOB_CERT_WARN: warn on stderr before running a command if the client
+//     certificate expires within the given duration, such as "168h".
 //
 // Example usage after environment setup:
 //
 //		telejob start sleep 100
+//		telejob start --label env=ci grep -n foo file
+//		telejob start --argv0 worker /usr/bin/sleep 100
 //		telejob stop <job_id>
+//		telejob start --paused sleep 100
+//		telejob start --not-before 2026-01-02T15:04:05Z make nightly
+//		telejob start --discard-output make clean
+//		telejob start --explain sleep 100
+//		telejob start --tty python3 -i
+//		telejob start --mount /srv/data:/data:ro ls /data
+//		telejob attach <job_id>
+//		telejob resume <job_id>
+//		telejob stop --signal INT <job_id>
 //		telejob status <job_id>
+//		telejob status <job_id> <job_id> <job_id>
+//		telejob wait --max-poll-interval 30s <job_id>
+//		telejob stats <job_id>
+//		telejob describe <job_id>
+//		telejob list --running-only
+//		telejob list --count
+//		telejob list --selector env=ci
+//		telejob stop --selector env=ci
 //		telejob logs <job_id>
+//		telejob logs --reconnect 5 <job_id>
+//		telejob logs --squeeze-blank <job_id>
+//		telejob doctor
+//		telejob server-cert
+//		telejob cert-check --within 168h
+//		telejob admin stop <job_id>
 //	    telejob [COMMAND] --help
 package main
 
 import (
 	"cmp"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"math/rand/v2"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/juliaogris/telejob/pkg/job"
 	"github.com/juliaogris/telejob/pkg/pb"
 	"github.com/juliaogris/telejob/pkg/telejob"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 const description = "Telejob is a client CLI to run jobs remotely in a restricted environment."
 
 type app struct {
-	Start  startCmd  `cmd:"" help:"Start a new job."`
-	Stop   stopCmd   `cmd:"" help:"Stop the job with given ID."`
-	Status statusCmd `cmd:"" help:"Status the job with given ID."`
-	Logs   logsCmd   `cmd:"" help:"Print logs of the job with given ID. Continuously stream additional output."`
+	Start      startCmd      `cmd:"" help:"Start a new job."`
+	Stop       stopCmd       `cmd:"" help:"Stop the job with given ID."`
+	Resume     resumeCmd     `cmd:"" help:"Resume the job with given ID, started with --paused."`
+	Status     statusCmd     `cmd:"" help:"Status the jobs with given IDs."`
+	Wait       waitCmd       `cmd:"" help:"Wait for the job with given ID to terminate and print its status. Fail if it exited with a non-zero exit code."`
+	Stats      statsCmd      `cmd:"" help:"Show the resource usage of the running job with given ID."`
+	Describe   describeCmd   `cmd:"" help:"Show the environment, limits and namespaces of the job with given ID, also once terminated. Environment values are redacted without the operator role."`
+	List       listCmd       `cmd:"" help:"List jobs."`
+	Logs       logsCmd       `cmd:"" help:"Print logs of the job with given ID. Continuously stream additional output."`
+	Attach     attachCmd     `cmd:"" help:"Print logs of the job with given ID, started with --tty, and send standard input to its terminal. Only one attach session at a time may send input."`
+	Doctor     doctorCmd     `cmd:"" help:"Check connectivity and permissions by running a trivial job end-to-end."`
+	ServerCert serverCertCmd `cmd:"" help:"Print the server's certificate subject, SANs, issuer and expiry. Fail if it is not trusted."`
+	CertCheck  certCheckCmd  `cmd:"" help:"Print the client certificate's subject and validity. Fail if it is not valid or expires soon."`
+	Admin      adminCmd      `cmd:"" help:"Operator commands, require the operator role."`
 }
 
 func main() {
 	var writer io.Writer = os.Stdout
+	var errWriter stderrWriter = os.Stderr
 	opts := []kong.Option{
-		kong.Bind(&writer),
+		kong.Bind(&writer, &errWriter),
 		kong.Description(description),
 		kong.ConfigureHelp(kong.HelpOptions{Compact: true}),
 	}
@@ -70,43 +144,213 @@ func main() {
 
 type startCmd struct {
 	cmd
-	Command string   `arg:"" required:"" help:"Command."`
-	Args    []string `arg:"" optional:"" help:"Command arguments."`
+	Timeout       time.Duration     `help:"Stop the job after the given duration. Zero means no timeout."`
+	Label         map[string]string `short:"l" help:"Label of the job, ex.: \"env=ci\"."`
+	Unique        bool              `help:"Do not start the job if a running job has the same labels. Requires --label."`
+	Env           []string          `short:"e" help:"Additional environment variable of the job, ex.: \"KEY=VALUE\"."`
+	Stdin         bool              `help:"Send standard input to the job until EOF."`
+	Argv0         string            `help:"Process name passed to the command as argv[0], requires an absolute command path."`
+	Paused        bool              `help:"Start the job frozen, its command runs only once resumed with the resume command."`
+	NotBefore     time.Time         `help:"Schedule the job to run its command at the given RFC 3339 time, ex.: \"2026-01-02T15:04:05Z\". Stop cancels it until then."`
+	DiscardOutput bool              `help:"Discard the job's output without buffering it, for fire-and-forget jobs. Its logs cannot be read."`
+	Explain       bool              `help:"Print the limits the job would run with instead of starting it."`
+	Tty           bool              `help:"Run the job with a pseudo-terminal, for interactive commands. Use the attach command to send it input."`
+	Mount         []string          `help:"Bind mount of a host path allowed by the server into the job's mount namespace, as SOURCE:TARGET, or SOURCE:TARGET:ro for read-only, ex.: \"/srv/data:/data:ro\"."`
+	Command       []string          `arg:"" required:"" passthrough:"partial" help:"Command and its arguments. All arguments after the command are passed to the job, including flags, ex.: \"ls -la\"."`
 }
 
 type stopCmd struct {
+	cmd
+	Signal   string            `help:"Signal sent to the job's process: HUP, INT, KILL, QUIT or TERM. Defaults to KILL."`
+	Selector map[string]string `short:"s" help:"Stop all running jobs with the given label instead of a single job, ex.: \"env=ci\"."`
+	ID       string            `arg:"" optional:"" help:"Job ID, required without --selector."`
+}
+
+type resumeCmd struct {
 	cmd
 	ID string `arg:"" required:"" help:"Job ID."`
 }
 
 type statusCmd struct {
 	cmd
-	ID         string `arg:"" required:"" help:"Job ID, use 'list' to find IDs."`
+	timeFlags
+	IDs []string `arg:"" required:"" name:"id" help:"Job IDs, use 'list' to find IDs."`
+}
+
+type waitCmd struct {
+	cmd
+	timeFlags
+	PollInterval    time.Duration `help:"Initial interval between status polls, growing up to --max-poll-interval." default:"100ms"`
+	MaxPollInterval time.Duration `help:"Maximum interval between status polls, ex.: \"30s\" to reduce server load for long-running jobs." default:"5s"`
+	ID              string        `arg:"" required:"" help:"Job ID."`
+}
+
+type statsCmd struct {
+	cmd
+	ID string `arg:"" required:"" help:"Job ID."`
+}
+
+type describeCmd struct {
+	cmd
+	timeFlags
+	ID string `arg:"" required:"" help:"Job ID."`
+}
+
+type listCmd struct {
+	cmd
+	timeFlags
+	RunningOnly bool              `help:"Only list running jobs."`
+	Count       bool              `help:"Only print the number of running jobs. Exit with an error if there are none."`
+	Selector    map[string]string `short:"s" help:"Only list jobs with the given label, ex.: \"env=ci\"."`
+}
+
+// timeFlags are the flags of commands printing timestamps.
+type timeFlags struct {
 	TimeFormat string `short:"t" help:"Time format." default:"2006-01-02T15:04:05Z07:00" env:"TELEJOB_TIME_FORMAT"`
+	Timezone   string `help:"IANA timezone of timestamps, ex.: \"Europe/Berlin\". Defaults to local time." env:"TELEJOB_TIMEZONE"`
+	UTC        bool   `help:"Print timestamps in UTC, overrides --timezone."`
 }
 
+// errJobFailed is returned by `wait` if the job exited with a non-zero exit
+// code, so that scripts can check the result of a job by the exit code.
+var errJobFailed = errors.New("job failed")
+
+// errNoRunningJobs is returned by `list --count` if no job is running, so
+// that scripts can check for running jobs by the exit code.
+var errNoRunningJobs = errors.New("no running jobs")
+
 type logsCmd struct {
+	cmd
+	ID         string `arg:"" required:"" help:"Job ID."`
+	FromStart  bool   `help:"Fail if the beginning of the logs has been discarded by the server." xor:"history"`
+	FollowOnly bool   `help:"Only print logs written from now on, skip earlier output." xor:"history,out"`
+	Merge      bool   `help:"Write the job's stderr output to stdout."`
+	Out        string `help:"Write the job's stdout and stderr output to the given file, created with mode 0600 once the job has terminated and all logs have been received." type:"path" xor:"out"`
+	Flush      bool   `help:"Flush buffered output after each chunk of logs, ex.: for interactive pipelines."`
+	Output     string `help:"Output format: text or jsonl. jsonl writes one JSON object per chunk with stream, time and base64 data to stdout." enum:"text,jsonl" default:"text"`
+	Reconnect  int    `help:"Re-open the log stream after the last received byte up to the given number of consecutive times if it fails with a transient error, ex.: a network outage." xor:"squeeze"`
+	Squeeze    bool   `help:"Collapse runs of blank lines into a single blank line, ex.: for verbose tool output." name:"squeeze-blank" xor:"squeeze"`
+}
+
+type attachCmd struct {
+	cmd
+	ID string `arg:"" required:"" help:"Job ID."`
+}
+
+type doctorCmd struct {
+	cmd
+}
+
+type serverCertCmd struct {
+	cmd
+}
+
+// certCheckCmd only reads the client certificate and does not connect to the
+// server, so it does not embed cmd.
+type certCheckCmd struct {
+	ClientCert string        `required:"" help:"Client Certificate file." env:"TELEJOB_CLIENT_CERT"`
+	ClientKey  string        `required:"" help:"Client Private Key file." env:"TELEJOB_CLIENT_KEY"`
+	Within     time.Duration `default:"720h" help:"Fail if the client certificate expires within the given duration, ex.: \"168h\"."`
+
+	w io.Writer // can be overridden for testing
+}
+
+type adminCmd struct {
+	Stop  adminStopCmd  `cmd:"" help:"Stop the job with given ID regardless of its owner."`
+	Usage adminUsageCmd `cmd:"" help:"Show the resource usage of all running jobs."`
+	Debug adminDebugCmd `cmd:"" help:"Show internal server counters, requires the server's --debug flag."`
+	Watch adminWatchCmd `cmd:"" help:"Stream job starts and terminations of all owners, one line per event."`
+}
+
+type adminUsageCmd struct {
+	cmd
+}
+
+type adminDebugCmd struct {
+	cmd
+}
+
+type adminWatchCmd struct {
+	cmd
+}
+
+type adminStopCmd struct {
 	cmd
 	ID string `arg:"" required:"" help:"Job ID."`
 }
 
 type cmd struct {
-	Address      string `required:"" short:"A" help:"Server address." env:"TELEJOB_ADDRESS"`
-	ClientCert   string `required:"" help:"Client Certificate file." env:"TELEJOB_CLIENT_CERT"`
-	ClientKey    string `required:"" help:"Client Private Key file." env:"TELEJOB_CLIENT_KEY"`
-	ServerCACert string `help:"Server CA certificate file." env:"TELEJOB_SERVER_CA_CERT"`
+	Address            string        `required:"" short:"A" help:"Server address." env:"TELEJOB_ADDRESS"`
+	ClientCert         string        `required:"" help:"Client Certificate file." env:"TELEJOB_CLIENT_CERT"`
+	ClientKey          string        `required:"" help:"Client Private Key file." env:"TELEJOB_CLIENT_KEY"`
+	ServerCACert       string        `help:"Server CA certificate file." env:"TELEJOB_SERVER_CA_CERT"`
+	ClientIntermediate []string      `help:"Intermediate CA certificate file presented with the client certificate, in order from the client certificate towards the CA." env:"TELEJOB_CLIENT_INTERMEDIATES"`
+	Proxy              string        `help:"HTTP CONNECT proxy URL, ex.: \"http://proxy:3128\". Defaults to HTTPS_PROXY." env:"TELEJOB_PROXY"`
+	CertWarn           time.Duration `help:"Warn on stderr if the client certificate expires within the given duration, ex.: \"168h\". 0 disables the warning." env:"TELEJOB_CERT_WARN"`
 
 	client *telejob.Client
 	w      io.Writer // can be overridden for testing
+	errW   io.Writer // can be overridden for testing
 }
 
+// stderrWriter is the writer for the job's stderr output. It is a distinct type
+// so that it can be bound independently of stdout with [kong.Bind].
+type stderrWriter io.Writer
+
 // Run is called by [kong] when the CLI arguments contain the `start` command.
 func (c *startCmd) Run() error {
+	command, args, err := c.commandArgs()
+	if err != nil {
+		return err
+	}
+	if c.Unique && len(c.Label) == 0 {
+		return errors.New("--unique requires at least one --label")
+	}
+	mounts, err := parseMounts(c.Mount)
+	if err != nil {
+		return err
+	}
 	req := &pb.StartRequest{
-		Command:   c.Command,
-		Arguments: c.Args,
+		Command:     command,
+		Argv0:       c.Argv0,
+		StartPaused: c.Paused,
+		Arguments:   args,
+		Labels:      c.Label,
+		Unique:      c.Unique,
+		Env:         c.Env,
+
+		DiscardOutput: c.DiscardOutput,
+		Tty:           c.Tty,
+		Mounts:        mounts,
+	}
+	if !c.NotBefore.IsZero() {
+		req.NotBefore = timestamppb.New(c.NotBefore)
+	}
+	if c.Tty {
+		if err := c.requireRPC("WriteInput"); err != nil {
+			return err
+		}
+	}
+	if c.Explain {
+		return c.explain(req)
+	}
+	ctx := context.Background()
+	if c.Timeout > 0 {
+		// The deadline of the Start call becomes the job's maximum duration.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+		req.StopAtDeadline = true
+	}
+	var resp *pb.StartResponse
+	if c.Stdin {
+		if err := c.requireRPC("StartStream"); err != nil {
+			return err
+		}
+		resp, err = c.client.StartStdin(ctx, req, os.Stdin)
+	} else {
+		resp, err = c.client.Start(ctx, req)
 	}
-	resp, err := c.client.Start(context.Background(), req)
 	if err != nil {
 		return fmt.Errorf("failed to start job: %w", err)
 	}
@@ -117,56 +361,1009 @@ func (c *startCmd) Run() error {
 	return nil
 }
 
+// explain prints the effective limits the server would apply to a job
+// started with req, without starting it.
+func (c *startCmd) explain(req *pb.StartRequest) error {
+	if err := c.requireRPC("ExplainLimits"); err != nil {
+		return err
+	}
+	resp, err := c.client.ExplainLimits(context.Background(), req)
+	if err != nil {
+		return fmt.Errorf("failed to explain limits: %w", err)
+	}
+	return printLimits(c.w, resp)
+}
+
+// printLimits writes effective job limits to the provided writer in a
+// tabular format, one limit per line. Unset limits are printed as
+// "unlimited".
+func printLimits(w io.Writer, l *pb.ExplainLimitsResponse) error {
+	orUnlimited := func(v any, set bool) string {
+		if !set {
+			return "unlimited"
+		}
+		return fmt.Sprint(v)
+	}
+	rows := [][2]string{
+		{"cpus", orUnlimited(l.GetCpus(), l.GetCpus() > 0)},
+		{"memory-kib", orUnlimited(l.GetMemoryKib(), l.GetMemoryKib() > 0)},
+		{"memory-high-kib", orUnlimited(l.GetMemoryHighKib(), l.GetMemoryHighKib() > 0)},
+		{"memory-min-kib", orUnlimited(l.GetMemoryMinKib(), l.GetMemoryMinKib() > 0)},
+		{"oom-group", strconv.FormatBool(l.GetOomGroup())},
+		{"max-cpu-seconds", orUnlimited(l.GetMaxCpuSeconds(), l.GetMaxCpuSeconds() > 0)},
+		{"io", orUnlimited(strings.Join(l.GetIo(), "; "), len(l.GetIo()) > 0)},
+	}
+	for _, name := range slices.Sorted(maps.Keys(l.GetRlimits())) {
+		rows = append(rows, [2]string{"rlimit-" + name, strconv.FormatUint(l.GetRlimits()[name], 10)})
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "LIMIT\tVALUE"); err != nil {
+		return fmt.Errorf("cannot write limits header: %w", err)
+	}
+	for _, row := range rows {
+		if _, err := fmt.Fprintf(tw, "%s\t%s\n", row[0], row[1]); err != nil {
+			return fmt.Errorf("cannot write limits content: %w", err)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("cannot flush limits tab writer: %w", err)
+	}
+	return nil
+}
+
+// commandArgs returns the job's command and arguments. Flags of the start
+// command are only parsed before the command, everything after it belongs to
+// the job. An optional "--" before the command, which kong keeps for
+// passthrough arguments, is dropped.
+func (c *startCmd) commandArgs() (string, []string, error) {
+	argv := c.Command
+	if len(argv) > 0 && argv[0] == "--" {
+		argv = argv[1:]
+	}
+	if len(argv) == 0 {
+		return "", nil, errors.New("missing command")
+	}
+	return argv[0], argv[1:], nil
+}
+
+// parseMounts parses --mount flags of the form SOURCE:TARGET or
+// SOURCE:TARGET:ro.
+func parseMounts(flags []string) ([]*pb.Mount, error) {
+	var mounts []*pb.Mount
+	for _, flag := range flags {
+		source, rest, _ := strings.Cut(flag, ":")
+		target, mode, hasMode := strings.Cut(rest, ":")
+		if source == "" || target == "" || (hasMode && mode != "ro") {
+			return nil, fmt.Errorf("invalid --mount %q: expected SOURCE:TARGET or SOURCE:TARGET:ro", flag)
+		}
+		mounts = append(mounts, &pb.Mount{Source: source, Target: target, ReadOnly: hasMode})
+	}
+	return mounts, nil
+}
+
+// Run is called by [kong] when the CLI arguments contain the `resume` command.
+func (c *resumeCmd) Run() error {
+	if err := c.requireRPC("Resume"); err != nil {
+		return err
+	}
+	_, err := c.client.Resume(context.Background(), &pb.ResumeRequest{Id: c.ID})
+	if err != nil {
+		return fmt.Errorf("failed to resume job: %w", err)
+	}
+	return nil
+}
+
 // Run is called by [kong] when the CLI arguments contain the `stop` command.
 func (c *stopCmd) Run() error {
-	req := &pb.StopRequest{Id: c.ID}
-	_, err := c.client.Stop(context.Background(), req)
+	switch {
+	case len(c.Selector) > 0 && c.ID != "":
+		return errors.New("job ID and --selector are mutually exclusive")
+	case len(c.Selector) > 0:
+		return c.stopSelected()
+	case c.ID == "":
+		return errors.New("job ID or --selector required")
+	}
+	req := &pb.StopRequest{Id: c.ID, Signal: c.Signal}
+	resp, err := c.client.Stop(context.Background(), req)
 	if err != nil {
 		return fmt.Errorf("failed to stop job: %w", err)
 	}
+	return c.warnTerminated(c.ID, resp.GetAlreadyTerminated())
+}
+
+// warnTerminated writes a note to stderr if the stopped job with the given ID
+// had already terminated, as the stop had no effect then.
+func (c *cmd) warnTerminated(id string, alreadyTerminated bool) error {
+	if !alreadyTerminated {
+		return nil
+	}
+	if _, err := fmt.Fprintf(c.errW, "job %s had already terminated\n", id); err != nil {
+		return fmt.Errorf("cannot write stop note: %w", err)
+	}
+	return nil
+}
+
+// stopSelected stops all running jobs of the caller matching the selector
+// and prints the ID of each stopped job. Jobs of other owners are never
+// listed by the server and therefore never stopped. The labels and state of
+// listed jobs are checked again before stopping them, as servers predating
+// label selectors ignore the selector of list requests and list all jobs.
+// Jobs terminated since being listed are skipped. It continues with the
+// remaining jobs if a job cannot be stopped and returns all errors.
+func (c *stopCmd) stopSelected() error {
+	if err := c.requireRPC("List"); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	resp, err := c.client.List(ctx, &pb.ListRequest{RunningOnly: true, Labels: c.Selector})
+	if err != nil {
+		return fmt.Errorf("failed to list jobs: %w", err)
+	}
+	var errs []error
+	for _, js := range resp.GetJobs() {
+		if js.GetState() == pb.State_STATE_STOPPED || !matchSelector(js.GetLabels(), c.Selector) {
+			continue
+		}
+		stopResp, err := c.client.Stop(ctx, &pb.StopRequest{Id: js.GetId(), Signal: c.Signal})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop job %s: %w", js.GetId(), err))
+			continue
+		}
+		if stopResp.GetAlreadyTerminated() {
+			continue // terminated since listed.
+		}
+		if _, err := fmt.Fprintln(c.w, js.GetId()); err != nil {
+			return fmt.Errorf("cannot write stopped job ID: %w", err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// matchSelector reports whether labels contains all key-value pairs of the
+// selector.
+func matchSelector(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Run is called by [kong] when the CLI arguments contain the `admin stop`
+// command.
+func (c *adminStopCmd) Run() error {
+	if err := c.requireRPC("ForceStop"); err != nil {
+		return err
+	}
+	req := &pb.ForceStopRequest{Id: c.ID}
+	resp, err := c.client.ForceStop(context.Background(), req)
+	if err != nil {
+		return fmt.Errorf("failed to force stop job: %w", err)
+	}
+	return c.warnTerminated(c.ID, resp.GetAlreadyTerminated())
+}
+
+// Run is called by [kong] when the CLI arguments contain the `admin usage`
+// command.
+func (c *adminUsageCmd) Run() error {
+	if err := c.requireRPC("Usage"); err != nil {
+		return err
+	}
+	resp, err := c.client.Usage(context.Background(), &pb.UsageRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to get usage: %w", err)
+	}
+	return printUsage(c.w, resp)
+}
+
+// Run is called by [kong] when the CLI arguments contain the `admin debug`
+// command.
+func (c *adminDebugCmd) Run() error {
+	if err := c.requireRPC("Debug"); err != nil {
+		return err
+	}
+	resp, err := c.client.Debug(context.Background(), &pb.DebugRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to get debug counters: %w", err)
+	}
+	tw := tabwriter.NewWriter(c.w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "DISPATCHERS\tFOLLOWERS\tGOROUTINES"); err != nil {
+		return fmt.Errorf("cannot write debug header: %w", err)
+	}
+	if _, err := fmt.Fprintf(tw, "%d\t%d\t%d\n", resp.GetLogDispatchers(), resp.GetLogFollowers(), resp.GetGoroutines()); err != nil {
+		return fmt.Errorf("cannot write debug content: %w", err)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("cannot flush debug tab writer: %w", err)
+	}
+	return nil
+}
+
+// Run is called by [kong] when the CLI arguments contain the `admin watch`
+// command.
+//
+// It prints a line with owner, job ID, state and, for terminated jobs, exit
+// code per event until the stream ends.
+func (c *adminWatchCmd) Run() error {
+	if err := c.requireRPC("WatchAll"); err != nil {
+		return err
+	}
+	stream, err := c.client.WatchAll(context.Background(), &pb.WatchAllRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to watch jobs: %w", err)
+	}
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to receive job event: %w", err)
+		}
+		js := resp.GetJobStatus()
+		fields := []string{resp.GetOwner(), js.GetId(), stateString(js.GetState())}
+		if exitCode := exitCodeString(js.GetExitCode()); exitCode != "" {
+			fields = append(fields, exitCode)
+		}
+		if _, err := fmt.Fprintln(c.w, strings.Join(fields, " ")); err != nil {
+			return fmt.Errorf("cannot write job event: %w", err)
+		}
+		if err := flush(c.w); err != nil {
+			return fmt.Errorf("cannot flush job event: %w", err)
+		}
+	}
+}
+
+// printUsage writes the aggregate resource usage to the provided writer in a
+// tabular format.
+func printUsage(w io.Writer, u *pb.UsageResponse) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "JOBS\tMEMORY\tCPU"); err != nil {
+		return fmt.Errorf("cannot write usage header: %w", err)
+	}
+	cpu := u.GetCpu().AsDuration().Round(time.Millisecond)
+	if _, err := fmt.Fprintf(tw, "%d\t%d\t%v\n", u.GetRunningJobs(), u.GetMemoryBytes(), cpu); err != nil {
+		return fmt.Errorf("cannot write usage content: %w", err)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("cannot flush usage tab writer: %w", err)
+	}
 	return nil
 }
 
 // Run is called by [kong] when the CLI arguments contain the `status` command.
+//
+// The statuses of multiple jobs are queried in a single StatusBatch call and
+// printed in the order of the given IDs. Jobs that cannot be queried are
+// skipped and reported in the returned error.
 func (c *statusCmd) Run() error {
-	req := &pb.StatusRequest{Id: c.ID}
-	resp, err := c.client.Status(context.Background(), req)
+	loc, err := c.location()
+	if err != nil {
+		return err
+	}
+	if len(c.IDs) == 1 {
+		resp, err := c.client.Status(context.Background(), &pb.StatusRequest{Id: c.IDs[0]})
+		if err != nil {
+			return fmt.Errorf("failed to get job status: %w", err)
+		}
+		return printJobStatus(c.w, []*pb.JobStatus{resp.GetJobStatus()}, c.TimeFormat, loc)
+	}
+	if err := c.requireRPC("StatusBatch"); err != nil {
+		return err
+	}
+	resp, err := c.client.StatusBatch(context.Background(), &pb.StatusBatchRequest{Ids: c.IDs})
+	if err != nil {
+		return fmt.Errorf("failed to get job statuses: %w", err)
+	}
+	var statuses []*pb.JobStatus
+	var errs []error
+	for _, id := range c.IDs {
+		r, ok := resp.GetResults()[id]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("no status of job %q", id))
+		case r.GetErrorCode() != 0:
+			errs = append(errs, errors.New(r.GetError()))
+		default:
+			statuses = append(statuses, r.GetJobStatus())
+		}
+	}
+	if len(statuses) > 0 {
+		if err := printJobStatus(c.w, statuses, c.TimeFormat, loc); err != nil {
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to get status of %d of %d jobs: %w", len(errs), len(c.IDs), errors.Join(errs...))
+	}
+	return nil
+}
+
+// Run is called by [kong] when the CLI arguments contain the `wait` command.
+//
+// The server has no RPC to watch a single job, so wait polls the job's status
+// with a jittered, exponentially growing interval, see pollBackoff.
+func (c *waitCmd) Run() error {
+	if c.PollInterval <= 0 || c.MaxPollInterval < c.PollInterval {
+		return fmt.Errorf("invalid poll intervals %v and %v: need 0 < --poll-interval <= --max-poll-interval", c.PollInterval, c.MaxPollInterval)
+	}
+	loc, err := c.location()
+	if err != nil {
+		return err
+	}
+	backoff := newPollBackoff(c.PollInterval, c.MaxPollInterval)
+	for {
+		resp, err := c.client.Status(context.Background(), &pb.StatusRequest{Id: c.ID})
+		if err != nil {
+			return fmt.Errorf("failed to get job status: %w", err)
+		}
+		js := resp.GetJobStatus()
+		if state := js.GetState(); state != pb.State_STATE_RUNNING && state != pb.State_STATE_SCHEDULED {
+			if err := printJobStatus(c.w, []*pb.JobStatus{js}, c.TimeFormat, loc); err != nil {
+				return err
+			}
+			if js.GetExitCode() != 0 {
+				return fmt.Errorf("%w: job %q exited with code %d", errJobFailed, c.ID, js.GetExitCode())
+			}
+			return nil
+		}
+		time.Sleep(backoff.next())
+	}
+}
+
+// pollBackoff computes the intervals between polls of a job's status. They
+// start at the initial interval, so that short jobs are noticed quickly, and
+// double up to the maximum interval, to reduce the server load of waiting for
+// long-running jobs. Each interval is jittered to between half and all of its
+// nominal value, so that concurrent waiters do not poll in lockstep.
+type pollBackoff struct {
+	interval time.Duration
+	max      time.Duration
+}
+
+func newPollBackoff(initial, maxInterval time.Duration) *pollBackoff {
+	return &pollBackoff{interval: initial, max: maxInterval}
+}
+
+// next returns the jittered interval before the next poll and grows the
+// nominal interval for the poll after.
+func (b *pollBackoff) next() time.Duration {
+	d := b.interval/2 + rand.N(b.interval/2+1) //nolint:gosec // G404: jitter does not need a secure random source.
+	b.interval = min(2*b.interval, b.max)
+	return d
+}
+
+// Run is called by [kong] when the CLI arguments contain the `stats` command.
+func (c *statsCmd) Run() error {
+	if err := c.requireRPC("Stats"); err != nil {
+		return err
+	}
+	resp, err := c.client.Stats(context.Background(), &pb.StatsRequest{Id: c.ID})
+	if err != nil {
+		return fmt.Errorf("failed to get job stats: %w", err)
+	}
+	return printStats(c.w, resp)
+}
+
+// printStats writes the resource usage of a job to the provided writer in a
+// tabular format.
+func printStats(w io.Writer, s *pb.StatsResponse) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "MEMORY\tPEAK\tCPU\tREAD\tWRITTEN\tPIDS"); err != nil {
+		return fmt.Errorf("cannot write stats header: %w", err)
+	}
+	cpu := s.GetCpu().AsDuration().Round(time.Millisecond)
+	if _, err := fmt.Fprintf(tw, "%d\t%d\t%v\t%d\t%d\t%d\n", s.GetMemoryCurrentBytes(), s.GetMemoryPeakBytes(), cpu, s.GetIoReadBytes(), s.GetIoWriteBytes(), s.GetPidsCurrent()); err != nil {
+		return fmt.Errorf("cannot write stats content: %w", err)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("cannot flush stats tab writer: %w", err)
+	}
+	return nil
+}
+
+// Run is called by [kong] when the CLI arguments contain the `describe`
+// command.
+func (c *describeCmd) Run() error {
+	if err := c.requireRPC("Describe"); err != nil {
+		return err
+	}
+	resp, err := c.client.Describe(context.Background(), &pb.DescribeRequest{Id: c.ID})
+	if err != nil {
+		return fmt.Errorf("failed to describe job: %w", err)
+	}
+	loc, err := c.location()
+	if err != nil {
+		return err
+	}
+	if err := printJobStatus(c.w, []*pb.JobStatus{resp.GetJobStatus()}, c.TimeFormat, loc); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(c.w); err != nil {
+		return fmt.Errorf("cannot write description: %w", err)
+	}
+	if err := printLimits(c.w, resp.GetLimits()); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(c.w); err != nil {
+		return fmt.Errorf("cannot write description: %w", err)
+	}
+	return printDescription(c.w, resp)
+}
+
+// printDescription writes the environment and namespaces of a described job
+// to the provided writer in a tabular format, one variable per line. Redacted
+// values are printed as "<redacted>".
+func printDescription(w io.Writer, d *pb.DescribeResponse) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "ENV\tVALUE"); err != nil {
+		return fmt.Errorf("cannot write environment header: %w", err)
+	}
+	for _, e := range d.GetEnv() {
+		value := e.GetValue()
+		if d.GetEnvRedacted() {
+			value = "<redacted>"
+		}
+		if _, err := fmt.Fprintf(tw, "%s\t%s\n", e.GetKey(), value); err != nil {
+			return fmt.Errorf("cannot write environment content: %w", err)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("cannot flush environment tab writer: %w", err)
+	}
+	namespaces := cmp.Or(strings.Join(d.GetNamespaces(), ", "), "none")
+	if _, err := fmt.Fprintf(w, "\nnamespaces: %s\n", namespaces); err != nil {
+		return fmt.Errorf("cannot write namespaces: %w", err)
+	}
+	return nil
+}
+
+// Run is called by [kong] when the CLI arguments contain the `list` command.
+func (c *listCmd) Run() error {
+	if err := c.requireRPC("List"); err != nil {
+		return err
+	}
+	req := &pb.ListRequest{RunningOnly: c.RunningOnly || c.Count, Labels: c.Selector}
+	resp, err := c.client.List(context.Background(), req)
 	if err != nil {
-		return fmt.Errorf("failed to get job status: %w", err)
+		return fmt.Errorf("failed to list jobs: %w", err)
+	}
+	if c.Count {
+		count := len(resp.GetJobs())
+		if _, err := fmt.Fprintln(c.w, count); err != nil {
+			return fmt.Errorf("cannot write job count: %w", err)
+		}
+		if count == 0 {
+			return errNoRunningJobs
+		}
+		return nil
+	}
+	loc, err := c.location()
+	if err != nil {
+		return err
+	}
+	return printJobStatus(c.w, resp.GetJobs(), c.TimeFormat, loc)
+}
+
+// location returns the location timestamps are printed in.
+func (c *timeFlags) location() (*time.Location, error) {
+	switch {
+	case c.UTC:
+		return time.UTC, nil
+	case c.Timezone != "":
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+		}
+		return loc, nil
+	default:
+		return time.Local, nil //nolint:gosmopolitan // usage of time.Local in local client CLI makes timestamps more readable.
 	}
-	return printJobStatus(c.w, resp.GetJobStatus(), c.TimeFormat)
 }
 
 // Run is called by [kong] when the CLI arguments contain the `logs` command.
+//
+// Output the job wrote to stderr is written to stderr unless Merge is set, so
+// that shell redirection of stdout and stderr works as for local commands.
+// With Out, all output is exported to a file instead, see export.
 func (c *logsCmd) Run() error {
-	req := &pb.LogsRequest{Id: c.ID}
-	stream, err := c.client.Logs(context.Background(), req)
+	if c.Out != "" {
+		return c.export()
+	}
+	return c.copyLogs(c.w, c.errW)
+}
+
+// attachInputSize is the maximum size of the input chunks sent by attach.
+const attachInputSize = 4096
+
+// eot is the terminal's end of transmission character, Ctrl-D, which signals
+// end of file to a job reading its terminal in canonical mode.
+const eot = 0x04
+
+// Run is called by [kong] when the CLI arguments contain the `attach`
+// command. It attaches to the job with the Attach RPC, streams the job's logs
+// to stdout until the job has terminated and sends standard input to the
+// job's terminal, followed by eot at EOF. Input dropped by the server, for
+// example as another session sends input, is reported on stderr.
+//
+// The local terminal is not switched to raw mode, so input is sent line by
+// line and echoed both locally and by the job's terminal.
+func (c *attachCmd) Run() error {
+	if err := c.requireRPC("Attach"); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := c.client.Attach(ctx)
 	if err != nil {
-		return fmt.Errorf("cannot open job logs stream: %w", err)
+		return fmt.Errorf("cannot open attach stream: %w", err)
 	}
+	if err := stream.Send(&pb.AttachRequest{Id: c.ID}); err != nil {
+		return fmt.Errorf("cannot send attach request: %w", err)
+	}
+	go c.sendInput(stream, os.Stdin)
 	for {
 		resp, err := stream.Recv()
 		if errors.Is(err, io.EOF) {
-			return nil // stream closed,
+			return nil
 		}
 		if err != nil {
 			return fmt.Errorf("failed to get job logs from stream: %w", err)
 		}
+		if msg := resp.GetInputError(); msg != "" {
+			if _, err := fmt.Fprintf(c.errW, "input dropped: %s\n", msg); err != nil {
+				return fmt.Errorf("cannot write input error: %w", err)
+			}
+			continue
+		}
 		if _, err := c.w.Write(resp.GetChunk()); err != nil {
+			return fmt.Errorf("cannot write job logs: %w", err)
+		}
+	}
+}
+
+// sendInput sends r to the job's terminal over the attach stream in chunks,
+// followed by eot at EOF, and closes the sending side of the stream. Send
+// errors are reported by Run, as they end the stream.
+func (c *attachCmd) sendInput(stream pb.Telejob_AttachClient, r io.Reader) {
+	buf := make([]byte, attachInputSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&pb.AttachRequest{Data: buf[:n]}); err != nil {
+				return
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			if err := stream.Send(&pb.AttachRequest{Data: []byte{eot}}); err == nil {
+				_ = stream.CloseSend()
+			}
+			return
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(c.errW, "cannot read standard input: %v\n", err)
+			_ = stream.CloseSend()
+			return
+		}
+	}
+}
+
+// export writes the job's logs to the output file. The logs are written to a
+// temporary file in the output file's directory first, which is renamed to the
+// output file only once the log stream has ended successfully. A failing log
+// stream therefore never leaves a partial output file behind.
+func (c *logsCmd) export() (err error) { //nolint:nonamedreturns // deliberate cleanup of error
+	tmp, err := os.CreateTemp(filepath.Dir(c.Out), "."+filepath.Base(c.Out)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary log file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	cw := &countingWriter{w: tmp}
+	if err := c.copyLogs(cw, cw); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("cannot sync temporary log file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot close temporary log file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.Out); err != nil {
+		return fmt.Errorf("cannot rename temporary log file: %w", err)
+	}
+	if _, err := fmt.Fprintf(c.w, "%d bytes written to %s\n", cw.n, c.Out); err != nil {
+		return fmt.Errorf("cannot report written bytes: %w", err)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write implements io.Writer.
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err //nolint:wrapcheck // transparent writer.
+}
+
+// Reconnects of the logs command start with a backoff of reconnectBackoff,
+// doubling up to maxReconnectBackoff.
+const (
+	reconnectBackoff    = 100 * time.Millisecond
+	maxReconnectBackoff = 5 * time.Second
+)
+
+// copyLogs streams the job's logs to the given writers until the end of the
+// log stream. Output the job wrote to stderr is written to errW unless Merge
+// is set.
+//
+// If the log stream fails with a transient error, it is re-opened at the
+// offset after the last received chunk, so that no output is duplicated or
+// skipped, up to Reconnect consecutive times.
+func (c *logsCmd) copyLogs(w, errW io.Writer) error {
+	req := &pb.LogsRequest{Id: c.ID, FromStart: c.FromStart, FollowOnly: c.FollowOnly, SqueezeBlankLines: c.Squeeze}
+	backoff, failures := reconnectBackoff, 0
+	for {
+		received, err := c.copyStream(req, w, errW)
+		if err == nil {
+			return nil
+		}
+		if received {
+			backoff, failures = reconnectBackoff, 0
+		}
+		if failures >= c.Reconnect || !isTransient(err) {
+			return err
+		}
+		failures++
+		if _, err := fmt.Fprintf(c.errW, "%v, reconnecting (%d/%d)\n", err, failures, c.Reconnect); err != nil {
+			return fmt.Errorf("cannot report reconnect: %w", err)
+		}
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxReconnectBackoff)
+	}
+}
+
+// isTransient reports whether err is a gRPC error that may succeed on retry,
+// such as a dropped connection.
+func isTransient(err error) bool {
+	switch status.Code(err) { //nolint:exhaustive // all other codes are permanent.
+	case codes.Unavailable, codes.Aborted, codes.Internal:
+		return true
+	default:
+		return false
+	}
+}
+
+// copyStream opens a single log stream for req and copies it to the given
+// writers, see copyLogs. After each received chunk, req is updated to
+// continue after it. It reports whether any chunk has been received.
+func (c *logsCmd) copyStream(req *pb.LogsRequest, w, errW io.Writer) (bool, error) {
+	received := false
+	stream, err := c.client.Logs(context.Background(), req)
+	if err != nil {
+		return false, fmt.Errorf("cannot open job logs stream: %w", err)
+	}
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return received, nil // stream closed,
+		}
+		if err != nil {
+			return received, fmt.Errorf("failed to get job logs from stream: %w", err)
+		}
+		if resp.GetHeartbeat() {
+			continue
+		}
+		if err := c.writeChunk(resp, w, errW); err != nil {
+			return received, err
+		}
+		req.Offset = max(req.GetOffset(), resp.GetOffset()) + uint64(len(resp.GetChunk()))
+		req.FromStart, req.FollowOnly = false, false
+		received = true
+	}
+}
+
+// writeChunk writes the log chunk of resp to w, or to errW for stderr output
+// unless Merge is set.
+func (c *logsCmd) writeChunk(resp *pb.LogsResponse, w, errW io.Writer) error {
+	out := w
+	if c.Output == "jsonl" {
+		if err := writeLogRecord(out, resp, time.Now()); err != nil {
+			return err
+		}
+	} else {
+		if resp.GetStream() == pb.Stream_STREAM_STDERR && !c.Merge {
+			out = errW
+		}
+		if _, err := out.Write(resp.GetChunk()); err != nil {
 			return fmt.Errorf("failed to print logs: %w ", err)
 		}
 	}
+	if c.Flush {
+		if err := flush(out); err != nil {
+			return fmt.Errorf("failed to flush logs: %w", err)
+		}
+	}
+	return nil
+}
+
+// logRecord is a chunk of job output in the JSON Lines output of the logs
+// command. Data is base64 encoded by encoding/json, so that arbitrary output
+// cannot break the framing of one record per line. Time is the time the chunk
+// was received by the client.
+type logRecord struct {
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+	Data   []byte    `json:"data"`
+}
+
+// writeLogRecord writes the log chunk of resp as a JSON Lines record,
+// received at the given time.
+func writeLogRecord(w io.Writer, resp *pb.LogsResponse, received time.Time) error {
+	record := logRecord{Stream: streamName(resp.GetStream()), Time: received, Data: resp.GetChunk()}
+	if err := json.NewEncoder(w).Encode(record); err != nil {
+		return fmt.Errorf("failed to print log record: %w", err)
+	}
+	return nil
+}
+
+// streamName returns the lower case name of the output stream, ex.: "stdout",
+// or an empty string if the stream is unspecified.
+func streamName(s pb.Stream) string {
+	switch s {
+	case pb.Stream_STREAM_STDOUT:
+		return "stdout"
+	case pb.Stream_STREAM_STDERR:
+		return "stderr"
+	case pb.Stream_STREAM_UNSPECIFIED:
+		return ""
+	}
+	return ""
+}
+
+// flusher is implemented by buffered writers, such as [bufio.Writer].
+type flusher interface {
+	Flush() error
+}
+
+// flush flushes w if it is a buffered writer and does nothing otherwise.
+func flush(w io.Writer) error {
+	if f, ok := w.(flusher); ok {
+		return f.Flush() //nolint:wrapcheck // wrapped by caller.
+	}
+	return nil
+}
+
+// Run is called by [kong] when the CLI arguments contain the `doctor` command.
+//
+// It starts a long-running `sleep` job, retrieves its status, stops it and
+// streams its logs to the end, reporting the result and duration of each step.
+// It stops at the first failed step as later steps depend on earlier ones.
+// The stop step fails if the job terminated before it could be stopped.
+func (c *doctorCmd) Run() error {
+	ctx := context.Background()
+	var id string
+	checks := []struct {
+		name string
+		fn   func() error
+	}{
+		{"start", func() error {
+			resp, err := c.client.Start(ctx, &pb.StartRequest{Command: "sleep", Arguments: []string{"60"}})
+			id = resp.GetId()
+			return err //nolint:wrapcheck // wrapped when reported.
+		}},
+		{"status", func() error {
+			_, err := c.client.Status(ctx, &pb.StatusRequest{Id: id})
+			return err //nolint:wrapcheck // wrapped when reported.
+		}},
+		{"stop", func() error {
+			resp, err := c.client.Stop(ctx, &pb.StopRequest{Id: id})
+			if err != nil {
+				return err //nolint:wrapcheck // wrapped when reported.
+			}
+			if resp.GetAlreadyTerminated() {
+				return errors.New("job terminated before it was stopped")
+			}
+			return nil
+		}},
+		{"logs", func() error {
+			stream, err := c.client.Logs(ctx, &pb.LogsRequest{Id: id})
+			if err != nil {
+				return err //nolint:wrapcheck // wrapped when reported.
+			}
+			for {
+				if _, err := stream.Recv(); err != nil {
+					if errors.Is(err, io.EOF) {
+						return nil
+					}
+					return err //nolint:wrapcheck // wrapped when reported.
+				}
+			}
+		}},
+	}
+	tw := tabwriter.NewWriter(c.w, 0, 0, 2, ' ', 0)
+	for _, check := range checks {
+		start := time.Now()
+		checkErr := check.fn()
+		dur := time.Since(start).Round(time.Microsecond)
+		result := "PASS"
+		if checkErr != nil {
+			result = "FAIL"
+		}
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%v\n", result, check.name, dur); err != nil {
+			return fmt.Errorf("cannot write doctor result: %w", err)
+		}
+		if checkErr != nil {
+			if err := tw.Flush(); err != nil {
+				return fmt.Errorf("cannot flush doctor tab writer: %w", err)
+			}
+			return fmt.Errorf("doctor check %q failed: %w", check.name, checkErr)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("cannot flush doctor tab writer: %w", err)
+	}
+	return nil
+}
+
+// Run is called by [kong] when the CLI arguments contain the `server-cert`
+// command.
+//
+// It prints the server's leaf certificate, also if it is not trusted, and
+// then fails with the verification error, if any.
+func (c *serverCertCmd) Run() error {
+	opts := []telejob.ClientOption{telejob.WithClientIntermediates(c.ClientIntermediate...)}
+	if c.Proxy != "" {
+		opts = append(opts, telejob.WithProxy(c.Proxy))
+	}
+	sc, err := telejob.ProbeServerCertificate(context.Background(), c.Address, c.ClientCert, c.ClientKey, c.ServerCACert, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to get server certificate: %w", err)
+	}
+	leaf := sc.Chain[0]
+	ips := make([]string, len(leaf.IPAddresses))
+	for i, ip := range leaf.IPAddresses {
+		ips[i] = ip.String()
+	}
+	trusted := "yes"
+	if sc.VerifyErr != nil {
+		trusted = "no"
+	}
+	tw := tabwriter.NewWriter(c.w, 0, 0, 2, ' ', 0)
+	rows := [][2]string{
+		{"Subject", leaf.Subject.String()},
+		{"DNS SANs", strings.Join(leaf.DNSNames, ", ")},
+		{"IP SANs", strings.Join(ips, ", ")},
+		{"Issuer", leaf.Issuer.String()},
+		{"Not before", leaf.NotBefore.UTC().Format(time.RFC3339)},
+		{"Not after", leaf.NotAfter.UTC().Format(time.RFC3339)},
+		{"Trusted", trusted},
+	}
+	for _, row := range rows {
+		if _, err := fmt.Fprintf(tw, "%s:\t%s\n", row[0], row[1]); err != nil {
+			return fmt.Errorf("cannot write server certificate: %w", err)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("cannot flush server certificate tab writer: %w", err)
+	}
+	if sc.VerifyErr != nil {
+		return fmt.Errorf("server certificate is not trusted: %w", sc.VerifyErr)
+	}
+	return nil
+}
+
+// Run is called by [kong] when the CLI arguments contain the `cert-check`
+// command.
+//
+// It prints the client certificate's subject and validity period and fails if
+// the certificate is not valid yet, has expired or expires within the
+// configured duration, so that users can renew it before mTLS handshakes
+// fail.
+func (c *certCheckCmd) Run() error {
+	cert, err := loadClientCert(c.ClientCert, c.ClientKey)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(c.w, 0, 0, 2, ' ', 0)
+	rows := [][2]string{
+		{"Subject", cert.Subject.String()},
+		{"Issuer", cert.Issuer.String()},
+		{"Not before", cert.NotBefore.UTC().Format(time.RFC3339)},
+		{"Not after", cert.NotAfter.UTC().Format(time.RFC3339)},
+	}
+	for _, row := range rows {
+		if _, err := fmt.Fprintf(tw, "%s:\t%s\n", row[0], row[1]); err != nil {
+			return fmt.Errorf("cannot write client certificate: %w", err)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("cannot flush client certificate tab writer: %w", err)
+	}
+	return checkCertExpiry(cert, time.Now(), c.Within)
+}
+
+// loadClientCert loads the client certificate and verifies that it matches
+// the client key.
+func loadClientCert(certFile, keyFile string) (*x509.Certificate, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load client certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse client certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// checkCertExpiry returns an error if the client certificate is not valid at
+// now or expires within the given duration after now.
+func checkCertExpiry(cert *x509.Certificate, now time.Time, within time.Duration) error {
+	notBefore, notAfter := cert.NotBefore.UTC().Format(time.RFC3339), cert.NotAfter.UTC().Format(time.RFC3339)
+	switch {
+	case now.Before(cert.NotBefore):
+		return fmt.Errorf("client certificate not valid before %s", notBefore)
+	case now.After(cert.NotAfter):
+		return fmt.Errorf("client certificate expired at %s", notAfter)
+	case cert.NotAfter.Sub(now) < within:
+		return fmt.Errorf("client certificate expires at %s, within %v", notAfter, within)
+	}
+	return nil
+}
+
+// warnCertExpiry writes a warning to stderr if the client certificate is not
+// valid or expires within CertWarn. Certificates that cannot be loaded are
+// reported when the client is created.
+func (c *cmd) warnCertExpiry() {
+	cert, err := loadClientCert(c.ClientCert, c.ClientKey)
+	if err != nil {
+		return
+	}
+	if err := checkCertExpiry(cert, time.Now(), c.CertWarn); err != nil {
+		_, _ = fmt.Fprintf(c.errW, "warning: %v\n", err)
+	}
+}
+
+// AfterApply is called by [kong] immediately after flag validation and
+// assignment and _before_ the `cert-check` command's Run method. It sets up
+// the output writer, see cmd.AfterApply.
+func (c *certCheckCmd) AfterApply(w *io.Writer) error {
+	c.w = cmp.Or(*w, io.Writer(os.Stdout))
+	return nil
 }
 
 // AfterApply is called by [kong] immediately after flag validation and
 // assignment and _before_ a command's Run method. It is useful for setting up
 // common resources like gRPC connections.
 //
-// The pointer to the io.Writer is required to keep the io.Writer type when
+// The pointers to the writers are required to keep the interface types when
 // passing through an `any` parameter on the [kong.Bind] function.
-func (c *cmd) AfterApply(w *io.Writer) error {
+func (c *cmd) AfterApply(w *io.Writer, errW *stderrWriter) error {
 	c.w = cmp.Or(*w, io.Writer(os.Stdout))
-	client, err := telejob.NewClient(c.Address, c.ClientCert, c.ClientKey, c.ServerCACert)
+	c.errW = cmp.Or(io.Writer(*errW), io.Writer(os.Stderr))
+	if c.CertWarn > 0 {
+		c.warnCertExpiry()
+	}
+	// Reconnects, such as of `logs --reconnect`, resume the TLS session.
+	opts := []telejob.ClientOption{
+		telejob.WithSessionCache(tls.NewLRUClientSessionCache(0)),
+		telejob.WithClientIntermediates(c.ClientIntermediate...),
+	}
+	if c.Proxy != "" {
+		opts = append(opts, telejob.WithProxy(c.Proxy))
+	}
+	client, err := telejob.NewClient(c.Address, c.ClientCert, c.ClientKey, c.ServerCACert, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
@@ -174,6 +1371,19 @@ func (c *cmd) AfterApply(w *io.Writer) error {
 	return nil
 }
 
+// requireRPC returns an error if the server does not support the RPC with
+// the given name, for commands added after the initial Start, Stop, Status and
+// Logs RPCs, so that older servers fail with a clear message.
+func (c *cmd) requireRPC(rpc string) error {
+	if err := c.client.RequireRPC(context.Background(), rpc); err != nil {
+		if errors.Is(err, telejob.ErrUnsupported) {
+			return fmt.Errorf("server too old for this command: %w", err)
+		}
+		return fmt.Errorf("failed to check server capabilities: %w", err)
+	}
+	return nil
+}
+
 // AfterRun is called by [kong] immediately after a command's Run method
 // completes. It is useful for cleaning up common resources like gRPC
 // connections.
@@ -184,23 +1394,33 @@ func (c *cmd) AfterRun() error {
 	return nil
 }
 
-// printJobStatus writes the job status to the provided writer in a tabular
-// format.
-func printJobStatus(w io.Writer, j *pb.JobStatus, layout string) error {
+// printJobStatus writes the job statuses to the provided writer in a tabular
+// format, one row per job, with timestamps in the given location.
+func printJobStatus(w io.Writer, jobs []*pb.JobStatus, layout string, loc *time.Location) error {
 	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
-	_, err := fmt.Fprintln(tw, "ID\tCOMMAND\tSTATE\tSTARTED\tSTOPPED\tEXIT")
+	_, err := fmt.Fprintln(tw, "ID\tCOMMAND\tSTATE\tSTARTED\tSTOPPED\tEXIT\tPROCS")
 	if err != nil {
 		return fmt.Errorf("cannot write job status header: %w", err)
 	}
-	state := stateString(j.GetState())
-	started := pbTimeString(j.GetStarted(), layout)
-	stopped := pbTimeString(j.GetStopped(), layout)
-	cs := append([]string{j.GetCommand()}, j.GetArguments()...)
-	command := strings.Join(cs, " ") // Consider proper shell quoting, not trivial.
-	exitCode := exitCodeString(j.GetExitCode())
-	_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", j.GetId(), command, state, started, stopped, exitCode)
-	if err != nil {
-		return fmt.Errorf("cannot write job status content: %w", err)
+	for _, j := range jobs {
+		state := stateString(j.GetState())
+		started := pbTimeString(j.GetStarted(), layout, loc)
+		stopped := pbTimeString(j.GetStopped(), layout, loc)
+		// Older servers do not send the command line.
+		command := cmp.Or(j.GetCommandLine(), telejob.CommandLine(j.GetCommand(), j.GetArguments()))
+		exitCode := exitCodeString(j.GetExitCode())
+		switch j.GetTerminationReason() {
+		case pb.TerminationReason_TERMINATION_REASON_CPU_LIMIT:
+			exitCode += " (cpu limit)"
+		case pb.TerminationReason_TERMINATION_REASON_TIMEOUT:
+			exitCode += " (timeout)"
+		case pb.TerminationReason_TERMINATION_REASON_UNSPECIFIED:
+		}
+		procs := strconv.FormatInt(j.GetProcessCount(), 10)
+		_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", j.GetId(), command, state, started, stopped, exitCode, procs)
+		if err != nil {
+			return fmt.Errorf("cannot write job status content: %w", err)
+		}
 	}
 	if err := tw.Flush(); err != nil {
 		return fmt.Errorf("cannot flush job status tab writer: %w", err)
@@ -215,6 +1435,8 @@ func stateString(s pb.State) string {
 		return "running"
 	case pb.State_STATE_STOPPED:
 		return "stopped"
+	case pb.State_STATE_SCHEDULED:
+		return "scheduled"
 	case pb.State_STATE_UNSPECIFIED:
 		return "State_STATE_UNSPECIFIED"
 	default:
@@ -222,14 +1444,14 @@ func stateString(s pb.State) string {
 	}
 }
 
-// pbTimeString converts a [timestamppb.Timestamp] to a string formatted
-// according to the provided layout. If the timestamp is zero, it returns an
-// empty string.
-func pbTimeString(t *timestamppb.Timestamp, layout string) string {
+// pbTimeString converts a [timestamppb.Timestamp] to a string in the given
+// location formatted according to the provided layout. If the timestamp is
+// zero, it returns an empty string.
+func pbTimeString(t *timestamppb.Timestamp, layout string, loc *time.Location) string {
 	if t.GetSeconds() == 0 && t.GetNanos() == 0 {
 		return ""
 	}
-	return t.AsTime().Local().Format(layout) //nolint:gosmopolitan // usage of time.Local in local client CLI makes timestamps more readable.
+	return t.AsTime().In(loc).Format(layout)
 }
 
 // exitCodeString converts an exit code to a string. It handles special cases
@@ -3,13 +3,22 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"flag"
 	"fmt"
 	"io"
+	"math/big"
 	"math/rand/v2"
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -21,6 +30,10 @@ import (
 	"github.com/juliaogris/telejob/pkg/pb"
 	"github.com/juliaogris/telejob/pkg/telejob"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 //nolint:gochecknoglobals
@@ -59,19 +72,171 @@ func TestMainSimple(t *testing.T) {
 	require.Len(t, lines, 3)
 
 	// sample output
-	// ID  COMMAND    STATE    STARTED   STOPPED  EXIT
-	// 2   sleep 100  running  19:11:28
+	// ID  COMMAND    STATE    STARTED   STOPPED  EXIT  PROCS
+	// 2   sleep 100  running  19:11:28                 1
 	//
 	// these test cases are fragile, let's keep them to a minimum
-	require.Equal(t, "ID  COMMAND    STATE    STARTED   STOPPED  EXIT", lines[0])
-	require.Regexp(t, `^2   sleep 100  running\s* \d\d:\d\d:\d\d\s*$`, lines[1])
+	require.Equal(t, "ID  COMMAND    STATE    STARTED   STOPPED  EXIT  PROCS", lines[0])
+	require.Regexp(t, `^2   sleep 100  running\s* \d\d:\d\d:\d\d\s+1$`, lines[1])
 	require.Equal(t, "", lines[2])
 
+	out, err = run(t, []string{"status", "1", id, "bogus"})
+	require.ErrorContains(t, err, `failed to get status of 1 of 3 jobs: job "bogus" not found`)
+	lines = strings.Split(out, "\n")
+	require.Len(t, lines, 4)
+	require.True(t, strings.HasPrefix(lines[1], "1 "))
+	require.True(t, strings.HasPrefix(lines[2], "2 "))
+
+	out, err = run(t, []string{"stats", id})
+	require.NoError(t, err)
+	lines = strings.Split(out, "\n")
+	require.Len(t, lines, 3)
+	require.Regexp(t, `^MEMORY\s+PEAK\s+CPU\s+READ\s+WRITTEN\s+PIDS$`, lines[0])
+	require.Regexp(t, `\s1$`, lines[1])
+
 	out, err = run(t, []string{"stop", id})
 	require.NoError(t, err)
 	require.Equal(t, "", out)
 }
 
+func TestMainWait(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Stop()
+	t.Setenv("TELEJOB_ADDRESS", ts.address)
+	t.Setenv("TELEJOB_CLIENT_CERT", "testdata/client1.crt")
+	t.Setenv("TELEJOB_CLIENT_KEY", "testdata/client1.key")
+	t.Setenv("TELEJOB_SERVER_CA_CERT", "testdata/server-ca.crt")
+
+	out, err := run(t, []string{"start", "sleep", "0.2"})
+	require.NoError(t, err)
+	id := strings.TrimSpace(out)
+	out, err = run(t, []string{"wait", "--poll-interval", "10ms", id})
+	require.NoError(t, err)
+	require.Regexp(t, `(?m)^\d+\s+sleep 0.2\s+stopped\s`, out)
+
+	out, err = run(t, []string{"start", "sh", "-c", "exit 3"})
+	require.NoError(t, err)
+	_, err = run(t, []string{"wait", strings.TrimSpace(out)})
+	require.ErrorIs(t, err, errJobFailed)
+
+	_, err = run(t, []string{"wait", "--poll-interval", "2s", "--max-poll-interval", "1s", id})
+	require.ErrorContains(t, err, "invalid poll intervals")
+}
+
+func TestPollBackoff(t *testing.T) {
+	t.Parallel()
+	const initial, maxInterval = 10 * time.Millisecond, time.Second
+	b := newPollBackoff(initial, maxInterval)
+	var prev, prevNominal time.Duration
+	for i := range 20 {
+		d := b.next()
+		nominal := min(initial<<i, maxInterval)
+		require.GreaterOrEqual(t, d, nominal/2)
+		require.LessOrEqual(t, d, nominal)
+		if nominal == 2*prevNominal {
+			// Jittered intervals grow while the nominal interval doubles.
+			require.GreaterOrEqual(t, d, prev, "interval shrank at poll %d", i)
+		}
+		prev, prevNominal = d, nominal
+	}
+	require.Equal(t, maxInterval, prevNominal)
+}
+
+func TestMainListCount(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Stop()
+	t.Setenv("TELEJOB_ADDRESS", ts.address)
+	t.Setenv("TELEJOB_CLIENT_CERT", "testdata/client1.crt")
+	t.Setenv("TELEJOB_CLIENT_KEY", "testdata/client1.key")
+	t.Setenv("TELEJOB_SERVER_CA_CERT", "testdata/server-ca.crt")
+
+	_, err := run(t, []string{"list", "--count"})
+	require.ErrorIs(t, err, errNoRunningJobs)
+
+	var ids []string
+	for range 2 {
+		out, err := run(t, []string{"start", "sleep", "100"})
+		require.NoError(t, err)
+		ids = append(ids, strings.TrimSpace(out))
+	}
+	out, err := run(t, []string{"start", "true"})
+	require.NoError(t, err)
+	_, err = run(t, []string{"logs", strings.TrimSpace(out)}) // wait for termination
+	require.NoError(t, err)
+
+	out, err = run(t, []string{"list", "--count"})
+	require.NoError(t, err)
+	require.Equal(t, "2\n", out)
+
+	out, err = run(t, []string{"list"})
+	require.NoError(t, err)
+	require.Len(t, strings.Split(out, "\n"), 5) // header, 3 jobs, trailing newline
+	out, err = run(t, []string{"list", "--running-only"})
+	require.NoError(t, err)
+	require.Len(t, strings.Split(out, "\n"), 4)
+
+	_, err = run(t, []string{"stop", ids[0]})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		out, err := run(t, []string{"list", "--count"})
+		return err == nil && out == "1\n"
+	}, 2*time.Second, 50*time.Millisecond)
+}
+
+func TestMainStopSelector(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Stop()
+	t.Setenv("TELEJOB_ADDRESS", ts.address)
+	t.Setenv("TELEJOB_CLIENT_CERT", "testdata/client1.crt")
+	t.Setenv("TELEJOB_CLIENT_KEY", "testdata/client1.key")
+	t.Setenv("TELEJOB_SERVER_CA_CERT", "testdata/server-ca.crt")
+
+	_, err := run(t, []string{"stop", "--selector", "env=ci", "1"})
+	require.ErrorContains(t, err, "mutually exclusive")
+	_, err = run(t, []string{"stop"})
+	require.ErrorContains(t, err, "job ID or --selector required")
+
+	var ciIDs []string
+	for range 2 {
+		out, err := run(t, []string{"start", "--label", "env=ci", "sleep", "100"})
+		require.NoError(t, err)
+		ciIDs = append(ciIDs, strings.TrimSpace(out))
+	}
+	out, err := run(t, []string{"start", "--label", "env=dev", "sleep", "100"})
+	require.NoError(t, err)
+	devID := strings.TrimSpace(out)
+
+	out, err = run(t, []string{"list", "--selector", "env=ci"})
+	require.NoError(t, err)
+	require.Len(t, strings.Split(out, "\n"), 4) // header, 2 jobs, trailing newline
+
+	out, err = run(t, []string{"stop", "--selector", "env=ci"})
+	require.NoError(t, err)
+	require.Equal(t, strings.Join(ciIDs, "\n")+"\n", out)
+	require.Eventually(t, func() bool {
+		out, err := run(t, []string{"list", "--count"})
+		return err == nil && out == "1\n"
+	}, 2*time.Second, 50*time.Millisecond)
+	out, err = run(t, []string{"status", devID})
+	require.NoError(t, err)
+	require.Contains(t, out, "running")
+
+	// Nothing left to stop.
+	out, err = run(t, []string{"stop", "--selector", "env=ci"})
+	require.NoError(t, err)
+	require.Empty(t, out)
+}
+
+func TestMatchSelector(t *testing.T) {
+	t.Parallel()
+	labels := map[string]string{"env": "ci", "team": "infra"}
+	require.True(t, matchSelector(labels, map[string]string{"env": "ci"}))
+	require.True(t, matchSelector(labels, labels))
+	require.False(t, matchSelector(labels, map[string]string{"env": "dev"}))
+	require.False(t, matchSelector(labels, map[string]string{"owner": "ci"}))
+	require.False(t, matchSelector(nil, map[string]string{"env": "ci"}))
+}
+
 func TestMainLogs(t *testing.T) {
 	ts := newTestServer(t)
 	defer ts.Stop()
@@ -87,6 +252,213 @@ func TestMainLogs(t *testing.T) {
 	require.Equal(t, "hello\n", out)
 }
 
+func TestStartCommandArgs(t *testing.T) {
+	t.Setenv("TELEJOB_ADDRESS", "localhost:8443")
+	t.Setenv("TELEJOB_CLIENT_CERT", "testdata/client1.crt")
+	t.Setenv("TELEJOB_CLIENT_KEY", "testdata/client1.key")
+	tests := map[string]struct {
+		args        []string
+		wantCommand string
+		wantArgs    []string
+		wantLabel   map[string]string
+	}{
+		"flags of job":           {args: []string{"grep", "-n", "foo", "file"}, wantCommand: "grep", wantArgs: []string{"-n", "foo", "file"}},
+		"separator":              {args: []string{"--", "tail", "-f", "file"}, wantCommand: "tail", wantArgs: []string{"-f", "file"}},
+		"start flags before":     {args: []string{"--label", "env=ci", "ls", "-la"}, wantCommand: "ls", wantArgs: []string{"-la"}, wantLabel: map[string]string{"env": "ci"}},
+		"start flag names after": {args: []string{"sleep", "--timeout", "1s"}, wantCommand: "sleep", wantArgs: []string{"--timeout", "1s"}},
+		"separator after":        {args: []string{"git", "log", "--", "main.go"}, wantCommand: "git", wantArgs: []string{"log", "--", "main.go"}},
+		"no arguments":           {args: []string{"true"}, wantCommand: "true", wantArgs: []string{}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			kctx, err := setupRun(t, append([]string{"start"}, tc.args...), io.Discard, io.Discard)
+			require.NoError(t, err)
+			start := kctx.Selected().Target.Addr().Interface().(*startCmd) //nolint:forcetypeassert // selected by "start".
+			command, args, err := start.commandArgs()
+			require.NoError(t, err)
+			require.Equal(t, tc.wantCommand, command)
+			require.Equal(t, tc.wantArgs, args)
+			require.Equal(t, tc.wantLabel, start.Label)
+		})
+	}
+
+	_, err := run(t, []string{"start", "--"})
+	require.ErrorContains(t, err, "missing command")
+	_, err = run(t, []string{"start", "--unique", "true"})
+	require.ErrorContains(t, err, "--unique requires at least one --label")
+}
+
+func TestParseMounts(t *testing.T) {
+	t.Parallel()
+	mounts, err := parseMounts([]string{"/srv/data:/data", "/etc/ssl:/ssl:ro"})
+	require.NoError(t, err)
+	require.Len(t, mounts, 2)
+	require.Equal(t, "/srv/data", mounts[0].GetSource())
+	require.Equal(t, "/data", mounts[0].GetTarget())
+	require.False(t, mounts[0].GetReadOnly())
+	require.True(t, mounts[1].GetReadOnly())
+
+	for _, flag := range []string{"/data", ":/data", "/data:", "/a:/b:rw", "/a:/b:ro:x"} {
+		_, err := parseMounts([]string{flag})
+		require.ErrorContains(t, err, "invalid --mount", flag)
+	}
+}
+
+func TestRequireRPC(t *testing.T) {
+	// A server reporting List as unsupported.
+	fake := &fakeTelejobClient{rpcs: []string{"Capabilities", "Start", "Stop", "Status", "Logs"}}
+	c := cmd{client: &telejob.Client{TelejobClient: fake}, w: io.Discard, errW: io.Discard}
+	err := (&listCmd{cmd: c}).Run()
+	require.ErrorIs(t, err, telejob.ErrUnsupported)
+	require.ErrorContains(t, err, "server too old for this command")
+
+	// The RPCs of a server predating the Capabilities RPC are unknown, its
+	// unsupported RPCs fail when called.
+	fake.rpcs = nil
+	require.NoError(t, c.requireRPC("List"))
+}
+
+func TestLogsReconnect(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "connection reset")
+	// The log "hello world!" is streamed by three streams, two of which
+	// drop mid-stream.
+	streams := []*fakeLogsClient{
+		{resps: []*pb.LogsResponse{{Chunk: []byte("hello "), Offset: 0}, {Heartbeat: true}}, err: unavailable},
+		{resps: []*pb.LogsResponse{{Chunk: []byte("world"), Offset: 6, Stream: pb.Stream_STREAM_STDERR}}, err: unavailable},
+		{resps: []*pb.LogsResponse{{Chunk: []byte("!"), Offset: 11}}, err: io.EOF},
+	}
+	var offsets []uint64
+	fake := &fakeTelejobClient{logs: func(req *pb.LogsRequest) (pb.Telejob_LogsClient, error) {
+		offsets = append(offsets, req.GetOffset())
+		stream := streams[0]
+		streams = streams[1:]
+		return stream, nil
+	}}
+	var stdout, stderr strings.Builder
+	c := cmd{client: &telejob.Client{TelejobClient: fake}, w: &stdout, errW: &stderr}
+	err := (&logsCmd{cmd: c, ID: "1", Merge: true, Reconnect: 1}).copyLogs(&stdout, &stdout)
+	require.NoError(t, err)
+	require.Equal(t, "hello world!", stdout.String())
+	require.Equal(t, []uint64{0, 6, 11}, offsets)
+	require.Equal(t, 2, strings.Count(stderr.String(), "reconnecting (1/1)"))
+
+	// Without --reconnect, or on permanent errors, the command fails.
+	for _, err := range []error{unavailable, status.Error(codes.NotFound, "job not found")} {
+		streams = []*fakeLogsClient{{err: err}, {err: io.EOF}}
+		err = (&logsCmd{cmd: c, ID: "1", Reconnect: 0}).copyLogs(io.Discard, io.Discard)
+		require.Error(t, err)
+	}
+	streams = []*fakeLogsClient{{err: status.Error(codes.NotFound, "job not found")}, {err: io.EOF}}
+	err = (&logsCmd{cmd: c, ID: "1", Reconnect: 3}).copyLogs(io.Discard, io.Discard)
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestStopAlreadyTerminated(t *testing.T) {
+	fake := &fakeTelejobClient{terminated: []string{"1"}}
+	var stderr strings.Builder
+	c := cmd{client: &telejob.Client{TelejobClient: fake}, w: io.Discard, errW: &stderr}
+	require.NoError(t, (&stopCmd{cmd: c, ID: "2"}).Run())
+	require.Empty(t, stderr.String())
+	require.NoError(t, (&stopCmd{cmd: c, ID: "1"}).Run())
+	require.Equal(t, "job 1 had already terminated\n", stderr.String())
+}
+
+// fakeTelejobClient is a pb.TelejobClient implementing Capabilities, Logs
+// and Stop only. It reports the given RPCs, or fails with Unimplemented if rpcs
+// is nil, like servers predating the Capabilities RPC. Logs calls logs. Stop
+// reports the jobs with IDs in terminated as already terminated.
+type fakeTelejobClient struct {
+	pb.TelejobClient
+	rpcs       []string
+	logs       func(*pb.LogsRequest) (pb.Telejob_LogsClient, error)
+	terminated []string
+}
+
+func (f *fakeTelejobClient) Stop(_ context.Context, req *pb.StopRequest, _ ...grpc.CallOption) (*pb.StopResponse, error) {
+	return &pb.StopResponse{AlreadyTerminated: slices.Contains(f.terminated, req.GetId())}, nil
+}
+
+func (f *fakeTelejobClient) Logs(_ context.Context, req *pb.LogsRequest, _ ...grpc.CallOption) (pb.Telejob_LogsClient, error) {
+	return f.logs(req)
+}
+
+// fakeLogsClient is a pb.Telejob_LogsClient receiving the given responses,
+// followed by err.
+type fakeLogsClient struct {
+	grpc.ClientStream
+	resps []*pb.LogsResponse
+	err   error
+}
+
+func (f *fakeLogsClient) Recv() (*pb.LogsResponse, error) {
+	if len(f.resps) == 0 {
+		return nil, f.err
+	}
+	resp := f.resps[0]
+	f.resps = f.resps[1:]
+	return resp, nil
+}
+
+func (f *fakeTelejobClient) Capabilities(context.Context, *pb.CapabilitiesRequest, ...grpc.CallOption) (*pb.CapabilitiesResponse, error) {
+	if f.rpcs == nil {
+		return nil, status.Error(codes.Unimplemented, "unknown method Capabilities")
+	}
+	return &pb.CapabilitiesResponse{Rpcs: f.rpcs}, nil
+}
+
+func TestMainLogsOut(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Stop()
+	t.Setenv("TELEJOB_ADDRESS", ts.address)
+	t.Setenv("TELEJOB_CLIENT_CERT", "testdata/client1.crt")
+	t.Setenv("TELEJOB_CLIENT_KEY", "testdata/client1.key")
+	t.Setenv("TELEJOB_SERVER_CA_CERT", "testdata/server-ca.crt")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "job.log")
+
+	// A failing log stream leaves no file behind.
+	_, err := run(t, []string{"logs", "--out", path, "NON-EXISTENT-ID"})
+	require.Error(t, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	out, err := run(t, []string{"start", "--", "sh", "-c", "echo out; sleep 0.1; echo err >&2"})
+	require.NoError(t, err)
+	id := strings.TrimSpace(out)
+	out, err = run(t, []string{"logs", "--out", path, id})
+	require.NoError(t, err)
+	require.Equal(t, "8 bytes written to "+path+"\n", out)
+	b, err := os.ReadFile(path) //nolint:gosec // G304: Potential file inclusion via variable
+	require.NoError(t, err)
+	require.Equal(t, "out\nerr\n", string(b))
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestMainEmptyArgs(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Stop()
+	t.Setenv("TELEJOB_ADDRESS", ts.address)
+	t.Setenv("TELEJOB_CLIENT_CERT", "testdata/client1.crt")
+	t.Setenv("TELEJOB_CLIENT_KEY", "testdata/client1.key")
+	t.Setenv("TELEJOB_SERVER_CA_CERT", "testdata/server-ca.crt")
+	_, err := run(t, []string{"start", ""})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "InvalidArgument")
+	_, err = run(t, []string{"start", " "})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "InvalidArgument")
+
+	out, err := run(t, []string{"start", "echo", ""})
+	require.NoError(t, err)
+	id := strings.TrimSpace(out)
+	out, err = run(t, []string{"logs", id})
+	require.NoError(t, err)
+	require.Equal(t, "\n", out)
+}
+
 func TestMainLogsStreamed(t *testing.T) {
 	ts := newTestServer(t)
 	defer ts.Stop()
@@ -133,6 +505,36 @@ func TestMainLogsStreamed(t *testing.T) {
 	require.Equal(t, wantLogs, out)
 }
 
+func TestMainLogsFlush(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Stop()
+	t.Setenv("TELEJOB_ADDRESS", ts.address)
+	t.Setenv("TELEJOB_CLIENT_CERT", "testdata/client1.crt")
+	t.Setenv("TELEJOB_CLIENT_KEY", "testdata/client1.key")
+	t.Setenv("TELEJOB_SERVER_CA_CERT", "testdata/server-ca.crt")
+
+	fname := filepath.Join(t.TempDir(), "logs")
+	f, err := os.OpenFile(fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	out, err := run(t, []string{"start", "--", "tail", "-f", fname})
+	require.NoError(t, err)
+	id := strings.TrimSpace(out)
+	defer func() { _, _ = run(t, []string{"stop", id}) }()
+	buf := &flushBuf{}
+	require.NoError(t, startWithWriter(t, []string{"logs", "--flush", id}, buf))
+
+	mustWrite(t, f, "1\n")
+	wantLogs := "1\n"
+	logsEqual := func() bool { return wantLogs == buf.String() }
+	require.Eventually(t, logsEqual, time.Second, 10*time.Millisecond, buf.String())
+
+	mustWrite(t, f, "2\n")
+	wantLogs = "1\n2\n"
+	require.Eventually(t, logsEqual, time.Second, 10*time.Millisecond, buf.String())
+}
+
 func TestMainManyLogsStreamed(t *testing.T) {
 	ts := newTestServer(t)
 	defer ts.Stop()
@@ -179,6 +581,259 @@ func TestMainManyLogsStreamed(t *testing.T) {
 	}
 }
 
+func TestMainLogsStderr(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Stop()
+	t.Setenv("TELEJOB_ADDRESS", ts.address)
+	t.Setenv("TELEJOB_CLIENT_CERT", "testdata/client1.crt")
+	t.Setenv("TELEJOB_CLIENT_KEY", "testdata/client1.key")
+	t.Setenv("TELEJOB_SERVER_CA_CERT", "testdata/server-ca.crt")
+	out, err := run(t, []string{"start", "--", "sh", "-c", "echo out; echo err >&2"})
+	require.NoError(t, err)
+	id := strings.TrimSpace(out)
+
+	out, errOut, err := runWithStderr(t, []string{"logs", id})
+	require.NoError(t, err)
+	require.Equal(t, "out\n", out)
+	require.Equal(t, "err\n", errOut)
+
+	out, errOut, err = runWithStderr(t, []string{"logs", "--merge", id})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"out", "err"}, strings.Fields(out))
+	require.Equal(t, "", errOut)
+}
+
+func TestMainLogsJSONL(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Stop()
+	t.Setenv("TELEJOB_ADDRESS", ts.address)
+	t.Setenv("TELEJOB_CLIENT_CERT", "testdata/client1.crt")
+	t.Setenv("TELEJOB_CLIENT_KEY", "testdata/client1.key")
+	t.Setenv("TELEJOB_SERVER_CA_CERT", "testdata/server-ca.crt")
+	out, err := run(t, []string{"start", "--", "sh", "-c", "echo out; sleep 0.1; echo err >&2"})
+	require.NoError(t, err)
+	id := strings.TrimSpace(out)
+
+	out, errOut, err := runWithStderr(t, []string{"logs", "--output", "jsonl", id})
+	require.NoError(t, err)
+	require.Equal(t, "", errOut)
+	records := parseLogRecords(t, out)
+	require.Len(t, records, 2)
+	require.Equal(t, "stdout", records[0].Stream)
+	require.Equal(t, "out\n", string(records[0].Data))
+	require.Equal(t, "stderr", records[1].Stream)
+	require.Equal(t, "err\n", string(records[1].Data))
+}
+
+func TestWriteLogRecord(t *testing.T) {
+	t.Parallel()
+	buf := &bytes.Buffer{}
+	received := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, writeLogRecord(buf, &pb.LogsResponse{Chunk: []byte("a\nb\x00\"}"), Stream: pb.Stream_STREAM_STDERR}, received))
+	require.NoError(t, writeLogRecord(buf, &pb.LogsResponse{Chunk: []byte("c")}, received))
+	records := parseLogRecords(t, buf.String())
+	want := []logRecord{
+		{Stream: "stderr", Time: received, Data: []byte("a\nb\x00\"}")},
+		{Stream: "", Time: received, Data: []byte("c")},
+	}
+	require.Equal(t, want, records)
+}
+
+// parseLogRecords parses JSON Lines output of the logs command, one record
+// per line.
+func parseLogRecords(t *testing.T, out string) []logRecord {
+	t.Helper()
+	var records []logRecord
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		var record logRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestMainDoctor(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Stop()
+	t.Setenv("TELEJOB_ADDRESS", ts.address)
+	t.Setenv("TELEJOB_CLIENT_CERT", "testdata/client1.crt")
+	t.Setenv("TELEJOB_CLIENT_KEY", "testdata/client1.key")
+	t.Setenv("TELEJOB_SERVER_CA_CERT", "testdata/server-ca.crt")
+
+	out, err := run(t, []string{"doctor"})
+	require.NoError(t, err)
+	lines := strings.Split(out, "\n")
+	require.Len(t, lines, 5)
+	for i, step := range []string{"start", "status", "stop", "logs"} {
+		require.Regexp(t, `^PASS  `+step+`\s+\S+$`, lines[i])
+	}
+
+	t.Setenv("TELEJOB_SERVER_CA_CERT", "testdata/client-ca.crt") // wrong CA
+	_, err = run(t, []string{"doctor"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `doctor check "start" failed`)
+}
+
+func TestMainServerCert(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Stop()
+	t.Setenv("TELEJOB_ADDRESS", ts.address)
+	t.Setenv("TELEJOB_CLIENT_CERT", "testdata/client1.crt")
+	t.Setenv("TELEJOB_CLIENT_KEY", "testdata/client1.key")
+	t.Setenv("TELEJOB_SERVER_CA_CERT", "testdata/server-ca.crt")
+
+	out, err := run(t, []string{"server-cert"})
+	require.NoError(t, err)
+	want := `Subject:     CN=server
+DNS SANs:    localhost
+IP SANs:     127.0.0.1
+Issuer:      CN=server-ca
+Not before:  2024-12-12T10:53:01Z
+Not after:   2044-12-12T11:03:00Z
+Trusted:     yes
+`
+	require.Equal(t, want, out)
+
+	t.Setenv("TELEJOB_SERVER_CA_CERT", "testdata/client-ca.crt") // wrong CA
+	_, err = run(t, []string{"server-cert"})
+	require.ErrorContains(t, err, "server certificate is not trusted")
+}
+
+func TestMainCertCheck(t *testing.T) {
+	// No server address is needed.
+	t.Setenv("TELEJOB_CLIENT_CERT", "testdata/client1.crt")
+	t.Setenv("TELEJOB_CLIENT_KEY", "testdata/client1.key")
+	out, err := run(t, []string{"cert-check"})
+	require.NoError(t, err)
+	want := `Subject:     CN=client1
+Issuer:      CN=client-ca
+Not before:  `
+	require.True(t, strings.HasPrefix(out, want), out)
+
+	now := time.Now()
+	tests := map[string]struct {
+		notBefore, notAfter time.Time
+		wantErr             string
+	}{
+		"valid":         {notBefore: now.Add(-time.Hour), notAfter: now.Add(365 * 24 * time.Hour)},
+		"expires soon":  {notBefore: now.Add(-time.Hour), notAfter: now.Add(24 * time.Hour), wantErr: "expires at"},
+		"expired":       {notBefore: now.Add(-2 * time.Hour), notAfter: now.Add(-time.Hour), wantErr: "expired at"},
+		"not yet valid": {notBefore: now.Add(time.Hour), notAfter: now.Add(365 * 24 * time.Hour), wantErr: "not valid before"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			certFile, keyFile := writeTestCert(t, tc.notBefore, tc.notAfter)
+			_, err := run(t, []string{"cert-check", "--client-cert", certFile, "--client-key", keyFile, "--within", "168h"})
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+
+	// Other commands only warn about certificates that expire soon, before
+	// connecting to the server.
+	t.Setenv("TELEJOB_ADDRESS", "localhost:8443")
+	certFile, keyFile := writeTestCert(t, now.Add(-time.Hour), now.Add(24*time.Hour))
+	args := []string{"status", "--client-cert", certFile, "--client-key", keyFile, "--cert-warn", "168h", "1"}
+	var stderr strings.Builder
+	_, err = setupRun(t, args, io.Discard, &stderr)
+	require.NoError(t, err)
+	require.Contains(t, stderr.String(), "warning: client certificate expires at")
+}
+
+// writeTestCert writes a self-signed certificate with the given validity and
+// its key to a temporary directory and returns their paths.
+func writeTestCert(t *testing.T, notBefore, notAfter time.Time) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(crand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestPBTimeString(t *testing.T) {
+	t.Parallel()
+	ts := timestamppb.New(time.Date(2024, 12, 24, 18, 30, 0, 0, time.UTC))
+	layout := "2006-01-02T15:04:05Z07:00"
+	require.Equal(t, "2024-12-24T18:30:00Z", pbTimeString(ts, layout, time.UTC))
+
+	sydney, err := time.LoadLocation("Australia/Sydney")
+	require.NoError(t, err)
+	require.Equal(t, "2024-12-25T05:30:00+11:00", pbTimeString(ts, layout, sydney))
+	require.Equal(t, "", pbTimeString(nil, layout, sydney))
+}
+
+func TestPrintLimits(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	limits := &pb.ExplainLimitsResponse{Cpus: 0.5, MemoryKib: 2000, Rlimits: map[string]uint64{"nproc": 10, "nofile": 64}}
+	require.NoError(t, printLimits(&buf, limits))
+	want := `LIMIT            VALUE
+cpus             0.5
+memory-kib       2000
+memory-high-kib  unlimited
+memory-min-kib   unlimited
+oom-group        false
+max-cpu-seconds  unlimited
+io               unlimited
+rlimit-nofile    64
+rlimit-nproc     10
+`
+	require.Equal(t, want, buf.String())
+}
+
+func TestPrintDescription(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	d := &pb.DescribeResponse{
+		Env:         []*pb.EnvVar{{Key: "PATH"}, {Key: "API_TOKEN"}},
+		EnvRedacted: true,
+		Namespaces:  []string{"mnt"},
+	}
+	require.NoError(t, printDescription(&buf, d))
+	want := `ENV        VALUE
+PATH       <redacted>
+API_TOKEN  <redacted>
+
+namespaces: mnt
+`
+	require.Equal(t, want, buf.String())
+}
+
+func TestStatusLocation(t *testing.T) {
+	t.Parallel()
+	loc, err := (&timeFlags{}).location()
+	require.NoError(t, err)
+	require.Equal(t, time.Local, loc)
+
+	loc, err = (&timeFlags{Timezone: "Australia/Sydney"}).location()
+	require.NoError(t, err)
+	require.Equal(t, "Australia/Sydney", loc.String())
+
+	loc, err = (&timeFlags{Timezone: "Australia/Sydney", UTC: true}).location()
+	require.NoError(t, err)
+	require.Equal(t, time.UTC, loc)
+
+	_, err = (&timeFlags{Timezone: "Nowhere/Special"}).location()
+	require.Error(t, err)
+}
+
 func mustWrite(t *testing.T, f *os.File, s string) {
 	t.Helper()
 	_, err := f.WriteString(s)
@@ -205,41 +860,57 @@ func receiveOnce(addr, id string) (string, error) {
 }
 
 func run(t *testing.T, args []string) (string, error) {
+	t.Helper()
+	out, _, err := runWithStderr(t, args)
+	return out, err
+}
+
+func runWithStderr(t *testing.T, args []string) (string, string, error) {
 	t.Helper()
 	buf := &bytes.Buffer{}
-	kctx, err := setupRun(t, args, buf)
+	errBuf := &bytes.Buffer{}
+	kctx, err := setupRun(t, args, buf, errBuf)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	err = kctx.Run()
 	if err != nil {
-		return "", fmt.Errorf("kong.Context.Run: %w", err)
+		return "", "", fmt.Errorf("kong.Context.Run: %w", err)
 	}
-	return buf.String(), nil
+	return buf.String(), errBuf.String(), nil
 }
 
 func start(t *testing.T, args []string) (fmt.Stringer, error) {
 	t.Helper()
 	syncBuf := &syncBuf{}
-	kctx, err := setupRun(t, args, syncBuf)
-	if err != nil {
+	if err := startWithWriter(t, args, syncBuf); err != nil {
 		return nil, err
 	}
+	return syncBuf, nil
+}
+
+func startWithWriter(t *testing.T, args []string, w io.Writer) error {
+	t.Helper()
+	kctx, err := setupRun(t, args, w, io.Discard)
+	if err != nil {
+		return err
+	}
 	go func() {
 		err := kctx.Run()
 		if err != nil {
 			t.Errorf("kong.Context.Run: %v", err)
 		}
 	}()
-	return syncBuf, nil
+	return nil
 }
 
-func setupRun(t *testing.T, args []string, w io.Writer) (*kong.Context, error) {
+func setupRun(t *testing.T, args []string, w, errW io.Writer) (*kong.Context, error) {
 	t.Helper()
 
+	errWriter := stderrWriter(errW)
 	opts := []kong.Option{
 		kong.Exit(exitFatalFn(t)),
-		kong.Bind(&w),
+		kong.Bind(&w, &errWriter),
 	}
 	parser, err := kong.New(&app{}, opts...)
 	if err != nil {
@@ -270,6 +941,27 @@ func (sb *syncBuf) String() string {
 	return string(sb.data)
 }
 
+// flushBuf is a syncBuf that only makes written data visible after Flush.
+type flushBuf struct {
+	syncBuf
+	pending []byte
+}
+
+func (fb *flushBuf) Write(b []byte) (int, error) {
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+	fb.pending = append(fb.pending, b...)
+	return len(b), nil
+}
+
+func (fb *flushBuf) Flush() error {
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+	fb.data = append(fb.data, fb.pending...)
+	fb.pending = nil
+	return nil
+}
+
 func exitFatalFn(t *testing.T) func(c int) {
 	t.Helper()
 	return func(_ int) {
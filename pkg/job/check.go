@@ -0,0 +1,63 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CheckReport is the result of a successful [Check]. Controllers are the
+// cgroup controllers enabled for jobs, such as "cpu", "io" and "memory".
+type CheckReport struct {
+	Cgroup      string
+	Controllers []string
+	JobDuration time.Duration
+}
+
+// Check validates that the host supports running jobs with the given
+// controller options, for example before deploying a server. It creates the
+// controller's cgroup with its resource controllers enabled, runs `true` as a
+// job under the configured limits and credential, waits for it to terminate
+// and removes the cgroup again.
+//
+// The controller's cgroup must not exist yet, so Check cannot be used for the
+// cgroup of a running controller.
+func Check(opts ...Option) (CheckReport, error) {
+	c, err := NewController(opts...)
+	if err != nil {
+		return CheckReport{}, err
+	}
+	report, err := c.check()
+	if stopErr := c.StopAll(); stopErr != nil {
+		err = errors.Join(err, stopErr)
+	}
+	return report, err
+}
+
+// check runs the check job of Check on a new controller without other jobs.
+func (c *Controller) check() (CheckReport, error) {
+	controlFile := filepath.Join(c.telejobCgroup, "cgroup.subtree_control")
+	b, err := os.ReadFile(controlFile) //nolint:gosec // G304: Potential file inclusion via variable
+	if err != nil {
+		return CheckReport{}, fmt.Errorf("%w: cannot read %q: %w", ErrCgroup, controlFile, err)
+	}
+	report := CheckReport{Cgroup: c.telejobCgroup, Controllers: strings.Fields(string(b))}
+	const owner = "telejob-check"
+	id, err := c.Start(owner, "true")
+	if err != nil {
+		return report, err
+	}
+	c.wg.Wait() // the check job is the controller's only job.
+	status, err := c.Status(owner, id)
+	if err != nil {
+		return report, err
+	}
+	if status.ExitCode != 0 {
+		return report, fmt.Errorf("%w: check job exited with code %d", ErrCommand, status.ExitCode)
+	}
+	report.JobDuration = status.Stopped.Sub(status.Started)
+	return report, nil
+}
@@ -1,37 +1,202 @@
 // Package job provides a controller and job types for the telejob service.
 //
 // It provides methods to manage jobs:
-//   - Start: Creates and starts a new job.
+//   - Start, StartJob, StartJobContext: Creates and starts a new job.
 //   - Stop: Stops a running job.
+//   - Resume: Resumes a job started paused.
+//   - ForceStop: Stops a running job of any owner.
 //   - Status: Returns the current status of a job.
+//   - StatusBatch: Returns the current statuses of multiple jobs at once.
+//   - AggregateUsage: Returns the resource usage summed over all running jobs.
 //   - Logs: Stream logs of a job.
+//   - WatchAll: Stream status changes of the jobs of all owners.
+//   - ReapOrphans: Kills and deletes cgroups not belonging to any job.
 //
 // ## Job Access:
-// Started jobs may only be accessed by their owner.
+// Started jobs may only be accessed by their owner. ForceStop and WatchAll
+// are the only exceptions, callers must ensure that they are only used by
+// operators.
+//
+// ## Labels:
+// Jobs can be labelled with key-value pairs. A job started with the Unique
+// start option is refused while another running job of the same owner has the
+// same labels, for example to allow only a single "deploy" job at a time.
 //
 // ## Concurrency:
 // The Status method returns a concurrency-safe copy of the job.Status.package job
 //
+// ## Backpressure:
+// The WithMaxJobs option limits the number of concurrently running jobs.
+// Starts beyond the limit fail with a [*TooManyJobsError] that contains a hint
+// when to retry, based on the durations of recently finished jobs.
+//
+// ## Credentials:
+// By default, jobs run with the same user and groups as the controller. Use
+// the WithCredential option to run jobs as a different user with a given set
+// of supplementary groups.
+//
+// ## Root Filesystem:
+// Use the WithRootfs option to confine jobs to a prepared directory tree, such
+// as an unpacked container image. Jobs are started in a new mount namespace
+// with the directory as root, commands are looked up within it and working
+// directories are relative to it. This requires root or the CAP_SYS_CHROOT
+// and CAP_SYS_ADMIN capabilities. Per-process rlimits and a umask are not
+// supported with a root filesystem, as the exec helper setting them cannot
+// run within it.
+//
+// ## Mounts:
+// Jobs can be given access to host directories and files with bind mounts in
+// a new mount namespace of the job, see StartOptions.Mounts. Mount sources
+// must be within the host paths allowed with the WithMountSources option.
+// Mounts are set up by the exec helper, which requires root. With a root
+// filesystem, mount targets are within it. The exec helper sets up the mounts
+// before it changes the root directory and switches to the credential set
+// with WithCredential, if any.
+//
+// ## File Descriptors:
+// Jobs inherit only stdin, stdout and stderr from the controller: files and
+// sockets opened by the standard library, such as the job cgroup and the
+// server's listener, are close-on-exec. File descriptors opened without
+// close-on-exec, for example by C libraries, would be inherited nonetheless.
+// The WithCloseFDs option guarantees that no other file descriptor is
+// inherited, at the cost of an additional exec per job. It is not supported
+// with a root filesystem.
+//
+// ## Environment:
+// Jobs do not inherit the environment of the controller's process, which may
+// hold secrets such as cloud credentials or the server's configuration. A
+// job's environment consists of the controller's variables allowed with the
+// WithInheritEnv option, such as PATH, followed by StartOptions.Env.
+//
+// ## Terminals:
+// Jobs started with StartOptions.Tty run with a pseudo-terminal as stdin,
+// stdout, stderr and controlling terminal, so that commands behave as in an
+// interactive session, for example with line-buffered or colored output.
+// Controller.WriteInput writes keystrokes to the terminal. Controller.AttachInput
+// claims the terminal's input for a single interactive session at a time.
+//
+// ## Seccomp:
+// The WithSeccompProfile option installs a seccomp filter in job processes
+// that kills a job's process when it makes one of the syscalls blocked by the
+// profile, for defense in depth. The profile is a JSON file such as
+// {"blocked": ["mount", "ptrace", "unshare"]}; only syscalls that jobs rarely
+// need, such as system administration syscalls, can be blocked. This requires
+// Linux 4.14 or later built with CONFIG_SECCOMP_FILTER, on amd64 or arm64.
+// Seccomp profiles are not supported with a root filesystem.
+//
+// ## Output Tee:
+// The WithTeeOutput option mirrors the output of all jobs to a writer, such as
+// the server's stdout, with each line prefixed by the job ID. It is meant for
+// operators debugging jobs without a client and drops output rather than
+// slowing down jobs if the writer cannot keep up.
+//
+// ## Discarded Output:
+// Jobs started with StartOptions.DiscardOutput, or by a controller created with
+// the WithDiscardOutput option, write their output to the null device. Their
+// output is not buffered, so that fire-and-forget jobs do not use memory for
+// logs nobody reads; reading their logs fails with ErrNoOutput.
+//
+// ## Event Log:
+// The WithEventLog option writes a JSON [LifecycleEvent] per line when a job
+// has started and when it has terminated, for ingestion into a log pipeline.
+// Terminated jobs are reported as exited, failed, stopped, oom or timeout,
+// with their exit code. WithEventHandler passes the events to a callback
+// instead.
+//
+// ## Command Decorator:
+// The WithCmdDecorator option lets embedders customize each job's exec.Cmd
+// right before it is started, for settings without a dedicated option. The
+// decorator must not undo the controller's setup, see WithCmdDecorator.
+//
+// ## Command Wrapper:
+// The WithCommandWrapper option runs every job's command through a fixed
+// wrapper, such as nice, ionice or a tracing tool, transparently to clients:
+// job statuses report the command and arguments as started.
+//
+// ## Scheduled Jobs:
+// Jobs started with StartOptions.NotBefore in the future are registered right
+// away with Status.Scheduled set. Their process is held frozen like that of a
+// paused job and their command runs at NotBefore. Stopping a scheduled job
+// cancels it.
+//
+// ## Stop Schedule:
+// By default, Stop kills a job with SIGKILL. The WithStopSchedule option makes
+// Stop escalate through a schedule of signals instead, such as SIGTERM, SIGTERM
+// again after 5 seconds and SIGKILL after 10 seconds, for jobs that need
+// repeated nudges to shut down cleanly. Paused and scheduled jobs are always
+// killed, as their command has not run yet.
+//
+// ## Owner Cgroups:
+// By default, job cgroups are created directly below the telejob cgroup. The
+// WithOwnerCgroups option nests them in a cgroup per owner instead, so that
+// the resource usage of each owner can be accounted on the host.
+//
 // ## Resource Limits:
 // The controller enforces memory, I/O, and CPU resource limits for each job
 // using cgroups v2. These limits are configured using functional options when
 // creating the controller.
+//
+// Limits require the corresponding cgroup controller to be delegated to the
+// telejob cgroup, see Controller.AvailableControllers. Limits of unavailable
+// controllers are skipped with a warning, or rejected with the
+// WithStrictControllers option. Controller.EffectiveLimits returns the
+// limits a job would run with, without starting it.
+//
+// The WithHostLimitCheck option catches CPU and memory limits exceeding the
+// host's CPUs or total memory, which jobs could never reach, with a warning or
+// an error.
+//
+// The memory guarantee of a job, see Limits.MemoryMinKiB, is capped by the
+// memory.min of its ancestor cgroups. The controller raises the memory.min of
+// the telejob cgroup, and of the owner cgroups with WithOwnerCgroups, to the
+// sum of the guarantees of their running jobs. The memory.min of the cgroups
+// above the telejob cgroup must be set by the operator.
 package job
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
+	"maps"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// recentDurationCount is the number of recently finished job durations the
+// retry hint of a TooManyJobsError is averaged over. defaultRetryAfter is the
+// hint used while no job has finished yet.
+const (
+	recentDurationCount = 32
+	defaultRetryAfter   = time.Second
 )
 
+// jobControllers are the cgroup controllers enabled for job cgroups, if
+// available. The pids controller is not used for limits, but provides the
+// pids.current file read by Controller.Stats.
+//
+//nolint:gochecknoglobals // read-only list.
+var jobControllers = []string{"cpu", "io", "memory", "pids"}
+
+// cgroupMkdir creates cgroup directories. It is replaced in tests to simulate
+// cgroup filesystems that cannot be written.
+var cgroupMkdir = os.Mkdir //nolint:gochecknoglobals // replaced in tests.
+
+// maxOwnerCgroupName is the maximum length of owner cgroup names, well below
+// the 255 bytes file name limit.
+const maxOwnerCgroupName = 128
+
 // The Controller manages jobs for the telejob service.
 //
 // It provides methods to:
@@ -40,27 +205,130 @@ import (
 //   - Retrieve job status.
 //   - Stream job logs.
 type Controller struct {
-	mutex         sync.Mutex
-	wg            sync.WaitGroup
-	jobs          map[string]*job
-	maxID         atomic.Uint64
-	shutDown      bool
-	telejobCgroup string
-	limits        Limits
+	mutex           sync.Mutex
+	uniqueMutex     sync.Mutex // serializes starts of unique jobs
+	wg              sync.WaitGroup
+	jobs            map[string]*job
+	starting        map[string]bool // IDs of jobs not added to jobs yet
+	maxID           atomic.Uint64
+	shutDown        bool
+	stopAllErr      error // returned by StopAll again once shut down
+	telejobCgroup   string
+	controllers     []string // enabled for job cgroups, nil if unknown
+	strictCtrls     bool
+	kill            killStrategy   // detected on the telejob cgroup
+	host            *hostResources // nil unless WithHostLimitCheck is used
+	hostLimitCheck  bool
+	hostLimitReject bool
+	limits          Limits
+	maxLogBytes     int
+	credential      *Credential
+	allowedGroups   []uint32
+	umask           *int
+	maxJobs         int
+	rootfs          string
+	mountSources    []string // host paths allowed as mount sources
+	outputDigest    bool
+	discardOutput   bool
+	closeFDs        bool
+	seccompPath     string
+	seccomp         []string
+	inheritEnv      []string // names of environment variables inherited by jobs
+	commandWrapper  []string // prefixed to the command of every job
+	stopSchedule    []StopStep
+	decorateCmd     func(*exec.Cmd)
+	reapOrphans     bool
+	setupTimeout    time.Duration
+	stopAllTimeout  time.Duration
+	teeWriter       io.Writer
+	tee             *outputTee
+	newCgroup       func(cgroup string, limits Limits) error // creates job cgroups, replaced in tests
+	admission       func(owner string, opts StartOptions) error
+	events          broadcaster
+	eventHandler    func(LifecycleEvent)
+
+	// ownerMutex protects ownerJobs, the number of jobs with a cgroup in
+	// each owner cgroup, by owner cgroup name, which is only used with
+	// WithOwnerCgroups, and the sums of the memory guarantees of the running
+	// jobs in the telejob cgroup and in each owner cgroup.
+	ownerCgroups   bool
+	ownerMutex     sync.Mutex
+	ownerJobs      map[string]int
+	memoryMinKiB   uint64
+	ownerMemoryMin map[string]uint64
+
+	// slotMutex protects running and recentDurations. It is separate from
+	// mutex, which StopAll holds while waiting for jobs to release their slot.
+	slotMutex       sync.Mutex
+	running         int
+	recentDurations []time.Duration
 }
 
 // NewController creates a new Controller with the given options.
 func NewController(opts ...Option) (*Controller, error) {
 	controller := &Controller{
 		jobs:          make(map[string]*job),
+		starting:      make(map[string]bool),
 		telejobCgroup: "/sys/fs/cgroup/telejob",
+		newCgroup:     newJobCgroup,
 	}
 	for _, opt := range opts {
 		opt(controller)
 	}
-	if err := newTelejobCgroup(controller.telejobCgroup); err != nil {
+	if err := controller.validateCredential(); err != nil {
+		return nil, err
+	}
+	if err := validateRlimits(controller.limits.Rlimits); err != nil {
+		return nil, err
+	}
+	if err := validateMemoryLimits(controller.limits); err != nil {
+		return nil, err
+	}
+	if controller.hostLimitCheck {
+		host, err := readHostResources()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrLimits, err)
+		}
+		controller.host = host
+	}
+	if err := controller.checkHostLimits(controller.limits); err != nil {
 		return nil, err
 	}
+	if err := validateStopSchedule(controller.stopSchedule); err != nil {
+		return nil, err
+	}
+	if len(controller.commandWrapper) > 0 && strings.TrimSpace(controller.commandWrapper[0]) == "" {
+		return nil, fmt.Errorf("%w: empty command wrapper %q", ErrCommand, controller.commandWrapper)
+	}
+	if err := controller.validateRootfs(controller.limits); err != nil {
+		return nil, err
+	}
+	if controller.seccompPath != "" {
+		seccomp, err := readSeccompProfile(controller.seccompPath)
+		if err != nil {
+			return nil, err
+		}
+		controller.seccomp = seccomp
+	}
+	controllers, err := newTelejobCgroup(controller.telejobCgroup, controller.reapOrphans)
+	if err != nil {
+		return nil, err
+	}
+	if controller.reapOrphans {
+		controller.reapOrphansOnStart()
+	}
+	controller.controllers = controllers
+	controller.kill = detectKillStrategy(controller.telejobCgroup)
+	if controller.kill != killCgroupFile {
+		slog.Warn("cgroup.kill unavailable, killing remaining job processes through cgroup.procs", "cgroup", controller.telejobCgroup)
+	}
+	if controller.limits, err = controller.supportedLimits(controller.limits); err != nil {
+		deleteCgroupOnErr(controller.telejobCgroup, err)
+		return nil, err
+	}
+	if controller.teeWriter != nil {
+		controller.tee = newStartedOutputTee(controller.teeWriter)
+	}
 	return controller, nil
 }
 
@@ -83,6 +351,215 @@ func WithLimits(limits Limits) Option {
 	}
 }
 
+// WithMaxLogBytes sets the maximum number of bytes of output buffered per job.
+// Once a job's output exceeds this size, its oldest output is discarded. A
+// value of zero, the default, buffers all output.
+func WithMaxLogBytes(n int) Option {
+	return func(c *Controller) {
+		c.maxLogBytes = n
+	}
+}
+
+// WithCredential sets the user, group and supplementary groups that job
+// processes run as. The controller requires sufficient privileges, typically
+// root, to switch to the given credential.
+func WithCredential(cred Credential) Option {
+	return func(c *Controller) {
+		c.credential = &cred
+	}
+}
+
+// WithAllowedGroups sets the supplementary group IDs that may be used with
+// WithCredential. If set, NewController fails if the credential contains a
+// group that is not allowed. If not set, any group is allowed.
+func WithAllowedGroups(groups ...uint32) Option {
+	return func(c *Controller) {
+		c.allowedGroups = groups
+	}
+}
+
+// WithUmask sets the file mode creation mask of job processes. By default,
+// jobs inherit the umask of the controller's process. The umask is set by the
+// exec helper in the job's process, so that the controller's umask is never
+// changed. It is not supported with WithRootfs.
+func WithUmask(mask int) Option {
+	return func(c *Controller) {
+		c.umask = &mask
+	}
+}
+
+// WithRootfs runs jobs with the given directory as their root directory, in
+// a new mount namespace. The directory must be an absolute path. See the
+// package documentation for the required privileges.
+func WithRootfs(path string) Option {
+	return func(c *Controller) {
+		c.rootfs = path
+	}
+}
+
+// WithOutputDigest computes a SHA-256 digest of each job's total output,
+// reported in [Status.OutputDigest] once the job has terminated. Clients can
+// use it to verify that a downloaded log is complete and unmodified. The
+// digest covers all output, also output discarded due to [WithMaxLogBytes].
+func WithOutputDigest() Option {
+	return func(c *Controller) {
+		c.outputDigest = true
+	}
+}
+
+// WithDiscardOutput discards the output of all jobs, as if they were started
+// with StartOptions.DiscardOutput, for servers running batch jobs whose output
+// does not matter.
+func WithDiscardOutput() Option {
+	return func(c *Controller) {
+		c.discardOutput = true
+	}
+}
+
+// WithCloseFDs guarantees that jobs do not inherit any open file descriptor
+// of the controller's process other than stdin, stdout and stderr, even
+// descriptors opened without close-on-exec. Jobs are started through the exec
+// helper, which marks all other descriptors close-on-exec before executing the
+// job's command. See the package documentation.
+func WithCloseFDs() Option {
+	return func(c *Controller) {
+		c.closeFDs = true
+	}
+}
+
+// WithSeccompProfile installs the seccomp profile read from the JSON file at
+// path in all job processes. Jobs making a syscall blocked by the profile are
+// killed. See the package documentation.
+func WithSeccompProfile(path string) Option {
+	return func(c *Controller) {
+		c.seccompPath = path
+	}
+}
+
+// WithTeeOutput mirrors the output of all jobs to w, for operators debugging
+// jobs on the server. Each line is prefixed with the job ID in brackets.
+// Output is buffered, so that a slow writer does not block jobs; output is
+// dropped while the buffer is full. All buffered output is written before
+// StopAll returns.
+func WithTeeOutput(w io.Writer) Option {
+	return func(c *Controller) {
+		c.teeWriter = w
+	}
+}
+
+// WithStopAllTimeout limits the time [Controller.StopAll] waits for stopped
+// jobs to terminate, so that a job whose processes cannot be killed, such as
+// a process in uninterruptible sleep, does not hang the shutdown. Once the
+// timeout expires, the processes of all job cgroups are killed once more and
+// StopAll proceeds after a short grace period, reporting the jobs that have
+// not terminated. A value of zero, the default, waits indefinitely.
+func WithStopAllTimeout(timeout time.Duration) Option {
+	return func(c *Controller) {
+		c.stopAllTimeout = timeout
+	}
+}
+
+// WithSetupTimeout limits the duration of a job's setup, the creation of its
+// cgroup and the start of its process. Starts exceeding the timeout fail with
+// an error wrapping [context.DeadlineExceeded]. A value of zero, the default,
+// does not limit the setup beyond the context passed to
+// [Controller.StartJobContext].
+//
+// The setup timeout is separate from StartOptions.Timeout, which limits the
+// runtime of a job once its process has started. A slow setup, for example
+// due to host contention, fails without holding a running job slot.
+func WithSetupTimeout(timeout time.Duration) Option {
+	return func(c *Controller) {
+		c.setupTimeout = timeout
+	}
+}
+
+// WithMaxJobs sets the maximum number of concurrently running jobs. Starts
+// beyond the maximum fail with a [*TooManyJobsError]. A value of zero, the
+// default, does not limit the number of jobs.
+func WithMaxJobs(n int) Option {
+	return func(c *Controller) {
+		c.maxJobs = n
+	}
+}
+
+// WithAdmission sets a hook that is called before each job start, before any
+// cgroup or process is created. If the hook returns an error, the start is
+// aborted with an error wrapping both [ErrAdmission] and the hook's error.
+// Embedders can use it to implement custom quotas, command policies or
+// scheduling windows. The hook must be safe for concurrent use.
+func WithAdmission(admit func(owner string, opts StartOptions) error) Option {
+	return func(c *Controller) {
+		c.admission = admit
+	}
+}
+
+// WithOwnerCgroups groups job cgroups by owner, for host-side accounting per
+// owner with tools such as systemd-cgtop. Job cgroups are created as
+// <cgroup>/<owner>/<id> rather than <cgroup>/<id>, see [WithCgroup]. The owner
+// component is sanitized to ASCII letters, digits, '-' and '_'; other
+// characters are replaced by '_'. Owner cgroups are created with the first
+// job of an owner and deleted once the owner has no more job cgroups.
+func WithOwnerCgroups() Option {
+	return func(c *Controller) {
+		c.ownerCgroups = true
+	}
+}
+
+// WithStrictControllers rejects limits of cgroup controllers that are not
+// available in the telejob cgroup with an error wrapping [ErrController]:
+// NewController fails for the controller's limits and starts fail for the
+// limits of StartOptions. By default, such limits are skipped with a warning.
+func WithStrictControllers() Option {
+	return func(c *Controller) {
+		c.strictCtrls = true
+	}
+}
+
+// WithInheritEnv allows jobs to inherit the controller's environment
+// variables with the given names, such as PATH or LANG. By default, jobs do not
+// inherit any of the controller's environment. See the package documentation.
+func WithInheritEnv(keys []string) Option {
+	return func(c *Controller) {
+		c.inheritEnv = keys
+	}
+}
+
+// WithCommandWrapper prefixes the command of every job with the given wrapper
+// command and arguments, such as []string{"nice", "-n", "10"} or a tracing
+// tool, which must run the job's command and arguments appended to them. The
+// wrapper is transparent to clients: job statuses report the job's command
+// and arguments without it. Jobs cannot override argv[0] with a wrapper, see
+// StartOptions.Argv0.
+func WithCommandWrapper(wrapper []string) Option {
+	return func(c *Controller) {
+		c.commandWrapper = wrapper
+	}
+}
+
+// WithCmdDecorator calls decorate with the command of each job right before
+// its process is started, for customizations without a dedicated option, such
+// as additional environment variables, SysProcAttr fields or ExtraFiles. It is
+// called concurrently for concurrent starts and, if a start is retried, more
+// than once per job.
+//
+// The command is fully configured when decorate is called, and decorate must
+// only add to it. In particular:
+//   - SysProcAttr.UseCgroupFD and CgroupFD place the process in the job's
+//     cgroup and must not be changed, or the job escapes its limits.
+//   - Path and Args may run the exec helper that applies rlimits, seccomp and
+//     paused starts rather than the job's command.
+//   - Stdin, Stdout and Stderr carry the job's input and logs.
+//   - Environment variables added to Env are not checked against the
+//     kernel's size limit, see [ErrArgsTooLarge].
+//
+// Callers are responsible for restricting decorators to trusted code.
+func WithCmdDecorator(decorate func(*exec.Cmd)) Option {
+	return func(c *Controller) {
+		c.decorateCmd = decorate
+	}
+}
+
 // Start starts a new job with the given command and arguments for the given
 // owner. It returns the ID of the newly started job, or an error if the job
 // could not be started.
@@ -90,42 +567,451 @@ func WithLimits(limits Limits) Option {
 // The job is executed within its own cgroup, with resource limits applied as
 // configured on the controller.
 func (c *Controller) Start(owner string, command string, args ...string) (string, error) {
-	if len(command) == 0 {
-		return "", fmt.Errorf("%w: empty command", ErrCommand)
+	return c.StartJob(owner, StartOptions{Command: command, Args: args})
+}
+
+// StartJob starts a new job configured by the given start options for the
+// given owner. It returns the ID of the newly started job, or an error if the
+// job could not be started.
+//
+// Empty and whitespace-only commands are rejected with an error wrapping
+// [ErrCommand]. The command is not trimmed otherwise. Arguments are passed
+// to the command as given, including empty arguments.
+//
+// If opts.Unique is set and another running job of the owner has the same
+// labels, it returns a [*DuplicateJobError] containing that job's ID. If the
+// maximum number of running jobs has been reached, it returns a
+// [*TooManyJobsError]. If the admission hook set with [WithAdmission] rejects
+// the start, it returns an error wrapping [ErrAdmission].
+func (c *Controller) StartJob(owner string, opts StartOptions) (string, error) {
+	return c.StartJobContext(context.Background(), owner, opts)
+}
+
+// StartJobContext starts a new job like StartJob. The job's setup is aborted
+// if ctx is done, or the setup timeout set with [WithSetupTimeout] elapses,
+// before the job's process has been started. The error then wraps the cause of
+// ctx, such as [context.DeadlineExceeded], and any partially set up cgroup is
+// deleted. Once started, the job's lifetime is independent of ctx.
+func (c *Controller) StartJobContext(ctx context.Context, owner string, opts StartOptions) (string, error) {
+	if strings.TrimSpace(opts.Command) == "" {
+		return "", fmt.Errorf("%w: empty command %q", ErrCommand, opts.Command)
+	}
+	if opts.Unique && len(opts.Labels) == 0 {
+		return "", fmt.Errorf("%w: unique job without labels", ErrCommand)
+	}
+	if err := c.validateArgv0(opts); err != nil {
+		return "", err
+	}
+	mounts, err := c.resolveMounts(opts.Mounts)
+	if err != nil {
+		return "", err
+	}
+	scheduled := opts.NotBefore.After(time.Now())
+	if scheduled && opts.Paused {
+		return "", fmt.Errorf("%w: a job cannot be both paused and scheduled", ErrCommand)
+	}
+	if (opts.Paused || scheduled) && c.rootfs != "" {
+		return "", fmt.Errorf("%w: starting paused or scheduled is not supported with a rootfs", ErrRootfs)
+	}
+	limits, err := c.EffectiveLimits(opts)
+	if err != nil {
+		return "", err
 	}
 
 	if c.isShutDown() {
 		return "", fmt.Errorf("cannot start command: %w", ErrShutdown)
 	}
-	id := strconv.FormatUint(c.maxID.Add(1), 10)
+	if c.admission != nil {
+		if err := c.admission(owner, opts); err != nil {
+			return "", fmt.Errorf("%w: %w", ErrAdmission, err)
+		}
+	}
+	if opts.Unique {
+		// Hold the lock until the job has been added, so that no other
+		// unique job with the same labels is started concurrently.
+		c.uniqueMutex.Lock()
+		defer c.uniqueMutex.Unlock()
+		if id, ok := c.findRunning(owner, opts.Labels); ok {
+			return "", &DuplicateJobError{ID: id}
+		}
+	}
+	if err := c.reserve(); err != nil {
+		return "", err
+	}
+	id := c.newID()
+	defer c.startDone(id)
+	parent, err := c.acquireParentCgroup(owner, limits.MemoryMinKiB)
+	if err != nil {
+		c.release(0)
+		return "", err
+	}
 
-	cgroup := filepath.Join(c.telejobCgroup, id)
-	job, err := newJob(owner, id, command, args, c.limits, cgroup)
+	cfg := jobConfig{
+		limits:      limits,
+		cgroup:      filepath.Join(parent, id),
+		maxLogBytes: c.maxLogBytes,
+		credential:  c.credential,
+		umask:       c.umask,
+		rootfs:      c.rootfs,
+		digest:      c.outputDigest,
+		discard:     c.discardOutput || opts.DiscardOutput,
+		closeFDs:    c.closeFDs,
+		seccomp:     c.seccomp,
+		env:         c.jobEnv(opts.Env),
+		tee:         c.tee,
+		newCgroup:   c.newCgroup,
+		decorateCmd: c.decorateCmd,
+		kill:        c.kill,
+		wrapper:     c.commandWrapper,
+	}
+	if c.setupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.setupTimeout)
+		defer cancel()
+	}
+	jobOpts := opts
+	jobOpts.Paused = opts.Paused || scheduled // scheduled jobs start paused.
+	jobOpts.Mounts = mounts
+	job, err := newJob(ctx, owner, id, jobOpts, cfg)
 	if err != nil {
+		c.releaseParentCgroup(owner, limits.MemoryMinKiB)
+		c.release(0)
 		return "", err
 	}
+	if scheduled {
+		job.schedule(opts.NotBefore)
+	}
+	if opts.Timeout > 0 {
+		job.stopAfter(opts.Timeout)
+	}
+	if limits.MaxCPUSeconds > 0 {
+		job.limitCPU(time.Duration(limits.MaxCPUSeconds*float64(time.Second)), cpuSampleInterval)
+	}
 
-	c.add(id, job) // synchronized with c.mutex
+	if err := c.add(id, job); err != nil { // synchronized with c.mutex
+		// StopAll has run since the start passed the shutdown check above,
+		// so the job has escaped its stop.
+		_ = job.stop()
+		job.wait()
+		c.releaseParentCgroup(owner, limits.MemoryMinKiB)
+		c.release(0)
+		return "", err
+	}
+	status := job.getStatus()
+	c.events.publish(Event{Owner: owner, Status: status})
+	c.emitLifecycleEvent(LifecycleStarted, owner, status)
 
 	c.wg.Add(1)
 	go func() {
 		defer c.wg.Done()
 		job.wait()
+		c.releaseParentCgroup(owner, limits.MemoryMinKiB)
+		status := job.getStatus()
+		c.release(status.Stopped.Sub(status.Started))
+		c.events.publish(Event{Owner: owner, Status: status})
+		c.emitLifecycleEvent(job.terminationEventType(), owner, status)
 	}()
 	return id, nil
 }
 
+// EffectiveLimits returns the limits a job started with the given options
+// would run with, without starting it: the controller's limits merged with
+// opts.Limits, see [StartOptions], without the limits of unavailable cgroup
+// controllers, see [WithStrictControllers]. It fails like StartJob for
+// invalid limits.
+func (c *Controller) EffectiveLimits(opts StartOptions) (Limits, error) {
+	if opts.Limits == nil {
+		return c.limits, nil
+	}
+	limits := mergeLimits(c.limits, *opts.Limits)
+	if err := validateRlimits(limits.Rlimits); err != nil {
+		return Limits{}, err
+	}
+	if err := validateMemoryLimits(limits); err != nil {
+		return Limits{}, err
+	}
+	if err := c.checkHostLimits(limits); err != nil {
+		return Limits{}, err
+	}
+	if err := c.validateRootfs(limits); err != nil {
+		return Limits{}, err
+	}
+	return c.supportedLimits(limits)
+}
+
+// mergeLimits returns the limits with the non-zero fields of override
+// replacing those of defaults. Rlimits are merged by name.
+func mergeLimits(defaults, override Limits) Limits {
+	result := defaults
+	if override.CPUs > 0 {
+		result.CPUs = override.CPUs
+	}
+	if override.MemoryKiB > 0 {
+		result.MemoryKiB = override.MemoryKiB
+	}
+	if override.MemoryHighKiB > 0 {
+		result.MemoryHighKiB = override.MemoryHighKiB
+	}
+	if override.MemoryMinKiB > 0 {
+		result.MemoryMinKiB = override.MemoryMinKiB
+	}
+	if override.OOMGroup {
+		result.OOMGroup = true
+	}
+	if len(override.IO) > 0 {
+		result.IO = override.IO
+	}
+	if len(override.Rlimits) > 0 {
+		result.Rlimits = maps.Clone(defaults.Rlimits)
+		if result.Rlimits == nil {
+			result.Rlimits = make(map[string]uint64, len(override.Rlimits))
+		}
+		maps.Copy(result.Rlimits, override.Rlimits)
+	}
+	if override.MaxCPUSeconds > 0 {
+		result.MaxCPUSeconds = override.MaxCPUSeconds
+	}
+	return result
+}
+
+// jobEnv returns the environment of a job started with the given additional
+// environment variables: the controller's variables allowed with
+// WithInheritEnv, followed by env. The result is never nil, so that the job
+// does not inherit the controller's environment.
+func (c *Controller) jobEnv(env []string) []string {
+	result := make([]string, 0, len(c.inheritEnv)+len(env))
+	for _, key := range c.inheritEnv {
+		if value, ok := os.LookupEnv(key); ok {
+			result = append(result, key+"="+value)
+		}
+	}
+	return append(result, env...)
+}
+
+// reserve reserves a running job slot, or returns a [*TooManyJobsError] if
+// the maximum number of running jobs has been reached.
+func (c *Controller) reserve() error {
+	c.slotMutex.Lock()
+	defer c.slotMutex.Unlock()
+	if c.maxJobs > 0 && c.running >= c.maxJobs {
+		return &TooManyJobsError{Max: c.maxJobs, RetryAfter: c.retryAfter()}
+	}
+	c.running++
+	return nil
+}
+
+// release releases a running job slot reserved with reserve. A positive
+// duration of the finished job is recorded for the retry hint.
+func (c *Controller) release(duration time.Duration) {
+	c.slotMutex.Lock()
+	defer c.slotMutex.Unlock()
+	c.running--
+	if duration <= 0 {
+		return
+	}
+	c.recentDurations = append(c.recentDurations, duration)
+	if len(c.recentDurations) > recentDurationCount {
+		c.recentDurations = c.recentDurations[1:]
+	}
+}
+
+// acquireParentCgroup returns the parent cgroup of a new job of the given
+// owner with the given memory guarantee. With WithOwnerCgroups, it is the
+// owner cgroup, which is created for the owner's first job; each call must be
+// followed by a call to releaseParentCgroup with the same memory guarantee
+// once the job's cgroup has been deleted. The memory guarantees of the parent
+// cgroups are raised by the job's guarantee, see adjustMemoryMin.
+func (c *Controller) acquireParentCgroup(owner string, memoryMinKiB uint64) (string, error) {
+	c.ownerMutex.Lock()
+	defer c.ownerMutex.Unlock()
+	if !c.ownerCgroups {
+		c.adjustMemoryMin("", memoryMinKiB, true)
+		return c.telejobCgroup, nil
+	}
+	name := ownerCgroupName(owner)
+	cgroup := filepath.Join(c.telejobCgroup, name)
+	if c.ownerJobs[name] == 0 {
+		if err := newOwnerCgroup(cgroup); err != nil {
+			return "", err
+		}
+	}
+	if c.ownerJobs == nil {
+		c.ownerJobs = map[string]int{}
+	}
+	c.ownerJobs[name]++
+	c.adjustMemoryMin(name, memoryMinKiB, true)
+	return cgroup, nil
+}
+
+// releaseParentCgroup releases the parent cgroup acquired with
+// acquireParentCgroup. The owner cgroup is deleted once the owner has no more
+// job cgroups.
+func (c *Controller) releaseParentCgroup(owner string, memoryMinKiB uint64) {
+	c.ownerMutex.Lock()
+	defer c.ownerMutex.Unlock()
+	if !c.ownerCgroups {
+		c.adjustMemoryMin("", memoryMinKiB, false)
+		return
+	}
+	name := ownerCgroupName(owner)
+	c.adjustMemoryMin(name, memoryMinKiB, false)
+	c.ownerJobs[name]--
+	if c.ownerJobs[name] > 0 {
+		return
+	}
+	delete(c.ownerJobs, name)
+	if err := deleteCgroup(filepath.Join(c.telejobCgroup, name)); err != nil {
+		// Deleted with the telejob cgroup by StopAll at the latest.
+		slog.Error("cannot delete owner cgroup", "owner", owner, "err", err)
+	}
+}
+
+// adjustMemoryMin raises or lowers the memory guarantee of the telejob cgroup
+// and of the owner cgroup with the given name, if not empty, by the given
+// guarantee of a job. Failures are logged, as they only weaken the job's
+// guarantee. It must be called with ownerMutex held.
+func (c *Controller) adjustMemoryMin(ownerName string, kib uint64, raise bool) {
+	if kib == 0 {
+		return
+	}
+	adjust := func(total uint64, cgroup string) uint64 {
+		if raise {
+			total += kib
+		} else {
+			total -= kib
+		}
+		if err := writeCgroupFile(cgroup, "memory.min", fmt.Sprintf("%d\n", total*1024)); err != nil {
+			slog.Error("cannot set memory guarantee of parent cgroup", "cgroup", cgroup, "err", err)
+		}
+		return total
+	}
+	c.memoryMinKiB = adjust(c.memoryMinKiB, c.telejobCgroup)
+	if ownerName == "" {
+		return
+	}
+	if c.ownerMemoryMin == nil {
+		c.ownerMemoryMin = map[string]uint64{}
+	}
+	c.ownerMemoryMin[ownerName] = adjust(c.ownerMemoryMin[ownerName], filepath.Join(c.telejobCgroup, ownerName))
+	if c.ownerMemoryMin[ownerName] == 0 {
+		delete(c.ownerMemoryMin, ownerName)
+	}
+}
+
+// deleteOwnerCgroups deletes the owner cgroups left behind, for example by
+// job starts whose cgroup setup was aborted by a timeout.
+func (c *Controller) deleteOwnerCgroups() error {
+	entries, err := os.ReadDir(c.telejobCgroup)
+	if err != nil {
+		return fmt.Errorf("cannot read telejob cgroup %q: %w", c.telejobCgroup, err)
+	}
+	var errs []error
+	for _, entry := range entries {
+		if entry.IsDir() {
+			errs = append(errs, deleteCgroup(filepath.Join(c.telejobCgroup, entry.Name())))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// retryAfter returns the average duration of recently finished jobs, or
+// defaultRetryAfter if no job has finished yet. It must be called with
+// c.slotMutex held.
+func (c *Controller) retryAfter() time.Duration {
+	if len(c.recentDurations) == 0 {
+		return defaultRetryAfter
+	}
+	var sum time.Duration
+	for _, d := range c.recentDurations {
+		sum += d
+	}
+	return sum / time.Duration(len(c.recentDurations))
+}
+
 // Stop stops the job with the given id.
 //
 // It terminates the job's process and all its child processes by first sending
 // a SIGKILL signal directly to the job's process and then to all its child
-// processes via the job's cgroup.kill file.
-func (c *Controller) Stop(owner, id string) error {
+// processes via the job's cgroup.kill file. On kernels without cgroup.kill,
+// before Linux 5.14, the child processes listed in the job's cgroup.procs file
+// are sent SIGKILL one by one instead.
+//
+// With [WithSignal], the given signal is sent to the job's process instead,
+// for example SIGINT for tools that clean up on interactive cancellation. The
+// job's child processes are only killed once the job's process has exited.
+// Without WithSignal, a controller with [WithStopSchedule] sends the first
+// signal of the schedule and escalates through the remaining steps in the
+// background until the job has terminated.
+//
+// Stopping a job that has already terminated has no effect and returns an
+// error wrapping [ErrJobNotRunning], so that callers can tell it apart from a
+// successful stop.
+func (c *Controller) Stop(owner, id string, opts ...StopOption) error {
+	sc, err := newStopConfig(opts, c.stopSchedule)
+	if err != nil {
+		return err
+	}
+	job, err := c.get(owner, id)
+	if err != nil {
+		return err
+	}
+	return job.escalate(sc.steps)
+}
+
+// Resume resumes the job with the given id, started paused with
+// StartOptions.Paused, if it belongs to the given owner. The job's cgroup is
+// thawed and its command is executed. Resuming a job that is not paused, or
+// has been resumed already, fails with an error wrapping [ErrJobNotPaused].
+func (c *Controller) Resume(owner, id string) error {
+	job, err := c.get(owner, id)
+	if err != nil {
+		return err
+	}
+	return job.resume()
+}
+
+// WriteInput writes data to the terminal of the job with the given id, as if
+// typed by a user, if the job belongs to the given owner. Only jobs started
+// with StartOptions.Tty have a terminal, writing to other jobs fails with an
+// error wrapping [ErrNoTerminal]. Writing blocks while the terminal's input
+// buffer is full, until the job reads its input or terminates.
+func (c *Controller) WriteInput(owner, id string, data []byte) error {
 	job, err := c.get(owner, id)
 	if err != nil {
 		return err
 	}
-	return job.stop()
+	return job.writeInput(data)
+}
+
+// AttachInput claims the terminal input of the job with the given id, if the
+// job belongs to the given owner, and returns a writer to it, for interactive
+// sessions that send input for a while. Closing the writer releases the
+// claim. Only one writer may claim a job's input at a time: while it is
+// claimed, AttachInput and WriteInput fail with an error wrapping
+// [ErrInputAttached]. Like WriteInput, it fails with an error wrapping
+// [ErrNoTerminal] for jobs without terminal.
+func (c *Controller) AttachInput(owner, id string) (io.WriteCloser, error) {
+	job, err := c.get(owner, id)
+	if err != nil {
+		return nil, err
+	}
+	return job.attachInput()
+}
+
+// ForceStop stops the job with the given id like Stop, regardless of the
+// job's owner. It is a break-glass path for operators and must only be called
+// after authorizing the operator. Every call is audit-logged with the operator
+// and the job's owner. Like Stop, it fails with an error wrapping
+// [ErrJobNotRunning] if the job has already terminated.
+func (c *Controller) ForceStop(operator, id string) error {
+	c.mutex.Lock()
+	job, ok := c.jobs[id]
+	c.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrJobNotFound, id)
+	}
+	slog.Warn("force-stopping job", "operator", operator, "id", id, "owner", job.owner)
+	return job.signal(syscall.SIGKILL)
 }
 
 // Status retrieves the status of the job with the given ID.
@@ -140,6 +1026,121 @@ func (c *Controller) Status(owner, id string) (Status, error) {
 	return job.getStatus(), nil
 }
 
+// StatusBatch returns the statuses of the jobs with the given IDs by ID, for
+// clients such as dashboards querying many jobs at once. The jobs are looked
+// up holding the controller's mutex once. Like with Status, looking up a job
+// fails with an error wrapping [ErrJobNotFound] or [ErrUnauthorized]; such
+// per-job errors are reported in the job's StatusResult and do not affect the
+// other jobs.
+func (c *Controller) StatusBatch(owner string, ids []string) map[string]StatusResult {
+	jobs := make(map[string]*job, len(ids))
+	results := make(map[string]StatusResult, len(ids))
+	c.mutex.Lock()
+	for _, id := range ids {
+		job, ok := c.jobs[id]
+		switch {
+		case !ok:
+			results[id] = StatusResult{Err: fmt.Errorf("%w: %q", ErrJobNotFound, id)}
+		case job.owner != owner:
+			results[id] = StatusResult{Err: fmt.Errorf("%w: owner %q does not have access to job %q", ErrUnauthorized, owner, id)}
+		default:
+			jobs[id] = job
+		}
+	}
+	c.mutex.Unlock()
+	// Statuses of running jobs are read from their cgroups, which must not
+	// block other callers of the controller.
+	for id, job := range jobs {
+		results[id] = StatusResult{Status: job.getStatus()}
+	}
+	return results
+}
+
+// Stats returns a snapshot of the resource usage of the running job with the
+// given ID, read from its cgroup in a single pass. It returns an error
+// wrapping [ErrJobNotRunning] if the job has terminated, as its cgroup is
+// removed on termination.
+func (c *Controller) Stats(owner, id string) (JobStats, error) {
+	job, err := c.get(owner, id)
+	if err != nil {
+		return JobStats{}, err
+	}
+	return job.stats()
+}
+
+// List returns the statuses of all jobs of the given owner, running and
+// terminated, ordered by job ID. Like [Controller.Status], it returns
+// concurrency-safe copies.
+func (c *Controller) List(owner string) []Status {
+	c.mutex.Lock()
+	var jobs []*job
+	for _, job := range c.jobs {
+		if job.owner == owner {
+			jobs = append(jobs, job)
+		}
+	}
+	c.mutex.Unlock()
+	statuses := make([]Status, 0, len(jobs))
+	for _, job := range jobs {
+		statuses = append(statuses, job.getStatus())
+	}
+	// IDs are decimal numbers without leading zeros, shorter IDs are smaller.
+	slices.SortFunc(statuses, func(a, b Status) int {
+		return cmp.Or(cmp.Compare(len(a.ID), len(b.ID)), strings.Compare(a.ID, b.ID))
+	})
+	return statuses
+}
+
+// DebugStats returns internal counters of the controller, such as the number
+// of log readers waiting for new log data. Like AggregateUsage, it is meant
+// for operators, for example to verify that log readers are cleaned up.
+func (c *Controller) DebugStats() DebugStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var stats DebugStats
+	for _, job := range c.jobs {
+		if job.dispatcher == nil {
+			continue // output discarded.
+		}
+		stats.LogDispatchers++
+		stats.LogFollowers += int(job.dispatcher.followerCount.Load())
+	}
+	return stats
+}
+
+// AggregateUsage returns the resource usage summed over all running jobs of
+// all owners, as accounted by their cgroups. Like ForceStop, it is meant for
+// operators. Jobs terminating while their usage is read are skipped.
+func (c *Controller) AggregateUsage() (Usage, error) {
+	c.mutex.Lock()
+	jobs := slices.Collect(maps.Values(c.jobs))
+	c.mutex.Unlock()
+	var usage Usage
+	for _, job := range jobs {
+		if !job.isRunning() {
+			continue
+		}
+		memory, err := readCgroupUint(job.cgroup, "memory.current")
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Usage{}, err
+		}
+		cpu, err := readCPUUsage(job.cgroup)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Usage{}, err
+		}
+		usage.RunningJobs++
+		usage.MemoryBytes += memory
+		usage.CPU += cpu
+	}
+	return usage, nil
+}
+
 // LogsReader returns an io.Reader for reading logs of the job with the given
 // ID.
 //
@@ -147,12 +1148,29 @@ func (c *Controller) Status(owner, id string) (Status, error) {
 // the end of the log stream is reached (io.EOF) and the job is terminated, or
 // the provided context is cancelled. The maximum log chunk size is determined
 // by size of the buffer passed to the Read method.
-func (c *Controller) LogsReader(ctx context.Context, id, owner string) (io.Reader, error) {
-	job, err := c.get(id, owner)
+//
+// If the controller was created with [WithMaxLogBytes], the oldest log data
+// may have been discarded. Use the [FromStart] option to fail with
+// [ErrLogTruncated] rather than skipping discarded data. Use the [FollowOnly]
+// option to skip all data written before the reader is created. Use the [FromOffset]
+// option to continue after the data read by a previous reader, the [Tail]
+// option to read only the end of the log and the [NoFollow] option to stop at
+// the end of the log written so far.
+//
+// The returned reader implements [StreamReader] to report whether the data of
+// each Read was written to the job's stdout or stderr, and its offset.
+//
+// Logs of jobs whose output is discarded, see StartOptions.DiscardOutput,
+// cannot be read and fail with [ErrNoOutput].
+func (c *Controller) LogsReader(ctx context.Context, owner, id string, opts ...LogsOption) (io.Reader, error) {
+	job, err := c.get(owner, id)
 	if err != nil {
 		return nil, err
 	}
-	return job.newLogReader(ctx), nil
+	if job.dispatcher == nil {
+		return nil, fmt.Errorf("%w: output of job %q is discarded", ErrNoOutput, id)
+	}
+	return job.newLogReader(ctx, opts...), nil
 }
 
 // StopAll stops all running jobs and cleans up the controller's resources.
@@ -163,39 +1181,142 @@ func (c *Controller) LogsReader(ctx context.Context, id, owner string) (io.Reade
 //
 // Since StopAll is intended for shutdown, it prioritizes completeness over
 // latency and holds the controller's lock for the duration of the process.
+//
+// With [WithStopAllTimeout], it waits for the jobs to terminate for a limited
+// time only and reports jobs that have not terminated by then with an error
+// wrapping [ErrStopTimeout]. The cgroups and the tee writer, see
+// [WithTeeOutput], are then left in place, as stuck jobs may still use them.
+//
+// If any job cannot be stopped or the parent cgroup cannot be removed, it
+// returns a [*StopAllError] listing the stopped, failed and stuck jobs.
+// Further calls to StopAll return the same error.
 func (c *Controller) StopAll() error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	if c.shutDown {
 		slog.Info("already shut down")
-		return nil
+		return c.stopAllErr
 	}
 	c.shutDown = true
 
-	errs := []error{}
-	for _, job := range c.jobs {
+	result := &StopAllError{Failed: map[string]error{}}
+	for id, job := range c.jobs {
 		if job.isRunning() {
 			if err := job.stop(); err != nil {
-				errs = append(errs, err)
+				result.Failed[id] = err
+				result.errs = append(result.errs, err)
+			} else {
+				result.Stopped = append(result.Stopped, id)
 			}
 		}
 	}
-	c.wg.Wait() // wait for all jobs to terminate.
+	slices.Sort(result.Stopped)
+	if stuck := c.waitJobs(); len(stuck) > 0 {
+		result.Stuck = stuck
+		result.errs = append(result.errs, fmt.Errorf("%w: jobs %q still running after %v", ErrStopTimeout, stuck, c.stopAllTimeout))
+		c.stopAllErr = result
+		return result
+	}
+	if c.ownerCgroups {
+		if err := c.deleteOwnerCgroups(); err != nil {
+			result.errs = append(result.errs, err)
+		}
+	}
+	if c.tee != nil {
+		c.tee.close()
+	}
 	if err := deleteCgroup(c.telejobCgroup); err != nil {
-		errs = append(errs, err)
+		result.errs = append(result.errs, err)
 	}
-	if len(errs) > 0 {
-		return errors.Join(errs...)
+	if len(result.errs) > 0 {
+		c.stopAllErr = result
+		return result
 	}
 	return nil
 }
 
+// waitJobs waits for all jobs to terminate, for at most the timeout set with
+// WithStopAllTimeout. Once the timeout has expired, it kills the processes of
+// the whole telejob cgroup subtree and waits for at most stopAllKillGrace. It
+// returns the sorted IDs of the jobs still running then. It must be called
+// with the mutex held.
+//
+// If jobs are stuck, the goroutine waiting for them is leaked until they
+// terminate, which is accepted as StopAll is only called on shutdown.
+func (c *Controller) waitJobs() []string {
+	if c.stopAllTimeout <= 0 {
+		c.wg.Wait()
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(c.stopAllTimeout):
+	}
+	slog.Warn("jobs did not terminate in time, killing all job cgroups", "timeout", c.stopAllTimeout, "cgroup", c.telejobCgroup)
+	if err := c.killAllCgroups(); err != nil {
+		slog.Error("cannot kill job cgroups", "err", err)
+	}
+	select {
+	case <-done:
+		return nil
+	case <-time.After(stopAllKillGrace):
+	}
+	var stuck []string
+	for id, job := range c.jobs {
+		if job.isRunning() {
+			stuck = append(stuck, id)
+		}
+	}
+	slices.Sort(stuck)
+	return stuck
+}
+
+// killAllCgroups kills the processes of all cgroups below the telejob cgroup
+// with the controller's kill strategy.
+func (c *Controller) killAllCgroups() error {
+	if c.kill == killCgroupProcs {
+		return killCgroupTreeProcs(c.telejobCgroup)
+	}
+	// Writing the telejob cgroup's cgroup.kill kills its whole subtree.
+	return killCgroup(c.telejobCgroup, c.kill)
+}
+
+// newID assigns the next job ID and records it as starting until startDone
+// is called, so that ReapOrphans keeps the job's cgroup while the job is
+// being started.
+func (c *Controller) newID() string {
+	id := strconv.FormatUint(c.maxID.Add(1), 10)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.starting[id] = true
+	return id
+}
+
+// startDone records that the start of the job with the given ID has
+// finished, see newID.
+func (c *Controller) startDone(id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.starting, id)
+}
+
 // add adds a job to the controller's job map. It is synchronized to ensure safe
-// concurrent access to the job map.
-func (c *Controller) add(id string, job *job) {
+// concurrent access to the job map. It fails with ErrShutdown if StopAll has
+// been called, in which case the job is not added.
+func (c *Controller) add(id string, job *job) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	if c.shutDown {
+		return fmt.Errorf("cannot start command: %w", ErrShutdown)
+	}
 	c.jobs[id] = job
+	return nil
 }
 
 // get retrieves a job from the controller by ID. It is synchronized to ensure
@@ -214,6 +1335,20 @@ func (c *Controller) get(owner, id string) (*job, error) {
 	return job, nil
 }
 
+// findRunning returns the ID of a running job of the given owner with the
+// given labels, if any. It is synchronized to ensure safe concurrent access to
+// the job map.
+func (c *Controller) findRunning(owner string, labels map[string]string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for id, job := range c.jobs {
+		if job.owner == owner && maps.Equal(job.status.Labels, labels) && job.isRunning() {
+			return id, true
+		}
+	}
+	return "", false
+}
+
 // isShutDown reports whether the controller has been shut down. It is
 // synchronized to ensure safe concurrent access to the shutdown status.
 func (c *Controller) isShutDown() bool {
@@ -222,29 +1357,286 @@ func (c *Controller) isShutDown() bool {
 	return c.shutDown
 }
 
+// validateCredential checks that the configured credential's supplementary
+// groups are contained in the allowed groups, if any are configured.
+func (c *Controller) validateCredential() error {
+	if c.credential == nil || c.allowedGroups == nil {
+		return nil
+	}
+	for _, group := range c.credential.Groups {
+		if !slices.Contains(c.allowedGroups, group) {
+			return fmt.Errorf("%w: supplementary group %d not allowed", ErrCredential, group)
+		}
+	}
+	return nil
+}
+
+// validateRootfs checks that the configured root filesystem, if any, is an
+// absolute path to a directory and that neither the given limits nor the
+// controller's options require the exec helper, which is not available within
+// the root.
+func (c *Controller) validateRootfs(limits Limits) error {
+	if c.rootfs == "" {
+		return nil
+	}
+	if !filepath.IsAbs(c.rootfs) {
+		return fmt.Errorf("%w: %q is not an absolute path", ErrRootfs, c.rootfs)
+	}
+	info, err := os.Stat(c.rootfs)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRootfs, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %q is not a directory", ErrRootfs, c.rootfs)
+	}
+	if len(limits.Rlimits) > 0 {
+		return fmt.Errorf("%w: rlimits are not supported with a rootfs", ErrRootfs)
+	}
+	if c.umask != nil {
+		return fmt.Errorf("%w: a umask is not supported with a rootfs", ErrRootfs)
+	}
+	if c.closeFDs {
+		return fmt.Errorf("%w: closing file descriptors is not supported with a rootfs", ErrRootfs)
+	}
+	if c.seccompPath != "" {
+		return fmt.Errorf("%w: seccomp profiles are not supported with a rootfs", ErrRootfs)
+	}
+	return nil
+}
+
+// validateArgv0 checks that the command of a job with argv[0] override is the
+// absolute path of an executable regular file, within the root filesystem if
+// one is configured.
+func (c *Controller) validateArgv0(opts StartOptions) error {
+	if opts.Argv0 == "" {
+		return nil
+	}
+	if len(c.commandWrapper) > 0 {
+		return fmt.Errorf("%w: argv[0] override is not supported with a command wrapper", ErrCommand)
+	}
+	if !filepath.IsAbs(opts.Command) {
+		return fmt.Errorf("%w: command %q must be an absolute path with argv[0] override", ErrCommand, opts.Command)
+	}
+	info, err := os.Stat(filepath.Join(c.rootfs, opts.Command))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCommand, err)
+	}
+	if !info.Mode().IsRegular() || info.Mode()&0o111 == 0 {
+		return fmt.Errorf("%w: %q is not an executable file", ErrCommand, opts.Command)
+	}
+	return nil
+}
+
 // newTelejobCgroup creates a new parent cgroup for telejob with the CPU, I/O,
-// and memory resource controllers enabled. It creates the cgroup directory and
-// writes "+cpu +io +memory" to the cgroup.subtree_control file to enable the
-// necessary controllers.
-func newTelejobCgroup(telejobCgroup string) error {
-	err := os.Mkdir(telejobCgroup, 0o750)
+// and memory resource controllers enabled, as far as available. It creates the
+// cgroup directory and enables the controllers with enableSubtreeControllers.
+// It returns the enabled controllers, or nil if the available controllers are
+// unknown. If reuse is set, an existing cgroup is reused rather than failing.
+func newTelejobCgroup(telejobCgroup string, reuse bool) ([]string, error) {
+	err := cgroupMkdir(telejobCgroup, 0o750)
+	if err != nil && !(reuse && errors.Is(err, fs.ErrExist)) {
+		return nil, cgroupMkdirError("telejob", telejobCgroup, err)
+	}
+	return enableSubtreeControllers(telejobCgroup)
+}
+
+// cgroupMkdirError returns the error for a failure to create the cgroup
+// directory of the given kind, such as "job". If the cgroup filesystem is
+// mounted read-only, as on some hardened hosts, the error wraps ErrCgroupReadOnly
+// and explains how to provide a writable cgroup instead of only reporting the
+// failed system call.
+func cgroupMkdirError(kind, cgroup string, err error) error {
+	if errors.Is(err, syscall.EROFS) {
+		return fmt.Errorf("%w: cannot create new %s cgroup %q: %w: delegate a writable cgroup v2 subtree to the server's user and select it with WithCgroup (--cgroup)", ErrCgroupReadOnly, kind, cgroup, err)
+	}
+	return fmt.Errorf("cannot create new %s cgroup %q: %w", kind, cgroup, err)
+}
+
+// newOwnerCgroup creates the cgroup of an owner's jobs, see WithOwnerCgroups,
+// with the controllers of job cgroups enabled. An existing cgroup, left behind
+// by an aborted job start, is reused.
+func newOwnerCgroup(cgroup string) error {
+	if err := os.Mkdir(cgroup, 0o750); err != nil && !errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%w: cannot create new owner cgroup %q: %w", ErrCgroup, cgroup, err)
+	}
+	if _, err := enableSubtreeControllers(cgroup); err != nil {
+		deleteCgroupOnErr(cgroup, err)
+		return fmt.Errorf("%w: %w", ErrCgroup, err)
+	}
+	return nil
+}
+
+// enableSubtreeControllers enables the jobControllers for the
+// child cgroups of the given cgroup, skipping controllers that are not listed
+// in its cgroup.controllers file, and returns the enabled controllers. If the
+// cgroup.controllers file does not exist, as outside of a cgroup v2 hierarchy,
+// all controllers are enabled and nil is returned.
+func enableSubtreeControllers(cgroup string) ([]string, error) {
+	available, err := readControllers(cgroup)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	var enabled []string
+	for _, name := range jobControllers {
+		if available == nil || slices.Contains(available, name) {
+			enabled = append(enabled, name)
+		}
+	}
+	if len(enabled) > 0 {
+		controlFile := filepath.Join(cgroup, "cgroup.subtree_control")
+		content := "+" + strings.Join(enabled, " +")
+		if err := os.WriteFile(controlFile, []byte(content), 0o600); err != nil {
+			return nil, fmt.Errorf("cannot configure cgroup subtree control %q: %w", controlFile, err)
+		}
+	}
+	if available == nil {
+		return nil, nil
+	}
+	if enabled == nil {
+		enabled = []string{} // known to be none
+	}
+	return enabled, nil
+}
+
+// readControllers reads the controllers available in the given cgroup from
+// its cgroup.controllers file.
+func readControllers(cgroup string) ([]string, error) {
+	absFilename := filepath.Join(cgroup, "cgroup.controllers")
+	b, err := os.ReadFile(absFilename) //nolint:gosec // G304: Potential file inclusion via variable
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot read %q: %w", ErrCgroup, absFilename, err)
+	}
+	return strings.Fields(string(b)), nil
+}
+
+// AvailableControllers returns the cgroup controllers available in the
+// telejob cgroup, such as "cpu", "io", "memory" and "pids", as delegated by
+// its parent cgroup. Callers can check it to know which limits are enforced
+// before starting a job. It returns nil if the controllers cannot be read.
+func (c *Controller) AvailableControllers() []string {
+	controllers, err := readControllers(c.telejobCgroup)
 	if err != nil {
-		return fmt.Errorf("cannot create new telejob cgroup %q: %w", telejobCgroup, err)
+		slog.Error("cannot read available cgroup controllers", "err", err)
+		return nil
 	}
-	controlFile := filepath.Join(telejobCgroup, "cgroup.subtree_control")
-	if err := os.WriteFile(controlFile, []byte("+cpu +io +memory"), 0o600); err != nil {
-		return fmt.Errorf("cannot configure cgroup subtree control %q: %w", controlFile, err)
+	return controllers
+}
+
+// validateMemoryLimits checks that the memory guarantee of the given limits
+// does not exceed their hard memory limit, which the kernel would accept but
+// could never honor.
+func validateMemoryLimits(limits Limits) error {
+	if limits.MemoryKiB > 0 && limits.MemoryMinKiB > limits.MemoryKiB {
+		return fmt.Errorf("%w: memory minimum of %d KiB exceeds memory limit of %d KiB", ErrLimits, limits.MemoryMinKiB, limits.MemoryKiB)
 	}
 	return nil
 }
 
+// supportedLimits returns the given limits without the limits of controllers
+// that are not enabled for job cgroups, logging a warning for the skipped
+// controllers. With WithStrictControllers, it fails with an error wrapping
+// ErrController instead.
+func (c *Controller) supportedLimits(limits Limits) (Limits, error) {
+	if c.controllers == nil {
+		return limits, nil
+	}
+	var missing []string
+	unavailable := func(name string, limited bool) bool {
+		if !limited || slices.Contains(c.controllers, name) {
+			return false
+		}
+		missing = append(missing, name)
+		return true
+	}
+	if unavailable("cpu", limits.CPUs > 0) {
+		limits.CPUs = 0
+	}
+	if unavailable("io", len(limits.IO) > 0) {
+		limits.IO = nil
+	}
+	if unavailable("memory", limits.MemoryKiB > 0 || limits.MemoryHighKiB > 0 || limits.MemoryMinKiB > 0 || limits.OOMGroup) {
+		limits.MemoryKiB, limits.MemoryHighKiB, limits.MemoryMinKiB, limits.OOMGroup = 0, 0, 0, false
+	}
+	if len(missing) == 0 {
+		return limits, nil
+	}
+	if c.strictCtrls {
+		return Limits{}, fmt.Errorf("%w: limits require %s", ErrController, strings.Join(missing, ", "))
+	}
+	slog.Warn("skipping limits of unavailable cgroup controllers", "controllers", missing)
+	return limits, nil
+}
+
+// ownerCgroupName returns the name of the cgroup of the given owner's jobs.
+// ASCII letters, digits, '-' and '_' are kept, all other characters are
+// replaced by '_', so that the name is a single path component that cannot
+// clash with cgroup interface files such as "cgroup.procs", which all contain
+// a dot. Names are truncated to maxOwnerCgroupName bytes, the empty name is
+// replaced by "_". Distinct owners may share a cgroup name.
+func ownerCgroupName(owner string) string {
+	if owner == "" {
+		return "_"
+	}
+	name := []byte(owner[:min(len(owner), maxOwnerCgroupName)])
+	for i, b := range name {
+		if !('a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || b == '-' || b == '_') {
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
+
+// openJobCgroup creates the job cgroup with newCgroup and opens it for use
+// as the cgroup file descriptor of the job's process.
+//
+// Cgroup filesystem operations cannot be interrupted and may hang on a
+// degraded host. They therefore run in a separate goroutine. If ctx is done
+// first, openJobCgroup returns an error wrapping [ErrCgroup] and the cause of
+// ctx, while the goroutine deletes the partially set up cgroup once the
+// operations have returned.
+func openJobCgroup(ctx context.Context, cgroup string, limits Limits, newCgroup func(string, Limits) error) (*os.File, error) {
+	type result struct {
+		file *os.File
+		err  error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		if err := newCgroup(cgroup, limits); err != nil {
+			resultCh <- result{err: err}
+			return
+		}
+		file, err := os.Open(cgroup) //nolint:gosec // G304: Potential file inclusion via variable
+		if err != nil {
+			err = fmt.Errorf("%w: cannot open new job cgroup %q: %w", ErrCgroup, cgroup, err)
+			deleteCgroupOnErr(cgroup, err)
+		}
+		resultCh <- result{file: file, err: err}
+	}()
+	select {
+	case r := <-resultCh:
+		return r.file, r.err
+	case <-ctx.Done():
+		go func() {
+			r := <-resultCh
+			if r.err != nil {
+				return // already cleaned up
+			}
+			if err := r.file.Close(); err != nil {
+				slog.Error("cannot close aborted cgroup file", "cgroup", cgroup, "err", err)
+			}
+			deleteCgroupOnErr(cgroup, ctx.Err())
+		}()
+		return nil, fmt.Errorf("%w: setup of job cgroup %q aborted: %w", ErrCgroup, cgroup, context.Cause(ctx))
+	}
+}
+
 // newJobCgroup creates a new cgroup for a job with the specified resource
 // limits. The new cgroup is created as a subcgroup under the given parent
 // cgroup. It configures CPU, memory, and I/O limits based on the provided
 // Limits.
 func newJobCgroup(cgroup string, limits Limits) (err error) { //nolint:nonamedreturns // deliberate cleanup of error
-	if err := os.Mkdir(cgroup, 0o750); err != nil {
-		return fmt.Errorf("cannot create new job cgroup %q: %w", cgroup, err)
+	if err := cgroupMkdir(cgroup, 0o750); err != nil {
+		return cgroupMkdirError("job", cgroup, err)
 	}
 	defer func() { deleteCgroupOnErr(cgroup, err) }()
 	if limits.CPUs > 0 {
@@ -259,6 +1651,23 @@ func newJobCgroup(cgroup string, limits Limits) (err error) { //nolint:nonamedre
 			return err
 		}
 	}
+	if limits.MemoryHighKiB > 0 {
+		content := fmt.Sprintf("%d\n", limits.MemoryHighKiB*1024)
+		if err := writeCgroupFile(cgroup, "memory.high", content); err != nil {
+			return err
+		}
+	}
+	if limits.MemoryMinKiB > 0 {
+		content := fmt.Sprintf("%d\n", limits.MemoryMinKiB*1024)
+		if err := writeCgroupFile(cgroup, "memory.min", content); err != nil {
+			return err
+		}
+	}
+	if limits.OOMGroup {
+		if err := writeCgroupFile(cgroup, "memory.oom.group", "1\n"); err != nil {
+			return err
+		}
+	}
 	for _, ioLimit := range limits.IO {
 		if err := writeCgroupFile(cgroup, "io.max", ioLimit); err != nil {
 			return err
@@ -267,6 +1676,89 @@ func newJobCgroup(cgroup string, limits Limits) (err error) { //nolint:nonamedre
 	return nil
 }
 
+// readCgroupUint reads a cgroup file containing a single unsigned integer,
+// such as memory.current.
+func readCgroupUint(jobCgroup, filename string) (uint64, error) {
+	absFilename := filepath.Join(jobCgroup, filename)
+	b, err := os.ReadFile(absFilename) //nolint:gosec // G304: Potential file inclusion via variable
+	if err != nil {
+		return 0, fmt.Errorf("%w: cannot read %q: %w", ErrCgroup, absFilename, err)
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: cannot parse %q: %w", ErrCgroup, absFilename, err)
+	}
+	return n, nil
+}
+
+// readOptionalCgroupUint reads a cgroup interface file like readCgroupUint,
+// but reports a missing file as zero, for files that depend on the kernel
+// version or the enabled controllers, such as memory.peak.
+func readOptionalCgroupUint(jobCgroup, filename string) (uint64, error) {
+	n, err := readCgroupUint(jobCgroup, filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// readCPUUsage reads the CPU time consumed by the cgroup from the usage_usec
+// entry of its cpu.stat file.
+func readCPUUsage(jobCgroup string) (time.Duration, error) {
+	absFilename := filepath.Join(jobCgroup, "cpu.stat")
+	b, err := os.ReadFile(absFilename) //nolint:gosec // G304: Potential file inclusion via variable
+	if err != nil {
+		return 0, fmt.Errorf("%w: cannot read %q: %w", ErrCgroup, absFilename, err)
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		value, ok := strings.CutPrefix(strings.TrimSpace(line), "usage_usec ")
+		if !ok {
+			continue
+		}
+		usec, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: cannot parse %q: %w", ErrCgroup, absFilename, err)
+		}
+		return time.Duration(usec) * time.Microsecond, nil
+	}
+	return 0, fmt.Errorf("%w: no usage_usec in %q", ErrCgroup, absFilename)
+}
+
+// readIOStat reads the number of bytes read and written by the cgroup, summed
+// over all devices of its io.stat file. A missing io.stat file, as without
+// io controller, is reported as zero I/O.
+func readIOStat(jobCgroup string) (uint64, uint64, error) {
+	absFilename := filepath.Join(jobCgroup, "io.stat")
+	b, err := os.ReadFile(absFilename) //nolint:gosec // G304: Potential file inclusion via variable
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: cannot read %q: %w", ErrCgroup, absFilename, err)
+	}
+	// Each line holds the stats of a device, ex.:
+	// 8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+	var read, write uint64
+	for _, line := range strings.Split(string(b), "\n") {
+		for _, field := range strings.Fields(line) {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok || (key != "rbytes" && key != "wbytes") {
+				continue
+			}
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("%w: cannot parse %q: %w", ErrCgroup, absFilename, err)
+			}
+			if key == "rbytes" {
+				read += n
+			} else {
+				write += n
+			}
+		}
+	}
+	return read, write, nil
+}
+
 // writeCgroupFile writes a cgroup file with the given content. It takes the job's
 // cgroup directory, the filename of the cgroup filename, and the content to
 // write to the file.
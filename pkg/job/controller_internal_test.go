@@ -0,0 +1,578 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopAllPartialFailure(t *testing.T) {
+	t.Parallel()
+	running := exec.Command("sleep", "100")
+	require.NoError(t, running.Start())
+	defer func() { _ = running.Wait() }()
+
+	// A released process cannot be killed, making job.stop fail.
+	released, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, released.Release())
+
+	controller := &Controller{
+		jobs: map[string]*job{
+			"1": {status: Status{ID: "1", Running: true}, cmd: running},
+			"2": {status: Status{ID: "2", Running: true}, cmd: &exec.Cmd{Process: released}},
+			"3": {status: Status{ID: "3", Running: false}},
+		},
+		telejobCgroup: filepath.Join(t.TempDir(), "non-existent"),
+	}
+	err = controller.StopAll()
+	require.Error(t, err)
+	require.ErrorIs(t, err, ErrJobStop)
+	var stopAllErr *StopAllError
+	require.ErrorAs(t, err, &stopAllErr)
+	require.Equal(t, []string{"1"}, stopAllErr.Stopped)
+	require.Len(t, stopAllErr.Failed, 1)
+	require.ErrorIs(t, stopAllErr.Failed["2"], ErrJobStop)
+
+	// Further calls report the same error.
+	require.Same(t, stopAllErr, controller.StopAll())
+}
+
+func TestNewJobCgroupMemoryLimits(t *testing.T) {
+	t.Parallel()
+	// A regular directory stands in for the cgroup filesystem, so that only
+	// the written limit files are tested.
+	cgroup := filepath.Join(t.TempDir(), "job")
+	limits := Limits{MemoryKiB: 2000, MemoryHighKiB: 1000, MemoryMinKiB: 500}
+	require.NoError(t, newJobCgroup(cgroup, limits))
+	b, err := os.ReadFile(filepath.Join(cgroup, "memory.max")) //nolint:gosec // G304: Potential file inclusion via variable
+	require.NoError(t, err)
+	require.Equal(t, "2048000\n", string(b))
+	b, err = os.ReadFile(filepath.Join(cgroup, "memory.high")) //nolint:gosec // G304: Potential file inclusion via variable
+	require.NoError(t, err)
+	require.Equal(t, "1024000\n", string(b))
+	b, err = os.ReadFile(filepath.Join(cgroup, "memory.min")) //nolint:gosec // G304: Potential file inclusion via variable
+	require.NoError(t, err)
+	require.Equal(t, "512000\n", string(b))
+
+	_, err = os.Stat(filepath.Join(cgroup, "memory.oom.group"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	cgroup = filepath.Join(t.TempDir(), "job")
+	require.NoError(t, newJobCgroup(cgroup, Limits{MemoryHighKiB: 1000, OOMGroup: true}))
+	_, err = os.Stat(filepath.Join(cgroup, "memory.max"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	b, err = os.ReadFile(filepath.Join(cgroup, "memory.oom.group")) //nolint:gosec // G304: Potential file inclusion via variable
+	require.NoError(t, err)
+	require.Equal(t, "1\n", string(b))
+}
+
+//nolint:paralleltest // replaces cgroupMkdir.
+func TestReadOnlyCgroupFS(t *testing.T) {
+	cgroupMkdir = func(name string, _ os.FileMode) error {
+		return &os.PathError{Op: "mkdir", Path: name, Err: syscall.EROFS}
+	}
+	t.Cleanup(func() { cgroupMkdir = os.Mkdir })
+
+	cgroup := filepath.Join(t.TempDir(), "telejob")
+	_, err := NewController(WithCgroup(cgroup))
+	require.ErrorIs(t, err, ErrCgroupReadOnly)
+	require.ErrorIs(t, err, syscall.EROFS)
+	require.ErrorContains(t, err, "delegate a writable cgroup")
+
+	err = newJobCgroup(filepath.Join(cgroup, "1"), Limits{})
+	require.ErrorIs(t, err, ErrCgroupReadOnly)
+
+	cgroupMkdir = func(name string, _ os.FileMode) error {
+		return &os.PathError{Op: "mkdir", Path: name, Err: syscall.EACCES}
+	}
+	_, err = NewController(WithCgroup(cgroup))
+	require.ErrorIs(t, err, syscall.EACCES)
+	require.NotErrorIs(t, err, ErrCgroupReadOnly)
+}
+
+func TestValidateMemoryLimits(t *testing.T) {
+	t.Parallel()
+	require.NoError(t, validateMemoryLimits(Limits{MemoryKiB: 2000, MemoryMinKiB: 2000}))
+	require.NoError(t, validateMemoryLimits(Limits{MemoryMinKiB: 2000})) // no hard limit.
+	require.ErrorIs(t, validateMemoryLimits(Limits{MemoryKiB: 1000, MemoryMinKiB: 2000}), ErrLimits)
+
+	_, err := NewController(WithLimits(Limits{MemoryKiB: 1000, MemoryMinKiB: 2000}))
+	require.ErrorIs(t, err, ErrLimits)
+	c := &Controller{}
+	_, err = c.EffectiveLimits(StartOptions{Limits: &Limits{MemoryKiB: 1000, MemoryMinKiB: 2000}})
+	require.ErrorIs(t, err, ErrLimits)
+}
+
+//nolint:paralleltest // replaces the default logger.
+func TestHostLimitCheck(t *testing.T) {
+	kib, err := parseMemTotal(strings.NewReader("MemTotal:       16318412 kB\nMemFree:         1234 kB\n"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(16318412), kib)
+	_, err = parseMemTotal(strings.NewReader("MemFree: 1234 kB\n"))
+	require.Error(t, err)
+
+	absurd := Limits{MemoryKiB: 1 << 50}
+	_, err = NewController(WithCgroup(t.TempDir()+"/telejob"), WithHostLimitCheck(true), WithLimits(absurd))
+	require.ErrorIs(t, err, ErrLimits)
+
+	c := &Controller{host: &hostResources{cpus: 4, memoryKiB: 1 << 20}, hostLimitReject: true}
+	_, err = c.EffectiveLimits(StartOptions{Limits: &Limits{CPUs: 4, MemoryKiB: 1 << 20}})
+	require.NoError(t, err)
+	_, err = c.EffectiveLimits(StartOptions{Limits: &Limits{CPUs: 8}})
+	require.ErrorIs(t, err, ErrLimits)
+	_, err = c.EffectiveLimits(StartOptions{Limits: &absurd})
+	require.ErrorIs(t, err, ErrLimits)
+
+	var logs strings.Builder
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	c.hostLimitReject = false
+	limits, err := c.EffectiveLimits(StartOptions{Limits: &absurd})
+	require.NoError(t, err)
+	require.Equal(t, absurd, limits)
+	require.Contains(t, logs.String(), "limits exceed host resources")
+	require.Contains(t, logs.String(), "memory limit of 1125899906842624 KiB exceeds the host's 1048576 KiB")
+}
+
+func TestControllerReapOrphans(t *testing.T) {
+	t.Parallel()
+	// Regular directories stand in for the cgroup filesystem.
+	dir := filepath.Join(t.TempDir(), "telejob")
+	mkdirs := func(names ...string) {
+		t.Helper()
+		for _, name := range names {
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, name), 0o750))
+		}
+	}
+	mkdirs("5/nested")
+	_, err := NewController(WithCgroup(dir))
+	require.ErrorIs(t, err, fs.ErrExist)
+
+	c, err := NewController(WithCgroup(dir), WithReapOrphans())
+	require.NoError(t, err)
+	require.NoDirExists(t, filepath.Join(dir, "5"))
+
+	exited := make(chan struct{})
+	close(exited)
+	c.jobs["1"] = &job{exited: make(chan struct{})} // running
+	c.jobs["3"] = &job{exited: exited}              // terminated, cgroup left behind
+	c.starting["2"] = true
+	mkdirs("1", "2", "3", "7", "x")
+	reaped, err := c.ReapOrphans()
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "3"), filepath.Join(dir, "7"), filepath.Join(dir, "x")}, reaped)
+	require.DirExists(t, filepath.Join(dir, "1"))
+	require.DirExists(t, filepath.Join(dir, "2")) // job being started.
+
+	c.ownerCgroups = true
+	c.ownerJobs = map[string]int{"alice": 1}
+	mkdirs("alice/1", "alice/9", "bob/4")
+	reaped, err = c.ReapOrphans()
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "1"), filepath.Join(dir, "2"), filepath.Join(dir, "alice", "9"), filepath.Join(dir, "bob")}, reaped)
+	require.DirExists(t, filepath.Join(dir, "alice", "1"))
+}
+
+func TestControllerParentMemoryMin(t *testing.T) {
+	t.Parallel()
+	// A regular directory stands in for the telejob cgroup.
+	dir := t.TempDir()
+	c := &Controller{telejobCgroup: dir, ownerCgroups: true}
+	requireMemoryMin := func(cgroup string, want string) {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(cgroup, "memory.min")) //nolint:gosec // G304: test file.
+		require.NoError(t, err)
+		require.Equal(t, want, string(b))
+	}
+	alice, err := c.acquireParentCgroup("alice", 100)
+	require.NoError(t, err)
+	_, err = c.acquireParentCgroup("alice", 0)
+	require.NoError(t, err)
+	bob, err := c.acquireParentCgroup("bob", 50)
+	require.NoError(t, err)
+	requireMemoryMin(dir, "153600\n")
+	requireMemoryMin(alice, "102400\n")
+	requireMemoryMin(bob, "51200\n")
+
+	c.releaseParentCgroup("alice", 100)
+	requireMemoryMin(dir, "51200\n")
+	requireMemoryMin(alice, "0\n")
+	c.releaseParentCgroup("bob", 50)
+	requireMemoryMin(dir, "0\n")
+	require.Empty(t, c.ownerMemoryMin)
+}
+
+func TestControllerMaxJobs(t *testing.T) {
+	t.Parallel()
+	c := &Controller{jobs: map[string]*job{}, maxJobs: 2}
+	require.NoError(t, c.reserve())
+	require.NoError(t, c.reserve())
+	err := c.reserve()
+	var tooManyErr *TooManyJobsError
+	require.ErrorAs(t, err, &tooManyErr)
+	require.ErrorIs(t, err, ErrTooManyJobs)
+	require.Equal(t, 2, tooManyErr.Max)
+	require.Equal(t, defaultRetryAfter, tooManyErr.RetryAfter)
+
+	c.release(time.Second)
+	c.release(3 * time.Second)
+	for range recentDurationCount - 2 {
+		require.NoError(t, c.reserve())
+		c.release(2 * time.Second)
+	}
+	require.NoError(t, c.reserve())
+	require.NoError(t, c.reserve())
+	_, err = c.StartJob("owner1", StartOptions{Command: "true"})
+	require.ErrorAs(t, err, &tooManyErr)
+	require.Equal(t, 2*time.Second, tooManyErr.RetryAfter)
+}
+
+func TestControllerStatusBatch(t *testing.T) {
+	t.Parallel()
+	c := &Controller{jobs: map[string]*job{
+		"1": {owner: "owner1", status: Status{ID: "1", Command: "true"}},
+		"2": {owner: "owner2", status: Status{ID: "2", Command: "false"}},
+	}}
+	results := c.StatusBatch("owner1", []string{"1", "2", "3"})
+	require.Len(t, results, 3)
+	require.NoError(t, results["1"].Err)
+	require.Equal(t, "true", results["1"].Status.Command)
+	require.ErrorIs(t, results["2"].Err, ErrUnauthorized)
+	require.Empty(t, results["2"].Status.Command)
+	require.ErrorIs(t, results["3"].Err, ErrJobNotFound)
+
+	require.Empty(t, c.StatusBatch("owner1", nil))
+}
+
+func TestControllerStopAllTimeout(t *testing.T) {
+	t.Parallel()
+	// A regular directory without cgroup.kill stands in for the telejob
+	// cgroup. The job's wait never returns, like for a process stuck in
+	// uninterruptible sleep. Its output is teed, see WithTeeOutput.
+	cgroup := filepath.Join(t.TempDir(), "telejob")
+	require.NoError(t, os.Mkdir(cgroup, 0o700))
+	cmd := exec.Command("sleep", "100")
+	require.NoError(t, cmd.Start())
+	defer func() { _ = cmd.Wait() }()
+	c := &Controller{
+		jobs: map[string]*job{
+			"1": {owner: "owner1", cmd: cmd, status: Status{ID: "1", Running: true, ExitCode: NotTerminated}},
+		},
+		telejobCgroup:  cgroup,
+		kill:           killCgroupProcs,
+		stopAllTimeout: 50 * time.Millisecond,
+		tee:            newStartedOutputTee(io.Discard),
+	}
+	c.wg.Add(1)
+
+	start := time.Now()
+	err := c.StopAll()
+	require.Less(t, time.Since(start), 50*time.Millisecond+stopAllKillGrace+time.Second)
+	require.ErrorIs(t, err, ErrStopTimeout)
+	var stopAllErr *StopAllError
+	require.ErrorAs(t, err, &stopAllErr)
+	require.Equal(t, []string{"1"}, stopAllErr.Stuck)
+	require.Equal(t, []string{"1"}, stopAllErr.Stopped)
+
+	// The stuck job may still write output and use its cgroup.
+	_, err = newTeeWriter(c.tee, "1").Write([]byte("late\n"))
+	require.NoError(t, err)
+	require.DirExists(t, cgroup)
+	require.Same(t, stopAllErr, c.StopAll())
+}
+
+func TestControllerStartDuringStopAll(t *testing.T) {
+	t.Parallel()
+	cgroup := "/sys/fs/cgroup/telejob-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	c, err := NewController(WithCgroup(cgroup), WithTeeOutput(io.Discard))
+	require.NoError(t, err)
+	defer os.Remove(cgroup) //nolint:errcheck // best effort cleanup.
+	// StopAll runs while the job is set up, after the start has passed the
+	// shutdown check.
+	c.newCgroup = func(cgroup string, limits Limits) error {
+		err := newJobCgroup(cgroup, limits)
+		_ = c.StopAll()
+		return err
+	}
+	_, err = c.StartJob("owner1", StartOptions{Command: "sh", Args: []string{"-c", "echo late; sleep 100"}})
+	require.ErrorIs(t, err, ErrShutdown)
+	require.Empty(t, c.jobs)
+	require.Zero(t, c.running)
+}
+
+func TestControllerSlowCgroupSetup(t *testing.T) {
+	t.Parallel()
+	// A regular directory stands in for the telejob cgroup. The injected
+	// cgroup setup blocks until released, like on a degraded host.
+	release := make(chan struct{})
+	c := &Controller{
+		jobs:          map[string]*job{},
+		starting:      map[string]bool{},
+		telejobCgroup: t.TempDir(),
+		newCgroup: func(cgroup string, limits Limits) error {
+			<-release
+			return newJobCgroup(cgroup, limits)
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.StartJobContext(ctx, "owner1", StartOptions{Command: "true"})
+	require.ErrorIs(t, err, ErrCgroup)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+	require.Empty(t, c.jobs)
+	require.Empty(t, c.starting)
+	require.Zero(t, c.running)
+
+	c.setupTimeout = 50 * time.Millisecond
+	_, err = c.StartJob("owner1", StartOptions{Command: "true"})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The partially set up cgroups are deleted once the setup returns.
+	close(release)
+	require.Eventually(t, func() bool {
+		entries, err := os.ReadDir(c.telejobCgroup)
+		return err == nil && len(entries) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestOwnerCgroupName(t *testing.T) {
+	t.Parallel()
+	tests := map[string]string{
+		"alice":                  "alice",
+		"bob-1_x":                "bob-1_x",
+		"alice@example.com":      "alice_example_com",
+		"../etc":                 "___etc",
+		"cgroup.procs":           "cgroup_procs",
+		"CN=Zoë":                 "CN_Zo__",
+		"":                       "_",
+		strings.Repeat("a", 300): strings.Repeat("a", maxOwnerCgroupName),
+	}
+	for owner, want := range tests {
+		require.Equal(t, want, ownerCgroupName(owner), owner)
+	}
+}
+
+func TestBroadcaster(t *testing.T) {
+	t.Parallel()
+	var b broadcaster
+	b.publish(Event{Owner: "owner1"}) // no watchers
+	fast, slow := b.subscribe(), b.subscribe()
+	for i := range eventBufferSize {
+		b.publish(Event{Status: Status{ID: strconv.Itoa(i)}})
+		require.Equal(t, strconv.Itoa(i), (<-fast).Status.ID)
+	}
+	// slow has not received any event and its buffer is full.
+	b.publish(Event{Status: Status{ID: "last"}})
+	require.Equal(t, "last", (<-fast).Status.ID)
+	for range eventBufferSize {
+		<-slow
+	}
+	_, ok := <-slow
+	require.False(t, ok, "slow watcher must be disconnected")
+
+	b.unsubscribe(fast)
+	_, ok = <-fast
+	require.False(t, ok)
+	b.unsubscribe(fast) // no double close
+	b.unsubscribe(slow)
+	require.Empty(t, b.watchers)
+}
+
+func TestReadIOStat(t *testing.T) {
+	t.Parallel()
+	// A regular directory stands in for the job cgroup.
+	cgroup := t.TempDir()
+	read, write, err := readIOStat(cgroup)
+	require.NoError(t, err)
+	require.Zero(t, read)
+	require.Zero(t, write)
+
+	content := "8:0 rbytes=1000 wbytes=4096 rios=1 wios=1 dbytes=0 dios=0\n" +
+		"8:16 rbytes=24 wbytes=0 rios=1 wios=0 dbytes=0 dios=0\n"
+	require.NoError(t, os.WriteFile(filepath.Join(cgroup, "io.stat"), []byte(content), 0o600))
+	read, write, err = readIOStat(cgroup)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1024), read)
+	require.Equal(t, uint64(4096), write)
+
+	require.NoError(t, os.WriteFile(filepath.Join(cgroup, "io.stat"), []byte("8:0 rbytes=x\n"), 0o600))
+	_, _, err = readIOStat(cgroup)
+	require.ErrorIs(t, err, ErrCgroup)
+}
+
+func TestControllerAggregateUsage(t *testing.T) {
+	t.Parallel()
+	// Regular directories stand in for the job cgroups.
+	dir := t.TempDir()
+	c := &Controller{jobs: map[string]*job{}}
+	files := map[string][2]string{
+		"1": {"1000\n", "usage_usec 1500\nuser_usec 1000\nsystem_usec 500\n"},
+		"2": {"2000\n", "usage_usec 500\nuser_usec 500\nsystem_usec 0\n"},
+		"3": {"4000\n", "usage_usec 9000\n"},
+	}
+	for id, content := range files {
+		cgroup := filepath.Join(dir, id)
+		require.NoError(t, os.Mkdir(cgroup, 0o750))
+		require.NoError(t, os.WriteFile(filepath.Join(cgroup, "memory.current"), []byte(content[0]), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(cgroup, "cpu.stat"), []byte(content[1]), 0o600))
+		c.jobs[id] = &job{cgroup: cgroup, status: Status{ID: id, Running: id != "3"}}
+	}
+	c.jobs["4"] = &job{cgroup: filepath.Join(dir, "4"), status: Status{ID: "4", Running: true}} // cgroup already deleted.
+
+	usage, err := c.AggregateUsage()
+	require.NoError(t, err)
+	require.Equal(t, Usage{RunningJobs: 2, MemoryBytes: 3000, CPU: 2 * time.Millisecond}, usage)
+}
+
+func TestJobStats(t *testing.T) {
+	t.Parallel()
+	// A regular directory stands in for the job cgroup.
+	cgroup := t.TempDir()
+	j := &job{cgroup: filepath.Join(cgroup, "missing"), status: Status{ID: "1", Running: true}}
+	_, err := j.stats()
+	require.ErrorIs(t, err, ErrJobNotRunning) // cgroup deleted.
+
+	// Without memory and pids controllers, their files are missing.
+	j.cgroup = cgroup
+	stats, err := j.stats()
+	require.NoError(t, err)
+	require.Equal(t, JobStats{}, stats)
+
+	files := map[string]string{
+		"memory.current": "1000\n",
+		"cpu.stat":       "usage_usec 1500\nuser_usec 1000\nsystem_usec 500\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(cgroup, name), []byte(content), 0o600))
+	}
+	stats, err = j.stats()
+	require.NoError(t, err)
+	require.Equal(t, JobStats{MemoryCurrent: 1000, CPU: 1500 * time.Microsecond}, stats)
+
+	files = map[string]string{
+		"memory.peak":  "3000\n",
+		"io.stat":      "8:0 rbytes=10 wbytes=20 rios=1 wios=1 dbytes=0 dios=0\n",
+		"pids.current": "2\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(cgroup, name), []byte(content), 0o600))
+	}
+	stats, err = j.stats()
+	require.NoError(t, err)
+	want := JobStats{MemoryCurrent: 1000, MemoryPeak: 3000, CPU: 1500 * time.Microsecond, IOReadBytes: 10, IOWriteBytes: 20, PidsCurrent: 2}
+	require.Equal(t, want, stats)
+
+	j.status.Running = false
+	_, err = j.stats()
+	require.ErrorIs(t, err, ErrJobNotRunning)
+}
+
+func TestEnableSubtreeControllers(t *testing.T) {
+	t.Parallel()
+	// A regular directory stands in for a cgroup without io controller.
+	cgroup := t.TempDir()
+	controlFile := filepath.Join(cgroup, "cgroup.subtree_control")
+	enabled, err := enableSubtreeControllers(cgroup)
+	require.NoError(t, err)
+	require.Nil(t, enabled)            // unknown without cgroup.controllers
+	b, err := os.ReadFile(controlFile) //nolint:gosec // G304: Potential file inclusion via variable
+	require.NoError(t, err)
+	require.Equal(t, "+cpu +io +memory +pids", string(b))
+
+	require.NoError(t, os.WriteFile(filepath.Join(cgroup, "cgroup.controllers"), []byte("cpu memory pids\n"), 0o600))
+	enabled, err = enableSubtreeControllers(cgroup)
+	require.NoError(t, err)
+	require.Equal(t, []string{"cpu", "memory", "pids"}, enabled)
+	b, err = os.ReadFile(controlFile) //nolint:gosec // G304: Potential file inclusion via variable
+	require.NoError(t, err)
+	require.Equal(t, "+cpu +memory +pids", string(b))
+
+	require.NoError(t, os.WriteFile(filepath.Join(cgroup, "cgroup.controllers"), []byte("\n"), 0o600))
+	enabled, err = enableSubtreeControllers(cgroup)
+	require.NoError(t, err)
+	require.Empty(t, enabled)
+	require.NotNil(t, enabled)
+}
+
+func TestControllerUnavailableControllers(t *testing.T) {
+	t.Parallel()
+	// A regular directory stands in for a telejob cgroup without io
+	// controller. The injected cgroup setup records the applied limits.
+	var applied []Limits
+	c := &Controller{
+		jobs:          map[string]*job{},
+		starting:      map[string]bool{},
+		telejobCgroup: t.TempDir(),
+		controllers:   []string{"cpu", "memory"},
+		newCgroup: func(_ string, limits Limits) error {
+			applied = append(applied, limits)
+			return errors.New("no job cgroup")
+		},
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(c.telejobCgroup, "cgroup.controllers"), []byte("cpu memory pids\n"), 0o600))
+	require.Equal(t, []string{"cpu", "memory", "pids"}, c.AvailableControllers())
+
+	limits := &Limits{CPUs: 0.5, MemoryKiB: 2000, IO: []string{"252:1 rbps=1000000"}}
+	_, err := c.StartJob("owner1", StartOptions{Command: "true", Limits: limits})
+	require.Error(t, err)
+	require.Equal(t, []Limits{{CPUs: 0.5, MemoryKiB: 2000}}, applied)
+
+	c.strictCtrls = true
+	_, err = c.StartJob("owner1", StartOptions{Command: "true", Limits: limits})
+	require.ErrorIs(t, err, ErrController)
+	require.ErrorContains(t, err, "limits require io")
+	require.Len(t, applied, 1)
+
+	_, err = c.StartJob("owner1", StartOptions{Command: "true", Limits: &Limits{CPUs: 0.5}})
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrController)
+	require.Len(t, applied, 2)
+}
+
+func TestControllerEffectiveLimits(t *testing.T) {
+	t.Parallel()
+	c := &Controller{
+		limits:      Limits{CPUs: 1, MemoryKiB: 4000, Rlimits: map[string]uint64{"nofile": 64}},
+		controllers: []string{"cpu", "memory"},
+	}
+	limits, err := c.EffectiveLimits(StartOptions{Command: "true"})
+	require.NoError(t, err)
+	require.Equal(t, c.limits, limits)
+
+	// Overrides are merged field by field into the controller's limits;
+	// limits of unavailable controllers are dropped.
+	override := &Limits{
+		MemoryKiB:     2000,
+		IO:            []string{"252:1 rbps=1000000"},
+		Rlimits:       map[string]uint64{"nproc": 32},
+		MaxCPUSeconds: 10,
+	}
+	limits, err = c.EffectiveLimits(StartOptions{Command: "true", Limits: override})
+	require.NoError(t, err)
+	want := Limits{CPUs: 1, MemoryKiB: 2000, Rlimits: map[string]uint64{"nofile": 64, "nproc": 32}, MaxCPUSeconds: 10}
+	require.Equal(t, want, limits)
+	require.Equal(t, map[string]uint64{"nofile": 64}, c.limits.Rlimits)
+
+	c.strictCtrls = true
+	_, err = c.EffectiveLimits(StartOptions{Command: "true", Limits: override})
+	require.ErrorIs(t, err, ErrController)
+
+	_, err = c.EffectiveLimits(StartOptions{Command: "true", Limits: &Limits{Rlimits: map[string]uint64{"unknown": 1}}})
+	require.ErrorIs(t, err, ErrRlimit)
+	require.Empty(t, c.jobs)
+}
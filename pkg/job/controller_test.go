@@ -1,17 +1,30 @@
 package job_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/fs"
 	"math/rand/v2"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/juliaogris/telejob/pkg/job"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 )
 
 var jobCount = flag.Int("jobs", 100, "number of jobs to start") //nolint:gochecknoglobals
@@ -43,6 +56,8 @@ func TestControllerSimple(t *testing.T) {
 	err = controller.Stop("owner", id)
 	require.NoError(t, err)
 	requireEventuallyStopped(t, controller, "owner", id)
+	err = controller.Stop("owner", id)
+	require.ErrorIs(t, err, job.ErrJobNotRunning)
 
 	got, err = controller.Status("owner", id)
 	require.NoError(t, err)
@@ -146,6 +161,28 @@ func TestControllerWithManyJobs(t *testing.T) {
 	require.ErrorIs(t, err, fs.ErrNotExist)
 }
 
+func TestControllerOOMGroup(t *testing.T) {
+	t.Parallel()
+	limits := job.Limits{MemoryKiB: 16 * 1024, OOMGroup: true}
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithLimits(limits))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	// tail buffers its newline-free input until it is OOM killed. Without
+	// memory.oom.group, the shell would wait for the background sleep.
+	script := "sleep 100 & head -c 100000000 /dev/zero | tail; wait"
+	id, err := controller.Start("owner1", "sh", "-c", script)
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	status, err := controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.NotEqual(t, 0, status.ExitCode)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
 func TestControllerOwnerAccess(t *testing.T) {
 	t.Parallel()
 	cgroup := randCgroup()
@@ -215,19 +252,1256 @@ func TestControllerExitCode(t *testing.T) {
 	require.ErrorIs(t, err, fs.ErrNotExist)
 }
 
-func randCgroup() string {
-	//nolint:gosec // G404: Use of weak random number generator
-	return fmt.Sprintf("/sys/fs/cgroup/telejob-%d", rand.Uint64())
+func TestControllerShortLivedStderr(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	ids := make([]string, 20)
+	for i := range ids {
+		ids[i], err = controller.Start("owner1", "sh", "-c", "echo failed to start >&2; exit 3")
+		require.NoError(t, err)
+	}
+	for _, id := range ids {
+		requireEventuallyStopped(t, controller, "owner1", id)
+		status, err := controller.Status("owner1", id)
+		require.NoError(t, err)
+		require.Equal(t, 3, status.ExitCode)
+
+		// Read only after the job has exited.
+		r, err := controller.LogsReader(context.Background(), "owner1", id)
+		require.NoError(t, err)
+		b, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, "failed to start\n", string(b))
+		sr, ok := r.(job.StreamReader)
+		require.True(t, ok)
+		require.Equal(t, job.Stderr, sr.Stream())
+	}
+
+	err = controller.StopAll()
+	require.NoError(t, err)
 }
 
-func requireEventuallyStopped(t *testing.T, controller *job.Controller, owner, id string) {
+func TestControllerOutputDigest(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithOutputDigest())
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	id, err := controller.Start("owner1", "sh", "-c", "seq 1000; echo done >&2")
+	require.NoError(t, err)
+	logs := readLogs(t, controller, "owner1", id)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	status, err := controller.Status("owner1", id)
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte(logs))
+	require.Equal(t, hex.EncodeToString(sum[:]), status.OutputDigest)
+	require.True(t, strings.HasSuffix(logs, "1000\ndone\n"))
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerTeeOutput(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	var tee bytes.Buffer
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithTeeOutput(&tee))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	id, err := controller.Start("owner1", "sh", "-c", "echo hello; echo world")
+	require.NoError(t, err)
+	logs := readLogs(t, controller, "owner1", id)
+	require.Equal(t, "hello\nworld\n", logs)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+	// StopAll writes all buffered output, so reading tee is race free.
+	want := fmt.Sprintf("[%s] hello\n[%s] world\n", id, id)
+	require.Equal(t, want, tee.String())
+}
+
+func TestControllerDiscardOutput(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithOutputDigest())
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	id, err := controller.StartJob("owner1", job.StartOptions{Command: "sh", Args: []string{"-c", "echo hello; echo world >&2; exit 3"}, DiscardOutput: true})
+	require.NoError(t, err)
+	require.Zero(t, controller.DebugStats().LogDispatchers)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	status, err := controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.Equal(t, 3, status.ExitCode)
+	require.Zero(t, status.MaxBufferedLogBytes)
+	require.Empty(t, status.OutputDigest)
+	_, err = controller.LogsReader(context.Background(), "owner1", id)
+	require.ErrorIs(t, err, job.ErrNoOutput)
+
+	// Output of other jobs is still captured.
+	id, err = controller.Start("owner1", "echo", "hello")
+	require.NoError(t, err)
+	require.Equal(t, "hello\n", readLogs(t, controller, "owner1", id))
+	require.Equal(t, 1, controller.DebugStats().LogDispatchers)
+	require.NoError(t, controller.StopAll())
+
+	// WithDiscardOutput discards the output of all jobs.
+	cgroup = randCgroup()
+	controller, err = job.NewController(job.WithCgroup(cgroup), job.WithDiscardOutput())
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+	id, err = controller.Start("owner1", "echo", "hello")
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	_, err = controller.LogsReader(context.Background(), "owner1", id)
+	require.ErrorIs(t, err, job.ErrNoOutput)
+	require.NoError(t, controller.StopAll())
+}
+
+func TestControllerEventLog(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	var buf bytes.Buffer
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithEventLog(&buf))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	failed, err := controller.Start("owner1", "sh", "-c", "exit 3")
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", failed)
+	stopped, err := controller.Start("owner2", "sleep", "10")
+	require.NoError(t, err)
+	require.NoError(t, controller.Stop("owner2", stopped))
+	requireEventuallyStopped(t, controller, "owner2", stopped)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+	// StopAll waits for all jobs, so reading the event log is race free.
+	var events []job.LifecycleEvent
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e job.LifecycleEvent
+		require.NoError(t, dec.Decode(&e))
+		events = append(events, e)
+	}
+	require.Len(t, events, 4)
+	require.Equal(t, job.LifecycleStarted, events[0].Type)
+	require.Equal(t, failed, events[0].ID)
+	require.Equal(t, "owner1", events[0].Owner)
+	require.Equal(t, "sh", events[0].Command)
+	require.Nil(t, events[0].ExitCode)
+	require.Equal(t, job.LifecycleFailed, events[1].Type)
+	require.Equal(t, failed, events[1].ID)
+	require.Equal(t, 3, *events[1].ExitCode)
+	require.False(t, events[1].Stopped.Before(events[1].Started))
+
+	require.Equal(t, job.LifecycleStarted, events[2].Type)
+	require.Equal(t, stopped, events[2].ID)
+	require.Equal(t, job.LifecycleStopped, events[3].Type)
+	require.Equal(t, "owner2", events[3].Owner)
+	require.Equal(t, job.TerminatedBySignal, *events[3].ExitCode)
+}
+
+func TestControllerIOAccounting(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	var statfs unix.Statfs_t
+	require.NoError(t, unix.Statfs(dir, &statfs))
+	if statfs.Type == unix.TMPFS_MAGIC {
+		t.Skip("requires a temporary directory on a block device")
+	}
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	out := "of=" + filepath.Join(dir, "out")
+	id, err := controller.Start("owner1", "dd", "if=/dev/zero", out, "bs=1M", "count=4", "conv=fsync")
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	status, err := controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.Equal(t, 0, status.ExitCode)
+	require.GreaterOrEqual(t, status.IOWriteBytes, uint64(4<<20))
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+// TestControllerFileDescriptors lists the open file descriptors inside a job.
+// It is not parallel, as descriptors opened by concurrent tests without
+// close-on-exec would be inherited by the default controller's jobs.
+func TestControllerFileDescriptors(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	leaked := filepath.Join(t.TempDir(), "leaked")
+	fd, err := unix.Open(leaked, unix.O_CREAT|unix.O_RDONLY, 0o600) // no O_CLOEXEC
+	require.NoError(t, err)
+	defer unix.Close(fd)
+
+	fds := jobFileDescriptors(t)
+	for n, target := range fds {
+		require.NotContains(t, target, "socket:", "fd %d", n)
+		require.NotContains(t, target, "/sys/fs/cgroup", "fd %d", n)
+	}
+	require.Equal(t, leaked, fds[fd])
+
+	fds = jobFileDescriptors(t, job.WithCloseFDs())
+	for n, target := range fds {
+		if n > 2 {
+			// The only other descriptor is ls' own, reading /proc/self/fd.
+			require.Regexp(t, `^/proc/\d+/fd$`, target, "fd %d", n)
+		}
+	}
+	_, err = job.NewController(job.WithCgroup(randCgroup()), job.WithRootfs(t.TempDir()), job.WithCloseFDs())
+	require.ErrorIs(t, err, job.ErrRootfs)
+}
+
+// jobFileDescriptors returns the targets of the open file descriptors of a
+// job by file descriptor number.
+func jobFileDescriptors(t *testing.T, opts ...job.Option) map[int]string {
 	t.Helper()
-	fn := func() bool {
-		status, err := controller.Status(owner, id)
+	cgroup := randCgroup()
+	controller, err := job.NewController(append(opts, job.WithCgroup(cgroup))...)
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	id, err := controller.Start("owner1", "ls", "-l", "/proc/self/fd")
+	require.NoError(t, err)
+	logs := readLogs(t, controller, "owner1", id)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	require.NoError(t, controller.StopAll())
+
+	fds := map[int]string{}
+	for _, line := range strings.Split(logs, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[len(fields)-2] != "->" {
+			continue
+		}
+		n, err := strconv.Atoi(fields[len(fields)-3])
+		require.NoError(t, err, line)
+		fds[n] = fields[len(fields)-1]
+	}
+	require.Contains(t, fds, 2, logs)
+	return fds
+}
+
+func TestControllerSeccompInvalid(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	_, err := job.NewController(job.WithCgroup(randCgroup()), job.WithSeccompProfile(filepath.Join(dir, "missing.json")))
+	require.ErrorIs(t, err, job.ErrSeccomp)
+	for name, profile := range map[string]string{
+		"malformed":   `{"blocked": "mount"}`,
+		"empty":       `{"blocked": []}`,
+		"unsupported": `{"blocked": ["mount", "read"]}`,
+	} {
+		path := filepath.Join(dir, name+".json")
+		require.NoError(t, os.WriteFile(path, []byte(profile), 0o600))
+		_, err = job.NewController(job.WithCgroup(randCgroup()), job.WithSeccompProfile(path))
+		require.ErrorIs(t, err, job.ErrSeccomp, name)
+	}
+}
+
+func TestControllerSeccomp(t *testing.T) {
+	t.Parallel()
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	path := filepath.Join(t.TempDir(), "seccomp.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"blocked": ["chroot", "mount"]}`), 0o600))
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithSeccompProfile(path))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	id, err := controller.Start("owner1", "echo", "allowed")
+	require.NoError(t, err)
+	require.Equal(t, "allowed\n", readLogs(t, controller, "owner1", id))
+	requireEventuallyStopped(t, controller, "owner1", id)
+	status, err := controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.Equal(t, 0, status.ExitCode)
+
+	// chroot is blocked, the job's process is killed with SIGSYS.
+	id, err = controller.Start("owner1", "chroot", "/", "true")
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	status, err = controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.Equal(t, -1, status.ExitCode)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerWatchAll(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := controller.WatchAll(ctx)
+	id1, err := controller.Start("owner1", "true")
+	require.NoError(t, err)
+	id2, err := controller.Start("owner2", "sh", "-c", "exit 3")
+	require.NoError(t, err)
+
+	started := map[string]string{}
+	exitCodes := map[string]int{}
+	for len(exitCodes) < 2 {
+		e := <-events
+		if e.Status.Running {
+			started[e.Status.ID] = e.Owner
+			continue
+		}
+		require.Contains(t, started, e.Status.ID, "start event must precede termination event")
+		exitCodes[e.Status.ID] = e.Status.ExitCode
+	}
+	require.Equal(t, map[string]string{id1: "owner1", id2: "owner2"}, started)
+	require.Equal(t, map[string]int{id1: 0, id2: 3}, exitCodes)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		_, ok := <-events
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerArgv0(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	cat, err := exec.LookPath("cat")
+	require.NoError(t, err)
+	notExecutable := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(notExecutable, nil, 0o644))
+	for _, command := range []string{"cat", notExecutable, filepath.Join(t.TempDir(), "missing")} {
+		_, err = controller.StartJob("owner1", job.StartOptions{Command: command, Argv0: "renamed"})
+		require.ErrorIs(t, err, job.ErrCommand, command)
+	}
+
+	// The kernel sets comm from the executable's file name, argv[0] is
+	// reflected in the command line shown by ps.
+	opts := job.StartOptions{Command: cat, Argv0: "renamed", Args: []string{"/proc/self/cmdline"}}
+	id, err := controller.StartJob("owner1", opts)
+	require.NoError(t, err)
+	require.Equal(t, "renamed\x00/proc/self/cmdline\x00", readLogs(t, controller, "owner1", id))
+	requireEventuallyStopped(t, controller, "owner1", id)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerStartPaused(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	id, err := controller.StartJob("owner1", job.StartOptions{Command: "echo", Args: []string{"resumed"}, Paused: true})
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	status, err := controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.True(t, status.Running)
+	require.True(t, status.Paused)
+	r, err := controller.LogsReader(context.Background(), "owner1", id, job.FollowOnly())
+	require.NoError(t, err)
+
+	require.ErrorIs(t, controller.Resume("owner2", id), job.ErrUnauthorized)
+	require.NoError(t, controller.Resume("owner1", id))
+	require.ErrorIs(t, controller.Resume("owner1", id), job.ErrJobNotPaused)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "resumed\n", string(b), "no output before resume")
+	requireEventuallyStopped(t, controller, "owner1", id)
+	status, err = controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.False(t, status.Paused)
+	require.Equal(t, 0, status.ExitCode)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerStartScheduled(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	notBefore := time.Now().Add(200 * time.Millisecond)
+	id, err := controller.StartJob("owner1", job.StartOptions{Command: "echo", Args: []string{"scheduled"}, NotBefore: notBefore})
+	require.NoError(t, err)
+	status, err := controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.True(t, status.Running)
+	require.True(t, status.Scheduled)
+	require.False(t, status.Paused)
+	require.ErrorIs(t, controller.Resume("owner1", id), job.ErrJobNotPaused)
+
+	r, err := controller.LogsReader(context.Background(), "owner1", id)
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "scheduled\n", string(b))
+	require.False(t, time.Now().Before(notBefore), "command ran before not-before")
+	requireEventuallyStopped(t, controller, "owner1", id)
+	status, err = controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.False(t, status.Scheduled)
+	require.Equal(t, 0, status.ExitCode)
+
+	// Stopping a scheduled job cancels it, even with a signal it would handle.
+	id, err = controller.StartJob("owner1", job.StartOptions{Command: "echo", Args: []string{"cancelled"}, NotBefore: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	require.NoError(t, controller.Stop("owner1", id, job.WithSignal(syscall.SIGINT)))
+	requireEventuallyStopped(t, controller, "owner1", id)
+	r, err = controller.LogsReader(context.Background(), "owner1", id)
+	require.NoError(t, err)
+	b, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.Empty(t, b)
+
+	_, err = controller.StartJob("owner1", job.StartOptions{Command: "true", Paused: true, NotBefore: time.Now().Add(time.Hour)})
+	require.ErrorIs(t, err, job.ErrCommand)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerList(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	var ids []string
+	for range 11 {
+		id, err := controller.Start("owner1", "true")
 		require.NoError(t, err)
-		return !status.Running
+		ids = append(ids, id)
 	}
-	require.Eventually(t, fn, time.Second*2, time.Millisecond*50, 0)
+	_, err = controller.Start("owner2", "true")
+	require.NoError(t, err)
+
+	statuses := controller.List("owner1")
+	got := make([]string, len(statuses))
+	for i, status := range statuses {
+		got[i] = status.ID
+	}
+	require.Equal(t, ids, got) // ordered numerically, "10" after "9"
+	require.Empty(t, controller.List("owner3"))
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerStopSignal(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	script := `trap 'exit 42' INT; echo ready; while true; do sleep 0.1; done`
+	id, err := controller.Start("owner1", "sh", "-c", script)
+	require.NoError(t, err)
+	r, err := controller.LogsReader(context.Background(), "owner1", id)
+	require.NoError(t, err)
+	b := make([]byte, len("ready"))
+	_, err = io.ReadFull(r, b) // wait for the trap to be installed
+	require.NoError(t, err)
+
+	err = controller.Stop("owner1", id, job.WithSignal(syscall.SIGSTOP))
+	require.ErrorIs(t, err, job.ErrSignal)
+	sig, err := job.ParseSignal("int")
+	require.NoError(t, err)
+	err = controller.Stop("owner1", id, job.WithSignal(sig))
+	require.NoError(t, err)
+
+	requireEventuallyStopped(t, controller, "owner1", id)
+	status, err := controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.Equal(t, 42, status.ExitCode)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestParseSignal(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]syscall.Signal{
+		"INT":     syscall.SIGINT,
+		"SIGINT":  syscall.SIGINT,
+		"term":    syscall.SIGTERM,
+		"sigkill": syscall.SIGKILL,
+		"HUP":     syscall.SIGHUP,
+		"QUIT":    syscall.SIGQUIT,
+	}
+	for name, want := range testCases {
+		got, err := job.ParseSignal(name)
+		require.NoError(t, err, name)
+		require.Equal(t, want, got, name)
+	}
+	for _, name := range []string{"", "STOP", "SIGSEGV", "9", "INTX"} {
+		_, err := job.ParseSignal(name)
+		require.ErrorIs(t, err, job.ErrSignal, name)
+	}
+}
+
+func TestControllerCredential(t *testing.T) {
+	t.Parallel()
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	cred := job.Credential{UID: 65534, GID: 65534, Groups: []uint32{100, 65534}}
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithCredential(cred))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	id, err := controller.Start("owner1", "grep", "-E", "^(Uid|Gid|Groups):", "/proc/self/status")
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	lines := strings.Split(readLogs(t, controller, "owner1", id), "\n")
+	require.Len(t, lines, 4)
+	require.Equal(t, []string{"Uid:", "65534", "65534", "65534", "65534"}, strings.Fields(lines[0]))
+	require.Equal(t, []string{"Gid:", "65534", "65534", "65534", "65534"}, strings.Fields(lines[1]))
+	require.Equal(t, []string{"Groups:", "100", "65534"}, strings.Fields(lines[2]))
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerCredentialGroupNotAllowed(t *testing.T) {
+	t.Parallel()
+	cred := job.Credential{UID: 65534, GID: 65534, Groups: []uint32{0}}
+	_, err := job.NewController(job.WithCgroup(randCgroup()), job.WithCredential(cred), job.WithAllowedGroups(100))
+	require.ErrorIs(t, err, job.ErrCredential)
+}
+
+func TestControllerUmask(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithUmask(0o077))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	fname := filepath.Join(t.TempDir(), "created")
+	id, err := controller.Start("owner1", "touch", fname)
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	info, err := os.Stat(fname)
+	require.NoError(t, err)
+	require.Equal(t, fs.FileMode(0o600), info.Mode().Perm())
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerRlimits(t *testing.T) {
+	t.Parallel()
+	limits := job.Limits{Rlimits: map[string]uint64{"nofile": 64, "core": 0}}
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithLimits(limits))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	id, err := controller.Start("owner1", "sh", "-c", "ulimit -n; ulimit -c")
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	require.Equal(t, "64\n0\n", readLogs(t, controller, "owner1", id))
+	status, err := controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.Equal(t, "sh", status.Command)
+	require.Equal(t, 0, status.ExitCode)
+
+	_, err = controller.Start("owner1", "NON-EXISTENT-COMMAND")
+	require.ErrorIs(t, err, job.ErrCommand)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerUnsupportedRlimit(t *testing.T) {
+	t.Parallel()
+	limits := job.Limits{Rlimits: map[string]uint64{"stack": 1024}}
+	_, err := job.NewController(job.WithCgroup(randCgroup()), job.WithLimits(limits))
+	require.ErrorIs(t, err, job.ErrRlimit)
+}
+
+func TestControllerRootfsInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := job.NewController(job.WithCgroup(randCgroup()), job.WithRootfs("relative/root"))
+	require.ErrorIs(t, err, job.ErrRootfs)
+	_, err = job.NewController(job.WithCgroup(randCgroup()), job.WithRootfs(filepath.Join(t.TempDir(), "missing")))
+	require.ErrorIs(t, err, job.ErrRootfs)
+	limits := job.Limits{Rlimits: map[string]uint64{"nofile": 32}}
+	_, err = job.NewController(job.WithCgroup(randCgroup()), job.WithRootfs(t.TempDir()), job.WithLimits(limits))
+	require.ErrorIs(t, err, job.ErrRootfs)
+	_, err = job.NewController(job.WithCgroup(randCgroup()), job.WithRootfs(t.TempDir()), job.WithUmask(0o077))
+	require.ErrorIs(t, err, job.ErrRootfs)
+}
+
+func TestControllerRootfs(t *testing.T) {
+	t.Parallel()
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	dir := t.TempDir()
+	rootfs := filepath.Join(dir, "rootfs")
+	require.NoError(t, os.MkdirAll(filepath.Join(rootfs, "bin"), 0o755))
+	buildStaticReadFile(t, filepath.Join(rootfs, "bin", "readfile"))
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, "inside"), []byte("inside"), 0o644))
+	outside := filepath.Join(dir, "outside")
+	require.NoError(t, os.WriteFile(outside, []byte("outside"), 0o644))
+
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithRootfs(rootfs))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	id, err := controller.Start("owner1", "/bin/readfile", "/inside")
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	require.Equal(t, "inside", readLogs(t, controller, "owner1", id))
+
+	id, err = controller.Start("owner1", "/bin/readfile", outside)
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	require.Contains(t, readLogs(t, controller, "owner1", id), "no such file or directory")
+
+	// Relative paths are relative to the working directory "/" of the root.
+	id, err = controller.StartJob("owner1", job.StartOptions{Command: "readfile", Args: []string{"../../../" + outside}})
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	require.Contains(t, readLogs(t, controller, "owner1", id), "no such file or directory")
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerMountsInvalid(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "allowed")
+	require.NoError(t, os.Mkdir(allowed, 0o755))
+	require.NoError(t, os.Symlink(dir, filepath.Join(allowed, "escape")))
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithMountSources(allowed))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	for name, m := range map[string]job.Mount{
+		"relative source": {Source: "allowed", Target: "/mnt"},
+		"relative target": {Source: allowed, Target: "mnt"},
+		"missing source":  {Source: filepath.Join(allowed, "missing"), Target: "/mnt"},
+		"not allowed":     {Source: dir, Target: "/mnt"},
+		"prefix":          {Source: allowed + "2", Target: "/mnt"},
+		"symlink escape":  {Source: filepath.Join(allowed, "escape"), Target: "/mnt"},
+	} {
+		_, err := controller.StartJob("owner1", job.StartOptions{Command: "true", Mounts: []job.Mount{m}})
+		require.ErrorIs(t, err, job.ErrMount, name)
+	}
+}
+
+func TestControllerMounts(t *testing.T) {
+	t.Parallel()
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source")
+	require.NoError(t, os.Mkdir(source, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "file"), []byte("mounted"), 0o644))
+	rw, ro := filepath.Join(dir, "rw"), filepath.Join(dir, "ro")
+	require.NoError(t, os.Mkdir(rw, 0o755))
+	require.NoError(t, os.Mkdir(ro, 0o755))
+
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithMountSources(source))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	script := fmt.Sprintf("cat %s/file; echo; echo x > %s/new && echo rw ok; echo x > %s/new || echo ro failed", rw, rw, ro)
+	id, err := controller.StartJob("owner1", job.StartOptions{
+		Command: "sh",
+		Args:    []string{"-c", script},
+		Mounts: []job.Mount{
+			{Source: source, Target: rw},
+			{Source: source, Target: ro, ReadOnly: true},
+		},
+	})
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	logs := readLogs(t, controller, "owner1", id)
+	require.Contains(t, logs, "mounted\nrw ok\n")
+	require.Contains(t, logs, "Read-only file system")
+	require.Contains(t, logs, "ro failed")
+
+	// The mounts are private to the job's mount namespace.
+	_, err = os.Stat(filepath.Join(rw, "file"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.NoError(t, controller.StopAll())
+}
+
+// buildStaticReadFile builds a statically linked program to the given path
+// that prints the content of the file given as first argument, or the error
+// reading it. Being statically linked, it runs in an otherwise empty rootfs.
+func buildStaticReadFile(t *testing.T, path string) {
+	t.Helper()
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("requires the go tool to build a static binary")
+	}
+	dir := t.TempDir()
+	src := `package main
+
+import "os"
+
+func main() {
+	b, err := os.ReadFile(os.Args[1])
+	if err != nil {
+		os.Stdout.WriteString(err.Error())
+		os.Exit(1)
+	}
+	os.Stdout.Write(b)
+}
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0o600))
+	cmd := exec.Command(goBin, "build", "-o", path, "main.go")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0", "GO111MODULE=off")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+func TestControllerStartUnique(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	opts := job.StartOptions{
+		Command: "sleep",
+		Args:    []string{"100"},
+		Labels:  map[string]string{"app": "deploy"},
+		Unique:  true,
+	}
+	id, err := controller.StartJob("owner1", opts)
+	require.NoError(t, err)
+	status, err := controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.Equal(t, opts.Labels, status.Labels)
+
+	_, err = controller.StartJob("owner1", opts)
+	require.ErrorIs(t, err, job.ErrJobExists)
+	_, err = controller.StartJob("owner1", job.StartOptions{Command: "true", Unique: true})
+	require.ErrorIs(t, err, job.ErrCommand)
+	var dupErr *job.DuplicateJobError
+	require.ErrorAs(t, err, &dupErr)
+	require.Equal(t, id, dupErr.ID)
+
+	// Other owners and other labels do not conflict.
+	_, err = controller.StartJob("owner2", opts)
+	require.NoError(t, err)
+	otherOpts := opts
+	otherOpts.Labels = map[string]string{"app": "deploy", "env": "ci"}
+	_, err = controller.StartJob("owner1", otherOpts)
+	require.NoError(t, err)
+
+	require.NoError(t, controller.Stop("owner1", id))
+	requireEventuallyStopped(t, controller, "owner1", id)
+	_, err = controller.StartJob("owner1", opts)
+	require.NoError(t, err)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerCommandWrapper(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	// The wrapper runs the job's command as a child rather than replacing
+	// itself with it, so that it shows in the job's process tree.
+	wrapper := []string{"sh", "-c", `"$@"; exit $?`, "wrapper"}
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithCommandWrapper(wrapper))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	opts := job.StartOptions{Command: "sh", Args: []string{"-c", `tr '\0' ' ' < /proc/$PPID/cmdline`}}
+	id, err := controller.StartJob("owner1", opts)
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	sh, err := exec.LookPath("sh")
+	require.NoError(t, err)
+	require.Contains(t, readLogs(t, controller, "owner1", id), "wrapper "+sh+" -c")
+	status, err := controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.Equal(t, "sh", status.Command)
+	require.Equal(t, opts.Args, status.Args)
+
+	// A missing command fails the start rather than the wrapper.
+	_, err = controller.StartJob("owner1", job.StartOptions{Command: "no-such-command"})
+	require.ErrorIs(t, err, job.ErrCommand)
+
+	_, err = controller.StartJob("owner1", job.StartOptions{Command: "/bin/true", Argv0: "x"})
+	require.ErrorIs(t, err, job.ErrCommand)
+
+	_, err = job.NewController(job.WithCgroup(randCgroup()), job.WithCommandWrapper([]string{" "}))
+	require.ErrorIs(t, err, job.ErrCommand)
+}
+
+func TestControllerDescribe(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	limits := &job.Limits{MemoryKiB: 100_000, Rlimits: map[string]uint64{"nofile": 32}}
+	id, err := controller.StartJob("owner1", job.StartOptions{Command: "true", Env: []string{"API_TOKEN=secret"}, Limits: limits})
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	d, err := controller.Describe("owner1", id)
+	require.NoError(t, err)
+	require.False(t, d.Status.Running)
+	require.Contains(t, d.Env, "API_TOKEN=secret")
+	require.Equal(t, uint64(100_000), d.Limits.MemoryKiB)
+	require.Equal(t, map[string]uint64{"nofile": 32}, d.Limits.Rlimits)
+	require.Empty(t, d.Namespaces)
+
+	_, err = controller.Describe("owner2", id)
+	require.ErrorIs(t, err, job.ErrUnauthorized)
+	d, err = controller.ForceDescribe("operator", id)
+	require.NoError(t, err)
+	require.Contains(t, d.Env, "API_TOKEN=secret")
+	_, err = controller.ForceDescribe("operator", "missing")
+	require.ErrorIs(t, err, job.ErrJobNotFound)
+}
+
+func TestControllerStartJob(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	dir := t.TempDir()
+	opts := job.StartOptions{
+		Command: "sh",
+		Args:    []string{"-c", "pwd; echo $GREETING; cat; ulimit -n"},
+		Labels:  map[string]string{"env": "test"},
+		Env:     []string{"GREETING=hello"},
+		Stdin:   []byte("input\n"),
+		Dir:     dir,
+		Limits:  &job.Limits{Rlimits: map[string]uint64{"nofile": 32}},
+	}
+	id, err := controller.StartJob("owner1", opts)
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	require.Equal(t, dir+"\nhello\ninput\n32\n", readLogs(t, controller, "owner1", id))
+	status, err := controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.Equal(t, opts.Labels, status.Labels)
+	require.Equal(t, 0, status.ExitCode)
+
+	id, err = controller.StartJob("owner1", job.StartOptions{Command: "sleep", Args: []string{"100"}, Timeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	status, err = controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.Equal(t, job.TerminatedBySignal, status.ExitCode)
+
+	_, err = controller.StartJob("owner1", job.StartOptions{Command: "true", Limits: &job.Limits{Rlimits: map[string]uint64{"bogus": 1}}})
+	require.ErrorIs(t, err, job.ErrRlimit)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerOwnerCgroups(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithOwnerCgroups())
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	ownerCgroup := filepath.Join(cgroup, "alice_example_com")
+	id1, err := controller.Start("alice@example.com", "sleep", "100")
+	require.NoError(t, err)
+	id2, err := controller.Start("alice@example.com", "sleep", "100")
+	require.NoError(t, err)
+	require.DirExists(t, filepath.Join(ownerCgroup, id1))
+	require.DirExists(t, filepath.Join(ownerCgroup, id2))
+	controllers, err := os.ReadFile(filepath.Join(ownerCgroup, "cgroup.subtree_control"))
+	require.NoError(t, err)
+	require.Contains(t, string(controllers), "memory")
+
+	// The owner cgroup is kept while the owner has jobs.
+	require.NoError(t, controller.Stop("alice@example.com", id1))
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(ownerCgroup, id1))
+		return errors.Is(err, fs.ErrNotExist)
+	}, time.Second, 10*time.Millisecond)
+	require.DirExists(t, ownerCgroup)
+
+	require.NoError(t, controller.Stop("alice@example.com", id2))
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(ownerCgroup)
+		return errors.Is(err, fs.ErrNotExist)
+	}, time.Second, 10*time.Millisecond)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+	require.NoDirExists(t, cgroup)
+}
+
+func TestControllerMaxCPUSeconds(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithLimits(job.Limits{MaxCPUSeconds: 0.2}))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	start := time.Now()
+	busy, err := controller.Start("owner1", "sh", "-c", "while :; do :; done")
+	require.NoError(t, err)
+	idle, err := controller.Start("owner1", "sleep", "100")
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", busy)
+	require.Less(t, time.Since(start), 5*time.Second)
+	status, err := controller.Status("owner1", busy)
+	require.NoError(t, err)
+	require.Equal(t, job.TerminationCPULimit, status.TerminationReason)
+	require.Equal(t, job.TerminatedBySignal, status.ExitCode)
+
+	// Idle jobs do not consume their CPU time budget.
+	status, err = controller.Status("owner1", idle)
+	require.NoError(t, err)
+	require.True(t, status.Running)
+	require.Zero(t, status.TerminationReason)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerTty(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	opts := job.StartOptions{
+		Command: "sh",
+		Args:    []string{"-c", "test -t 0 && test -t 1 && test -t 2 && echo tty; read line; echo \"got $line\""},
+		Tty:     true,
+	}
+	id, err := controller.StartJob("owner1", opts)
+	require.NoError(t, err)
+	require.NoError(t, controller.WriteInput("owner1", id, []byte("hello\n")))
+	requireEventuallyStopped(t, controller, "owner1", id)
+	logs := readLogs(t, controller, "owner1", id)
+	require.Contains(t, logs, "tty\r\n")
+	require.Contains(t, logs, "got hello\r\n")
+	require.ErrorIs(t, controller.WriteInput("owner1", id, []byte("x")), job.ErrJobNotRunning)
+
+	id, err = controller.Start("owner1", "true")
+	require.NoError(t, err)
+	require.ErrorIs(t, controller.WriteInput("owner1", id, []byte("x")), job.ErrNoTerminal)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerInheritEnv(t *testing.T) {
+	t.Setenv("TELEJOB_TEST_SECRET", "secret")
+	t.Setenv("TELEJOB_TEST_ALLOWED", "allowed")
+	opts := job.StartOptions{
+		Command: "sh",
+		Args:    []string{"-c", "echo \"$TELEJOB_TEST_SECRET|$TELEJOB_TEST_ALLOWED|$GREETING\""},
+		Env:     []string{"GREETING=hello"},
+	}
+
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+	id, err := controller.StartJob("owner1", opts)
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	require.Equal(t, "||hello\n", readLogs(t, controller, "owner1", id))
+	require.NoError(t, controller.StopAll())
+
+	cgroup = randCgroup()
+	controller, err = job.NewController(job.WithCgroup(cgroup), job.WithInheritEnv([]string{"TELEJOB_TEST_ALLOWED", "TELEJOB_TEST_UNSET"}))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+	id, err = controller.StartJob("owner1", opts)
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	require.Equal(t, "|allowed|hello\n", readLogs(t, controller, "owner1", id))
+	require.NoError(t, controller.StopAll())
+}
+
+func TestControllerCmdDecorator(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	decorate := func(cmd *exec.Cmd) {
+		cmd.Env = append(cmd.Env, "DECORATED=yes")
+	}
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithCmdDecorator(decorate))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	id, err := controller.StartJob("owner1", job.StartOptions{Command: "sh", Args: []string{"-c", "echo $DECORATED"}})
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	require.Equal(t, "yes\n", readLogs(t, controller, "owner1", id))
+	require.NoError(t, controller.StopAll())
+}
+
+func TestControllerArgsTooLarge(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	// A single variable exceeding the per-string limit.
+	huge := "HUGE=" + strings.Repeat("x", 200*1024)
+	_, err = controller.StartJob("owner1", job.StartOptions{Command: "true", Env: []string{huge}})
+	require.ErrorIs(t, err, job.ErrArgsTooLarge)
+	require.ErrorContains(t, err, "single argument")
+
+	// Many variables exceeding the total limit together.
+	env := make([]string, 100)
+	for i := range env {
+		env[i] = fmt.Sprintf("VAR%d=%s", i, strings.Repeat("x", 100*1024))
+	}
+	_, err = controller.StartJob("owner1", job.StartOptions{Command: "true", Env: env})
+	require.ErrorIs(t, err, job.ErrArgsTooLarge)
+	require.NotErrorIs(t, err, syscall.E2BIG)
+	require.Empty(t, controller.List("owner1"))
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerEmptyCommandAndArgs(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	for _, command := range []string{"", " ", "\t\n"} {
+		_, err := controller.Start("owner1", command)
+		require.ErrorIs(t, err, job.ErrCommand)
+	}
+
+	id, err := controller.Start("owner1", "printf", "[%s]", "", " ")
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	require.Equal(t, "[][ ]", readLogs(t, controller, "owner1", id))
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerMaxBufferedLogBytes(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithMaxLogBytes(1000))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	id, err := controller.Start("owner1", "head", "-c", "600", "/dev/zero")
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	status, err := controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.Equal(t, 600, status.MaxBufferedLogBytes)
+
+	id, err = controller.Start("owner1", "head", "-c", "5000", "/dev/zero")
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	status, err = controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.Greater(t, status.MaxBufferedLogBytes, 1000)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerAggregateUsage(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	var sum uint64
+	for range 2 {
+		id, err := controller.Start("owner1", "sleep", "100")
+		require.NoError(t, err)
+		b, err := os.ReadFile(filepath.Join(cgroup, id, "memory.current")) //nolint:gosec // G304: Potential file inclusion via variable
+		require.NoError(t, err)
+		n, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		require.NoError(t, err)
+		sum += n
+	}
+	usage, err := controller.AggregateUsage()
+	require.NoError(t, err)
+	require.Equal(t, 2, usage.RunningJobs)
+	require.InEpsilon(t, sum, usage.MemoryBytes, 0.2)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerAvailableControllers(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+	require.Subset(t, controller.AvailableControllers(), []string{"cpu", "io", "memory"})
+	require.NoError(t, controller.StopAll())
+}
+
+func TestControllerStats(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	id, err := controller.Start("owner1", "sleep", "100")
+	require.NoError(t, err)
+	stats, err := controller.Stats("owner1", id)
+	require.NoError(t, err)
+	require.NotZero(t, stats.MemoryCurrent)
+	require.GreaterOrEqual(t, stats.MemoryPeak, stats.MemoryCurrent)
+	require.Equal(t, uint64(1), stats.PidsCurrent)
+
+	_, err = controller.Stats("owner2", id)
+	require.ErrorIs(t, err, job.ErrUnauthorized)
+
+	require.NoError(t, controller.Stop("owner1", id))
+	requireEventuallyStopped(t, controller, "owner1", id)
+	_, err = controller.Stats("owner1", id)
+	require.ErrorIs(t, err, job.ErrJobNotRunning)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerAdmission(t *testing.T) {
+	t.Parallel()
+	errForbidden := errors.New("forbidden command")
+	var admitted []string
+	admit := func(owner string, opts job.StartOptions) error {
+		if opts.Command == "rm" {
+			return errForbidden
+		}
+		admitted = append(admitted, owner+":"+opts.Command)
+		return nil
+	}
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup), job.WithAdmission(admit))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	_, err = controller.Start("owner1", "rm", "-rf", "/")
+	require.ErrorIs(t, err, job.ErrAdmission)
+	require.ErrorIs(t, err, errForbidden)
+	entries, err := os.ReadDir(cgroup)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.False(t, entry.IsDir(), "leaked job cgroup %q", entry.Name())
+	}
+
+	id, err := controller.Start("owner1", "true")
+	require.NoError(t, err)
+	requireEventuallyStopped(t, controller, "owner1", id)
+	require.Equal(t, []string{"owner1:true"}, admitted)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func TestControllerProcessCount(t *testing.T) {
+	t.Parallel()
+	cgroup := randCgroup()
+	controller, err := job.NewController(job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer cleanupCgroup(cgroup)
+
+	id, err := controller.Start("owner1", "sh", "-c", "sleep 100 & sleep 100 & wait")
+	require.NoError(t, err)
+	manyProcs := func() bool {
+		status, err := controller.Status("owner1", id)
+		require.NoError(t, err)
+		return status.ProcessCount > 1
+	}
+	require.Eventually(t, manyProcs, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, controller.Stop("owner1", id))
+	requireEventuallyStopped(t, controller, "owner1", id)
+	status, err := controller.Status("owner1", id)
+	require.NoError(t, err)
+	require.Equal(t, 0, status.ProcessCount)
+
+	err = controller.StopAll()
+	require.NoError(t, err)
+}
+
+func randCgroup() string {
+	//nolint:gosec // G404: Use of weak random number generator
+	return fmt.Sprintf("/sys/fs/cgroup/telejob-%d", rand.Uint64())
+}
+
+func requireEventuallyStopped(t *testing.T, controller *job.Controller, owner, id string) {
+	t.Helper()
+	fn := func() bool {
+		status, err := controller.Status(owner, id)
+		require.NoError(t, err)
+		return !status.Running
+	}
+	require.Eventually(t, fn, time.Second*2, time.Millisecond*50, 0)
+}
+
+func readLogs(t *testing.T, controller *job.Controller, owner, id string) string {
+	t.Helper()
+	r, err := controller.LogsReader(context.Background(), owner, id)
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(b)
 }
 
 func cleanupCgroup(cgroup string) {
@@ -0,0 +1,70 @@
+package job
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+)
+
+// Description describes how a job has been run, for auditing. It is
+// available for as long as the job's status, including after the job has
+// terminated.
+//
+// Env is the job's complete environment as KEY=VALUE pairs, Limits are the
+// job's effective limits and Namespaces lists the namespaces the job's
+// process runs in other than the controller's, such as "mnt" for jobs with a
+// rootfs or mounts. Env may contain secrets; callers must not log it and
+// should redact its values for untrusted clients.
+type Description struct {
+	Status     Status
+	Env        []string
+	Limits     Limits
+	Namespaces []string
+}
+
+// Describe returns the description of the job with the given ID.
+func (c *Controller) Describe(owner, id string) (Description, error) {
+	job, err := c.get(owner, id)
+	if err != nil {
+		return Description{}, err
+	}
+	return job.describe(), nil
+}
+
+// ForceDescribe returns the description of the job with the given ID like
+// Describe, regardless of the job's owner. Like [Controller.ForceStop], it
+// must only be called after authorizing the operator, and every call is
+// audit-logged with the operator and the job's owner.
+func (c *Controller) ForceDescribe(operator, id string) (Description, error) {
+	c.mutex.Lock()
+	job, ok := c.jobs[id]
+	c.mutex.Unlock()
+	if !ok {
+		return Description{}, fmt.Errorf("%w: %q", ErrJobNotFound, id)
+	}
+	slog.Warn("force-describing job", "operator", operator, "id", id, "owner", job.owner)
+	return job.describe(), nil
+}
+
+// describe returns the job's description, see Description.
+func (j *job) describe() Description {
+	limits := j.limits
+	limits.IO = slices.Clone(limits.IO)
+	limits.Rlimits = maps.Clone(limits.Rlimits)
+	return Description{
+		Status:     j.getStatus(),
+		Env:        slices.Clone(j.env),
+		Limits:     limits,
+		Namespaces: slices.Clone(j.namespaces),
+	}
+}
+
+// jobNamespaces returns the names of the namespaces a job with the given
+// options and config runs in, see Description.Namespaces.
+func jobNamespaces(opts StartOptions, cfg jobConfig) []string {
+	if cfg.rootfs != "" || len(opts.Mounts) > 0 {
+		return []string{"mnt"}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package job
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// LifecycleEventType is the type of a [LifecycleEvent].
+type LifecycleEventType string
+
+// Lifecycle event types. A job's first event is always LifecycleStarted, its
+// last event one of the other types.
+const (
+	// LifecycleStarted is the type of events of jobs whose process has
+	// started.
+	LifecycleStarted LifecycleEventType = "started"
+	// LifecycleExited is the type of events of jobs that exited with exit
+	// code 0 on their own.
+	LifecycleExited LifecycleEventType = "exited"
+	// LifecycleFailed is the type of events of jobs that exited with a
+	// non-zero exit code or were killed by a signal on their own.
+	LifecycleFailed LifecycleEventType = "failed"
+	// LifecycleStopped is the type of events of jobs stopped by a client,
+	// an operator, the controller's shutdown or the controller's CPU time
+	// limit, see LifecycleEvent.Reason.
+	LifecycleStopped LifecycleEventType = "stopped"
+	// LifecycleOOM is the type of events of jobs that failed after a process
+	// of the job has been killed by the OOM killer.
+	LifecycleOOM LifecycleEventType = "oom"
+	// LifecycleTimeout is the type of events of jobs stopped after
+	// StartOptions.Timeout.
+	LifecycleTimeout LifecycleEventType = "timeout"
+)
+
+// LifecycleEvent is a job lifecycle event reported to the sink set with
+// [WithEventLog] or [WithEventHandler]. Stopped and ExitCode are only set for
+// terminated jobs. Reason is the job's TerminationReason, if any.
+type LifecycleEvent struct {
+	Type     LifecycleEventType `json:"type"`
+	Time     time.Time          `json:"time"`
+	ID       string             `json:"id"`
+	Owner    string             `json:"owner"`
+	Command  string             `json:"command"`
+	Args     []string           `json:"args,omitempty"`
+	Started  time.Time          `json:"started"`
+	Stopped  *time.Time         `json:"stopped,omitempty"`
+	ExitCode *int               `json:"exit_code,omitempty"`
+	Reason   string             `json:"reason,omitempty"`
+}
+
+// WithEventLog writes the lifecycle events of all jobs to w as JSON, one
+// [LifecycleEvent] per line, for ingestion into a log pipeline. Writes are
+// synchronous and serialized; write errors are logged and otherwise ignored.
+// It replaces the handler set with [WithEventHandler].
+func WithEventLog(w io.Writer) Option {
+	return func(c *Controller) {
+		c.eventHandler = newJSONEventWriter(w).write
+	}
+}
+
+// WithEventHandler calls handler with the lifecycle events of all jobs. It
+// is called synchronously when a job has started and when it has terminated,
+// possibly concurrently for different jobs, and must not block. It replaces
+// the writer set with [WithEventLog].
+func WithEventHandler(handler func(LifecycleEvent)) Option {
+	return func(c *Controller) {
+		c.eventHandler = handler
+	}
+}
+
+// jsonEventWriter writes lifecycle events as JSON lines, see WithEventLog.
+type jsonEventWriter struct {
+	mutex sync.Mutex
+	enc   *json.Encoder
+}
+
+func newJSONEventWriter(w io.Writer) *jsonEventWriter {
+	return &jsonEventWriter{enc: json.NewEncoder(w)}
+}
+
+func (w *jsonEventWriter) write(e LifecycleEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err := w.enc.Encode(e); err != nil {
+		slog.Error("cannot write job event", "id", e.ID, "type", e.Type, "err", err)
+	}
+}
+
+// emitLifecycleEvent reports the event of the given type for the job with
+// the given owner and status to the controller's event handler, if any.
+func (c *Controller) emitLifecycleEvent(typ LifecycleEventType, owner string, status Status) {
+	if c.eventHandler != nil {
+		c.eventHandler(newLifecycleEvent(typ, owner, status))
+	}
+}
+
+// newLifecycleEvent returns the event of the given type for the job with the
+// given owner and status.
+func newLifecycleEvent(typ LifecycleEventType, owner string, status Status) LifecycleEvent {
+	e := LifecycleEvent{
+		Type:    typ,
+		Time:    time.Now(),
+		ID:      status.ID,
+		Owner:   owner,
+		Command: status.Command,
+		Args:    status.Args,
+		Started: status.Started,
+		Reason:  status.TerminationReason.String(),
+	}
+	if !status.Running {
+		stopped, exitCode := status.Stopped, status.ExitCode
+		e.Stopped, e.ExitCode = &stopped, &exitCode
+	}
+	return e
+}
+
+// terminationEventType returns the lifecycle event type of the terminated
+// job. It must only be called after wait.
+func (j *job) terminationEventType() LifecycleEventType {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	switch {
+	case j.oomKilled && j.status.ExitCode != 0:
+		return LifecycleOOM
+	case j.status.TerminationReason == TerminationTimeout:
+		return LifecycleTimeout
+	case j.signaled || j.status.TerminationReason != 0:
+		return LifecycleStopped
+	case j.status.ExitCode != 0:
+		return LifecycleFailed
+	default:
+		return LifecycleExited
+	}
+}
@@ -0,0 +1,196 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"slices"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// execHelperArg0 is the argv[0] used when the current binary is re-executed
+// as exec helper for a job.
+const execHelperArg0 = "telejob-exec-helper"
+
+// rlimitResources maps the supported rlimit names to their resource IDs.
+//
+//nolint:gochecknoglobals // read-only lookup table.
+var rlimitResources = map[string]int{
+	"core":   unix.RLIMIT_CORE,
+	"nofile": unix.RLIMIT_NOFILE,
+	"nproc":  unix.RLIMIT_NPROC,
+}
+
+// execConfig is the configuration applied by the exec helper in the job's
+// process before executing the job's command.
+//
+// If CloseFDs is set, all file descriptors other than stdin, stdout and stderr
+// are marked close-on-exec, so that the job's command does not inherit them.
+// Seccomp lists the syscalls blocked by a seccomp filter, see applySeccomp.
+// If Stop is set, the helper stops itself with SIGSTOP right before executing
+// the job's command, see Controller.Resume. Mounts are bind mounted in the
+// job's new mount namespace first, see applyMounts. If Umask is not nil, it
+// is set as the file mode creation mask of the job's process, see WithUmask.
+//
+// Rootfs, Dir and Credential are only set for jobs with mounts, which the
+// helper must set up with the host's root directory and as root: the helper
+// then changes its root directory to Rootfs and its working directory to Dir
+// after the mounts, and switches to Credential before installing the seccomp
+// filter.
+type execConfig struct {
+	Umask      *int              `json:"umask,omitempty"`
+	Mounts     []Mount           `json:"mounts,omitempty"`
+	Rootfs     string            `json:"rootfs,omitempty"`
+	Dir        string            `json:"dir,omitempty"`
+	Credential *Credential       `json:"credential,omitempty"`
+	Rlimits    map[string]uint64 `json:"rlimits,omitempty"`
+	CloseFDs   bool              `json:"closeFDs,omitempty"`
+	Seccomp    []string          `json:"seccomp,omitempty"`
+	Stop       bool              `json:"stop,omitempty"`
+}
+
+// needsHelper reports whether the exec config requires the exec helper.
+func (ec execConfig) needsHelper() bool {
+	return ec.Umask != nil || len(ec.Mounts) > 0 || len(ec.Rlimits) > 0 || ec.CloseFDs || len(ec.Seccomp) > 0 || ec.Stop
+}
+
+// validateRlimits checks that all given rlimit names are supported.
+func validateRlimits(rlimits map[string]uint64) error {
+	for name := range rlimits {
+		if _, ok := rlimitResources[name]; !ok {
+			return fmt.Errorf("%w: unsupported rlimit %q", ErrRlimit, name)
+		}
+	}
+	return nil
+}
+
+// init runs the exec helper if the current process has been started as one.
+//
+// Some process attributes, such as rlimits, cannot be set through
+// syscall.SysProcAttr. They are applied by the exec helper instead: the job
+// starts as a re-execution of the current binary with execHelperArg0 as
+// argv[0], see [wrapWithHelper]. The helper applies the exec config to its
+// own process and then replaces itself with the job's command using execve,
+// so the job keeps the helper's PID. It runs during the initialization of
+// this package, after the packages it imports have been initialized but
+// before main and the initialization of packages importing it. If the helper
+// fails, it exits with status 127 and the job's command is never executed.
+func init() { //nolint:gochecknoinits // the exec helper must run before main.
+	if len(os.Args) > 0 && os.Args[0] == execHelperArg0 {
+		if err := runExecHelper(os.Args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "telejob: %v\n", err)
+			os.Exit(127) //nolint:revive // the exec helper never returns to main.
+		}
+	}
+}
+
+// wrapWithHelper rewrites the given command to run through the exec helper
+// if the exec config requires it. The helper receives the serialized exec
+// config, the resolved command path and the original arguments.
+func wrapWithHelper(cmd *exec.Cmd, ec execConfig) error {
+	if !ec.needsHelper() {
+		return nil
+	}
+	b, err := json.Marshal(ec)
+	if err != nil {
+		return fmt.Errorf("cannot marshal exec config: %w", err)
+	}
+	cmd.Args = append([]string{execHelperArg0, string(b), cmd.Path}, cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+	return nil
+}
+
+// setCredential switches the process to the given credential, supplementary
+// groups first, as they cannot be changed without privileges afterwards. The
+// syscall package applies the changes to all threads of the process.
+func setCredential(cred Credential) error {
+	groups := make([]int, len(cred.Groups))
+	for i, gid := range cred.Groups {
+		groups[i] = int(gid)
+	}
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("cannot set groups %v: %w", cred.Groups, err)
+	}
+	if err := syscall.Setgid(int(cred.GID)); err != nil {
+		return fmt.Errorf("cannot set gid %d: %w", cred.GID, err)
+	}
+	if err := syscall.Setuid(int(cred.UID)); err != nil {
+		return fmt.Errorf("cannot set uid %d: %w", cred.UID, err)
+	}
+	return nil
+}
+
+// runExecHelper applies the exec config and executes the job's command. It
+// only returns on error.
+//
+// args contains the serialized exec config, the command path and the
+// command's argv.
+func runExecHelper(args []string) error {
+	if len(args) < 3 { //nolint:mnd // config, path, argv[0]
+		return fmt.Errorf("exec helper: expected config, path and argv, got %q", args)
+	}
+	var ec execConfig
+	if err := json.Unmarshal([]byte(args[0]), &ec); err != nil {
+		return fmt.Errorf("exec helper: cannot parse config: %w", err)
+	}
+	if ec.Umask != nil {
+		unix.Umask(*ec.Umask)
+	}
+	if len(ec.Mounts) > 0 {
+		if err := applyMounts(ec.Rootfs, ec.Mounts); err != nil {
+			return fmt.Errorf("exec helper: %w", err)
+		}
+	}
+	if ec.Rootfs != "" {
+		if err := unix.Chroot(ec.Rootfs); err != nil {
+			return fmt.Errorf("exec helper: cannot change root to %q: %w", ec.Rootfs, err)
+		}
+	}
+	if ec.Dir != "" {
+		if err := unix.Chdir(ec.Dir); err != nil {
+			return fmt.Errorf("exec helper: cannot change directory to %q: %w", ec.Dir, err)
+		}
+	}
+	names := make([]string, 0, len(ec.Rlimits))
+	for name := range ec.Rlimits {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		limit := &unix.Rlimit{Cur: ec.Rlimits[name], Max: ec.Rlimits[name]}
+		if err := unix.Setrlimit(rlimitResources[name], limit); err != nil {
+			return fmt.Errorf("exec helper: cannot set rlimit %s=%d: %w", name, ec.Rlimits[name], err)
+		}
+	}
+	if ec.CloseFDs {
+		if err := unix.CloseRange(3, math.MaxUint32, unix.CLOSE_RANGE_CLOEXEC); err != nil { //nolint:mnd // first fd after stderr.
+			return fmt.Errorf("exec helper: cannot close file descriptors: %w", err)
+		}
+	}
+	if ec.Credential != nil {
+		if err := setCredential(*ec.Credential); err != nil {
+			return fmt.Errorf("exec helper: %w", err)
+		}
+	}
+	// The seccomp filter is installed last, so that it does not apply to the
+	// helper's own setup.
+	if len(ec.Seccomp) > 0 {
+		if err := applySeccomp(ec.Seccomp); err != nil {
+			return fmt.Errorf("exec helper: %w", err)
+		}
+	}
+	if ec.Stop {
+		if err := unix.Kill(os.Getpid(), unix.SIGSTOP); err != nil {
+			return fmt.Errorf("exec helper: cannot stop: %w", err)
+		}
+	}
+	path, argv := args[1], args[2:]
+	if err := syscall.Exec(path, argv, os.Environ()); err != nil { //nolint:gosec // G204: executing the job's command is the purpose.
+		return fmt.Errorf("exec helper: cannot execute %q: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package job
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// WithHostLimitCheck compares the CPU and memory limits of the controller and
+// of StartOptions with the host's number of CPUs and total memory, as read
+// from /proc/meminfo, to catch misconfigured limits that jobs could never
+// reach, such as a memory limit larger than the host's memory. Limits
+// exceeding the host's resources are logged as a warning or, if reject is
+// set, rejected with an error wrapping [ErrLimits]: NewController fails for
+// the controller's limits and starts fail for the limits of StartOptions.
+func WithHostLimitCheck(reject bool) Option {
+	return func(c *Controller) {
+		c.hostLimitCheck = true
+		c.hostLimitReject = reject
+	}
+}
+
+// hostResources are the total resources of the host, see WithHostLimitCheck.
+type hostResources struct {
+	cpus      int
+	memoryKiB uint64
+}
+
+// readHostResources returns the number of CPUs usable by the controller's
+// process and the host's total memory.
+func readHostResources() (*hostResources, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read host memory: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read-only.
+	memoryKiB, err := parseMemTotal(f)
+	if err != nil {
+		return nil, err
+	}
+	return &hostResources{cpus: runtime.NumCPU(), memoryKiB: memoryKiB}, nil
+}
+
+// parseMemTotal returns the total memory in KiB of the "MemTotal" line of the
+// given /proc/meminfo content, such as "MemTotal:       16318412 kB".
+func parseMemTotal(r io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "MemTotal:")
+		if !ok {
+			continue
+		}
+		kib, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse host memory %q: %w", value, err)
+		}
+		return kib, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("cannot read host memory: %w", err)
+	}
+	return 0, fmt.Errorf("cannot read host memory: no MemTotal in /proc/meminfo")
+}
+
+// checkHostLimits checks the given limits against the host's resources if
+// enabled with WithHostLimitCheck, logging a warning or returning an error
+// wrapping ErrLimits for limits exceeding them.
+func (c *Controller) checkHostLimits(limits Limits) error {
+	if c.host == nil {
+		return nil
+	}
+	var exceeded []string
+	if limits.CPUs > float64(c.host.cpus) {
+		exceeded = append(exceeded, fmt.Sprintf("%g CPUs exceed the host's %d CPUs", limits.CPUs, c.host.cpus))
+	}
+	memoryLimits := []struct {
+		name string
+		kib  uint64
+	}{
+		{"memory limit", limits.MemoryKiB},
+		{"memory high", limits.MemoryHighKiB},
+		{"memory minimum", limits.MemoryMinKiB},
+	}
+	for _, m := range memoryLimits {
+		if m.kib > c.host.memoryKiB {
+			exceeded = append(exceeded, fmt.Sprintf("%s of %d KiB exceeds the host's %d KiB", m.name, m.kib, c.host.memoryKiB))
+		}
+	}
+	if len(exceeded) == 0 {
+		return nil
+	}
+	if c.hostLimitReject {
+		return fmt.Errorf("%w: %s", ErrLimits, strings.Join(exceeded, ", "))
+	}
+	slog.Warn("limits exceed host resources", "limits", exceeded)
+	return nil
+}
@@ -1,16 +1,58 @@
 package job
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
+	"maps"
+	"math/rand/v2"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Linux fails exec with E2BIG if a single argument or environment string,
+// including its terminating NUL, exceeds maxArgStrlen (MAX_ARG_STRLEN), or if
+// all strings and their pointers exceed argMax. argMax is a quarter of the
+// stack size limit, at least minArgMax (ARG_MAX) and at most maxArgMax.
+// argsHeadroom is reserved for the arguments added by the exec helper.
+const (
+	maxArgStrlen = 32 * 4096
+	minArgMax    = 128 * 1024
+	maxArgMax    = 6 * 1024 * 1024
+	argsHeadroom = 4096
+)
+
+// cpuSampleInterval is the interval at which the CPU time of jobs with a CPU
+// time budget is sampled, see Limits.MaxCPUSeconds.
+const cpuSampleInterval = 100 * time.Millisecond
+
+// Job starts failing with EAGAIN are retried up to startAttempts times,
+// starting with a backoff of startBackoff.
+const (
+	startAttempts = 3
+	startBackoff  = 10 * time.Millisecond
+)
+
+// A running job is near its memory limit once its memory usage exceeds
+// nearMemoryLimitRatio of memory.max. A warning is logged at most once per
+// memoryWarningInterval per job.
+const (
+	nearMemoryLimitRatio  = 0.9
+	memoryWarningInterval = time.Minute
 )
 
 // job represents a process with owner and resource limits in any execution
@@ -22,31 +64,133 @@ type job struct {
 	cmd        *exec.Cmd
 	owner      string
 	cgroup     string
-	dispatcher *logDispatcher
+	dispatcher *logDispatcher // nil if the job's output is discarded
+	timeout    time.Duration  // the job's timeout, if any, see stopAfter
+	timer      *time.Timer    // stops the job after its timeout, if any; protected by mutex
+	startTimer *time.Timer    // runs a scheduled job's command, if any
+	waitOnce   sync.Once      // guards reaping the job's process, see wait
+	digest     *outputDigest  // digest of the job's output, if enabled
+	tty        *os.File       // master side of the job's terminal, if any
+	ttyDone    chan struct{}  // closed once all terminal output has been read
+	exited     chan struct{}  // closed once the job's process has been reaped
+	env        []string       // the job's environment, see Description
+	limits     Limits         // the job's effective limits
+	namespaces []string       // the job's namespaces, see Description
+	kill       killStrategy   // kills the job's remaining processes, see wait
+
+	lastMemoryWarning time.Time // protected by mutex
+	signaled          bool      // a signal has been sent to the job, protected by mutex
+	oomKilled         bool      // the OOM killer killed a job process, protected by mutex
+	inputAttached     bool      // the terminal input is claimed by attachInput, protected by mutex
+}
+
+// jobConfig holds the settings of the controller applied to a new job.
+//
+// At most maxLogBytes of the job's most recent output are buffered, a value of
+// zero buffers all output. If credential is not nil, the job's process runs
+// with the given credential. If umask is not nil, the job's process runs with
+// the given file mode creation mask. If rootfs is not empty, the job's process
+// runs with rootfs as its root directory. If digest is set, a digest of the
+// job's output is computed. If discard is set, the job's output is discarded
+// without buffering, teeing or digesting it. If closeFDs is set, the job's
+// process does not inherit any file descriptors other than stdin, stdout and
+// stderr. seccomp lists the syscalls blocked for the job's process. env is
+// the job's complete environment. If tty is not nil, it is the job's stdin,
+// stdout, stderr and controlling terminal. If tee is not nil, the job's output
+// is mirrored to it. newCgroup creates the job's cgroup, see newJobCgroup. If
+// decorateCmd is not nil, it is called with the job's command before it is
+// started, see WithCmdDecorator. kill is how the processes left in the job's
+// cgroup are killed once the job's process has terminated. If wrapper is not
+// empty, the job's command runs through it, see WithCommandWrapper.
+type jobConfig struct {
+	limits      Limits
+	cgroup      string
+	maxLogBytes int
+	credential  *Credential
+	umask       *int
+	rootfs      string
+	digest      bool
+	discard     bool
+	closeFDs    bool
+	seccomp     []string
+	env         []string
+	tty         *os.File
+	tee         *outputTee
+	newCgroup   func(cgroup string, limits Limits) error
+	decorateCmd func(*exec.Cmd)
+	kill        killStrategy
+	wrapper     []string
 }
 
-// newJob creates a new job with the given id, command, owner, limits and
-// cgroup.
-func newJob(owner, id string, command string, args []string, limits Limits, cgroup string) (*job, error) {
-	inputCh := make(chan []byte)
-	cmd, err := newStartedCmd(id, command, args, limits, cgroup, channelWriter(inputCh))
+// newJob creates a new job with the given id, start options, owner and job
+// config. The setup of the job's cgroup and process is aborted if ctx is done
+// before the job's process has been started; ctx does not affect the job's
+// lifetime otherwise.
+func newJob(ctx context.Context, owner, id string, opts StartOptions, cfg jobConfig) (*job, error) {
+	if opts.Tty {
+		return newTTYJob(ctx, owner, id, opts, cfg)
+	}
+	if cfg.discard {
+		// Nil writers connect the output to the null device, without pipes
+		// or copying goroutines.
+		cmd, err := newStartedCmd(ctx, id, opts, cfg, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		return newStartedJob(owner, id, opts, cfg, cmd, nil, nil), nil
+	}
+	inputCh, outDigest, stdout, stderr := newJobOutput(id, cfg)
+	cmd, err := newStartedCmd(ctx, id, opts, cfg, stdout, stderr)
 	if err != nil {
 		return nil, err
 	}
+	return newStartedJob(owner, id, opts, cfg, cmd, newStartedLogDispatcher(inputCh, cfg.maxLogBytes), outDigest), nil
+}
+
+// newJobOutput returns the input channel of the job's log dispatcher, the
+// job's output digest, which is nil unless enabled, and the writers of the
+// job's stdout and stderr, which send to the channel and the tee, if any.
+func newJobOutput(id string, cfg jobConfig) (chan logInput, *outputDigest, io.Writer, io.Writer) {
+	inputCh := make(chan logInput)
+	var outDigest *outputDigest
+	if cfg.digest {
+		outDigest = newOutputDigest()
+	}
+	var stdout, stderr io.Writer
+	stdout = channelWriter{ch: inputCh, stream: Stdout, digest: outDigest}
+	stderr = channelWriter{ch: inputCh, stream: Stderr, digest: outDigest}
+	if cfg.tee != nil {
+		stdout = io.MultiWriter(stdout, newTeeWriter(cfg.tee, id))
+		stderr = io.MultiWriter(stderr, newTeeWriter(cfg.tee, id))
+	}
+	return inputCh, outDigest, stdout, stderr
+}
+
+// newStartedJob returns the job of the started command. dispatcher and
+// outDigest are nil if the job's output is discarded or not digested.
+func newStartedJob(owner, id string, opts StartOptions, cfg jobConfig, cmd *exec.Cmd, dispatcher *logDispatcher, outDigest *outputDigest) *job {
 	return &job{
 		status: Status{
 			ID:       id,
-			Command:  command,
-			Args:     args,
+			Command:  opts.Command,
+			Args:     opts.Args,
+			Labels:   maps.Clone(opts.Labels),
 			Started:  time.Now(),
 			Running:  true,
 			ExitCode: NotTerminated,
+			Paused:   opts.Paused,
 		},
 		cmd:        cmd,
 		owner:      owner,
-		cgroup:     cgroup,
-		dispatcher: newStartedLogDispatcher(inputCh),
-	}, nil
+		cgroup:     cfg.cgroup,
+		dispatcher: dispatcher,
+		digest:     outDigest,
+		exited:     make(chan struct{}),
+		env:        cfg.env,
+		limits:     cfg.limits,
+		namespaces: jobNamespaces(opts, cfg),
+		kill:       cfg.kill,
+	}
 }
 
 // isRunning synchronously returns the running status of the job.
@@ -56,23 +200,194 @@ func (j *job) isRunning() bool {
 	return j.status.Running
 }
 
+// hasExited reports whether the job's process has been reaped and its cgroup
+// deleted, or given up on, see reap.
+func (j *job) hasExited() bool {
+	select {
+	case <-j.exited:
+		return true
+	default:
+		return false
+	}
+}
+
 // getStatus synchronously creates a copy of the Status of the current to be
-// used to returned to the client.
+// used to returned to the client. The process count is read from the job's
+// cgroup for running jobs.
 func (j *job) getStatus() Status {
 	j.mutex.Lock()
-	defer j.mutex.Unlock()
-	return j.status
+	status := j.status
+	j.mutex.Unlock()
+	if j.dispatcher != nil {
+		status.MaxBufferedLogBytes = int(j.dispatcher.maxBuffered.Load())
+	}
+	if status.Running {
+		status.ProcessCount = processCount(j.cgroup)
+		status.IOReadBytes, status.IOWriteBytes = ioBytes(j.cgroup)
+		status.NearMemoryLimit = j.checkMemoryLimit()
+	}
+	return status
+}
+
+// checkMemoryLimit reports whether the memory usage of the job's cgroup
+// exceeds nearMemoryLimitRatio of its memory limit, so that operators are
+// warned before the job is killed by the OOM killer. It then logs a warning,
+// at most once per memoryWarningInterval.
+func (j *job) checkMemoryLimit() bool {
+	current, limit, ok := memoryUsage(j.cgroup)
+	if !ok || float64(current) < nearMemoryLimitRatio*float64(limit) {
+		return false
+	}
+	j.mutex.Lock()
+	warn := time.Since(j.lastMemoryWarning) >= memoryWarningInterval
+	if warn {
+		j.lastMemoryWarning = time.Now()
+	}
+	id := j.status.ID
+	j.mutex.Unlock()
+	if warn {
+		slog.Warn("job near memory limit", "Status.ID", id, "owner", j.owner, "memory.current", current, "memory.max", limit)
+	}
+	return true
+}
+
+// memoryUsage returns the current memory usage and the memory limit of the
+// given cgroup. It returns false if the cgroup has no memory limit or the
+// values cannot be read, for example as the job has terminated in the
+// meantime.
+func memoryUsage(cgroup string) (uint64, uint64, bool) {
+	b, err := os.ReadFile(filepath.Join(cgroup, "memory.max"))
+	if err != nil {
+		return 0, 0, false
+	}
+	limit, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	// Without limit, memory.max is "max", which fails to parse. A literal
+	// memory.max of 0 is treated like no limit, as no usage can be near it.
+	if err != nil || limit == 0 {
+		return 0, 0, false
+	}
+	current, err := readCgroupUint(cgroup, "memory.current")
+	if err != nil {
+		return 0, 0, false
+	}
+	return current, limit, true
 }
 
-// stop stops the job with a `SIGKILL` signal.
+// ioBytes returns the number of bytes read and written by the processes of
+// the given cgroup. It returns 0 if the I/O stats cannot be read, for example
+// as the job has terminated in the meantime.
+func ioBytes(cgroup string) (uint64, uint64) {
+	read, write, err := readIOStat(cgroup)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("cannot read io.stat", "cgroup", cgroup, "err", err)
+		}
+		return 0, 0
+	}
+	return read, write
+}
+
+// oomKillCount returns the number of processes of the given cgroup killed by
+// the OOM killer, from the oom_kill entry of its memory.events file. It
+// returns 0 if the file cannot be read, as without memory controller.
+func oomKillCount(cgroup string) uint64 {
+	b, err := os.ReadFile(filepath.Join(cgroup, "memory.events"))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if value, ok := strings.CutPrefix(line, "oom_kill "); ok {
+			n, _ := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+// processCount returns the number of processes in the given cgroup. It
+// returns 0 if the cgroup no longer exists, as the job has terminated in the
+// meantime.
+func processCount(cgroup string) int {
+	b, err := os.ReadFile(filepath.Join(cgroup, "cgroup.procs"))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("cannot read cgroup.procs", "cgroup", cgroup, "err", err)
+		}
+		return 0
+	}
+	return bytes.Count(b, []byte("\n"))
+}
+
+// stats reads the resource usage of the job from its cgroup. It fails with
+// ErrJobNotRunning if the job has terminated, before or while reading.
+func (j *job) stats() (JobStats, error) {
+	if !j.isRunning() {
+		return JobStats{}, fmt.Errorf("%w: %q", ErrJobNotRunning, j.status.ID)
+	}
+	stats, err := readJobStats(j.cgroup)
+	if errors.Is(err, fs.ErrNotExist) {
+		return JobStats{}, fmt.Errorf("%w: %q", ErrJobNotRunning, j.status.ID)
+	}
+	return stats, err
+}
+
+// readJobStats reads memory.current, memory.peak, cpu.stat, io.stat and
+// pids.current of the given cgroup. Missing files, as without the memory or
+// pids controller, are reported as zero. A missing cgroup, as once the job
+// has terminated, fails with an error wrapping fs.ErrNotExist. It is checked
+// after reading, so that files missing because the cgroup has been deleted
+// meanwhile are not reported as zero.
+func readJobStats(cgroup string) (JobStats, error) {
+	var stats JobStats
+	var err error
+	if stats.MemoryCurrent, err = readOptionalCgroupUint(cgroup, "memory.current"); err != nil {
+		return JobStats{}, err
+	}
+	if stats.MemoryPeak, err = readOptionalCgroupUint(cgroup, "memory.peak"); err != nil {
+		return JobStats{}, err
+	}
+	if stats.CPU, err = readCPUUsage(cgroup); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return JobStats{}, err
+	}
+	if stats.IOReadBytes, stats.IOWriteBytes, err = readIOStat(cgroup); err != nil {
+		return JobStats{}, err
+	}
+	if stats.PidsCurrent, err = readOptionalCgroupUint(cgroup, "pids.current"); err != nil {
+		return JobStats{}, err
+	}
+	if _, err := os.Stat(cgroup); err != nil {
+		return JobStats{}, fmt.Errorf("%w: cannot read cgroup %q: %w", ErrCgroup, cgroup, err)
+	}
+	return stats, nil
+}
+
+// stop stops the job with a `SIGKILL` signal. Unlike signal, it succeeds if
+// the job has already stopped, for internal callers racing with the job's
+// termination, such as timeouts.
 func (j *job) stop() error {
+	err := j.signal(syscall.SIGKILL)
+	if errors.Is(err, ErrJobNotRunning) {
+		slog.Info("job already stopped", "id", j.status.ID)
+		return nil
+	}
+	return err
+}
+
+// signal sends the given signal to the job's process. It fails with
+// ErrJobNotRunning if the job has already stopped.
+func (j *job) signal(sig syscall.Signal) error {
 	j.mutex.Lock()
 	defer j.mutex.Unlock()
 	if !j.status.Running {
-		slog.Info("job already stopped", "id", j.status.ID)
-		return nil
+		return fmt.Errorf("%w: %q", ErrJobNotRunning, j.status.ID)
+	}
+	if j.status.Scheduled || j.status.Paused {
+		// The frozen process of a paused or scheduled job would only receive
+		// other signals once resumed. Its command has not run yet, so cancel
+		// it.
+		sig = syscall.SIGKILL
 	}
-	if err := j.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+	if err := j.cmd.Process.Signal(sig); err != nil && !errors.Is(err, os.ErrProcessDone) {
 		// There is an unavoidable race condition between killing the process
 		// and waiting for it to exit. We ignore os.ErrProcessDone, as it
 		// indicates the process has already exited, possibly due to a
@@ -80,16 +395,145 @@ func (j *job) stop() error {
 		//
 		// The cgroup.kill file is used in job.wait() for final cleanup,
 		// ensuring any remaining child processes are also terminated.
-		return fmt.Errorf("%w: cannot kill %q: %w", ErrJobStop, j.status.ID, err)
+		return fmt.Errorf("%w: cannot send %s to %q: %w", ErrJobStop, unix.SignalName(sig), j.status.ID, err)
 	}
+	j.signaled = true
 	return nil
 }
 
+// escalate sends the signal of the first step of the stop schedule to the
+// job's process like signal and the signals of the remaining steps after
+// their delays in the background, until the job has terminated. See
+// WithStopSchedule.
+func (j *job) escalate(steps []StopStep) error {
+	if err := j.signal(steps[0].Signal); err != nil {
+		return err
+	}
+	if len(steps) > 1 {
+		go j.escalateSteps(steps[1:])
+	}
+	return nil
+}
+
+// escalateSteps sends the signals of the given stop steps after their delays,
+// see escalate. It returns early once the job has terminated.
+func (j *job) escalateSteps(steps []StopStep) {
+	for _, step := range steps {
+		timer := time.NewTimer(step.Delay)
+		select {
+		case <-j.exited:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		slog.Info("escalating job stop", "id", j.status.ID, "signal", unix.SignalName(step.Signal))
+		if err := j.signal(step.Signal); err != nil {
+			if !errors.Is(err, ErrJobNotRunning) {
+				slog.Error("cannot escalate job stop", "id", j.status.ID, "err", err)
+			}
+			return
+		}
+	}
+}
+
+// stopAfter stops the job with TerminationTimeout once it has run for the
+// given timeout. The timeout of a paused or scheduled job only starts once
+// its command runs, see resume and schedule. It must be called before wait.
+func (j *job) stopAfter(timeout time.Duration) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.timeout = timeout
+	if !j.status.Paused && !j.status.Scheduled {
+		j.startTimeout()
+	}
+}
+
+// startTimeout starts the timer stopping the job after its timeout, if any.
+// It must be called with j.mutex held.
+func (j *job) startTimeout() {
+	if j.timeout <= 0 || j.timer != nil {
+		return
+	}
+	timeout := j.timeout
+	j.timer = time.AfterFunc(timeout, func() {
+		j.mutex.Lock()
+		if j.status.Running {
+			j.status.TerminationReason = TerminationTimeout
+		}
+		j.mutex.Unlock()
+		slog.Info("stopping job after timeout", "id", j.status.ID, "timeout", timeout)
+		if err := j.stop(); err != nil {
+			slog.Error("cannot stop job after timeout", "id", j.status.ID, "err", err)
+		}
+	})
+}
+
+// limitCPU stops the job with TerminationCPULimit once the CPU time consumed
+// by its cgroup exceeds limit. The CPU time is sampled every interval until
+// the job has terminated.
+func (j *job) limitCPU(limit, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if !j.isRunning() {
+				return
+			}
+			usage, err := readCPUUsage(j.cgroup)
+			if err != nil || usage <= limit {
+				continue // the cgroup is gone if the job has just terminated.
+			}
+			j.mutex.Lock()
+			running := j.status.Running
+			if running {
+				j.status.TerminationReason = TerminationCPULimit
+			}
+			j.mutex.Unlock()
+			if !running {
+				return
+			}
+			slog.Info("stopping job exceeding CPU time limit", "id", j.status.ID, "usage", usage, "limit", limit)
+			if err := j.stop(); err != nil {
+				slog.Error("cannot stop job exceeding CPU time limit", "id", j.status.ID, "err", err)
+			}
+			return
+		}
+	}()
+}
+
 // wait waits for the job to finish, updates the job status and deletes its
-// cgroups. It must only be called once per job.
+// cgroups. It is safe to call wait multiple times, also concurrently: the
+// job's process is reaped by the first call only, as a second call of
+// exec.Cmd.Wait would fail and overwrite the job's exit code. All calls
+// return once the job's status has been updated.
 func (j *job) wait() {
+	j.waitOnce.Do(j.reap)
+}
+
+// reap waits for the job's process, updates the job status and deletes its
+// cgroups. It must only be called once per job, see wait.
+func (j *job) reap() {
 	waitErr := j.cmd.Wait()
 	j.mutex.Lock()
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+	j.timeout = 0 // not started by a later resume.
+	j.mutex.Unlock()
+	if j.startTimer != nil {
+		j.startTimer.Stop()
+	}
+	// Kill all children through <job-cgroup>/cgroup.kill, or cgroup.procs
+	// on kernels without cgroup.kill. This also closes the terminal's slave
+	// side held by children outliving the job's process, such as background
+	// jobs of an interactive shell, so that closeTTY returns. Waiting for the
+	// terminal's output does not hold the mutex, which would block status
+	// queries and stops if a process could not be killed.
+	if err := killCgroup(j.cgroup, j.kill); err != nil {
+		slog.Error("cannot kill job cgroup", "err", err, "id", j.status.ID, "strategy", j.kill)
+	}
+	j.closeTTY()
+	j.mutex.Lock()
 	defer j.mutex.Unlock()
 	j.status.Running = false
 	j.status.Stopped = time.Now()
@@ -102,12 +546,23 @@ func (j *job) wait() {
 	default:
 		slog.Error("cannot wait for job", "err", waitErr, "id", j.status.ID)
 	}
-	j.dispatcher.closeInput()
-	// Write "1" to <job-cgroup>/cgroup.kill to kill all children.
-	if err := writeCgroupFile(j.cgroup, "cgroup.kill", "1"); err != nil {
-		slog.Error("cannot write to cgroup.kill", "err", err, "id", j.status.ID)
+	// The job's stdout and stderr are not *os.File, so exec.Cmd copies them
+	// from pipes in goroutines and Wait only returns after these goroutines
+	// have written all output, up to EOF, to the dispatcher's unbuffered
+	// input channel. Output of short-lived jobs, such as an error message
+	// written right before exiting, is therefore never lost by closing the
+	// input here. Setting cmd.WaitDelay would break this guarantee. The
+	// output of a terminal is read separately and has been waited for above.
+	if j.dispatcher != nil {
+		j.dispatcher.closeInput()
+	}
+	if j.digest != nil {
+		j.status.OutputDigest = j.digest.sum()
 	}
+	j.status.IOReadBytes, j.status.IOWriteBytes = ioBytes(j.cgroup)
+	j.oomKilled = oomKillCount(j.cgroup) > 0
 	deleteCgroupWithRetry(j.cgroup, j.status.ID, 3, time.Second)
+	close(j.exited)
 }
 
 // deleteCgroupWithRetry deletes the cgroup with the given id and retries the
@@ -134,34 +589,287 @@ func deleteCgroupWithRetry(cgroup, id string, retries int, dur time.Duration) {
 	slog.Error("cannot delete cgroup after retries", "id", id, "attempt", retries)
 }
 
-// newLogReader streams the logs of the job to the returned io.Reader.
-func (j *job) newLogReader(ctx context.Context) io.Reader {
-	return j.dispatcher.newReader(ctx)
+// lookPathInRoot resolves the command like [exec.LookPath], but in the
+// directories of the controller's PATH within the given root directory. The
+// returned path is relative to the root. Commands containing a slash are
+// returned unchanged.
+func lookPathInRoot(root, command string) (string, error) {
+	if strings.Contains(command, "/") {
+		return command, nil
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		path := filepath.Join(dir, command)
+		info, err := os.Stat(filepath.Join(root, path))
+		if err == nil && info.Mode().IsRegular() && info.Mode()&0o111 != 0 {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q in rootfs %q", exec.ErrNotFound, command, root)
+}
+
+// lookWrappedCommand resolves the command of a job run through a command
+// wrapper like that of a job without wrapper: in the directories of the
+// controller's PATH, within root if not empty, see lookPathInRoot. Commands
+// containing a slash are returned unchanged if they name an executable file,
+// relative to dir if not absolute.
+func lookWrappedCommand(root, dir, command string) (string, error) {
+	if !strings.Contains(command, "/") {
+		if root != "" {
+			return lookPathInRoot(root, command)
+		}
+		return exec.LookPath(command)
+	}
+	path := command
+	if !filepath.IsAbs(path) {
+		if root != "" {
+			dir = cmp.Or(dir, "/")
+		}
+		path = filepath.Join(dir, path)
+	}
+	info, err := os.Stat(filepath.Join(root, path))
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() || info.Mode()&0o111 == 0 {
+		return "", fmt.Errorf("%w: %q is not an executable file", exec.ErrNotFound, command)
+	}
+	return command, nil
+}
+
+// newLogReader streams the logs of the job to the returned StreamReader.
+func (j *job) newLogReader(ctx context.Context, opts ...LogsOption) StreamReader {
+	return j.dispatcher.newReader(ctx, opts...)
 }
 
-// newStartedCmd creates a new started command with the given limits, cgroup and command output writer.
-func newStartedCmd(id string, command string, args []string, limits Limits, cgroup string, w io.Writer) (*exec.Cmd, error) {
-	if err := newJobCgroup(cgroup, limits); err != nil {
+// newStartedCmd creates a new started command with the given start options,
+// job config and command output writers. Starts failing with a transient
+// error, such as EAGAIN under heavy load, are retried; see retryStart.
+func newStartedCmd(ctx context.Context, id string, opts StartOptions, cfg jobConfig, stdout, stderr io.Writer) (*exec.Cmd, error) {
+	if err := checkArgsSize(opts, cfg.env); err != nil {
 		return nil, err
 	}
-	file, err := os.Open(cgroup) //nolint:gosec // G304: Potential file inclusion via variable
+	return retryStart(ctx, id, func() (*exec.Cmd, error) {
+		return startCmd(ctx, id, opts, cfg, stdout, stderr)
+	})
+}
+
+// checkArgsSize returns an error wrapping ErrArgsTooLarge if the command, its
+// arguments and its environment env would make exec fail with E2BIG. It
+// reports which string or how much is too large, rather than a bare E2BIG.
+func checkArgsSize(opts StartOptions, env []string) error {
+	strs := slices.Concat([]string{opts.Command}, opts.Args, env)
+	size := 0
+	for _, s := range strs {
+		if len(s)+1 > maxArgStrlen {
+			return fmt.Errorf("%w: single argument or environment variable of %d bytes exceeds %d bytes", ErrArgsTooLarge, len(s)+1, maxArgStrlen)
+		}
+		size += len(s) + 1 + strconv.IntSize/8 // string, NUL and pointer.
+	}
+	if limit := argMax() - argsHeadroom; size > limit {
+		return fmt.Errorf("%w: %d bytes exceed the limit of %d bytes", ErrArgsTooLarge, size, limit)
+	}
+	return nil
+}
+
+// argMax returns the maximum total size of exec arguments and environment,
+// derived from the stack size limit like the kernel does.
+func argMax() int {
+	var rlim unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_STACK, &rlim); err != nil || rlim.Cur/4 > maxArgMax {
+		return maxArgMax
+	}
+	return max(int(rlim.Cur/4), minArgMax) //nolint:gosec // at most maxArgMax.
+}
+
+// retryStart calls start until it succeeds, fails with a non-transient error
+// or startAttempts is reached. Between attempts it sleeps for a jittered,
+// exponentially growing backoff, unless ctx is done. start must clean up after
+// itself on failure, in particular it must delete the job cgroup.
+func retryStart(ctx context.Context, id string, start func() (*exec.Cmd, error)) (*exec.Cmd, error) {
+	backoff := startBackoff
+	for attempt := 1; ; attempt++ {
+		cmd, err := start()
+		if err == nil || attempt == startAttempts || !errors.Is(err, syscall.EAGAIN) {
+			return cmd, err
+		}
+		slog.Warn("retrying job start after transient error", "Status.ID", id, "attempt", attempt, "err", err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: start aborted: %w", ErrCommand, context.Cause(ctx))
+		case <-time.After(backoff/2 + rand.N(backoff/2)): //nolint:gosec // G404: jitter does not need a secure random source.
+		}
+		backoff *= 2
+	}
+}
+
+// startCmd makes a single attempt to create a new started command, see
+// newStartedCmd.
+func startCmd(ctx context.Context, id string, opts StartOptions, cfg jobConfig, stdout, stderr io.Writer) (*exec.Cmd, error) {
+	command := opts.Command
+	cgroup, limits, rootfs := cfg.cgroup, cfg.limits, cfg.rootfs
+	file, err := openJobCgroup(ctx, cgroup, limits, cfg.newCgroup)
 	if err != nil {
-		return nil, fmt.Errorf("cannot open new job cgroup %q: %w", cgroup, err)
+		return nil, err
 	}
 	defer func() {
 		if err := file.Close(); err != nil { // cgroup file can only be closed after exec.Cmd has started!
 			slog.Error("cannot close cgroup file", "Status.ID", id, "cgroup", cgroup, "err", err)
 		}
 	}()
+	args := opts.Args
+	if len(cfg.wrapper) > 0 {
+		// The wrapper runs the job's command, resolved here so that a
+		// missing command fails the start rather than the wrapper.
+		path, err := lookWrappedCommand(rootfs, opts.Dir, opts.Command)
+		if err != nil {
+			deleteCgroupOnErr(cgroup, err)
+			return nil, fmt.Errorf("%w: cannot start command %v: %w", ErrCommand, opts.Command, err)
+		}
+		command, args = cfg.wrapper[0], slices.Concat(cfg.wrapper[1:], []string{path}, opts.Args)
+	}
 	cmd := exec.Command(command, args...)
+	if opts.Argv0 != "" {
+		cmd.Args[0] = opts.Argv0
+	}
+	cmd.Env = cfg.env
+	if opts.Stdin != nil && cfg.tty == nil {
+		cmd.Stdin = bytes.NewReader(opts.Stdin)
+	}
+	cmd.Dir = opts.Dir
+	if rootfs != "" {
+		cmd.Path, cmd.Err = lookPathInRoot(rootfs, command)
+		// Without working directory, the job would start in the
+		// controller's working directory outside of the root.
+		cmd.Dir = cmp.Or(cmd.Dir, "/")
+	}
+	ec := execConfig{Umask: cfg.umask, Mounts: opts.Mounts, Rlimits: limits.Rlimits, CloseFDs: cfg.closeFDs, Seccomp: cfg.seccomp, Stop: opts.Paused}
+	// Mounts are set up by the exec helper as root within the host's root
+	// directory, so the helper changes the root and working directory and
+	// switches to the credential itself.
+	helperSetup := len(opts.Mounts) > 0
+	if helperSetup {
+		ec.Rootfs, ec.Dir, ec.Credential = rootfs, cmd.Dir, cfg.credential
+		cmd.Dir = ""
+	}
+	if cmd.Err == nil {
+		if err := wrapWithHelper(cmd, ec); err != nil {
+			deleteCgroupOnErr(cgroup, err)
+			return nil, fmt.Errorf("%w: %w", ErrCommand, err)
+		}
+	}
 	cmd.SysProcAttr = &syscall.SysProcAttr{UseCgroupFD: true, CgroupFD: int(file.Fd())}
-	cmd.Stdout = w
-	cmd.Stderr = w
+	if rootfs != "" || helperSetup {
+		cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWNS
+	}
+	if rootfs != "" && !helperSetup {
+		cmd.SysProcAttr.Chroot = rootfs
+	}
+	if cred := cfg.credential; cred != nil && !helperSetup {
+		cmd.SysProcAttr.Credential = &syscall.Credential{
+			Uid:    cred.UID,
+			Gid:    cred.GID,
+			Groups: cred.Groups,
+		}
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if cfg.tty != nil {
+		// The job's process starts a new session with the terminal as its
+		// controlling terminal, Ctty is stdin's descriptor in the child.
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = cfg.tty, cfg.tty, cfg.tty
+		cmd.SysProcAttr.Setsid, cmd.SysProcAttr.Setctty, cmd.SysProcAttr.Ctty = true, true, 0
+	}
+	if cfg.decorateCmd != nil {
+		cfg.decorateCmd(cmd)
+	}
+	if err := ctx.Err(); err != nil {
+		deleteCgroupOnErr(cgroup, err)
+		return nil, fmt.Errorf("%w: start of command %v aborted: %w", ErrCommand, command, context.Cause(ctx))
+	}
 	if err := cmd.Start(); err != nil {
 		if err := deleteCgroup(cgroup); err != nil {
 			slog.Error("cannot delete failed job cgroup", "Status.ID", id, "cgroup", cgroup, "err", err)
 		}
 		return nil, fmt.Errorf("%w: cannot start command %v: %w", ErrCommand, command, err)
 	}
+	if opts.Paused {
+		if err := freezeStopped(cmd.Process.Pid, cgroup); err != nil {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			deleteCgroupOnErr(cgroup, err)
+			return nil, fmt.Errorf("%w: cannot start command %v paused: %w", ErrCommand, command, err)
+		}
+	}
 	return cmd, nil
 }
+
+// cldStopped is the siginfo code of a stopped child, CLD_STOPPED.
+const cldStopped = 5
+
+// freezeStopped waits until the process with the given pid, started paused,
+// has stopped itself in the exec helper. It then freezes the job's cgroup, so
+// that the process cannot be continued by SIGCONT until the job is resumed.
+func freezeStopped(pid int, cgroup string) error {
+	var info unix.Siginfo
+	// WNOWAIT leaves the child waitable for exec.Cmd.Wait.
+	if err := unix.Waitid(unix.P_PID, pid, &info, unix.WSTOPPED|unix.WEXITED|unix.WNOWAIT, nil); err != nil {
+		return fmt.Errorf("cannot wait for stop: %w", err)
+	}
+	if info.Code != cldStopped {
+		return fmt.Errorf("process exited before it stopped, siginfo code %d", info.Code)
+	}
+	return writeCgroupFile(cgroup, "cgroup.freeze", "1")
+}
+
+// resume thaws the cgroup of a job started paused and continues its stopped
+// process, which then executes the job's command.
+func (j *job) resume() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if !j.status.Running || !j.status.Paused {
+		return fmt.Errorf("%w: %q", ErrJobNotPaused, j.status.ID)
+	}
+	if err := j.thaw(); err != nil {
+		return err
+	}
+	j.status.Paused = false
+	j.startTimeout()
+	return nil
+}
+
+// thaw thaws the job's cgroup and continues its process, stopped in the exec
+// helper. It must be called with j.mutex held.
+func (j *job) thaw() error {
+	if err := writeCgroupFile(j.cgroup, "cgroup.freeze", "0"); err != nil {
+		return err
+	}
+	if err := j.cmd.Process.Signal(syscall.SIGCONT); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("cannot continue job %q: %w", j.status.ID, err)
+	}
+	return nil
+}
+
+// schedule marks the job, started paused, as scheduled and resumes it at
+// notBefore, see StartOptions.NotBefore. It must be called before wait.
+func (j *job) schedule(notBefore time.Time) {
+	j.mutex.Lock()
+	j.status.Paused, j.status.Scheduled = false, true
+	j.mutex.Unlock()
+	j.startTimer = time.AfterFunc(time.Until(notBefore), func() {
+		j.mutex.Lock()
+		defer j.mutex.Unlock()
+		if !j.status.Running || !j.status.Scheduled {
+			return // cancelled.
+		}
+		slog.Info("running scheduled job", "id", j.status.ID)
+		if err := j.thaw(); err != nil {
+			slog.Error("cannot run scheduled job", "id", j.status.ID, "err", err)
+			return
+		}
+		j.status.Scheduled = false
+		j.startTimeout()
+	})
+}
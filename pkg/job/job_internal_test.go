@@ -0,0 +1,667 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobNearMemoryLimit(t *testing.T) {
+	t.Parallel()
+	// A regular directory stands in for the job cgroup.
+	cgroup := t.TempDir()
+	inputCh := make(chan logInput)
+	defer close(inputCh)
+	j := &job{
+		status:     Status{ID: "1", Running: true},
+		owner:      "owner1",
+		cgroup:     cgroup,
+		dispatcher: newStartedLogDispatcher(inputCh, 0),
+	}
+	writeFile := func(name, content string) {
+		t.Helper()
+		require.NoError(t, os.WriteFile(filepath.Join(cgroup, name), []byte(content), 0o600))
+	}
+	require.False(t, j.getStatus().NearMemoryLimit) // no cgroup files
+
+	writeFile("memory.max", "max\n")
+	writeFile("memory.current", "1000000\n")
+	require.False(t, j.getStatus().NearMemoryLimit)
+
+	writeFile("memory.max", "1200000\n")
+	require.False(t, j.getStatus().NearMemoryLimit)
+	require.True(t, j.lastMemoryWarning.IsZero())
+
+	writeFile("memory.current", "1100000\n")
+	require.True(t, j.getStatus().NearMemoryLimit)
+	warned := j.lastMemoryWarning
+	require.False(t, warned.IsZero())
+	require.True(t, j.getStatus().NearMemoryLimit)
+	require.Equal(t, warned, j.lastMemoryWarning, "warning must be rate limited")
+}
+
+func TestJobLimitCPU(t *testing.T) {
+	t.Parallel()
+	// A regular directory stands in for the job cgroup.
+	cgroup := t.TempDir()
+	cpuStat := filepath.Join(cgroup, "cpu.stat")
+	require.NoError(t, os.WriteFile(cpuStat, []byte("usage_usec 40000\n"), 0o600))
+	cmd := exec.Command("sleep", "10")
+	require.NoError(t, cmd.Start())
+	inputCh := make(chan logInput)
+	defer close(inputCh)
+	j := &job{
+		status:     Status{ID: "1", Running: true},
+		cmd:        cmd,
+		cgroup:     cgroup,
+		dispatcher: newStartedLogDispatcher(inputCh, 0),
+	}
+
+	j.limitCPU(50*time.Millisecond, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	require.Zero(t, j.getStatus().TerminationReason)
+
+	require.NoError(t, os.WriteFile(cpuStat, []byte("usage_usec 60000\n"), 0o600))
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, syscall.SIGKILL, exitErr.Sys().(syscall.WaitStatus).Signal()) //nolint:forcetypeassert // always a WaitStatus on Linux.
+	require.Equal(t, TerminationCPULimit, j.getStatus().TerminationReason)
+}
+
+func TestTeeWriter(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	tee := newStartedOutputTee(&buf)
+	w1, w2 := newTeeWriter(tee, "1"), newTeeWriter(tee, "2")
+	for _, s := range []string{"a", "b\nc\n", "\n", "d"} {
+		_, err := w1.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	_, err := w2.Write([]byte("e\n"))
+	require.NoError(t, err)
+	tee.close()
+	require.Equal(t, "[1] ab\n[1] c\n[1] \n[1] d[2] e\n", buf.String())
+
+	// Output of jobs started concurrently with StopAll is dropped.
+	_, err = w1.Write([]byte("late\n"))
+	require.NoError(t, err)
+	tee.close()
+	require.Equal(t, "[1] ab\n[1] c\n[1] \n[1] d[2] e\n", buf.String())
+}
+
+func TestTeeWriterSlow(t *testing.T) {
+	t.Parallel()
+	unblock := make(chan struct{})
+	var n int
+	tee := newStartedOutputTee(writerFunc(func(b []byte) (int, error) {
+		<-unblock
+		n++
+		return len(b), nil
+	}))
+	w := newTeeWriter(tee, "1")
+	// The writer is blocked, so writes beyond the buffer must be dropped
+	// rather than block.
+	for range teeBufferSize + 10 {
+		_, err := w.Write([]byte("x\n"))
+		require.NoError(t, err)
+	}
+	require.Positive(t, tee.dropped.Load())
+	close(unblock)
+	tee.close()
+	require.Less(t, n, teeBufferSize+10)
+}
+
+// writerFunc adapts a function to an io.Writer.
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) { return f(b) }
+
+func TestFreezeStopped(t *testing.T) {
+	t.Parallel()
+	// A regular directory stands in for the job cgroup, so the process is
+	// only stopped, not frozen.
+	cgroup := t.TempDir()
+	var out bytes.Buffer
+	cmd := exec.Command("echo", "resumed")
+	cmd.Stdout = &out
+	require.NoError(t, wrapWithHelper(cmd, execConfig{Stop: true}))
+	require.NoError(t, cmd.Start())
+	require.NoError(t, freezeStopped(cmd.Process.Pid, cgroup))
+	b, err := os.ReadFile(filepath.Join(cgroup, "cgroup.freeze"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(b))
+
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, cmd.Process.Signal(syscall.SIGCONT))
+	require.NoError(t, cmd.Wait())
+	require.Equal(t, "resumed\n", out.String())
+
+	// Without exec helper, the process exits without stopping.
+	cmd = exec.Command("true")
+	require.NoError(t, cmd.Start())
+	require.Error(t, freezeStopped(cmd.Process.Pid, cgroup))
+	require.NoError(t, cmd.Wait())
+}
+
+func TestExecHelperUmask(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", "umask")
+	cmd.Stdout = &out
+	mask := 0o077
+	require.NoError(t, wrapWithHelper(cmd, execConfig{Umask: &mask}))
+	require.NoError(t, cmd.Run())
+	require.Equal(t, "0077\n", out.String())
+}
+
+func TestExecHelperMounts(t *testing.T) {
+	t.Parallel()
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	dir := t.TempDir()
+	source, sub, rw, ro := filepath.Join(dir, "source"), filepath.Join(dir, "sub"), filepath.Join(dir, "rw"), filepath.Join(dir, "ro")
+	for _, d := range []string{source, filepath.Join(source, "sub"), sub, rw, ro} {
+		require.NoError(t, os.Mkdir(d, 0o755))
+	}
+	require.NoError(t, os.Symlink(source, filepath.Join(dir, "link")))
+	run := func(mounts []Mount, script string) (string, error) {
+		t.Helper()
+		cmd := exec.Command("sh", "-c", script)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWNS}
+		require.NoError(t, wrapWithHelper(cmd, execConfig{Mounts: mounts}))
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	// The first mount is a submount of the read-only mount's source.
+	mounts := []Mount{
+		{Source: sub, Target: filepath.Join(source, "sub")},
+		{Source: source, Target: rw},
+		{Source: source, Target: ro, ReadOnly: true},
+	}
+	script := fmt.Sprintf("echo x > %s/x && echo rw ok; echo x > %s/x || echo ro failed; echo x > %s/sub/x || echo ro sub failed", rw, ro, ro)
+	out, err := run(mounts, script)
+	require.NoError(t, err)
+	require.Contains(t, out, "rw ok\n")
+	require.Contains(t, out, "ro failed\n")
+	require.Contains(t, out, "ro sub failed\n")
+
+	// Sources are resolved before, symbolic links are not followed.
+	out, err = run([]Mount{{Source: filepath.Join(dir, "link"), Target: rw}}, "true")
+	require.Error(t, err)
+	require.Contains(t, out, "cannot open mount source")
+}
+
+func TestExecHelperMountsRootfs(t *testing.T) {
+	t.Parallel()
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	if target, err := os.Readlink("/bin"); err != nil || target != "usr/bin" {
+		t.Skip("requires a merged /usr")
+	}
+	// The rootfs only holds the links of a merged /usr, the host's /usr is
+	// mounted in it.
+	root := t.TempDir()
+	require.NoError(t, os.Chmod(root, 0o755))
+	for _, name := range []string{"bin", "lib", "lib64", "sbin"} {
+		require.NoError(t, os.Symlink("usr/"+name, filepath.Join(root, name)))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(root, "usr"), 0o755))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "data"), 0o755))
+	data := t.TempDir()
+	require.NoError(t, os.Chmod(data, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(data, "file"), []byte("mounted\n"), 0o644))
+
+	var out bytes.Buffer
+	cmd := exec.Command("/usr/bin/sh", "-c", "cat file; pwd; id -u; id -G")
+	cmd.Stdout, cmd.Stderr = &out, &out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWNS}
+	require.NoError(t, wrapWithHelper(cmd, execConfig{
+		Mounts:     []Mount{{Source: "/usr", Target: "/usr", ReadOnly: true}, {Source: data, Target: "/data"}},
+		Rootfs:     root,
+		Dir:        "/data",
+		Credential: &Credential{UID: 65534, GID: 65534},
+	}))
+	require.NoError(t, cmd.Run(), out.String())
+	require.Equal(t, "mounted\n/data\n65534\n65534\n", out.String())
+}
+
+func TestRetryStartTransient(t *testing.T) {
+	t.Parallel()
+	want := &exec.Cmd{}
+	attempts := 0
+	start := func() (*exec.Cmd, error) {
+		attempts++
+		if attempts < startAttempts {
+			return nil, fmt.Errorf("%w: cannot start command: %w", ErrCommand, syscall.EAGAIN)
+		}
+		return want, nil
+	}
+	cmd, err := retryStart(context.Background(), "id", start)
+	require.NoError(t, err)
+	require.Same(t, want, cmd)
+	require.Equal(t, startAttempts, attempts)
+}
+
+func TestRetryStartExhausted(t *testing.T) {
+	t.Parallel()
+	attempts := 0
+	start := func() (*exec.Cmd, error) {
+		attempts++
+		return nil, syscall.EAGAIN
+	}
+	_, err := retryStart(context.Background(), "id", start)
+	require.ErrorIs(t, err, syscall.EAGAIN)
+	require.Equal(t, startAttempts, attempts)
+}
+
+func TestRetryStartNotTransient(t *testing.T) {
+	t.Parallel()
+	attempts := 0
+	start := func() (*exec.Cmd, error) {
+		attempts++
+		return nil, fmt.Errorf("%w: %w", ErrCommand, exec.ErrNotFound)
+	}
+	_, err := retryStart(context.Background(), "id", start)
+	require.ErrorIs(t, err, exec.ErrNotFound)
+	require.Equal(t, 1, attempts)
+}
+
+func TestJobSignalTerminated(t *testing.T) {
+	t.Parallel()
+	j := &job{status: Status{ID: "1"}} // terminated
+	require.ErrorIs(t, j.signal(syscall.SIGTERM), ErrJobNotRunning)
+	require.NoError(t, j.stop())
+}
+
+func TestJobEscalate(t *testing.T) {
+	t.Parallel()
+	// A regular directory stands in for the job cgroup.
+	cgroup := filepath.Join(t.TempDir(), "1")
+	require.NoError(t, os.Mkdir(cgroup, 0o700))
+	// The process only exits on the second SIGTERM.
+	cmd := exec.Command("sh", "-c", `n=0; trap 'n=$((n+1)); [ $n -ge 2 ] && exit 7' TERM; echo ready; while :; do sleep 0.01; done`)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	_, err = stdout.Read(make([]byte, 6)) // wait for the trap.
+	require.NoError(t, err)
+	j := &job{
+		status: Status{ID: "1", Running: true, ExitCode: NotTerminated},
+		cmd:    cmd,
+		cgroup: cgroup,
+		exited: make(chan struct{}),
+	}
+	go j.wait()
+
+	steps := []StopStep{
+		{Signal: syscall.SIGTERM},
+		{Signal: syscall.SIGTERM, Delay: 100 * time.Millisecond},
+		{Signal: syscall.SIGKILL, Delay: 5 * time.Second},
+	}
+	require.NoError(t, j.escalate(steps))
+	require.True(t, j.isRunning(), "first SIGTERM must not stop the job")
+	select {
+	case <-j.exited:
+	case <-time.After(3 * time.Second):
+		t.Fatal("job not stopped by second SIGTERM")
+	}
+	require.Equal(t, 7, j.getStatus().ExitCode)
+	require.ErrorIs(t, j.escalate(steps), ErrJobNotRunning)
+}
+
+func TestJobEscalatePaused(t *testing.T) {
+	t.Parallel()
+	// A regular directory stands in for the job cgroup, so the process is
+	// only stopped, not frozen. A stopped process ignores SIGTERM until it
+	// is continued.
+	cgroup := filepath.Join(t.TempDir(), "1")
+	require.NoError(t, os.Mkdir(cgroup, 0o700))
+	cmd := exec.Command("sleep", "60")
+	require.NoError(t, wrapWithHelper(cmd, execConfig{Stop: true}))
+	require.NoError(t, cmd.Start())
+	require.NoError(t, freezeStopped(cmd.Process.Pid, cgroup))
+	j := &job{
+		status: Status{ID: "1", Running: true, Paused: true, ExitCode: NotTerminated},
+		cmd:    cmd,
+		cgroup: cgroup,
+		exited: make(chan struct{}),
+	}
+	go j.wait()
+
+	require.NoError(t, j.escalate([]StopStep{{Signal: syscall.SIGTERM}}))
+	select {
+	case <-j.exited:
+	case <-time.After(3 * time.Second):
+		t.Fatal("paused job not stopped")
+	}
+	require.False(t, j.isRunning())
+}
+
+func TestJobTimeoutPaused(t *testing.T) {
+	t.Parallel()
+	// A regular directory stands in for the job cgroup, see
+	// TestJobEscalatePaused.
+	cgroup := filepath.Join(t.TempDir(), "1")
+	require.NoError(t, os.Mkdir(cgroup, 0o700))
+	cmd := exec.Command("sleep", "60")
+	require.NoError(t, wrapWithHelper(cmd, execConfig{Stop: true}))
+	require.NoError(t, cmd.Start())
+	require.NoError(t, freezeStopped(cmd.Process.Pid, cgroup))
+	j := &job{
+		status: Status{ID: "1", Running: true, Paused: true, ExitCode: NotTerminated},
+		cmd:    cmd,
+		cgroup: cgroup,
+		exited: make(chan struct{}),
+	}
+	go j.wait()
+
+	// The timeout does not count while the job is paused.
+	j.stopAfter(50 * time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+	require.True(t, j.isRunning(), "paused job stopped by timeout")
+
+	require.NoError(t, j.resume())
+	select {
+	case <-j.exited:
+	case <-time.After(3 * time.Second):
+		t.Fatal("resumed job not stopped after timeout")
+	}
+	require.Equal(t, TerminationTimeout, j.getStatus().TerminationReason)
+}
+
+//nolint:paralleltest // sets PATH.
+func TestLookWrappedCommand(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	require.NoError(t, err)
+	path, err := lookWrappedCommand("", "", "sh")
+	require.NoError(t, err)
+	require.Equal(t, sh, path)
+	_, err = lookWrappedCommand("", "", "no-such-command")
+	require.ErrorIs(t, err, exec.ErrNotFound)
+
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "usr/bin"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "usr/bin/tool"), nil, 0o755)) //nolint:gosec // executable test file.
+	require.NoError(t, os.WriteFile(filepath.Join(root, "usr/bin/data"), nil, 0o644)) //nolint:gosec // test file.
+	t.Setenv("PATH", "/usr/bin")
+	path, err = lookWrappedCommand(root, "", "tool")
+	require.NoError(t, err)
+	require.Equal(t, "/usr/bin/tool", path)
+	_, err = lookWrappedCommand(root, "", "sh") // not in the rootfs.
+	require.ErrorIs(t, err, exec.ErrNotFound)
+
+	// Commands with a slash are resolved relative to the working directory.
+	path, err = lookWrappedCommand(root, "/usr", "bin/tool")
+	require.NoError(t, err)
+	require.Equal(t, "bin/tool", path)
+	_, err = lookWrappedCommand(root, "", "bin/tool")
+	require.Error(t, err)
+	_, err = lookWrappedCommand(root, "", "/usr/bin/data")
+	require.ErrorIs(t, err, exec.ErrNotFound)
+}
+
+func TestValidateStopSchedule(t *testing.T) {
+	t.Parallel()
+	require.NoError(t, validateStopSchedule(nil))
+	require.NoError(t, validateStopSchedule([]StopStep{{Signal: syscall.SIGINT}, {Signal: syscall.SIGKILL, Delay: time.Second}}))
+	require.ErrorIs(t, validateStopSchedule([]StopStep{{Signal: syscall.SIGSTOP}}), ErrSignal)
+	require.ErrorIs(t, validateStopSchedule([]StopStep{{Signal: syscall.SIGTERM, Delay: time.Second}}), ErrSignal)
+	require.ErrorIs(t, validateStopSchedule([]StopStep{{Signal: syscall.SIGTERM}, {Signal: syscall.SIGKILL, Delay: -time.Second}}), ErrSignal)
+
+	_, err := NewController(WithStopSchedule([]StopStep{{Signal: syscall.SIGSTOP}}))
+	require.ErrorIs(t, err, ErrSignal)
+}
+
+func TestJobTerminationEventType(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		job  *job
+		want LifecycleEventType
+	}{
+		"exited":    {job: &job{status: Status{ExitCode: 0}}, want: LifecycleExited},
+		"failed":    {job: &job{status: Status{ExitCode: 3}}, want: LifecycleFailed},
+		"killed":    {job: &job{status: Status{ExitCode: TerminatedBySignal}}, want: LifecycleFailed},
+		"stopped":   {job: &job{status: Status{ExitCode: TerminatedBySignal}, signaled: true}, want: LifecycleStopped},
+		"stopped 0": {job: &job{status: Status{ExitCode: 0}, signaled: true}, want: LifecycleStopped},
+		"cpu limit": {job: &job{status: Status{ExitCode: TerminatedBySignal, TerminationReason: TerminationCPULimit}, signaled: true}, want: LifecycleStopped},
+		"timeout":   {job: &job{status: Status{ExitCode: TerminatedBySignal, TerminationReason: TerminationTimeout}, signaled: true}, want: LifecycleTimeout},
+		"oom":       {job: &job{status: Status{ExitCode: TerminatedBySignal}, oomKilled: true}, want: LifecycleOOM},
+		"oom child": {job: &job{status: Status{ExitCode: 0}, oomKilled: true}, want: LifecycleExited},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tc.want, tc.job.terminationEventType())
+		})
+	}
+}
+
+func TestOOMKillCount(t *testing.T) {
+	t.Parallel()
+	// A regular directory stands in for the job cgroup.
+	cgroup := t.TempDir()
+	require.Zero(t, oomKillCount(cgroup)) // no memory controller
+	events := "low 0\nhigh 0\nmax 4\noom 2\noom_kill 1\noom_group_kill 0\n"
+	require.NoError(t, os.WriteFile(filepath.Join(cgroup, "memory.events"), []byte(events), 0o600))
+	require.Equal(t, uint64(1), oomKillCount(cgroup))
+}
+
+func TestJSONEventWriter(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	w := newJSONEventWriter(&buf)
+	started := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	status := Status{ID: "1", Command: "sh", Args: []string{"-c", "exit 3"}, Started: started, Running: true, ExitCode: NotTerminated}
+	w.write(newLifecycleEvent(LifecycleStarted, "owner1", status))
+	status.Running, status.ExitCode, status.Stopped = false, 3, started.Add(time.Second)
+	w.write(newLifecycleEvent(LifecycleFailed, "owner1", status))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+	delete(got, "time")
+	want := map[string]any{"type": "started", "id": "1", "owner": "owner1", "command": "sh", "args": []any{"-c", "exit 3"}, "started": "2024-01-02T03:04:05Z"}
+	require.Equal(t, want, got)
+
+	got = nil
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &got))
+	require.Equal(t, "failed", got["type"])
+	require.Equal(t, "2024-01-02T03:04:06Z", got["stopped"])
+	require.InDelta(t, 3, got["exit_code"], 0)
+}
+
+func TestJobWaitOnce(t *testing.T) {
+	t.Parallel()
+	// A regular directory stands in for the job cgroup.
+	cgroup := filepath.Join(t.TempDir(), "1")
+	require.NoError(t, os.Mkdir(cgroup, 0o700))
+	cmd := exec.Command("sh", "-c", "exit 3")
+	require.NoError(t, cmd.Start())
+	j := &job{
+		status:     Status{ID: "1", Running: true, ExitCode: NotTerminated},
+		cmd:        cmd,
+		cgroup:     cgroup,
+		dispatcher: newStartedLogDispatcher(make(chan logInput), 0),
+		exited:     make(chan struct{}),
+	}
+
+	// Concurrent waits neither panic on closing the log input twice nor
+	// overwrite the exit code with the error of a second exec.Cmd.Wait.
+	const n = 10
+	statuses := make(chan Status, n)
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			j.wait()
+			statuses <- j.getStatus()
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	first := j.getStatus()
+	require.False(t, first.Running)
+	require.Equal(t, 3, first.ExitCode)
+	for status := range statuses {
+		require.Equal(t, first, status)
+	}
+
+	j.wait()
+	require.Equal(t, first, j.getStatus())
+}
+
+func TestJobWaitKillProcs(t *testing.T) {
+	t.Parallel()
+	// A regular directory without cgroup.kill stands in for the job cgroup
+	// on kernels before Linux 5.14.
+	cgroup := filepath.Join(t.TempDir(), "1")
+	require.NoError(t, os.Mkdir(cgroup, 0o700))
+	require.Equal(t, killCgroupProcs, detectKillStrategy(cgroup))
+	child := exec.Command("sleep", "100")
+	require.NoError(t, child.Start())
+	procs := fmt.Sprintf("%d\n", child.Process.Pid)
+	require.NoError(t, os.WriteFile(filepath.Join(cgroup, "cgroup.procs"), []byte(procs), 0o600))
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Start())
+	j := &job{
+		status: Status{ID: "1", Running: true, ExitCode: NotTerminated},
+		cmd:    cmd,
+		cgroup: cgroup,
+		exited: make(chan struct{}),
+		kill:   detectKillStrategy(cgroup),
+	}
+
+	j.wait()
+	err := child.Wait()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, syscall.SIGKILL, exitErr.Sys().(syscall.WaitStatus).Signal()) //nolint:forcetypeassert // always a WaitStatus on Linux.
+	require.NoFileExists(t, filepath.Join(cgroup, "cgroup.kill"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(cgroup, "cgroup.kill"), nil, 0o600))
+	require.Equal(t, killCgroupFile, detectKillStrategy(cgroup))
+}
+
+func TestJobWaitTTYChildOutlivesJob(t *testing.T) {
+	t.Parallel()
+	// A regular directory without cgroup.kill stands in for the job cgroup.
+	// The child keeps the terminal's slave side open after the job's
+	// process has exited, like a background job of an interactive shell.
+	cgroup := filepath.Join(t.TempDir(), "1")
+	require.NoError(t, os.Mkdir(cgroup, 0o700))
+	master, slave, err := openPTY()
+	require.NoError(t, err)
+	child := exec.Command("sleep", "100")
+	child.Stdin, child.Stdout, child.Stderr = slave, slave, slave
+	require.NoError(t, child.Start())
+	require.NoError(t, slave.Close())
+	procs := fmt.Sprintf("%d\n", child.Process.Pid)
+	require.NoError(t, os.WriteFile(filepath.Join(cgroup, "cgroup.procs"), []byte(procs), 0o600))
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Start())
+	j := &job{
+		status:  Status{ID: "1", Running: true, ExitCode: NotTerminated},
+		cmd:     cmd,
+		cgroup:  cgroup,
+		exited:  make(chan struct{}),
+		kill:    killCgroupProcs,
+		tty:     master,
+		ttyDone: make(chan struct{}),
+	}
+	go func() {
+		defer close(j.ttyDone)
+		_, _ = io.Copy(io.Discard, master)
+	}()
+
+	go j.wait()
+	select {
+	case <-j.exited:
+	case <-time.After(3 * time.Second):
+		t.Fatal("job not reaped while a child holds its terminal")
+	}
+	require.False(t, j.isRunning())
+	require.Error(t, child.Wait())
+}
+
+func TestOpenPTY(t *testing.T) {
+	t.Parallel()
+	master, slave, err := openPTY()
+	require.NoError(t, err)
+	defer master.Close() //nolint:errcheck // read-only use in test.
+
+	_, err = slave.WriteString("hi\n")
+	require.NoError(t, err)
+	require.NoError(t, slave.Close())
+	b := make([]byte, 10)
+	n, err := master.Read(b)
+	require.NoError(t, err)
+	require.Equal(t, "hi\r\n", string(b[:n])) // the terminal translates newlines.
+	_, err = master.Read(b)
+	require.ErrorIs(t, err, syscall.EIO)
+}
+
+func TestJobWriteInputNoTerminal(t *testing.T) {
+	t.Parallel()
+	j := &job{status: Status{ID: "1", Running: true}}
+	require.ErrorIs(t, j.writeInput([]byte("x")), ErrNoTerminal)
+}
+
+func TestJobAttachInput(t *testing.T) {
+	t.Parallel()
+	master, slave, err := openPTY()
+	require.NoError(t, err)
+	defer master.Close() //nolint:errcheck // closed with the job in production.
+	defer slave.Close()  //nolint:errcheck // read-only use in test.
+	j := &job{status: Status{ID: "1", Running: true}, tty: master}
+
+	input, err := j.attachInput()
+	require.NoError(t, err)
+	_, err = j.attachInput()
+	require.ErrorIs(t, err, ErrInputAttached)
+	require.ErrorIs(t, j.writeInput([]byte("x")), ErrInputAttached)
+
+	_, err = input.Write([]byte("hi\n"))
+	require.NoError(t, err)
+	b := make([]byte, 10)
+	n, err := slave.Read(b)
+	require.NoError(t, err)
+	require.Equal(t, "hi\n", string(b[:n]))
+
+	// Closing the writer releases the claim.
+	require.NoError(t, input.Close())
+	require.NoError(t, input.Close())
+	input, err = j.attachInput()
+	require.NoError(t, err)
+	require.NoError(t, input.Close())
+
+	// A terminal closed as the job has just terminated is reported like a
+	// terminated job.
+	input, err = j.attachInput()
+	require.NoError(t, err)
+	require.NoError(t, master.Close())
+	_, err = input.Write([]byte("x"))
+	require.ErrorIs(t, err, ErrJobNotRunning)
+	require.NoError(t, input.Close())
+
+	j.status.Running = false
+	_, err = j.attachInput()
+	require.ErrorIs(t, err, ErrJobNotRunning)
+}
@@ -0,0 +1,115 @@
+package job
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// killStrategy is how the processes of a job's cgroup are killed once the
+// job's process has terminated, see detectKillStrategy.
+type killStrategy int
+
+const (
+	// killCgroupFile kills all processes of the cgroup by writing its
+	// cgroup.kill file, available since Linux 5.14.
+	killCgroupFile killStrategy = iota
+	// killCgroupProcs sends SIGKILL to each process listed in the cgroup's
+	// cgroup.procs file, for older kernels.
+	killCgroupProcs
+)
+
+// stopAllKillGrace is the time StopAll waits for the jobs killed after the
+// timeout set with WithStopAllTimeout to terminate, see waitJobs.
+const stopAllKillGrace = time.Second
+
+// killProcsRounds is the maximum number of times cgroup.procs is read and
+// its processes are killed by the killCgroupProcs strategy, as processes may
+// fork while they are being killed.
+const killProcsRounds = 10
+
+func (s killStrategy) String() string {
+	if s == killCgroupProcs {
+		return "cgroup.procs"
+	}
+	return "cgroup.kill"
+}
+
+// detectKillStrategy returns killCgroupFile if the given cgroup, which must
+// not be the root cgroup, has a cgroup.kill file and killCgroupProcs
+// otherwise.
+func detectKillStrategy(cgroup string) killStrategy {
+	if _, err := os.Stat(filepath.Join(cgroup, "cgroup.kill")); err != nil {
+		return killCgroupProcs
+	}
+	return killCgroupFile
+}
+
+// killCgroup kills all processes of the given cgroup with the given strategy.
+func killCgroup(cgroup string, strategy killStrategy) error {
+	if strategy == killCgroupProcs {
+		return killProcs(cgroup)
+	}
+	return writeCgroupFile(cgroup, "cgroup.kill", "1")
+}
+
+// killProcs sends SIGKILL to the processes listed in the cgroup.procs file of
+// the given cgroup, until no process is listed that has not been killed yet.
+// Unlike writing cgroup.kill, this is not atomic: a process forked after
+// cgroup.procs has been read is only killed in a later round, for at most
+// killProcsRounds rounds. A missing cgroup.procs file is not an error, as the
+// cgroup has no processes left.
+func killProcs(cgroup string) error {
+	killed := map[int]bool{}
+	for range killProcsRounds {
+		pids, err := cgroupPIDs(cgroup)
+		if err != nil {
+			return err
+		}
+		n := 0
+		for _, pid := range pids {
+			if killed[pid] {
+				continue
+			}
+			if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+				return fmt.Errorf("%w: cannot kill process %d of cgroup %q: %w", ErrCgroup, pid, cgroup, err)
+			}
+			killed[pid] = true
+			n++
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: processes of cgroup %q still forking after %d rounds of kills", ErrCgroup, cgroup, killProcsRounds)
+}
+
+// cgroupPIDs returns the process IDs listed in the cgroup.procs file of the
+// given cgroup, or none if the file does not exist.
+func cgroupPIDs(cgroup string) ([]int, error) {
+	b, err := os.ReadFile(filepath.Join(cgroup, "cgroup.procs"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot read processes of cgroup %q: %w", ErrCgroup, cgroup, err)
+	}
+	var pids []int
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		// Non-positive IDs would signal process groups.
+		pid, err := strconv.Atoi(scanner.Text())
+		if err != nil || pid <= 0 {
+			return nil, fmt.Errorf("%w: invalid process ID %q in cgroup %q", ErrCgroup, scanner.Text(), cgroup)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
@@ -1,40 +1,128 @@
 package job
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"slices"
+	"sync"
+	"sync/atomic"
 )
 
-// channelWriter implements io.Writer by sending byte slices to a channel.
-type channelWriter chan []byte
+// logInput is a piece of log data written to one of the job's output streams.
+type logInput struct {
+	stream Stream
+	data   []byte
+}
+
+// channelWriter implements io.Writer by sending byte slices tagged with the
+// output stream to a channel. If digest is not nil, the data is also added to
+// the digest.
+type channelWriter struct {
+	ch     chan<- logInput
+	stream Stream
+	digest *outputDigest
+}
 
 // Write implements io.Writer by sending the provided byte slice to the channel.
 //
 // A copy of the byte slice is sent to prevent race conditions.
 func (w channelWriter) Write(b []byte) (int, error) {
-	w <- slices.Clone(b) // Send a copy to avoid data races on the underlying array.
+	if w.digest != nil {
+		// Hold the lock while sending, so that the digest covers the data of
+		// all output streams in the order the dispatcher receives it.
+		w.digest.mutex.Lock()
+		defer w.digest.mutex.Unlock()
+		w.digest.hash.Write(b)
+	}
+	w.ch <- logInput{stream: w.stream, data: slices.Clone(b)} // Send a copy to avoid data races on the underlying array.
 	return len(b), nil
 }
 
+// outputDigest is a running SHA-256 digest of a job's total output, shared by
+// the channelWriters of the job's output streams.
+type outputDigest struct {
+	mutex sync.Mutex
+	hash  hash.Hash
+}
+
+// newOutputDigest returns a new, empty output digest.
+func newOutputDigest() *outputDigest {
+	return &outputDigest{hash: sha256.New()}
+}
+
+// sum returns the hex encoded digest of the output written so far.
+func (d *outputDigest) sum() string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// logChunk is a piece of log data of a single output stream together with its
+// absolute offset in the log stream.
+type logChunk struct {
+	offset uint64
+	stream Stream
+	data   []byte
+}
+
+// logSegment marks the absolute offset in the log stream from which on log
+// data belongs to the given output stream, up to the offset of the next
+// segment.
+type logSegment struct {
+	offset uint64
+	stream Stream
+}
+
 // logResponseCh is a channel for receiving log data.
-type logResponseCh chan []byte
+type logResponseCh chan logChunk
 
 // logRequest represents a request for log data, specifying the starting index
-// and a channel for receiving the response.
+// and a channel for receiving the response. If fromEnd is set, startIdx is
+// ignored and the request starts at the current end of the log.
 type logRequest struct {
 	startIdx uint64
+	fromEnd  bool
+	tail     uint64 // with fromEnd, start tail bytes before the end.
+	noFollow bool
 	respCh   logResponseCh
 }
 
 // logDispatcher distributes log data received on an input channel to multiple
 // readers.
+//
+// If maxBytes is greater than zero, the dispatcher only buffers the most recent
+// maxBytes of log data and discards older data. The offset field holds the
+// absolute offset of the first buffered byte, that is the number of bytes that
+// have been discarded so far.
+//
+// The output stream of the buffered log data is tracked in segments, ordered
+// by offset. The first segment may start before offset if its beginning has
+// been discarded.
 type logDispatcher struct {
-	inputCh chan []byte
-	reqCh   chan logRequest
-	doneCh  chan logResponseCh
-	fullLog []byte
+	inputCh  chan logInput
+	reqCh    chan logRequest
+	doneCh   chan logResponseCh
+	fullLog  []byte
+	segments []logSegment
+	offset   uint64
+	maxBytes int
+
+	// maxBuffered is the high-water mark of len(fullLog) before trim. It is
+	// read outside the dispatcher's goroutine for job status.
+	maxBuffered atomic.Int64
+
+	// endOffset is end(). It is read outside the dispatcher's goroutine to
+	// position follow-only readers when they are created.
+	endOffset atomic.Uint64
+
+	// followerCount is len(followers). It is read outside the dispatcher's
+	// goroutine for debug stats.
+	followerCount atomic.Int64
 
 	// followers is a set of log response channels waiting to receive the next
 	// piece of future log data. Followers are removed from this set after the
@@ -43,13 +131,15 @@ type logDispatcher struct {
 }
 
 // newStartedLogDispatcher creates and starts a new logDispatcher. The
-// dispatcher runs in its own goroutine.
-func newStartedLogDispatcher(inputCh chan []byte) *logDispatcher {
+// dispatcher runs in its own goroutine. A maxBytes value of zero buffers the
+// full log.
+func newStartedLogDispatcher(inputCh chan logInput, maxBytes int) *logDispatcher {
 	l := &logDispatcher{
 		inputCh:   inputCh,
 		reqCh:     make(chan logRequest),
 		doneCh:    make(chan logResponseCh),
 		followers: make(map[logResponseCh]bool),
+		maxBytes:  maxBytes,
 	}
 	go l.start()
 	return l
@@ -60,11 +150,11 @@ func newStartedLogDispatcher(inputCh chan []byte) *logDispatcher {
 func (l *logDispatcher) start() {
 	for {
 		select {
-		case b, ok := <-l.inputCh:
+		case in, ok := <-l.inputCh:
 			if !ok {
 				l.handleInputClosed()
 			} else {
-				l.handleInput(b)
+				l.handleInput(in)
 			}
 		case req := <-l.reqCh:
 			l.handleRequest(req)
@@ -74,6 +164,7 @@ func (l *logDispatcher) start() {
 				close(respCh)
 			}
 		}
+		l.followerCount.Store(int64(len(l.followers)))
 	}
 }
 
@@ -81,17 +172,65 @@ func (l *logDispatcher) start() {
 //
 // If the input channel is closed, it notifies all followers and cleans up.
 // Otherwise, it appends the new data to the full log and sends it to all
-// current followers.
-func (l *logDispatcher) handleInput(b []byte) {
-	l.fullLog = append(l.fullLog, b...)
+// current followers. Empty data is ignored, followers keep waiting for data.
+func (l *logDispatcher) handleInput(in logInput) {
+	if len(in.data) == 0 {
+		return
+	}
+	chunk := logChunk{offset: l.end(), stream: in.stream, data: in.data}
+	if len(l.segments) == 0 || l.segments[len(l.segments)-1].stream != in.stream {
+		l.segments = append(l.segments, logSegment{offset: l.end(), stream: in.stream})
+	}
+	l.fullLog = append(l.fullLog, in.data...)
+	if n := int64(len(l.fullLog)); n > l.maxBuffered.Load() {
+		l.maxBuffered.Store(n)
+	}
+	l.trim()
+	l.endOffset.Store(l.end())
 	for follower := range l.followers {
 		// A follower is always waiting for a response on a buffered channel,
 		// this never blocks.
-		follower <- b
+		follower <- chunk
 	}
 	clear(l.followers)
 }
 
+// trim discards the oldest log data if the buffered log exceeds maxBytes.
+//
+// The remaining data is copied to a new slice rather than shifted in place, as
+// readers may still hold slices of the previous backing array.
+func (l *logDispatcher) trim() {
+	if l.maxBytes <= 0 || len(l.fullLog) <= l.maxBytes {
+		return
+	}
+	n := len(l.fullLog) - l.maxBytes
+	l.fullLog = slices.Clone(l.fullLog[n:])
+	l.offset += uint64(n) //nolint:gosec // n is positive.
+	for len(l.segments) > 1 && l.segments[1].offset <= l.offset {
+		l.segments = l.segments[1:]
+	}
+}
+
+// segmentEnd returns the output stream of the log data at the given absolute
+// offset and the offset at which the data of this stream ends.
+func (l *logDispatcher) segmentEnd(offset uint64) (Stream, uint64) {
+	i, found := slices.BinarySearchFunc(l.segments, offset, func(seg logSegment, offset uint64) int {
+		return cmp.Compare(seg.offset, offset)
+	})
+	if !found {
+		i-- // offset is within the previous segment.
+	}
+	if i+1 < len(l.segments) {
+		return l.segments[i].stream, l.segments[i+1].offset
+	}
+	return l.segments[i].stream, l.end()
+}
+
+// end returns the absolute offset of the end of the log stream.
+func (l *logDispatcher) end() uint64 {
+	return l.offset + uint64(len(l.fullLog))
+}
+
 func (l *logDispatcher) handleInputClosed() {
 	l.inputCh = nil
 	for follower := range l.followers {
@@ -102,34 +241,106 @@ func (l *logDispatcher) handleInputClosed() {
 
 // handleRequest processes a log request.
 //
-// If the requested data is already available, it is sent to the requester.
-// Otherwise, the requester is added as a follower to receive future log data.
-// If the input channel is closed, the response channel is closed immediately.
+// If the requested data is already available, it is sent to the requester, up
+// to the end of its output stream's segment. If the requested data has already
+// been discarded, the oldest buffered data is sent instead; the offset of the
+// response tells the requester where the data starts. Otherwise, the
+// requester is added as a follower to receive future log data. If the input
+// channel is closed or the requester does not follow the log, the response
+// channel is closed immediately.
+//
+// Requests from the end of the log are resolved here, within the dispatcher
+// loop, so that they cannot race with appended log data.
 func (l *logDispatcher) handleRequest(req logRequest) {
 	respCh := req.respCh
+	startIdx := req.startIdx
+	if req.fromEnd {
+		startIdx = l.end() - min(req.tail, uint64(len(l.fullLog)))
+	}
 	switch {
-	case req.startIdx < uint64(len(l.fullLog)):
-		respCh <- l.fullLog[req.startIdx:]
-	case l.inputCh != nil:
+	case startIdx < l.end():
+		start := max(startIdx, l.offset)
+		stream, end := l.segmentEnd(start)
+		respCh <- logChunk{offset: start, stream: stream, data: l.fullLog[start-l.offset : end-l.offset]}
+	case l.inputCh != nil && !req.noFollow:
 		l.followers[respCh] = true
 	default:
 		close(respCh)
 	}
 }
 
-// newReader creates a new io.Reader for reading logs from the dispatcher.
+// newReader creates a new StreamReader for reading logs from the dispatcher.
 //
 // Each call to newReader creates a new, independent reader with its own
 // dedicated response channel. The provided context controls the lifetime of
 // the reader. When the context is cancelled, pending and subsequent calls to
 // Read will return an error.
-func (l *logDispatcher) newReader(ctx context.Context) io.Reader {
-	return &logReader{
+func (l *logDispatcher) newReader(ctx context.Context, opts ...LogsOption) StreamReader {
+	lr := &logReader{
 		startIdx:   0,
 		respCh:     make(logResponseCh, 1),
 		ctx:        ctx,
 		dispatcher: l,
 	}
+	for _, opt := range opts {
+		opt(lr)
+	}
+	return lr
+}
+
+// LogsOption is a functional option for log readers.
+type LogsOption func(*logReader)
+
+// FollowOnly makes log readers skip all log data written before they were
+// created and only return log data written afterwards.
+func FollowOnly() LogsOption {
+	return func(lr *logReader) {
+		lr.startIdx = lr.dispatcher.endOffset.Load()
+		lr.fromEnd, lr.tail = false, 0
+	}
+}
+
+// FromStart requires log readers to read the log from its very beginning.
+//
+// By default, log readers silently skip log data that has been discarded
+// because the log exceeded the controller's maximum log size. With FromStart,
+// Read returns an error wrapping [ErrLogTruncated] instead.
+func FromStart() LogsOption {
+	return func(lr *logReader) {
+		lr.fromStart = true
+	}
+}
+
+// FromOffset makes log readers start at the given absolute offset in the log,
+// such as the offset after the last byte read by a previous reader, as
+// reported by [StreamReader.Offset]. Like with [FromStart], Read returns an
+// error wrapping [ErrLogTruncated] if data at the offset has been discarded.
+// A reader starting beyond the current end of the log waits for log data up
+// to the offset.
+func FromOffset(offset uint64) LogsOption {
+	return func(lr *logReader) {
+		lr.startIdx = offset
+		lr.fromStart = true
+	}
+}
+
+// Tail makes log readers start n bytes before the end of the log at their
+// first call to Read, or at the oldest buffered log data if fewer bytes are
+// buffered. Unlike [FollowOnly], which starts at the end of the log when the
+// reader is created, Tail(0) skips all log data written before the first Read.
+func Tail(n uint64) LogsOption {
+	return func(lr *logReader) {
+		lr.fromEnd = true
+		lr.tail = n
+	}
+}
+
+// NoFollow makes log readers return io.EOF once they have read all log data
+// written so far, rather than waiting for further log data of running jobs.
+func NoFollow() LogsOption {
+	return func(lr *logReader) {
+		lr.noFollow = true
+	}
 }
 
 // closeInput closes the log dispatcher's input channel, signaling that no more
@@ -144,10 +355,17 @@ func (l *logDispatcher) closeInput() {
 // logReader reads log data from a logDispatcher.
 //
 // A logReader requests log data in discrete chunks from the dispatcher using a
-// dedicated response channel. It maintains a start index to track the position
-// of the next read.
+// dedicated response channel. It maintains a start index to track the absolute
+// position of the next read and the output stream and offset of the most
+// recent read.
 type logReader struct {
 	startIdx   uint64
+	stream     Stream
+	offset     uint64
+	fromStart  bool
+	fromEnd    bool   // start at the end of the log with the next Read.
+	tail       uint64 // with fromEnd, start tail bytes before the end.
+	noFollow   bool
 	respCh     logResponseCh
 	ctx        context.Context //nolint:containedctx // The context is used to cancel Read.
 	dispatcher *logDispatcher
@@ -161,28 +379,69 @@ type logReader struct {
 //
 // If the context is cancelled, Read returns an error wrapping the context
 // error. If the response channel is closed, Read returns io.EOF, indicating
-// the end of the log stream. Otherwise, Read copies the received data into p
-// and updates the start index.
+// the end of the log stream. If the requested data has been discarded, Read
+// skips ahead to the oldest available data, or returns an error wrapping
+// ErrLogTruncated if the reader was created with [FromStart]. Otherwise, Read
+// copies the received data into p and updates the start index. The data read
+// by a single call to Read always belongs to a single output stream.
+//
+// Read never returns zero bytes without error for a non-empty p: empty chunks
+// are skipped and the next chunk is requested instead.
 func (lr *logReader) Read(p []byte) (int, error) {
 	if lr.ctx.Err() != nil {
 		return 0, fmt.Errorf("log reader context already done: %w", lr.ctx.Err())
 	}
-	if lr.respCh == nil {
-		return 0, io.EOF
-	}
-	req := logRequest{startIdx: lr.startIdx, respCh: lr.respCh}
-	lr.dispatcher.reqCh <- req
-	select {
-	case <-lr.ctx.Done():
-		lr.dispatcher.doneCh <- req.respCh
-		return 0, fmt.Errorf("log reader context received done: %w", lr.ctx.Err())
-	case b, ok := <-lr.respCh:
-		if !ok {
-			lr.respCh = nil
+	for {
+		if lr.respCh == nil {
 			return 0, io.EOF
 		}
-		n := copy(p, b)
-		lr.startIdx += uint64(n) //nolint:gosec // n cannot be negative.
-		return n, nil
+		req := logRequest{startIdx: lr.startIdx, fromEnd: lr.fromEnd, tail: lr.tail, noFollow: lr.noFollow, respCh: lr.respCh}
+		lr.dispatcher.reqCh <- req
+		select {
+		case <-lr.ctx.Done():
+			lr.dispatcher.doneCh <- req.respCh
+			return 0, fmt.Errorf("log reader context received done: %w", lr.ctx.Err())
+		case chunk, ok := <-lr.respCh:
+			if !ok {
+				lr.respCh = nil
+				return 0, io.EOF
+			}
+			if lr.fromEnd {
+				lr.startIdx = chunk.offset
+				lr.fromEnd = false
+			}
+			if chunk.offset > lr.startIdx {
+				if lr.fromStart {
+					return 0, fmt.Errorf("%w: data from offset %d to %d discarded", ErrLogTruncated, lr.startIdx, chunk.offset)
+				}
+				lr.startIdx = chunk.offset
+			}
+			data := chunk.data
+			if skip := lr.startIdx - chunk.offset; skip > 0 {
+				// Only followers of a reader started beyond the end of the
+				// log receive data before their start index.
+				data = data[min(skip, uint64(len(data))):]
+			}
+			if len(data) == 0 {
+				continue
+			}
+			n := copy(p, data)
+			lr.offset = lr.startIdx
+			lr.startIdx += uint64(n) //nolint:gosec // n cannot be negative.
+			lr.stream = chunk.stream
+			return n, nil
+		}
 	}
 }
+
+// Stream returns the output stream of the data returned by the most recent
+// call to Read.
+func (lr *logReader) Stream() Stream {
+	return lr.stream
+}
+
+// Offset returns the absolute offset in the log of the data returned by the
+// most recent call to Read.
+func (lr *logReader) Offset() uint64 {
+	return lr.offset
+}
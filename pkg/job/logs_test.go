@@ -2,7 +2,10 @@ package job
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"math/rand"
 	"strings"
@@ -15,12 +18,12 @@ import (
 
 func TestLogsSimple(t *testing.T) {
 	t.Parallel()
-	inputCh := make(chan []byte)
+	inputCh := make(chan logInput)
 	go func() {
-		inputCh <- []byte("hello")
+		inputCh <- stdoutInput([]byte("hello"))
 		close(inputCh)
 	}()
-	dispatcher := newStartedLogDispatcher(inputCh)
+	dispatcher := newStartedLogDispatcher(inputCh, 0)
 	r := dispatcher.newReader(context.Background())
 	b := make([]byte, 10)
 	n, err := r.Read(b)
@@ -33,11 +36,11 @@ func TestLogsSimple(t *testing.T) {
 
 func TestLogsNoInput(t *testing.T) {
 	t.Parallel()
-	inputCh := make(chan []byte)
+	inputCh := make(chan logInput)
 	go func() {
 		close(inputCh)
 	}()
-	dispatcher := newStartedLogDispatcher(inputCh)
+	dispatcher := newStartedLogDispatcher(inputCh, 0)
 	r := dispatcher.newReader(context.Background())
 	b := make([]byte, 10)
 	n, err := r.Read(b)
@@ -50,10 +53,10 @@ func TestLogsWithManyReaders(t *testing.T) {
 	t.Parallel()
 	const readerCount = 100
 
-	inputCh := make(chan []byte)
-	dispatcher := newStartedLogDispatcher(inputCh)
+	inputCh := make(chan logInput)
+	dispatcher := newStartedLogDispatcher(inputCh, 0)
 	go func() {
-		inputCh <- []byte("hello")
+		inputCh <- stdoutInput([]byte("hello"))
 		close(inputCh)
 	}()
 	readers := make([]io.Reader, readerCount)
@@ -75,9 +78,9 @@ func TestLogsWithManyDelayedReaders(t *testing.T) {
 	const delay = 100 * time.Millisecond
 	const text = "Hello slow, slow world!"
 
-	inputCh := make(chan []byte)
+	inputCh := make(chan logInput)
 
-	dispatcher := newStartedLogDispatcher(inputCh)
+	dispatcher := newStartedLogDispatcher(inputCh, 0)
 	go inputSlowly(inputCh, text, delay)
 	wg := &sync.WaitGroup{}
 	wg.Add(readerCount)
@@ -107,9 +110,9 @@ func (sr *slowReader) Read(b []byte) (int, error) {
 
 func TestLogsWithCancel(t *testing.T) {
 	t.Parallel()
-	inputCh := make(chan []byte)
+	inputCh := make(chan logInput)
 	ctx, cancel := context.WithCancel(context.Background())
-	dispatcher := newStartedLogDispatcher(inputCh)
+	dispatcher := newStartedLogDispatcher(inputCh, 0)
 
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
@@ -126,12 +129,308 @@ func TestLogsWithCancel(t *testing.T) {
 	waitWithTimeout(t, wg, time.Second)
 
 	// ensure we can read historical logs
-	inputCh <- []byte("hi")
+	inputCh <- stdoutInput([]byte("hi"))
 	r = dispatcher.newReader(context.Background())
 	close(inputCh)
 	requireRead(t, r, 1, "hi")
 }
 
+func TestLogsTruncated(t *testing.T) {
+	t.Parallel()
+	inputCh := make(chan logInput)
+	dispatcher := newStartedLogDispatcher(inputCh, 5)
+	inputCh <- stdoutInput([]byte("hello"))
+	inputCh <- stdoutInput([]byte(" world"))
+	close(inputCh)
+
+	requireRead(t, dispatcher.newReader(context.Background()), 10, "world")
+
+	r := dispatcher.newReader(context.Background(), FromStart())
+	_, err := r.Read(make([]byte, 10))
+	require.ErrorIs(t, err, ErrLogTruncated)
+}
+
+func TestLogsFromStartNotTruncated(t *testing.T) {
+	t.Parallel()
+	inputCh := make(chan logInput)
+	dispatcher := newStartedLogDispatcher(inputCh, 5)
+	inputCh <- stdoutInput([]byte("hi"))
+	inputCh <- stdoutInput([]byte("!"))
+	close(inputCh)
+
+	requireRead(t, dispatcher.newReader(context.Background(), FromStart()), 10, "hi!")
+}
+
+func TestLogsFromOffset(t *testing.T) {
+	t.Parallel()
+	inputCh := make(chan logInput)
+	dispatcher := newStartedLogDispatcher(inputCh, 8)
+	inputCh <- stdoutInput([]byte("hello"))
+	inputCh <- logInput{stream: Stderr, data: []byte("world")}
+
+	r := dispatcher.newReader(context.Background(), FromOffset(3))
+	requireStreamRead(t, r, Stdout, "lo")
+	require.Equal(t, uint64(3), r.Offset())
+	requireStreamRead(t, r, Stderr, "world")
+	require.Equal(t, uint64(5), r.Offset())
+
+	r = dispatcher.newReader(context.Background(), FromOffset(1))
+	_, err := r.Read(make([]byte, 10))
+	require.ErrorIs(t, err, ErrLogTruncated)
+
+	// A reader beyond the end of the log waits for data up to its offset.
+	r = dispatcher.newReader(context.Background(), FromOffset(12))
+	done := make(chan struct{})
+	go func() {
+		requireStreamRead(t, r, Stdout, "23456789")
+		require.Equal(t, uint64(12), r.Offset())
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond) // let the reader register as follower.
+	inputCh <- stdoutInput([]byte("0"))
+	inputCh <- stdoutInput([]byte("123456789"))
+	close(inputCh)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reader beyond the end of the log did not finish")
+	}
+}
+
+func TestLogsFollowOnly(t *testing.T) {
+	t.Parallel()
+	inputCh := make(chan logInput)
+	dispatcher := newStartedLogDispatcher(inputCh, 0)
+	inputCh <- stdoutInput([]byte("before"))
+	require.Eventually(t, func() bool { return dispatcher.endOffset.Load() == 6 }, time.Second, time.Millisecond)
+
+	r := dispatcher.newReader(context.Background(), FollowOnly())
+	// Data written between creating the reader and its first Read is not
+	// skipped.
+	inputCh <- stdoutInput([]byte("during"))
+	done := make(chan struct{})
+	go func() {
+		requireRead(t, r, 20, "duringafter")
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond) // let the reader register as follower.
+	inputCh <- stdoutInput([]byte("after"))
+	close(inputCh)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("follow-only reader did not finish")
+	}
+}
+
+func TestLogsTailNoFollow(t *testing.T) {
+	t.Parallel()
+	inputCh := make(chan logInput)
+	dispatcher := newStartedLogDispatcher(inputCh, 8)
+	inputCh <- stdoutInput([]byte("hello"))
+	inputCh <- logInput{stream: Stderr, data: []byte("world")}
+
+	// The input is still open, but readers do not wait for more data.
+	b, err := io.ReadAll(dispatcher.newReader(context.Background(), Tail(3), NoFollow()))
+	require.NoError(t, err)
+	require.Equal(t, "rld", string(b))
+
+	r := dispatcher.newReader(context.Background(), Tail(100), NoFollow())
+	requireStreamRead(t, r, Stdout, "llo")
+	require.Equal(t, uint64(2), r.Offset())
+	requireStreamRead(t, r, Stderr, "world")
+	_, err = r.Read(make([]byte, 10))
+	require.ErrorIs(t, err, io.EOF)
+
+	b, err = io.ReadAll(dispatcher.newReader(context.Background(), Tail(0), NoFollow()))
+	require.NoError(t, err)
+	require.Empty(t, b)
+	close(inputCh)
+}
+
+func TestLogsStreams(t *testing.T) {
+	t.Parallel()
+	inputCh := make(chan logInput)
+	dispatcher := newStartedLogDispatcher(inputCh, 0)
+	inputCh <- stdoutInput([]byte("out1"))
+	inputCh <- logInput{stream: Stderr, data: []byte("err1")}
+	inputCh <- logInput{stream: Stderr, data: []byte("err2")}
+	inputCh <- stdoutInput([]byte("out2"))
+	close(inputCh)
+
+	r := dispatcher.newReader(context.Background())
+	requireStreamRead(t, r, Stdout, "out1")
+	requireStreamRead(t, r, Stderr, "err1err2")
+	requireStreamRead(t, r, Stdout, "out2")
+	_, err := r.Read(make([]byte, 10))
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestLogsStreamsTruncated(t *testing.T) {
+	t.Parallel()
+	inputCh := make(chan logInput)
+	dispatcher := newStartedLogDispatcher(inputCh, 4)
+	inputCh <- stdoutInput([]byte("out"))
+	inputCh <- logInput{stream: Stderr, data: []byte("err")}
+	inputCh <- stdoutInput([]byte("out"))
+	close(inputCh)
+
+	r := dispatcher.newReader(context.Background())
+	requireStreamRead(t, r, Stderr, "r")
+	requireStreamRead(t, r, Stdout, "out")
+}
+
+func TestLogsEmptyInput(t *testing.T) {
+	t.Parallel()
+	inputCh := make(chan logInput)
+	dispatcher := newStartedLogDispatcher(inputCh, 0)
+	r := dispatcher.newReader(context.Background())
+	go func() {
+		inputCh <- stdoutInput([]byte{})
+		inputCh <- logInput{stream: Stderr, data: nil}
+		inputCh <- stdoutInput([]byte("hi"))
+		inputCh <- stdoutInput([]byte{})
+		close(inputCh)
+	}()
+	requireStreamRead(t, r, Stdout, "hi")
+	n, err := r.Read(make([]byte, 10))
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, 0, n)
+	require.Len(t, dispatcher.segments, 1)
+}
+
+func TestLogsMaxBuffered(t *testing.T) {
+	t.Parallel()
+	inputCh := make(chan logInput)
+	dispatcher := newStartedLogDispatcher(inputCh, 8)
+	inputCh <- stdoutInput([]byte("hello"))
+	inputCh <- stdoutInput([]byte(" world"))
+	inputCh <- stdoutInput([]byte("!"))
+	close(inputCh)
+	r := dispatcher.newReader(context.Background())
+	_, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, int64(11), dispatcher.maxBuffered.Load())
+
+	inputCh = make(chan logInput)
+	dispatcher = newStartedLogDispatcher(inputCh, 0)
+	inputCh <- stdoutInput([]byte("hello"))
+	close(inputCh)
+	_, err = io.ReadAll(dispatcher.newReader(context.Background()))
+	require.NoError(t, err)
+	require.Equal(t, int64(5), dispatcher.maxBuffered.Load())
+}
+
+func TestLogsFollowerCount(t *testing.T) {
+	t.Parallel()
+	inputCh := make(chan logInput)
+	dispatcher := newStartedLogDispatcher(inputCh, 0)
+	requireFollowers := func(want int64) {
+		t.Helper()
+		require.Eventually(t, func() bool {
+			return dispatcher.followerCount.Load() == want
+		}, time.Second, 5*time.Millisecond)
+	}
+
+	// Readers waiting for data are followers until data arrives.
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := dispatcher.newReader(context.Background())
+			requireStreamRead(t, r, Stdout, "hello")
+		}()
+	}
+	requireFollowers(5)
+	inputCh <- stdoutInput([]byte("hello"))
+	wg.Wait()
+	requireFollowers(0)
+
+	// Cancelled readers are no longer followers.
+	ctx, cancel := context.WithCancel(context.Background())
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := dispatcher.newReader(ctx, FollowOnly())
+			_, err := r.Read(make([]byte, 10))
+			require.ErrorIs(t, err, context.Canceled)
+		}()
+	}
+	requireFollowers(3)
+	cancel()
+	wg.Wait()
+	requireFollowers(0)
+
+	// Closing the input ends all followers.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := io.ReadAll(dispatcher.newReader(context.Background(), FollowOnly()))
+		require.NoError(t, err)
+	}()
+	requireFollowers(1)
+	close(inputCh)
+	wg.Wait()
+	requireFollowers(0)
+}
+
+func TestLogsOutputDigest(t *testing.T) {
+	t.Parallel()
+	// The digest covers all output, also output discarded from the log.
+	inputCh := make(chan logInput)
+	newStartedLogDispatcher(inputCh, 4)
+	digest := newOutputDigest()
+	stdout := channelWriter{ch: inputCh, stream: Stdout, digest: digest}
+	stderr := channelWriter{ch: inputCh, stream: Stderr, digest: digest}
+	_, err := io.WriteString(stdout, "hello ")
+	require.NoError(t, err)
+	_, err = io.WriteString(stderr, "world")
+	require.NoError(t, err)
+	close(inputCh)
+	sum := sha256.Sum256([]byte("hello world"))
+	require.Equal(t, hex.EncodeToString(sum[:]), digest.sum())
+
+	// Concurrently written output is digested in log order.
+	inputCh = make(chan logInput)
+	dispatcher := newStartedLogDispatcher(inputCh, 0)
+	digest = newOutputDigest()
+	stdout = channelWriter{ch: inputCh, stream: Stdout, digest: digest}
+	stderr = channelWriter{ch: inputCh, stream: Stderr, digest: digest}
+	var wg sync.WaitGroup
+	for _, w := range []channelWriter{stdout, stderr} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 100 {
+				_, err := fmt.Fprintf(w, "%v %d\n", w.stream, i)
+				require.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(inputCh)
+	b, err := io.ReadAll(dispatcher.newReader(context.Background()))
+	require.NoError(t, err)
+	require.Len(t, b, 2*len("stdout 0\n")*10+2*len("stdout 10\n")*90)
+	sum = sha256.Sum256(b)
+	require.Equal(t, hex.EncodeToString(sum[:]), digest.sum())
+}
+
+func requireStreamRead(t *testing.T, r StreamReader, want Stream, wantData string) {
+	t.Helper()
+	b := make([]byte, 100)
+	n, err := r.Read(b)
+	require.NoError(t, err)
+	require.Equal(t, wantData, string(b[:n]))
+	require.Equal(t, want, r.Stream())
+}
+
+func stdoutInput(b []byte) logInput {
+	return logInput{stream: Stdout, data: b}
+}
+
 type delayedTestCase struct {
 	name        string
 	input       string
@@ -157,10 +456,10 @@ func TestLogsWithDelay(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
-			inputCh := make(chan []byte)
+			inputCh := make(chan logInput)
 
 			go inputSlowly(inputCh, tc.input, tc.inputDelay)
-			dispatcher := newStartedLogDispatcher(inputCh)
+			dispatcher := newStartedLogDispatcher(inputCh, 0)
 			r := dispatcher.newReader(context.Background())
 			rs := &slowReader{r: r, delay: tc.outputDelay}
 			requireRead(t, rs, 10, tc.input)
@@ -168,10 +467,10 @@ func TestLogsWithDelay(t *testing.T) {
 	}
 }
 
-func inputSlowly(inputCh chan []byte, s string, delay time.Duration) {
+func inputSlowly(inputCh chan logInput, s string, delay time.Duration) {
 	b := []byte(s)
 	for i := range b {
-		inputCh <- b[i : i+1]
+		inputCh <- stdoutInput(b[i : i+1])
 		if delay > 0 {
 			randDelay := time.Duration(rand.Int63n(int64(delay)))
 			time.Sleep(randDelay)
@@ -0,0 +1,153 @@
+package job
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Mount is a bind mount of a host file or directory into the job's mount
+// namespace, see StartOptions.Mounts. Source is the absolute host path, which
+// must be within a path allowed with [WithMountSources]. Target is the absolute
+// path the source is mounted on, within the root filesystem set with
+// [WithRootfs], if any, which must exist. If ReadOnly is set, the job cannot
+// write through the mount, including its submounts.
+type Mount struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"readOnly,omitempty"`
+}
+
+// WithMountSources allows the given absolute host paths and everything below
+// them as sources of the bind mounts of jobs, see StartOptions.Mounts. Without
+// allowed sources, jobs with mounts are refused.
+func WithMountSources(paths ...string) Option {
+	return func(c *Controller) {
+		c.mountSources = append(c.mountSources, paths...)
+	}
+}
+
+// resolveMounts checks that the given mounts have absolute targets and
+// existing sources within the allowed mount sources, after resolving symbolic
+// links, and returns the mounts with their resolved sources. The exec helper
+// mounts the resolved sources without following symbolic links, so that
+// replacing a path component by a symbolic link after the check fails the
+// job rather than escaping the allowed mount sources, see applyMounts.
+func (c *Controller) resolveMounts(mounts []Mount) ([]Mount, error) {
+	if len(mounts) == 0 {
+		return nil, nil
+	}
+	resolved := make([]Mount, 0, len(mounts))
+	for _, m := range mounts {
+		if !filepath.IsAbs(m.Source) || !filepath.IsAbs(m.Target) {
+			return nil, fmt.Errorf("%w: source %q and target %q must be absolute paths", ErrMount, m.Source, m.Target)
+		}
+		source, err := filepath.EvalSymlinks(m.Source)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMount, err)
+		}
+		if !c.isMountSource(source) {
+			return nil, fmt.Errorf("%w: source %q not allowed", ErrMount, m.Source)
+		}
+		m.Source = source
+		resolved = append(resolved, m)
+	}
+	return resolved, nil
+}
+
+// isMountSource reports whether the given resolved path is within one of the
+// allowed mount sources.
+func (c *Controller) isMountSource(path string) bool {
+	for _, allowed := range c.mountSources {
+		allowed, err := filepath.EvalSymlinks(allowed)
+		if err != nil {
+			continue
+		}
+		if allowed == "/" || path == allowed || strings.HasPrefix(path, allowed+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyMounts bind mounts the given mounts in the job's new mount namespace,
+// with their targets within the given root directory, "/" if empty. All mounts
+// of the namespace are made private first, so that the job's mounts do not
+// propagate to the host.
+//
+// Sources are opened without following symbolic links, as they have been
+// resolved by resolveMounts, and targets are resolved within the root, so
+// that symbolic links in the root cannot point them elsewhere. Both are
+// mounted through their /proc/self/fd paths. Read-only mounts are made
+// read-only with all their submounts, as the flag is ignored when creating a
+// bind mount.
+func applyMounts(root string, mounts []Mount) error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("cannot make mounts private: %w", err)
+	}
+	rootFD, err := unix.Open(cmp.Or(root, "/"), unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("cannot open root %q: %w", root, err)
+	}
+	defer unix.Close(rootFD) //nolint:errcheck // O_PATH descriptor.
+	for _, m := range mounts {
+		if err := applyMount(rootFD, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyMount bind mounts m with its target within the root directory opened
+// as rootFD, see applyMounts.
+func applyMount(rootFD int, m Mount) error {
+	source, err := unix.Openat2(unix.AT_FDCWD, m.Source, &unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_NO_SYMLINKS,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot open mount source %q: %w", m.Source, err)
+	}
+	defer unix.Close(source) //nolint:errcheck // O_PATH descriptor.
+	target, err := openInRoot(rootFD, m.Target)
+	if err != nil {
+		return fmt.Errorf("cannot open mount target %q: %w", m.Target, err)
+	}
+	defer unix.Close(target) //nolint:errcheck // O_PATH descriptor.
+	if err := unix.Mount(fdPath(source), fdPath(target), "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("cannot bind mount %q on %q: %w", m.Source, m.Target, err)
+	}
+	if !m.ReadOnly {
+		return nil
+	}
+	// The target descriptor refers to the directory below the new mount,
+	// which is therefore opened again.
+	mounted, err := openInRoot(rootFD, m.Target)
+	if err != nil {
+		return fmt.Errorf("cannot open mount target %q: %w", m.Target, err)
+	}
+	defer unix.Close(mounted) //nolint:errcheck // O_PATH descriptor.
+	attr := &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY}
+	if err := unix.MountSetattr(mounted, "", unix.AT_EMPTY_PATH|unix.AT_RECURSIVE, attr); err != nil {
+		return fmt.Errorf("cannot make mount %q read-only: %w", m.Target, err)
+	}
+	return nil
+}
+
+// openInRoot opens path as O_PATH descriptor, resolving it within the root
+// directory opened as rootFD.
+func openInRoot(rootFD int, path string) (int, error) {
+	return unix.Openat2(rootFD, path, &unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_IN_ROOT | unix.RESOLVE_NO_MAGICLINKS,
+	})
+}
+
+// fdPath returns the /proc/self/fd path of the given file descriptor.
+func fdPath(fd int) string {
+	return "/proc/self/fd/" + strconv.Itoa(fd)
+}
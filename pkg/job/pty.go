@@ -0,0 +1,202 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// openPTY opens a new pseudo-terminal and returns its master and slave side.
+// The job's processes use the slave side as their controlling terminal, the
+// controller reads their output from and writes their input to the master
+// side.
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open pseudo-terminal: %w", err)
+	}
+	// The ioctls go through SyscallConn rather than Fd, which would put the
+	// master into blocking mode, so that closing it interrupts pending reads.
+	var n uint32
+	var ioctlErr error
+	conn, err := master.SyscallConn()
+	if err == nil {
+		err = conn.Control(func(fd uintptr) {
+			if ioctlErr = unix.IoctlSetPointerInt(int(fd), unix.TIOCSPTLCK, 0); ioctlErr != nil {
+				return
+			}
+			n, ioctlErr = unix.IoctlGetUint32(int(fd), unix.TIOCGPTN)
+		})
+	}
+	if err = errors.Join(err, ioctlErr); err != nil {
+		_ = master.Close()
+		return nil, nil, fmt.Errorf("cannot unlock pseudo-terminal: %w", err)
+	}
+	slave, err := os.OpenFile("/dev/pts/"+strconv.FormatUint(uint64(n), 10), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		_ = master.Close()
+		return nil, nil, fmt.Errorf("cannot open pseudo-terminal slave: %w", err)
+	}
+	return master, slave, nil
+}
+
+// newTTYJob creates a new job like newJob, whose stdin, stdout and stderr are
+// the slave side of a new pseudo-terminal, see StartOptions.Tty. The job's
+// output is read from the master side and logged as stdout, as the terminal
+// does not distinguish stdout and stderr. StartOptions.Stdin is written to
+// the terminal as initial input.
+func newTTYJob(ctx context.Context, owner, id string, opts StartOptions, cfg jobConfig) (*job, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCommand, err)
+	}
+	cfg.tty = slave
+	cmd, err := newStartedCmd(ctx, id, opts, cfg, nil, nil)
+	// The job's processes hold their own descriptors of the slave side. The
+	// master side reports end of file once they have all been closed.
+	if err := slave.Close(); err != nil {
+		slog.Error("cannot close pseudo-terminal slave", "Status.ID", id, "err", err)
+	}
+	if err != nil {
+		_ = master.Close()
+		return nil, err
+	}
+	out := io.Discard
+	var dispatcher *logDispatcher
+	var outDigest *outputDigest
+	if !cfg.discard {
+		var inputCh chan logInput
+		inputCh, outDigest, out, _ = newJobOutput(id, cfg)
+		dispatcher = newStartedLogDispatcher(inputCh, cfg.maxLogBytes)
+	}
+	j := newStartedJob(owner, id, opts, cfg, cmd, dispatcher, outDigest)
+	j.tty, j.ttyDone = master, make(chan struct{})
+	go func() {
+		defer close(j.ttyDone)
+		// Reading the master side fails with EIO rather than returning
+		// io.EOF once all slave descriptors have been closed.
+		if _, err := io.Copy(out, master); err != nil && !errors.Is(err, syscall.EIO) {
+			slog.Error("cannot read pseudo-terminal", "Status.ID", id, "err", err)
+		}
+	}()
+	if len(opts.Stdin) > 0 {
+		// Writing blocks while the terminal's input buffer is full.
+		go func() {
+			if err := j.writeInput(opts.Stdin); err != nil {
+				slog.Error("cannot write stdin to pseudo-terminal", "Status.ID", id, "err", err)
+			}
+		}()
+	}
+	return j, nil
+}
+
+// writeInput writes data to the job's terminal, as if typed by a user. It
+// blocks while the terminal's input buffer is full, until the job reads its
+// input or terminates.
+//
+// It fails with an error wrapping ErrInputAttached while the input is claimed
+// by attachInput.
+func (j *job) writeInput(data []byte) error {
+	j.mutex.Lock()
+	err := j.inputError()
+	j.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return j.writeTTY(data)
+}
+
+// inputError returns an error if the job has no terminal, has terminated or
+// its input is claimed by attachInput. It must be called with the mutex held.
+func (j *job) inputError() error {
+	if j.tty == nil {
+		return fmt.Errorf("%w: %q", ErrNoTerminal, j.status.ID)
+	}
+	if !j.status.Running {
+		return fmt.Errorf("%w: %q", ErrJobNotRunning, j.status.ID)
+	}
+	if j.inputAttached {
+		return fmt.Errorf("%w: %q", ErrInputAttached, j.status.ID)
+	}
+	return nil
+}
+
+// writeTTY writes data to the master side of the job's terminal. It fails
+// with an error wrapping ErrJobNotRunning if the terminal has been closed.
+func (j *job) writeTTY(data []byte) error {
+	// The master side is closed once the job has terminated, which
+	// interrupts a blocked write.
+	_, err := j.tty.Write(data)
+	if errors.Is(err, os.ErrClosed) {
+		return fmt.Errorf("%w: %q", ErrJobNotRunning, j.status.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write to terminal of job %q: %w", j.status.ID, err)
+	}
+	return nil
+}
+
+// attachInput claims the input of the job's terminal for a single writer,
+// such as an interactive attach session, and returns a writer to it. Closing
+// the writer releases the claim. While the input is claimed, attachInput and
+// writeInput fail with an error wrapping ErrInputAttached.
+func (j *job) attachInput() (io.WriteCloser, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if err := j.inputError(); err != nil {
+		return nil, err
+	}
+	j.inputAttached = true
+	return &attachedInput{job: j}, nil
+}
+
+// attachedInput is the claimed input of a job's terminal, see attachInput.
+type attachedInput struct {
+	job       *job
+	closeOnce sync.Once
+}
+
+// Write writes data to the job's terminal. It fails with an error wrapping
+// ErrJobNotRunning once the job has terminated.
+func (a *attachedInput) Write(data []byte) (int, error) {
+	if !a.job.isRunning() {
+		return 0, fmt.Errorf("%w: %q", ErrJobNotRunning, a.job.status.ID)
+	}
+	if err := a.job.writeTTY(data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Close releases the claim on the job's input. It does not close the
+// terminal.
+func (a *attachedInput) Close() error {
+	a.closeOnce.Do(func() {
+		a.job.mutex.Lock()
+		defer a.job.mutex.Unlock()
+		a.job.inputAttached = false
+	})
+	return nil
+}
+
+// closeTTY waits until all output of the job's terminal has been read and
+// closes the terminal's master side. It must only be called after the job's
+// process has terminated and its cgroup has been killed, and without the
+// mutex held, as processes still holding the slave side keep it waiting.
+func (j *job) closeTTY() {
+	if j.tty == nil {
+		return
+	}
+	<-j.ttyDone
+	if err := j.tty.Close(); err != nil {
+		slog.Error("cannot close pseudo-terminal", "Status.ID", j.status.ID, "err", err)
+	}
+}
@@ -0,0 +1,194 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// Deleting a reaped cgroup is retried up to reapDeleteAttempts times, every
+// reapDeleteInterval, while its killed processes exit.
+const (
+	reapDeleteAttempts = 20
+	reapDeleteInterval = 50 * time.Millisecond
+)
+
+// WithReapOrphans makes NewController reuse an existing telejob cgroup, see
+// [WithCgroup], rather than failing, and reap the orphan cgroups in it with
+// [Controller.ReapOrphans], for example after a crash of the previous server
+// instance. Reaped cgroups are logged.
+func WithReapOrphans() Option {
+	return func(c *Controller) {
+		c.reapOrphans = true
+	}
+}
+
+// ReapOrphans kills the processes of the child cgroups of the telejob cgroup
+// that do not belong to the controller, such as the job cgroups left behind by
+// a crashed server, deletes them and returns their paths.
+//
+// The cgroups of jobs that are being started or whose process has not been
+// reaped yet are kept. The cgroup of a terminated job that could not be
+// deleted is reaped. With [WithOwnerCgroups], owner cgroups of owners with
+// jobs are kept, but orphan job cgroups in them are reaped. Reaping continues
+// after errors; the returned error joins all of them.
+func (c *Controller) ReapOrphans() ([]string, error) {
+	// Holding ownerMutex keeps owner cgroups from being created or deleted
+	// concurrently. mutex is locked first and only while the orphans are
+	// listed, as jobs terminating during StopAll, which holds mutex, wait for
+	// ownerMutex.
+	c.mutex.Lock()
+	c.ownerMutex.Lock()
+	defer c.ownerMutex.Unlock()
+	orphans, err := c.orphanCgroups()
+	c.mutex.Unlock()
+	var reaped []string
+	errs := []error{err}
+	for _, cgroup := range orphans {
+		if err := reapCgroup(cgroup); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		reaped = append(reaped, cgroup)
+	}
+	return reaped, errors.Join(errs...)
+}
+
+// orphanCgroups returns the paths of the orphan cgroups in the telejob cgroup,
+// see ReapOrphans. Errors listing owner cgroups are joined and do not stop
+// the listing. It must be called with mutex and ownerMutex held.
+func (c *Controller) orphanCgroups() ([]string, error) {
+	children, err := childCgroups(c.telejobCgroup)
+	if err != nil {
+		return nil, err
+	}
+	var orphans []string
+	var errs []error
+	for _, child := range children {
+		name := filepath.Base(child)
+		switch {
+		case c.ownerCgroups && c.ownerJobs[name] > 0:
+			jobCgroups, err := childCgroups(child)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for _, jobCgroup := range jobCgroups {
+				if !c.isLiveID(filepath.Base(jobCgroup)) {
+					orphans = append(orphans, jobCgroup)
+				}
+			}
+		case c.ownerCgroups || !c.isLiveID(name):
+			orphans = append(orphans, child)
+		}
+	}
+	return orphans, errors.Join(errs...)
+}
+
+// isLiveID reports whether name is the ID of a job that is being started or
+// whose process has not been reaped yet. It must be called with mutex held.
+func (c *Controller) isLiveID(name string) bool {
+	if c.starting[name] {
+		return true
+	}
+	job, ok := c.jobs[name]
+	return ok && !job.hasExited()
+}
+
+// childCgroups returns the paths of the child cgroups of the given cgroup,
+// sorted by name.
+func childCgroups(cgroup string) ([]string, error) {
+	entries, err := os.ReadDir(cgroup)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot read cgroup %q: %w", ErrCgroup, cgroup, err)
+	}
+	var children []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			children = append(children, filepath.Join(cgroup, entry.Name()))
+		}
+	}
+	slices.Sort(children)
+	return children, nil
+}
+
+// reapCgroup kills all processes of the given cgroup and its descendants
+// through its cgroup.kill file, or through the cgroup.procs files of the
+// cgroup and its descendants on kernels without cgroup.kill, and deletes the
+// cgroup and its descendants, waiting for the killed processes to exit.
+func reapCgroup(cgroup string) error {
+	// Unlike writeCgroupFile, writing does not create a missing file, which
+	// would keep the cgroup from being deleted outside of a cgroup
+	// filesystem.
+	f, err := os.OpenFile(filepath.Join(cgroup, "cgroup.kill"), os.O_WRONLY, 0)
+	switch {
+	case err == nil:
+		_, err = f.WriteString("1")
+		err = errors.Join(err, f.Close())
+		if err != nil {
+			return fmt.Errorf("%w: cannot kill orphan cgroup %q: %w", ErrCgroup, cgroup, err)
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		if err := killCgroupTreeProcs(cgroup); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: cannot kill orphan cgroup %q: %w", ErrCgroup, cgroup, err)
+	}
+	return deleteCgroupTree(cgroup)
+}
+
+// killCgroupTreeProcs kills the processes of the given cgroup and its
+// descendants through their cgroup.procs files, see killProcs.
+func killCgroupTreeProcs(cgroup string) error {
+	children, err := childCgroups(cgroup)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := killCgroupTreeProcs(child); err != nil {
+			return err
+		}
+	}
+	return killProcs(cgroup)
+}
+
+// deleteCgroupTree deletes the given cgroup after its descendants, retrying
+// while the cgroup is busy with exiting processes.
+func deleteCgroupTree(cgroup string) error {
+	children, err := childCgroups(cgroup)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := deleteCgroupTree(child); err != nil {
+			return err
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		err := deleteCgroup(cgroup)
+		if err == nil || !errors.Is(err, syscall.EBUSY) || attempt == reapDeleteAttempts {
+			return err
+		}
+		time.Sleep(reapDeleteInterval)
+	}
+}
+
+// reapOrphansOnStart reaps the orphan cgroups of a reused telejob cgroup, see
+// WithReapOrphans. Failures are logged, as orphans do not keep the
+// controller from working.
+func (c *Controller) reapOrphansOnStart() {
+	reaped, err := c.ReapOrphans()
+	if len(reaped) > 0 {
+		slog.Warn("reaped orphan cgroups", "cgroups", reaped)
+	}
+	if err != nil {
+		slog.Error("cannot reap orphan cgroups", "err", err)
+	}
+}
@@ -0,0 +1,150 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// seccompSyscalls maps the syscall names that can be blocked by a seccomp
+// profile to their numbers. It is limited to syscalls that are available on
+// all supported architectures and that jobs rarely need, such as syscalls
+// administering the system or escaping its isolation.
+//
+//nolint:gochecknoglobals // read-only lookup table.
+var seccompSyscalls = map[string]uint32{
+	"acct":              unix.SYS_ACCT,
+	"add_key":           unix.SYS_ADD_KEY,
+	"bpf":               unix.SYS_BPF,
+	"chroot":            unix.SYS_CHROOT,
+	"clock_settime":     unix.SYS_CLOCK_SETTIME,
+	"delete_module":     unix.SYS_DELETE_MODULE,
+	"finit_module":      unix.SYS_FINIT_MODULE,
+	"init_module":       unix.SYS_INIT_MODULE,
+	"kexec_load":        unix.SYS_KEXEC_LOAD,
+	"keyctl":            unix.SYS_KEYCTL,
+	"mount":             unix.SYS_MOUNT,
+	"open_by_handle_at": unix.SYS_OPEN_BY_HANDLE_AT,
+	"perf_event_open":   unix.SYS_PERF_EVENT_OPEN,
+	"pivot_root":        unix.SYS_PIVOT_ROOT,
+	"process_vm_readv":  unix.SYS_PROCESS_VM_READV,
+	"process_vm_writev": unix.SYS_PROCESS_VM_WRITEV,
+	"ptrace":            unix.SYS_PTRACE,
+	"reboot":            unix.SYS_REBOOT,
+	"request_key":       unix.SYS_REQUEST_KEY,
+	"sethostname":       unix.SYS_SETHOSTNAME,
+	"setdomainname":     unix.SYS_SETDOMAINNAME,
+	"setns":             unix.SYS_SETNS,
+	"settimeofday":      unix.SYS_SETTIMEOFDAY,
+	"swapoff":           unix.SYS_SWAPOFF,
+	"swapon":            unix.SYS_SWAPON,
+	"umount2":           unix.SYS_UMOUNT2,
+	"unshare":           unix.SYS_UNSHARE,
+	"userfaultfd":       unix.SYS_USERFAULTFD,
+}
+
+// seccompArchs maps the supported architectures to their audit architecture
+// reported to seccomp filters.
+//
+//nolint:gochecknoglobals // read-only lookup table.
+var seccompArchs = map[string]uint32{
+	"amd64": unix.AUDIT_ARCH_X86_64,
+	"arm64": unix.AUDIT_ARCH_AARCH64,
+}
+
+// x32SyscallBit is set in the numbers of x32 ABI syscalls on amd64. They are
+// blocked, as they would otherwise bypass the profile's syscall numbers.
+const x32SyscallBit = 0x40000000
+
+// seccompProfile is the content of a seccomp profile file, for example:
+//
+//	{"blocked": ["mount", "ptrace", "unshare"]}
+type seccompProfile struct {
+	Blocked []string `json:"blocked"`
+}
+
+// readSeccompProfile reads and validates the seccomp profile file at path
+// and returns the sorted, deduplicated names of the blocked syscalls.
+func readSeccompProfile(path string) ([]string, error) {
+	if _, ok := seccompArchs[runtime.GOARCH]; !ok {
+		return nil, fmt.Errorf("%w: unsupported architecture %s", ErrSeccomp, runtime.GOARCH)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSeccomp, err)
+	}
+	var profile seccompProfile
+	if err := json.Unmarshal(b, &profile); err != nil {
+		return nil, fmt.Errorf("%w: cannot parse profile %q: %w", ErrSeccomp, path, err)
+	}
+	if len(profile.Blocked) == 0 {
+		return nil, fmt.Errorf("%w: profile %q blocks no syscalls", ErrSeccomp, path)
+	}
+	for _, name := range profile.Blocked {
+		if _, ok := seccompSyscalls[name]; !ok {
+			return nil, fmt.Errorf("%w: unsupported syscall %q", ErrSeccomp, name)
+		}
+	}
+	slices.Sort(profile.Blocked)
+	return slices.Compact(profile.Blocked), nil
+}
+
+// seccompFilter returns a seccomp BPF program that kills the process on any
+// of the given syscalls, on foreign architectures and on x32 syscalls, and
+// allows all other syscalls.
+func seccompFilter(arch uint32, blocked []string) []unix.SockFilter {
+	// Offsets of the nr and arch fields of struct seccomp_data.
+	const nrOffset, archOffset = 0, 4
+	filter := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: archOffset},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 1, K: arch},
+		{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_KILL_PROCESS},
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: nrOffset},
+	}
+	// Conditional jumps are relative and target the final kill statement,
+	// which follows the allow statement after the comparisons.
+	jumps := len(blocked) + 1
+	filter = append(filter, unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, Jt: uint8(jumps), K: x32SyscallBit}) //nolint:gosec // validated in applySeccomp.
+	for i, name := range blocked {
+		jumps = len(blocked) - i
+		filter = append(filter, unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: uint8(jumps), K: seccompSyscalls[name]}) //nolint:gosec // validated in applySeccomp.
+	}
+	return append(filter,
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_ALLOW},
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_KILL_PROCESS},
+	)
+}
+
+// applySeccomp installs a seccomp filter blocking the given syscalls for all
+// threads of the current process. The filter is inherited by executed
+// commands and their children. It sets no_new_privs, so that unprivileged
+// processes may install the filter.
+func applySeccomp(blocked []string) error {
+	arch, ok := seccompArchs[runtime.GOARCH]
+	if !ok {
+		return fmt.Errorf("unsupported architecture %s", runtime.GOARCH)
+	}
+	if len(blocked) >= 255 { //nolint:mnd // maximum BPF conditional jump offset.
+		return fmt.Errorf("too many blocked syscalls: %d", len(blocked))
+	}
+	for _, name := range blocked {
+		if _, ok := seccompSyscalls[name]; !ok {
+			return fmt.Errorf("unsupported syscall %q", name)
+		}
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("cannot set no_new_privs: %w", err)
+	}
+	filter := seccompFilter(arch, blocked)
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]} //nolint:gosec // at most 262 statements.
+	_, _, errno := unix.Syscall(unix.SYS_SECCOMP, unix.SECCOMP_SET_MODE_FILTER, unix.SECCOMP_FILTER_FLAG_TSYNC, uintptr(unsafe.Pointer(&prog)))
+	if errno != 0 {
+		return fmt.Errorf("cannot install seccomp filter: %w", errno)
+	}
+	return nil
+}
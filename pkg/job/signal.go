@@ -0,0 +1,118 @@
+package job
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// stopSignals maps the names of the signals jobs can be stopped with to the
+// signals. Other signals, such as SIGSTOP, do not stop a job in a sensible way.
+//
+//nolint:gochecknoglobals // read-only lookup table.
+var stopSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"KILL": syscall.SIGKILL,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+}
+
+// ParseSignal returns the signal with the given name, such as "INT" or
+// "SIGINT", for use with [WithSignal]. The name is case-insensitive. Only
+// SIGHUP, SIGINT, SIGKILL, SIGQUIT and SIGTERM are supported, any other
+// name fails with [ErrSignal].
+func ParseSignal(name string) (syscall.Signal, error) {
+	key := strings.TrimPrefix(strings.ToUpper(name), "SIG")
+	sig, ok := stopSignals[key]
+	if !ok {
+		return 0, fmt.Errorf("%w: unsupported signal %q", ErrSignal, name)
+	}
+	return sig, nil
+}
+
+// StopOption is a functional option for [Controller.Stop].
+type StopOption func(*stopConfig)
+
+// stopConfig holds the configuration of a single stop request.
+type stopConfig struct {
+	steps []StopStep
+}
+
+// WithSignal makes Stop send the given signal to the job's process rather
+// than SIGKILL or the controller's stop schedule. The signal must be one of
+// the signals supported by [ParseSignal]. Jobs may handle or ignore the
+// signal and keep running.
+func WithSignal(sig syscall.Signal) StopOption {
+	return func(sc *stopConfig) {
+		sc.steps = []StopStep{{Signal: sig}}
+	}
+}
+
+// StopStep is a step of a stop schedule, see [WithStopSchedule]. Its Signal
+// is sent to the job's process Delay after the previous step.
+type StopStep struct {
+	Signal syscall.Signal
+	Delay  time.Duration
+}
+
+// WithStopSchedule makes Stop escalate through the given steps rather than
+// sending SIGKILL, for jobs that need repeated nudges to shut down cleanly.
+// For example, the following schedule sends SIGTERM, SIGTERM again after 5
+// seconds and SIGKILL after another 5 seconds:
+//
+//	[]StopStep{{Signal: syscall.SIGTERM}, {Signal: syscall.SIGTERM, Delay: 5 * time.Second}, {Signal: syscall.SIGKILL, Delay: 5 * time.Second}}
+//
+// The first step is sent by Stop and must not have a delay, the following
+// steps are sent in the background and skipped once the job has terminated.
+// All signals must be supported by [ParseSignal]. Stop requests with
+// [WithSignal], ForceStop, timeouts and shutdown are not affected.
+func WithStopSchedule(steps []StopStep) Option {
+	return func(c *Controller) {
+		c.stopSchedule = slices.Clone(steps)
+	}
+}
+
+// newStopConfig returns the stop configuration for the given options, with
+// the given schedule or SIGKILL as default. It fails with [ErrSignal] for
+// unsupported signals.
+func newStopConfig(opts []StopOption, schedule []StopStep) (stopConfig, error) {
+	sc := stopConfig{steps: schedule}
+	if len(sc.steps) == 0 {
+		sc.steps = []StopStep{{Signal: syscall.SIGKILL}}
+	}
+	for _, opt := range opts {
+		opt(&sc)
+	}
+	if err := validateStopSchedule(sc.steps); err != nil {
+		return stopConfig{}, err
+	}
+	return sc, nil
+}
+
+// validateStopSchedule checks that all steps of the stop schedule have a
+// supported signal and a non-negative delay, and that the first step has no
+// delay. An empty schedule is valid.
+func validateStopSchedule(steps []StopStep) error {
+	for i, step := range steps {
+		if !isStopSignal(step.Signal) {
+			return fmt.Errorf("%w: unsupported signal %d", ErrSignal, step.Signal)
+		}
+		if step.Delay < 0 || (i == 0 && step.Delay != 0) {
+			return fmt.Errorf("%w: invalid delay %v of stop step %d", ErrSignal, step.Delay, i+1)
+		}
+	}
+	return nil
+}
+
+// isStopSignal reports whether sig is one of the supported stop signals.
+func isStopSignal(sig syscall.Signal) bool {
+	for _, s := range stopSignals {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
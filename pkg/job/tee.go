@@ -0,0 +1,111 @@
+package job
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// teeBufferSize is the number of output chunks queued for the tee writer.
+// Chunks are dropped while the queue is full, see outputTee.send.
+const teeBufferSize = 1024
+
+// outputTee mirrors the output of all jobs to a writer, set with
+// WithTeeOutput. Output is queued in a bounded buffer and written by a
+// separate goroutine, so that a slow writer never blocks jobs.
+type outputTee struct {
+	ch      chan []byte
+	done    chan struct{}
+	dropped atomic.Int64
+
+	// mutex protects closed, so that send does not write to ch once it has
+	// been closed, for example by jobs started concurrently with StopAll.
+	mutex  sync.Mutex
+	closed bool
+}
+
+// newStartedOutputTee creates a new outputTee writing to w and starts its
+// writing goroutine. Write errors are ignored, as teed output is for
+// debugging only.
+func newStartedOutputTee(w io.Writer) *outputTee {
+	t := &outputTee{
+		ch:   make(chan []byte, teeBufferSize),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(t.done)
+		for b := range t.ch {
+			_, _ = w.Write(b)
+		}
+	}()
+	return t
+}
+
+// send queues b for writing without blocking. b is dropped if the queue is
+// full or the tee has been closed.
+func (t *outputTee) send(b []byte) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		t.dropped.Add(1)
+		return
+	}
+	select {
+	case t.ch <- b:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// close writes all queued output and stops the writing goroutine. Output
+// sent after close is dropped. It is safe to call close multiple times.
+func (t *outputTee) close() {
+	t.mutex.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.ch)
+	}
+	t.mutex.Unlock()
+	<-t.done
+	if n := t.dropped.Load(); n > 0 {
+		slog.Warn("dropped teed job output", "chunks", n)
+	}
+}
+
+// teeWriter implements io.Writer for a single output stream of a job by
+// prefixing each line with the job ID and sending it to an outputTee.
+//
+// It is not safe for concurrent use; exec.Cmd writes each output stream
+// from a single goroutine.
+type teeWriter struct {
+	tee       *outputTee
+	prefix    []byte
+	lineStart bool
+}
+
+// newTeeWriter returns a teeWriter for the output stream of the job with
+// the given id.
+func newTeeWriter(tee *outputTee, id string) *teeWriter {
+	return &teeWriter{tee: tee, prefix: []byte("[" + id + "] "), lineStart: true}
+}
+
+// Write implements io.Writer by sending a prefixed copy of b to the tee. It
+// never blocks and never fails.
+func (w *teeWriter) Write(b []byte) (int, error) {
+	buf := make([]byte, 0, len(b)+len(w.prefix))
+	for rest := b; len(rest) > 0; {
+		if w.lineStart {
+			buf = append(buf, w.prefix...)
+		}
+		var line []byte
+		line, rest, w.lineStart = bytes.Cut(rest, []byte{'\n'})
+		buf = append(buf, line...)
+		if w.lineStart {
+			buf = append(buf, '\n')
+		}
+	}
+	w.tee.send(buf)
+	return len(b), nil
+}
@@ -2,17 +2,39 @@ package job
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"time"
 )
 
 // Sentinel Errors returned by the job package.
 var (
-	ErrCgroup       = errors.New("cgroup error")
-	ErrCommand      = errors.New("command error")
-	ErrJobNotFound  = errors.New("job not found")
-	ErrJobStop      = errors.New("job stop error")
-	ErrShutdown     = errors.New("already shut down")
-	ErrUnauthorized = errors.New("unauthorized")
+	ErrAdmission      = errors.New("admission denied")
+	ErrArgsTooLarge   = errors.New("arguments and environment too large")
+	ErrCgroup         = errors.New("cgroup error")
+	ErrCgroupReadOnly = errors.New("cgroup filesystem is read-only")
+	ErrCommand        = errors.New("command error")
+	ErrController     = errors.New("cgroup controller unavailable")
+	ErrCredential     = errors.New("credential error")
+	ErrInputAttached  = errors.New("job input already attached")
+	ErrJobExists      = errors.New("job already exists")
+	ErrJobNotFound    = errors.New("job not found")
+	ErrJobNotPaused   = errors.New("job not paused")
+	ErrJobNotRunning  = errors.New("job not running")
+	ErrJobStop        = errors.New("job stop error")
+	ErrLimits         = errors.New("invalid limits")
+	ErrLogTruncated   = errors.New("log truncated")
+	ErrMount          = errors.New("mount error")
+	ErrNoOutput       = errors.New("output not captured")
+	ErrNoTerminal     = errors.New("job has no terminal")
+	ErrRlimit         = errors.New("rlimit error")
+	ErrRootfs         = errors.New("rootfs error")
+	ErrSeccomp        = errors.New("seccomp error")
+	ErrShutdown       = errors.New("already shut down")
+	ErrSignal         = errors.New("signal error")
+	ErrStopTimeout    = errors.New("jobs did not terminate in time")
+	ErrTooManyJobs    = errors.New("too many jobs")
+	ErrUnauthorized   = errors.New("unauthorized")
 )
 
 // NotTerminated is the exit code used to indicate that a job is still running.
@@ -26,19 +48,321 @@ const (
 )
 
 // Status represents the current state of the job.
+//
+// Labels are shared with the job and must not be modified. ProcessCount is
+// the number of live processes in the job's cgroup, including processes forked
+// by the job's command. It is 0 for terminated jobs.
+//
+// MaxBufferedLogBytes is the largest number of log bytes buffered for the job
+// so far, recorded before older output is discarded. It helps to size the
+// controller's maximum log size, see [WithMaxLogBytes], which it exceeds if
+// the job wrote more output than the log keeps.
+//
+// IOReadBytes and IOWriteBytes are the number of bytes the job's processes
+// read from and wrote to block devices, as accounted by the job's cgroup. They
+// help to tune I/O limits and are zero without io controller.
+//
+// Paused is set for jobs started paused until they are resumed.
+//
+// Scheduled is set for jobs started with StartOptions.NotBefore in the future
+// until their command runs.
+//
+// NearMemoryLimit is set for running jobs whose memory usage exceeds 90% of
+// their memory limit, an early warning before they are killed by the OOM
+// killer. A warning is logged for such jobs when their status is retrieved.
+//
+// TerminationReason is set if the job was terminated by the controller
+// because it exceeded a limit, rather than by exiting or being stopped.
+//
+// OutputDigest is the hex encoded SHA-256 digest of the job's total output,
+// stdout and stderr in log order. It is only set for terminated jobs of a
+// controller created with [WithOutputDigest].
 type Status struct {
-	ID       string
-	Command  string
-	Args     []string
-	Started  time.Time
-	Running  bool
-	ExitCode int
-	Stopped  time.Time
+	ID                  string
+	Command             string
+	Args                []string
+	Labels              map[string]string
+	Started             time.Time
+	Running             bool
+	ExitCode            int
+	Stopped             time.Time
+	ProcessCount        int
+	MaxBufferedLogBytes int
+	OutputDigest        string
+	IOReadBytes         uint64
+	IOWriteBytes        uint64
+	NearMemoryLimit     bool
+	Paused              bool
+	Scheduled           bool
+	TerminationReason   TerminationReason
+}
+
+// StatusResult is the result of looking up a single job of a
+// [Controller.StatusBatch] call: the job's Status, or Err if the lookup
+// failed, such as with an error wrapping [ErrJobNotFound].
+type StatusResult struct {
+	Status Status
+	Err    error
+}
+
+// TerminationReason identifies the limit a job was terminated for by the
+// controller. The zero value is used for jobs that have not been terminated
+// by the controller.
+type TerminationReason int
+
+const (
+	// TerminationCPULimit is the reason of jobs that have exceeded
+	// [Limits.MaxCPUSeconds].
+	TerminationCPULimit TerminationReason = iota + 1
+	// TerminationTimeout is the reason of jobs that have exceeded
+	// StartOptions.Timeout.
+	TerminationTimeout
+)
+
+// String returns the lower-case name of the termination reason, or an empty
+// string for the zero value.
+func (r TerminationReason) String() string {
+	switch r {
+	case 0:
+		return ""
+	case TerminationCPULimit:
+		return "cpu limit"
+	case TerminationTimeout:
+		return "timeout"
+	default:
+		return fmt.Sprintf("TerminationReason(%d)", int(r))
+	}
+}
+
+// StartOptions configures a job started with [Controller.StartJob].
+//
+// Labels are arbitrary key-value pairs attached to the job. If Unique is set,
+// the job is not started while another running job of the same owner has the
+// same set of labels, which must not be empty.
+//
+// Env contains environment variables of the form KEY=VALUE that are added to
+// the environment inherited from the controller's process, which is empty
+// unless allowed with [WithInheritEnv]. Stdin is the job's complete standard
+// input, if nil the job reads from the null device. Dir is the job's working
+// directory, if empty the controller's working directory.
+//
+// If Limits is not nil, its non-zero fields replace the controller's limits
+// for this job, rlimits are replaced by name. Callers are responsible for
+// restricting per-job limits to trusted sources. If Timeout is positive, the
+// job is stopped once it has run for the given duration.
+//
+// If Paused is set, the job's process is started frozen, before the job's
+// command is executed. The command only runs once the job has been resumed
+// with [Controller.Resume], and a Timeout counts from resuming. Stopping a
+// paused job kills it.
+//
+// If NotBefore is in the future, the job is scheduled: its process is started
+// frozen like a paused job and resumed at NotBefore, when the command runs.
+// Stopping a scheduled job cancels it, the command never runs. A Timeout
+// counts from NotBefore. NotBefore cannot be combined with Paused.
+//
+// If Argv0 is set, it is passed to the command as argv[0] instead of Command,
+// for example to run a binary under a different process name. Command must
+// then be the absolute path of an executable file.
+//
+// If DiscardOutput is set, the job's stdout and stderr are connected to the
+// null device, for fire-and-forget jobs whose output does not matter. No
+// output is buffered, teed or digested, and reading the job's logs fails with
+// [ErrNoOutput]. See also [WithDiscardOutput].
+//
+// If Tty is set, the job's stdin, stdout and stderr are a new pseudo-terminal,
+// which is also the job's controlling terminal, for interactive commands and
+// commands that behave differently without a terminal. The terminal's output,
+// stdout and stderr alike, is logged as stdout. Stdin is written to the
+// terminal as initial input; further input is written with
+// [Controller.WriteInput].
+//
+// Mounts are bind mounts of host paths, allowed with [WithMountSources], into
+// a new mount namespace of the job, for example to give a job read-only access
+// to a data directory. Mounts require root. With [WithRootfs], their targets
+// are within the root filesystem. Their sources are checked when the job is
+// started, failing with [ErrMount], their targets when the job's process sets
+// them up, failing the job.
+type StartOptions struct {
+	Command string
+	Argv0   string
+	Args    []string
+	Labels  map[string]string
+	Unique  bool
+	Env     []string
+	Stdin   []byte
+	Dir     string
+	Limits  *Limits
+	Timeout time.Duration
+	Paused  bool
+
+	NotBefore time.Time
+
+	DiscardOutput bool
+	Tty           bool
+	Mounts        []Mount
+}
+
+// DuplicateJobError is returned when starting a unique job while another
+// running job of the same owner has the same labels. It wraps [ErrJobExists].
+type DuplicateJobError struct {
+	ID string // ID of the running job with the same labels.
+}
+
+// Error returns a description of the conflict including the running job's ID.
+func (e *DuplicateJobError) Error() string {
+	return fmt.Sprintf("%v: running job %q has the same labels", ErrJobExists, e.ID)
+}
+
+// Unwrap returns ErrJobExists.
+func (e *DuplicateJobError) Unwrap() error {
+	return ErrJobExists
+}
+
+// TooManyJobsError is returned when a job cannot be started because the
+// controller's maximum number of running jobs has been reached. RetryAfter is
+// a hint how long callers should wait before retrying, derived from the
+// durations of recently finished jobs.
+type TooManyJobsError struct {
+	Max        int
+	RetryAfter time.Duration
+}
+
+// Error returns a description of the limit including the retry hint.
+func (e *TooManyJobsError) Error() string {
+	return fmt.Sprintf("%v: maximum of %d running jobs reached, retry after %v", ErrTooManyJobs, e.Max, e.RetryAfter)
+}
+
+// Unwrap returns ErrTooManyJobs, so that errors.Is(err, ErrTooManyJobs) holds.
+func (e *TooManyJobsError) Unwrap() error {
+	return ErrTooManyJobs
+}
+
+// Usage is the aggregate resource usage of running jobs. MemoryBytes is the
+// sum of the jobs' current memory usage. CPU is the sum of the CPU time
+// consumed by the jobs since they were started.
+type Usage struct {
+	RunningJobs int
+	MemoryBytes uint64
+	CPU         time.Duration
+}
+
+// JobStats is a snapshot of the resource usage of a running job, as
+// accounted by its cgroup. MemoryPeak and PidsCurrent are zero if the kernel
+// or the enabled cgroup controllers do not provide them, IOReadBytes and
+// IOWriteBytes are zero without io controller.
+type JobStats struct {
+	MemoryCurrent uint64
+	MemoryPeak    uint64
+	CPU           time.Duration
+	IOReadBytes   uint64
+	IOWriteBytes  uint64
+	PidsCurrent   uint64
+}
+
+// DebugStats are internal counters of the controller for diagnosing leaks.
+// LogDispatchers is the number of log dispatchers, one per job known to the
+// controller whose output is not discarded. LogFollowers is the number of log
+// readers of all jobs waiting for log data not yet written by the job.
+type DebugStats struct {
+	LogDispatchers int
+	LogFollowers   int
 }
 
 // Limits represents the resource limits for a job.
+//
+// CPUs, MemoryKiB and IO limit the job's aggregate resource usage through its
+// cgroup. MemoryKiB is a hard limit, jobs exceeding it are OOM killed.
+// MemoryHighKiB is a soft limit, jobs exceeding it are throttled and their
+// memory is reclaimed. Both memory limits can be combined. MemoryMinKiB is a
+// memory guarantee for high-priority jobs, the kernel does not reclaim the
+// job's memory below it. It must not exceed MemoryKiB if both are set. If
+// OOMGroup is set, the OOM killer kills all processes of the job together
+// rather than only the offending process, which could leave the job in a
+// broken, partial state. Rlimits limit each of the job's processes
+// individually, keyed by "core", "nofile" or "nproc". Both the soft and the
+// hard limit are set to the given value.
+//
+// MaxCPUSeconds bounds the total CPU time consumed by the job's processes,
+// unlike a timeout, which bounds the wall-clock time. The job's CPU time is
+// sampled periodically and the job is stopped with TerminationCPULimit once
+// it exceeds the budget, so it may overrun the budget by up to a sampling
+// interval of CPU time per CPU.
 type Limits struct {
-	CPUs      float64
-	MemoryKiB uint64
-	IO        []string
+	CPUs          float64
+	MemoryKiB     uint64
+	MemoryHighKiB uint64
+	MemoryMinKiB  uint64
+	OOMGroup      bool
+	IO            []string
+	Rlimits       map[string]uint64
+	MaxCPUSeconds float64
+}
+
+// Credential represents the user and group identity job processes run as.
+//
+// UID and GID are the user and group ID the job's process switches to before
+// executing the command. Groups are the supplementary group IDs of the
+// process; if empty, the process has no supplementary groups.
+type Credential struct {
+	UID    uint32   `json:"uid"`
+	GID    uint32   `json:"gid"`
+	Groups []uint32 `json:"groups,omitempty"`
+}
+
+// StopAllError is returned by [Controller.StopAll] if any job could not be
+// stopped or the controller's resources could not be cleaned up.
+//
+// Stopped contains the IDs of the jobs that were stopped successfully and
+// Failed contains the stop errors of the jobs that could not be stopped, keyed
+// by job ID. Stuck contains the IDs of the jobs that had not terminated when
+// the timeout set with [WithStopAllTimeout] expired, see [ErrStopTimeout].
+// StopAllError unwraps to all underlying errors, like the result of
+// errors.Join.
+type StopAllError struct {
+	Stopped []string
+	Failed  map[string]error
+	Stuck   []string
+	errs    []error
+}
+
+// Error returns the joined error messages of all underlying errors.
+func (e *StopAllError) Error() string {
+	return errors.Join(e.errs...).Error()
+}
+
+// Unwrap returns all underlying errors.
+func (e *StopAllError) Unwrap() []error {
+	return e.errs
+}
+
+// Stream identifies the output stream of a job that log data was written to.
+type Stream int
+
+const (
+	// Stdout is the job's standard output.
+	Stdout Stream = iota + 1
+	// Stderr is the job's standard error.
+	Stderr
+)
+
+// String returns the lower-case name of the stream.
+func (s Stream) String() string {
+	switch s {
+	case Stdout:
+		return "stdout"
+	case Stderr:
+		return "stderr"
+	default:
+		return fmt.Sprintf("Stream(%d)", int(s))
+	}
+}
+
+// StreamReader is an io.Reader for job logs that reports the output stream
+// and the absolute offset in the log of the data returned by the most recent
+// call to Read. A new reader can continue after this data with [FromOffset].
+type StreamReader interface {
+	io.Reader
+	Stream() Stream
+	Offset() uint64
 }
@@ -0,0 +1,80 @@
+package job
+
+import (
+	"context"
+	"sync"
+)
+
+// eventBufferSize is the number of events buffered per watcher. Watchers
+// falling further behind are disconnected, see broadcaster.publish.
+const eventBufferSize = 256
+
+// Event is a change of a job's status, reported by [Controller.WatchAll] when
+// a job has started and when it has terminated.
+type Event struct {
+	Owner  string
+	Status Status
+}
+
+// broadcaster sends events to all subscribed watchers. Its zero value has no
+// watchers and is ready to use.
+type broadcaster struct {
+	mutex    sync.Mutex
+	watchers map[chan Event]struct{}
+}
+
+// subscribe returns a new buffered channel receiving all events published
+// from now on.
+func (b *broadcaster) subscribe() chan Event {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.watchers == nil {
+		b.watchers = map[chan Event]struct{}{}
+	}
+	ch := make(chan Event, eventBufferSize)
+	b.watchers[ch] = struct{}{}
+	return ch
+}
+
+// unsubscribe removes and closes the watcher channel, unless it has already
+// been removed.
+func (b *broadcaster) unsubscribe(ch chan Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.watchers[ch]; ok {
+		delete(b.watchers, ch)
+		close(ch)
+	}
+}
+
+// publish sends the event to all watchers without blocking. Watchers whose
+// buffer is full are unsubscribed, closing their channel, so that a slow
+// watcher neither blocks jobs nor silently misses events.
+func (b *broadcaster) publish(e Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for ch := range b.watchers {
+		select {
+		case ch <- e:
+		default:
+			delete(b.watchers, ch)
+			close(ch)
+		}
+	}
+}
+
+// WatchAll returns a channel receiving an [Event] whenever a job of any owner
+// starts or terminates, until ctx is done. Callers must ensure that it is only
+// used by operators, see [Controller.ForceStop].
+//
+// The channel is closed once ctx is done. It is also closed if the caller
+// falls more than a buffer of events behind; the caller can then tell that
+// events have been missed by ctx not being done.
+func (c *Controller) WatchAll(ctx context.Context) <-chan Event {
+	ch := c.events.subscribe()
+	go func() {
+		<-ctx.Done()
+		c.events.unsubscribe(ch)
+	}()
+	return ch
+}
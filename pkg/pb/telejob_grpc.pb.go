@@ -19,20 +19,97 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	Telejob_Start_FullMethodName  = "/telejob.v1.Telejob/Start"
-	Telejob_Stop_FullMethodName   = "/telejob.v1.Telejob/Stop"
-	Telejob_Status_FullMethodName = "/telejob.v1.Telejob/Status"
-	Telejob_Logs_FullMethodName   = "/telejob.v1.Telejob/Logs"
+	Telejob_Capabilities_FullMethodName  = "/telejob.v1.Telejob/Capabilities"
+	Telejob_Start_FullMethodName         = "/telejob.v1.Telejob/Start"
+	Telejob_StartStream_FullMethodName   = "/telejob.v1.Telejob/StartStream"
+	Telejob_ExplainLimits_FullMethodName = "/telejob.v1.Telejob/ExplainLimits"
+	Telejob_Stop_FullMethodName          = "/telejob.v1.Telejob/Stop"
+	Telejob_Resume_FullMethodName        = "/telejob.v1.Telejob/Resume"
+	Telejob_Status_FullMethodName        = "/telejob.v1.Telejob/Status"
+	Telejob_StatusBatch_FullMethodName   = "/telejob.v1.Telejob/StatusBatch"
+	Telejob_Describe_FullMethodName      = "/telejob.v1.Telejob/Describe"
+	Telejob_WriteInput_FullMethodName    = "/telejob.v1.Telejob/WriteInput"
+	Telejob_Attach_FullMethodName        = "/telejob.v1.Telejob/Attach"
+	Telejob_Stats_FullMethodName         = "/telejob.v1.Telejob/Stats"
+	Telejob_List_FullMethodName          = "/telejob.v1.Telejob/List"
+	Telejob_Logs_FullMethodName          = "/telejob.v1.Telejob/Logs"
+	Telejob_GetLogs_FullMethodName       = "/telejob.v1.Telejob/GetLogs"
+	Telejob_ForceStop_FullMethodName     = "/telejob.v1.Telejob/ForceStop"
+	Telejob_Usage_FullMethodName         = "/telejob.v1.Telejob/Usage"
+	Telejob_Debug_FullMethodName         = "/telejob.v1.Telejob/Debug"
+	Telejob_WatchAll_FullMethodName      = "/telejob.v1.Telejob/WatchAll"
 )
 
 // TelejobClient is the client API for Telejob service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type TelejobClient interface {
+	// Capabilities returns the names of the RPCs supported by the server, so
+	// that clients can degrade gracefully on older servers. Servers predating
+	// Capabilities fail with UNIMPLEMENTED, their RPCs are unknown.
+	Capabilities(ctx context.Context, in *CapabilitiesRequest, opts ...grpc.CallOption) (*CapabilitiesResponse, error)
 	Start(ctx context.Context, in *StartRequest, opts ...grpc.CallOption) (*StartResponse, error)
+	// StartStream starts a job like Start, for requests too large for a single
+	// message. The first message carries the start request, subsequent messages
+	// carry chunks of stdin and environment variables, which are assembled by
+	// the server before the job is started.
+	StartStream(ctx context.Context, opts ...grpc.CallOption) (Telejob_StartStreamClient, error)
+	// ExplainLimits returns the effective resource limits a job started with
+	// the given request would run with, without starting it. Start requests
+	// carry no limits, all jobs run with the server's limits. Limits of cgroup
+	// controllers unavailable on the server are omitted, as they are for
+	// started jobs.
+	ExplainLimits(ctx context.Context, in *StartRequest, opts ...grpc.CallOption) (*ExplainLimitsResponse, error)
 	Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (*StopResponse, error)
+	// Resume starts the execution of a job started with start_paused. It fails
+	// with FAILED_PRECONDITION if the job is not paused.
+	Resume(ctx context.Context, in *ResumeRequest, opts ...grpc.CallOption) (*ResumeResponse, error)
 	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	// StatusBatch returns the statuses of multiple jobs in one call, for
+	// dashboards. Jobs that cannot be queried, for example as they do not
+	// exist, are reported per job rather than failing the call.
+	StatusBatch(ctx context.Context, in *StatusBatchRequest, opts ...grpc.CallOption) (*StatusBatchResponse, error)
+	// Describe returns how a job has been run, for auditing, also after it has
+	// terminated. Environment values are redacted unless the caller has the
+	// operator role, which may also describe jobs of other owners.
+	Describe(ctx context.Context, in *DescribeRequest, opts ...grpc.CallOption) (*DescribeResponse, error)
+	// WriteInput writes to the terminal of a job started with tty. It fails
+	// with FAILED_PRECONDITION for jobs without terminal or not running.
+	WriteInput(ctx context.Context, in *WriteInputRequest, opts ...grpc.CallOption) (*WriteInputResponse, error)
+	// Attach streams the logs of a job like Logs and writes the data of the
+	// request stream to the job's terminal like WriteInput, for interactive
+	// sessions. The first request must set the job's id. Any number of attach
+	// sessions may follow a job's output, but only one at a time may send
+	// input: data sent while another session sends input is dropped and
+	// reported in a response with input_error, like other input that cannot be
+	// written. The output stream continues.
+	Attach(ctx context.Context, opts ...grpc.CallOption) (Telejob_AttachClient, error)
+	// Stats returns a snapshot of the resource usage of a running job. It fails
+	// with FAILED_PRECONDITION if the job has terminated.
+	Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error)
+	// List returns the statuses of the caller's jobs, ordered by job ID.
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
 	Logs(ctx context.Context, in *LogsRequest, opts ...grpc.CallOption) (Telejob_LogsClient, error)
+	// GetLogs returns the log written so far by a job in a single response,
+	// for scripts that do not want to manage a log stream. It does not wait for
+	// further output of running jobs.
+	GetLogs(ctx context.Context, in *GetLogsRequest, opts ...grpc.CallOption) (*GetLogsResponse, error)
+	// ForceStop stops any job regardless of its owner. It requires the operator
+	// role and fails with PERMISSION_DENIED otherwise.
+	ForceStop(ctx context.Context, in *ForceStopRequest, opts ...grpc.CallOption) (*ForceStopResponse, error)
+	// Usage returns the resource usage summed over the running jobs of all
+	// owners. It requires the operator role and fails with PERMISSION_DENIED
+	// otherwise.
+	Usage(ctx context.Context, in *UsageRequest, opts ...grpc.CallOption) (*UsageResponse, error)
+	// Debug returns internal counters of the server for diagnosing leaks. It
+	// must be enabled on the server and fails with UNIMPLEMENTED otherwise. It
+	// requires the operator role and fails with PERMISSION_DENIED otherwise.
+	Debug(ctx context.Context, in *DebugRequest, opts ...grpc.CallOption) (*DebugResponse, error)
+	// WatchAll streams an event whenever a job of any owner starts or
+	// terminates, for operator dashboards. It requires the operator role and
+	// fails with PERMISSION_DENIED otherwise. Watchers falling too far behind
+	// are disconnected with RESOURCE_EXHAUSTED.
+	WatchAll(ctx context.Context, in *WatchAllRequest, opts ...grpc.CallOption) (Telejob_WatchAllClient, error)
 }
 
 type telejobClient struct {
@@ -43,6 +120,15 @@ func NewTelejobClient(cc grpc.ClientConnInterface) TelejobClient {
 	return &telejobClient{cc}
 }
 
+func (c *telejobClient) Capabilities(ctx context.Context, in *CapabilitiesRequest, opts ...grpc.CallOption) (*CapabilitiesResponse, error) {
+	out := new(CapabilitiesResponse)
+	err := c.cc.Invoke(ctx, Telejob_Capabilities_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *telejobClient) Start(ctx context.Context, in *StartRequest, opts ...grpc.CallOption) (*StartResponse, error) {
 	out := new(StartResponse)
 	err := c.cc.Invoke(ctx, Telejob_Start_FullMethodName, in, out, opts...)
@@ -52,6 +138,49 @@ func (c *telejobClient) Start(ctx context.Context, in *StartRequest, opts ...grp
 	return out, nil
 }
 
+func (c *telejobClient) StartStream(ctx context.Context, opts ...grpc.CallOption) (Telejob_StartStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Telejob_ServiceDesc.Streams[0], Telejob_StartStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &telejobStartStreamClient{stream}
+	return x, nil
+}
+
+type Telejob_StartStreamClient interface {
+	Send(*StartStreamRequest) error
+	CloseAndRecv() (*StartResponse, error)
+	grpc.ClientStream
+}
+
+type telejobStartStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *telejobStartStreamClient) Send(m *StartStreamRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *telejobStartStreamClient) CloseAndRecv() (*StartResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(StartResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *telejobClient) ExplainLimits(ctx context.Context, in *StartRequest, opts ...grpc.CallOption) (*ExplainLimitsResponse, error) {
+	out := new(ExplainLimitsResponse)
+	err := c.cc.Invoke(ctx, Telejob_ExplainLimits_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *telejobClient) Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (*StopResponse, error) {
 	out := new(StopResponse)
 	err := c.cc.Invoke(ctx, Telejob_Stop_FullMethodName, in, out, opts...)
@@ -61,6 +190,15 @@ func (c *telejobClient) Stop(ctx context.Context, in *StopRequest, opts ...grpc.
 	return out, nil
 }
 
+func (c *telejobClient) Resume(ctx context.Context, in *ResumeRequest, opts ...grpc.CallOption) (*ResumeResponse, error) {
+	out := new(ResumeResponse)
+	err := c.cc.Invoke(ctx, Telejob_Resume_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *telejobClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
 	out := new(StatusResponse)
 	err := c.cc.Invoke(ctx, Telejob_Status_FullMethodName, in, out, opts...)
@@ -70,8 +208,84 @@ func (c *telejobClient) Status(ctx context.Context, in *StatusRequest, opts ...g
 	return out, nil
 }
 
+func (c *telejobClient) StatusBatch(ctx context.Context, in *StatusBatchRequest, opts ...grpc.CallOption) (*StatusBatchResponse, error) {
+	out := new(StatusBatchResponse)
+	err := c.cc.Invoke(ctx, Telejob_StatusBatch_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telejobClient) Describe(ctx context.Context, in *DescribeRequest, opts ...grpc.CallOption) (*DescribeResponse, error) {
+	out := new(DescribeResponse)
+	err := c.cc.Invoke(ctx, Telejob_Describe_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telejobClient) WriteInput(ctx context.Context, in *WriteInputRequest, opts ...grpc.CallOption) (*WriteInputResponse, error) {
+	out := new(WriteInputResponse)
+	err := c.cc.Invoke(ctx, Telejob_WriteInput_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telejobClient) Attach(ctx context.Context, opts ...grpc.CallOption) (Telejob_AttachClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Telejob_ServiceDesc.Streams[1], Telejob_Attach_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &telejobAttachClient{stream}
+	return x, nil
+}
+
+type Telejob_AttachClient interface {
+	Send(*AttachRequest) error
+	Recv() (*LogsResponse, error)
+	grpc.ClientStream
+}
+
+type telejobAttachClient struct {
+	grpc.ClientStream
+}
+
+func (x *telejobAttachClient) Send(m *AttachRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *telejobAttachClient) Recv() (*LogsResponse, error) {
+	m := new(LogsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *telejobClient) Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error) {
+	out := new(StatsResponse)
+	err := c.cc.Invoke(ctx, Telejob_Stats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telejobClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, Telejob_List_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *telejobClient) Logs(ctx context.Context, in *LogsRequest, opts ...grpc.CallOption) (Telejob_LogsClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Telejob_ServiceDesc.Streams[0], Telejob_Logs_FullMethodName, opts...)
+	stream, err := c.cc.NewStream(ctx, &Telejob_ServiceDesc.Streams[2], Telejob_Logs_FullMethodName, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -102,32 +316,207 @@ func (x *telejobLogsClient) Recv() (*LogsResponse, error) {
 	return m, nil
 }
 
+func (c *telejobClient) GetLogs(ctx context.Context, in *GetLogsRequest, opts ...grpc.CallOption) (*GetLogsResponse, error) {
+	out := new(GetLogsResponse)
+	err := c.cc.Invoke(ctx, Telejob_GetLogs_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telejobClient) ForceStop(ctx context.Context, in *ForceStopRequest, opts ...grpc.CallOption) (*ForceStopResponse, error) {
+	out := new(ForceStopResponse)
+	err := c.cc.Invoke(ctx, Telejob_ForceStop_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telejobClient) Usage(ctx context.Context, in *UsageRequest, opts ...grpc.CallOption) (*UsageResponse, error) {
+	out := new(UsageResponse)
+	err := c.cc.Invoke(ctx, Telejob_Usage_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telejobClient) Debug(ctx context.Context, in *DebugRequest, opts ...grpc.CallOption) (*DebugResponse, error) {
+	out := new(DebugResponse)
+	err := c.cc.Invoke(ctx, Telejob_Debug_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telejobClient) WatchAll(ctx context.Context, in *WatchAllRequest, opts ...grpc.CallOption) (Telejob_WatchAllClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Telejob_ServiceDesc.Streams[3], Telejob_WatchAll_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &telejobWatchAllClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Telejob_WatchAllClient interface {
+	Recv() (*WatchAllResponse, error)
+	grpc.ClientStream
+}
+
+type telejobWatchAllClient struct {
+	grpc.ClientStream
+}
+
+func (x *telejobWatchAllClient) Recv() (*WatchAllResponse, error) {
+	m := new(WatchAllResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // TelejobServer is the server API for Telejob service.
 // All implementations should embed UnimplementedTelejobServer
 // for forward compatibility
 type TelejobServer interface {
+	// Capabilities returns the names of the RPCs supported by the server, so
+	// that clients can degrade gracefully on older servers. Servers predating
+	// Capabilities fail with UNIMPLEMENTED, their RPCs are unknown.
+	Capabilities(context.Context, *CapabilitiesRequest) (*CapabilitiesResponse, error)
 	Start(context.Context, *StartRequest) (*StartResponse, error)
+	// StartStream starts a job like Start, for requests too large for a single
+	// message. The first message carries the start request, subsequent messages
+	// carry chunks of stdin and environment variables, which are assembled by
+	// the server before the job is started.
+	StartStream(Telejob_StartStreamServer) error
+	// ExplainLimits returns the effective resource limits a job started with
+	// the given request would run with, without starting it. Start requests
+	// carry no limits, all jobs run with the server's limits. Limits of cgroup
+	// controllers unavailable on the server are omitted, as they are for
+	// started jobs.
+	ExplainLimits(context.Context, *StartRequest) (*ExplainLimitsResponse, error)
 	Stop(context.Context, *StopRequest) (*StopResponse, error)
+	// Resume starts the execution of a job started with start_paused. It fails
+	// with FAILED_PRECONDITION if the job is not paused.
+	Resume(context.Context, *ResumeRequest) (*ResumeResponse, error)
 	Status(context.Context, *StatusRequest) (*StatusResponse, error)
+	// StatusBatch returns the statuses of multiple jobs in one call, for
+	// dashboards. Jobs that cannot be queried, for example as they do not
+	// exist, are reported per job rather than failing the call.
+	StatusBatch(context.Context, *StatusBatchRequest) (*StatusBatchResponse, error)
+	// Describe returns how a job has been run, for auditing, also after it has
+	// terminated. Environment values are redacted unless the caller has the
+	// operator role, which may also describe jobs of other owners.
+	Describe(context.Context, *DescribeRequest) (*DescribeResponse, error)
+	// WriteInput writes to the terminal of a job started with tty. It fails
+	// with FAILED_PRECONDITION for jobs without terminal or not running.
+	WriteInput(context.Context, *WriteInputRequest) (*WriteInputResponse, error)
+	// Attach streams the logs of a job like Logs and writes the data of the
+	// request stream to the job's terminal like WriteInput, for interactive
+	// sessions. The first request must set the job's id. Any number of attach
+	// sessions may follow a job's output, but only one at a time may send
+	// input: data sent while another session sends input is dropped and
+	// reported in a response with input_error, like other input that cannot be
+	// written. The output stream continues.
+	Attach(Telejob_AttachServer) error
+	// Stats returns a snapshot of the resource usage of a running job. It fails
+	// with FAILED_PRECONDITION if the job has terminated.
+	Stats(context.Context, *StatsRequest) (*StatsResponse, error)
+	// List returns the statuses of the caller's jobs, ordered by job ID.
+	List(context.Context, *ListRequest) (*ListResponse, error)
 	Logs(*LogsRequest, Telejob_LogsServer) error
+	// GetLogs returns the log written so far by a job in a single response,
+	// for scripts that do not want to manage a log stream. It does not wait for
+	// further output of running jobs.
+	GetLogs(context.Context, *GetLogsRequest) (*GetLogsResponse, error)
+	// ForceStop stops any job regardless of its owner. It requires the operator
+	// role and fails with PERMISSION_DENIED otherwise.
+	ForceStop(context.Context, *ForceStopRequest) (*ForceStopResponse, error)
+	// Usage returns the resource usage summed over the running jobs of all
+	// owners. It requires the operator role and fails with PERMISSION_DENIED
+	// otherwise.
+	Usage(context.Context, *UsageRequest) (*UsageResponse, error)
+	// Debug returns internal counters of the server for diagnosing leaks. It
+	// must be enabled on the server and fails with UNIMPLEMENTED otherwise. It
+	// requires the operator role and fails with PERMISSION_DENIED otherwise.
+	Debug(context.Context, *DebugRequest) (*DebugResponse, error)
+	// WatchAll streams an event whenever a job of any owner starts or
+	// terminates, for operator dashboards. It requires the operator role and
+	// fails with PERMISSION_DENIED otherwise. Watchers falling too far behind
+	// are disconnected with RESOURCE_EXHAUSTED.
+	WatchAll(*WatchAllRequest, Telejob_WatchAllServer) error
 }
 
 // UnimplementedTelejobServer should be embedded to have forward compatible implementations.
 type UnimplementedTelejobServer struct {
 }
 
+func (UnimplementedTelejobServer) Capabilities(context.Context, *CapabilitiesRequest) (*CapabilitiesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Capabilities not implemented")
+}
 func (UnimplementedTelejobServer) Start(context.Context, *StartRequest) (*StartResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Start not implemented")
 }
+func (UnimplementedTelejobServer) StartStream(Telejob_StartStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method StartStream not implemented")
+}
+func (UnimplementedTelejobServer) ExplainLimits(context.Context, *StartRequest) (*ExplainLimitsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExplainLimits not implemented")
+}
 func (UnimplementedTelejobServer) Stop(context.Context, *StopRequest) (*StopResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Stop not implemented")
 }
+func (UnimplementedTelejobServer) Resume(context.Context, *ResumeRequest) (*ResumeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Resume not implemented")
+}
 func (UnimplementedTelejobServer) Status(context.Context, *StatusRequest) (*StatusResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
 }
+func (UnimplementedTelejobServer) StatusBatch(context.Context, *StatusBatchRequest) (*StatusBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StatusBatch not implemented")
+}
+func (UnimplementedTelejobServer) Describe(context.Context, *DescribeRequest) (*DescribeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Describe not implemented")
+}
+func (UnimplementedTelejobServer) WriteInput(context.Context, *WriteInputRequest) (*WriteInputResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WriteInput not implemented")
+}
+func (UnimplementedTelejobServer) Attach(Telejob_AttachServer) error {
+	return status.Errorf(codes.Unimplemented, "method Attach not implemented")
+}
+func (UnimplementedTelejobServer) Stats(context.Context, *StatsRequest) (*StatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
+}
+func (UnimplementedTelejobServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
 func (UnimplementedTelejobServer) Logs(*LogsRequest, Telejob_LogsServer) error {
 	return status.Errorf(codes.Unimplemented, "method Logs not implemented")
 }
+func (UnimplementedTelejobServer) GetLogs(context.Context, *GetLogsRequest) (*GetLogsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLogs not implemented")
+}
+func (UnimplementedTelejobServer) ForceStop(context.Context, *ForceStopRequest) (*ForceStopResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ForceStop not implemented")
+}
+func (UnimplementedTelejobServer) Usage(context.Context, *UsageRequest) (*UsageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Usage not implemented")
+}
+func (UnimplementedTelejobServer) Debug(context.Context, *DebugRequest) (*DebugResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Debug not implemented")
+}
+func (UnimplementedTelejobServer) WatchAll(*WatchAllRequest, Telejob_WatchAllServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchAll not implemented")
+}
 
 // UnsafeTelejobServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to TelejobServer will
@@ -140,6 +529,24 @@ func RegisterTelejobServer(s grpc.ServiceRegistrar, srv TelejobServer) {
 	s.RegisterService(&Telejob_ServiceDesc, srv)
 }
 
+func _Telejob_Capabilities_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CapabilitiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelejobServer).Capabilities(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telejob_Capabilities_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelejobServer).Capabilities(ctx, req.(*CapabilitiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Telejob_Start_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(StartRequest)
 	if err := dec(in); err != nil {
@@ -158,6 +565,50 @@ func _Telejob_Start_Handler(srv interface{}, ctx context.Context, dec func(inter
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Telejob_StartStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TelejobServer).StartStream(&telejobStartStreamServer{stream})
+}
+
+type Telejob_StartStreamServer interface {
+	SendAndClose(*StartResponse) error
+	Recv() (*StartStreamRequest, error)
+	grpc.ServerStream
+}
+
+type telejobStartStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *telejobStartStreamServer) SendAndClose(m *StartResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *telejobStartStreamServer) Recv() (*StartStreamRequest, error) {
+	m := new(StartStreamRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Telejob_ExplainLimits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelejobServer).ExplainLimits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telejob_ExplainLimits_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelejobServer).ExplainLimits(ctx, req.(*StartRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Telejob_Stop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(StopRequest)
 	if err := dec(in); err != nil {
@@ -176,6 +627,24 @@ func _Telejob_Stop_Handler(srv interface{}, ctx context.Context, dec func(interf
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Telejob_Resume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResumeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelejobServer).Resume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telejob_Resume_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelejobServer).Resume(ctx, req.(*ResumeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Telejob_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(StatusRequest)
 	if err := dec(in); err != nil {
@@ -194,6 +663,122 @@ func _Telejob_Status_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Telejob_StatusBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatusBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelejobServer).StatusBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telejob_StatusBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelejobServer).StatusBatch(ctx, req.(*StatusBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Telejob_Describe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DescribeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelejobServer).Describe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telejob_Describe_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelejobServer).Describe(ctx, req.(*DescribeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Telejob_WriteInput_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteInputRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelejobServer).WriteInput(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telejob_WriteInput_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelejobServer).WriteInput(ctx, req.(*WriteInputRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Telejob_Attach_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TelejobServer).Attach(&telejobAttachServer{stream})
+}
+
+type Telejob_AttachServer interface {
+	Send(*LogsResponse) error
+	Recv() (*AttachRequest, error)
+	grpc.ServerStream
+}
+
+type telejobAttachServer struct {
+	grpc.ServerStream
+}
+
+func (x *telejobAttachServer) Send(m *LogsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *telejobAttachServer) Recv() (*AttachRequest, error) {
+	m := new(AttachRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Telejob_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelejobServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telejob_Stats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelejobServer).Stats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Telejob_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelejobServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telejob_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelejobServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Telejob_Logs_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(LogsRequest)
 	if err := stream.RecvMsg(m); err != nil {
@@ -215,6 +800,99 @@ func (x *telejobLogsServer) Send(m *LogsResponse) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Telejob_GetLogs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLogsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelejobServer).GetLogs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telejob_GetLogs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelejobServer).GetLogs(ctx, req.(*GetLogsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Telejob_ForceStop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ForceStopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelejobServer).ForceStop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telejob_ForceStop_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelejobServer).ForceStop(ctx, req.(*ForceStopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Telejob_Usage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelejobServer).Usage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telejob_Usage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelejobServer).Usage(ctx, req.(*UsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Telejob_Debug_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DebugRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelejobServer).Debug(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telejob_Debug_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelejobServer).Debug(ctx, req.(*DebugRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Telejob_WatchAll_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchAllRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TelejobServer).WatchAll(m, &telejobWatchAllServer{stream})
+}
+
+type Telejob_WatchAllServer interface {
+	Send(*WatchAllResponse) error
+	grpc.ServerStream
+}
+
+type telejobWatchAllServer struct {
+	grpc.ServerStream
+}
+
+func (x *telejobWatchAllServer) Send(m *WatchAllResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // Telejob_ServiceDesc is the grpc.ServiceDesc for Telejob service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -222,25 +900,89 @@ var Telejob_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "telejob.v1.Telejob",
 	HandlerType: (*TelejobServer)(nil),
 	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Capabilities",
+			Handler:    _Telejob_Capabilities_Handler,
+		},
 		{
 			MethodName: "Start",
 			Handler:    _Telejob_Start_Handler,
 		},
+		{
+			MethodName: "ExplainLimits",
+			Handler:    _Telejob_ExplainLimits_Handler,
+		},
 		{
 			MethodName: "Stop",
 			Handler:    _Telejob_Stop_Handler,
 		},
+		{
+			MethodName: "Resume",
+			Handler:    _Telejob_Resume_Handler,
+		},
 		{
 			MethodName: "Status",
 			Handler:    _Telejob_Status_Handler,
 		},
+		{
+			MethodName: "StatusBatch",
+			Handler:    _Telejob_StatusBatch_Handler,
+		},
+		{
+			MethodName: "Describe",
+			Handler:    _Telejob_Describe_Handler,
+		},
+		{
+			MethodName: "WriteInput",
+			Handler:    _Telejob_WriteInput_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _Telejob_Stats_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _Telejob_List_Handler,
+		},
+		{
+			MethodName: "GetLogs",
+			Handler:    _Telejob_GetLogs_Handler,
+		},
+		{
+			MethodName: "ForceStop",
+			Handler:    _Telejob_ForceStop_Handler,
+		},
+		{
+			MethodName: "Usage",
+			Handler:    _Telejob_Usage_Handler,
+		},
+		{
+			MethodName: "Debug",
+			Handler:    _Telejob_Debug_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StartStream",
+			Handler:       _Telejob_StartStream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Attach",
+			Handler:       _Telejob_Attach_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 		{
 			StreamName:    "Logs",
 			Handler:       _Telejob_Logs_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "WatchAll",
+			Handler:       _Telejob_WatchAll_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "telejob.proto",
 }
@@ -1,9 +1,14 @@
 package telejob
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 )
 
@@ -11,14 +16,15 @@ import (
 // authentication, used in [NewServer] to ensure properly secured connections.
 // It requires a server certificate and key file, and a client CA certificate
 // file. It enforces TLS version 1.3 and requires and verifies client
-// certificates.
-func serverTLSConfig(serverCertFile, serverKeyFile, clientCACertFile string) (*tls.Config, error) {
+// certificates. The server certificate is presented with the given
+// intermediate CA certificates, see loadCertificate.
+func serverTLSConfig(serverCertFile, serverKeyFile, clientCACertFile string, intermediateFiles ...string) (*tls.Config, error) {
 	if clientCACertFile == "" {
 		return nil, fmt.Errorf("%w: client CA cert file is required", ErrCASetup)
 	}
-	certificate, err := tls.LoadX509KeyPair(serverCertFile, serverKeyFile)
+	certificate, err := loadCertificate(serverCertFile, serverKeyFile, intermediateFiles)
 	if err != nil {
-		return nil, fmt.Errorf("%w: server cert file %q, key file %q: %w", ErrCertLoad, serverCertFile, serverKeyFile, err)
+		return nil, fmt.Errorf("server cert: %w", err)
 	}
 	clientCAs, err := newCertPool(clientCACertFile)
 	if err != nil {
@@ -36,11 +42,12 @@ func serverTLSConfig(serverCertFile, serverKeyFile, clientCACertFile string) (*t
 // authentication, used in [NewClient] to ensure properly secured connections.
 // It requires a client certificate and key file. It optionally uses the
 // provided server CA certificate, if it's not available as part of the root
-// certificates. It enforces TLS version 1.3.
-func clientTLSConfig(clientCertFile, clientKeyFile, serverCACertFile string) (*tls.Config, error) {
-	certificate, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+// certificates. It enforces TLS version 1.3. The client certificate is
+// presented with the given intermediate CA certificates, see loadCertificate.
+func clientTLSConfig(clientCertFile, clientKeyFile, serverCACertFile string, intermediateFiles ...string) (*tls.Config, error) {
+	certificate, err := loadCertificate(clientCertFile, clientKeyFile, intermediateFiles)
 	if err != nil {
-		return nil, fmt.Errorf("%w: client cert file %q, key file %q: %w", ErrCertLoad, clientCertFile, clientKeyFile, err)
+		return nil, fmt.Errorf("client cert: %w", err)
 	}
 	rootCAs, err := newCertPool(serverCACertFile)
 	if err != nil {
@@ -53,6 +60,60 @@ func clientTLSConfig(clientCertFile, clientKeyFile, serverCACertFile string) (*t
 	}, nil
 }
 
+// loadCertificate loads a certificate and its key like [tls.LoadX509KeyPair]
+// and appends the certificates of the given intermediate CA certificate PEM
+// files to its chain, for leaf and intermediate certificates kept in separate
+// files. The chain must be ordered from the leaf to the root, each certificate
+// signed by the next one, and is validated to fail early with a clear error
+// rather than with a failed handshake.
+func loadCertificate(certFile, keyFile string, intermediateFiles []string) (tls.Certificate, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("%w: cert file %q, key file %q: %w", ErrCertLoad, certFile, keyFile, err)
+	}
+	if len(intermediateFiles) == 0 {
+		return certificate, nil
+	}
+	for _, file := range intermediateFiles {
+		b, err := os.ReadFile(file) //nolint:gosec // G304: Potential file inclusion via variable
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("%w: cannot read intermediate cert file %q: %w", ErrCertLoad, file, err)
+		}
+		n := len(certificate.Certificate)
+		for block, rest := pem.Decode(b); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type == "CERTIFICATE" {
+				certificate.Certificate = append(certificate.Certificate, block.Bytes)
+			}
+		}
+		if len(certificate.Certificate) == n {
+			return tls.Certificate{}, fmt.Errorf("%w: no certificate in intermediate cert file %q", ErrCertLoad, file)
+		}
+	}
+	if err := verifyChainLinks(certificate.Certificate); err != nil {
+		return tls.Certificate{}, fmt.Errorf("%w: cert file %q: %w", ErrCertLoad, certFile, err)
+	}
+	return certificate, nil
+}
+
+// verifyChainLinks verifies that each certificate of the DER encoded chain is
+// signed by the next one.
+func verifyChainLinks(chain [][]byte) error {
+	certs := make([]*x509.Certificate, len(chain))
+	for i, der := range chain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("cannot parse certificate %d of chain: %w", i, err)
+		}
+		certs[i] = cert
+	}
+	for i := range len(certs) - 1 {
+		if err := certs[i].CheckSignatureFrom(certs[i+1]); err != nil {
+			return fmt.Errorf("certificate %q is not signed by intermediate %q: %w", certs[i].Subject, certs[i+1].Subject, err)
+		}
+	}
+	return nil
+}
+
 // newCertPool creates a x509.CertPool.
 //
 // If the provided CA certificate file path is empty, it attempts to load the
@@ -76,3 +137,100 @@ func newCertPool(caCertFile string) (*x509.CertPool, error) {
 	}
 	return certPool, nil
 }
+
+// ServerCertificate is the certificate chain presented by a server, as
+// returned by [ProbeServerCertificate].
+type ServerCertificate struct {
+	// Chain is the presented certificate chain, leaf certificate first.
+	Chain []*x509.Certificate
+	// VerifyErr is the error verifying the chain for the server address with
+	// the client's root certificates, nil if the chain is trusted.
+	VerifyErr error
+}
+
+// ProbeServerCertificate performs a TLS handshake with the server at address
+// and returns the certificate chain it presents, to debug mTLS trust problems.
+// Unlike [NewClient], the chain is returned even if it is not trusted, the
+// verification error is reported in the result instead. The client
+// certificate, key and server CA are used as in [NewClient]. The handshake
+// uses the proxy given by [WithProxy] or the HTTPS_PROXY environment variable,
+// if any.
+func ProbeServerCertificate(ctx context.Context, address, clientCert, clientKey, serverCA string, clientOpts ...ClientOption) (*ServerCertificate, error) {
+	o := &clientOptions{}
+	for _, opt := range clientOpts {
+		opt(o)
+	}
+	tlsConfig, err := clientTLSConfig(clientCert, clientKey, serverCA, o.intermediates...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCredentials, err)
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: address %q: %w", ErrClientConn, address, err)
+	}
+	result := &ServerCertificate{}
+	tlsConfig.ServerName = host
+	tlsConfig.ClientSessionCache = o.sessionCache
+	tlsConfig.InsecureSkipVerify = true //nolint:gosec // the chain is verified below and reported even if untrusted.
+	tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("cannot parse server certificate: %w", err)
+			}
+			result.Chain = append(result.Chain, cert)
+		}
+		return nil
+	}
+	conn, err := dialProbe(ctx, address, o.proxy)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close() //nolint:errcheck // probe connection, nothing is sent.
+	tlsConn := tls.Client(conn, tlsConfig)
+	// The handshake may fail after the server has presented its certificate,
+	// for example if it rejects the client certificate.
+	if err := tlsConn.HandshakeContext(ctx); err != nil && len(result.Chain) == 0 {
+		return nil, fmt.Errorf("%w: TLS handshake with %q: %w", ErrClientConn, address, err)
+	}
+	if len(result.Chain) == 0 {
+		return nil, fmt.Errorf("%w: %q presented no certificate", ErrClientConn, address)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range result.Chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, result.VerifyErr = result.Chain[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         tlsConfig.RootCAs,
+		Intermediates: intermediates,
+	})
+	return result, nil
+}
+
+// dialProbe connects to address, through the given HTTP CONNECT proxy URL or
+// the proxy of the environment, if any.
+func dialProbe(ctx context.Context, address, proxy string) (net.Conn, error) {
+	if proxy == "" {
+		envProxy, err := http.ProxyFromEnvironment(&http.Request{URL: &url.URL{Scheme: "https", Host: address}})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrProxy, err)
+		}
+		if envProxy != nil {
+			proxy = envProxy.String()
+		}
+	}
+	if proxy != "" {
+		proxyURL, err := parseProxyURL(proxy)
+		if err != nil {
+			return nil, err
+		}
+		return proxyDialer(proxyURL)(ctx, address)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot dial %q: %w", ErrClientConn, address, err)
+	}
+	return conn, nil
+}
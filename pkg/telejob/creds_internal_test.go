@@ -0,0 +1,107 @@
+package telejob
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionResumption(t *testing.T) {
+	t.Parallel()
+	key := [32]byte{1, 2, 3}
+	tests := map[string]struct {
+		opts       []ServerOption
+		wantResume bool
+	}{
+		"default":       {wantResume: true},
+		"ticket keys":   {opts: []ServerOption{WithSessionTicketKeys(key)}, wantResume: true},
+		"no resumption": {opts: []ServerOption{WithSessionTicketKeys(key), WithoutSessionResumption()}, wantResume: false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			serverConfig, clientConfig := newResumptionConfigs(t, tc.opts...)
+			require.False(t, handshake(t, serverConfig, clientConfig))
+			require.Equal(t, tc.wantResume, handshake(t, serverConfig, clientConfig))
+		})
+	}
+
+	// Servers sharing ticket keys resume each other's sessions.
+	serverConfig, clientConfig := newResumptionConfigs(t, WithSessionTicketKeys(key))
+	require.False(t, handshake(t, serverConfig, clientConfig))
+	replicaConfig, _ := newResumptionConfigs(t, WithSessionTicketKeys(key))
+	require.True(t, handshake(t, replicaConfig, clientConfig))
+
+	// Without session cache, clients never resume.
+	clientConfig.ClientSessionCache = nil
+	require.False(t, handshake(t, serverConfig, clientConfig))
+	require.False(t, handshake(t, serverConfig, clientConfig))
+}
+
+func BenchmarkHandshake(b *testing.B) {
+	b.Run("full", func(b *testing.B) {
+		serverConfig, clientConfig := newResumptionConfigs(b, WithoutSessionResumption())
+		for range b.N {
+			handshake(b, serverConfig, clientConfig)
+		}
+	})
+	b.Run("resumed", func(b *testing.B) {
+		serverConfig, clientConfig := newResumptionConfigs(b)
+		handshake(b, serverConfig, clientConfig)
+		b.ResetTimer()
+		for range b.N {
+			require.True(b, handshake(b, serverConfig, clientConfig))
+		}
+	})
+}
+
+// newResumptionConfigs returns the TLS configurations of a server with the
+// given options and of a client with a session cache.
+func newResumptionConfigs(tb testing.TB, opts ...ServerOption) (*tls.Config, *tls.Config) {
+	tb.Helper()
+	o := &serverOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	serverConfig, err := serverTLSConfig("testdata/server.crt", "testdata/server.key", "testdata/client-ca.crt")
+	require.NoError(tb, err)
+	o.configureSessionResumption(serverConfig)
+	clientConfig, err := clientTLSConfig("testdata/client1.crt", "testdata/client1.key", "testdata/server-ca.crt")
+	require.NoError(tb, err)
+	clientConfig.ServerName = "127.0.0.1"
+	clientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	return serverConfig, clientConfig
+}
+
+// handshake performs a TLS handshake over a loopback connection and reports
+// whether the client resumed a session. The client reads a byte sent by the
+// server, so that it receives the server's session ticket. Unlike net.Pipe,
+// the loopback connection is buffered, as both sides write concurrently.
+func handshake(tb testing.TB, serverConfig, clientConfig *tls.Config) bool {
+	tb.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(tb, err)
+	defer lis.Close() //nolint:errcheck // test listener.
+	errCh := make(chan error, 1)
+	go func() {
+		serverConn, err := lis.Accept()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		conn := tls.Server(serverConn, serverConfig)
+		defer conn.Close() //nolint:errcheck // test connection.
+		_, err = conn.Write([]byte{1})
+		errCh <- err
+	}()
+	clientConn, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(tb, err)
+	conn := tls.Client(clientConn, clientConfig)
+	defer conn.Close() //nolint:errcheck // test connection.
+	_, err = conn.Read(make([]byte, 1))
+	require.NoError(tb, err)
+	require.NoError(tb, <-errCh)
+	return conn.ConnectionState().DidResume
+}
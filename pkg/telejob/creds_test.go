@@ -2,7 +2,19 @@ package telejob_test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/juliaogris/telejob/pkg/pb"
 	"github.com/juliaogris/telejob/pkg/telejob"
@@ -44,6 +56,30 @@ func TestCredsServerCertNoIP(t *testing.T) {
 	require.Contains(t, s.Message(), "doesn't contain any IP SANs")
 }
 
+func TestCredsProbeServerCertificate(t *testing.T) {
+	t.Parallel()
+	ts := newTestServer(t, serverCrt, serverKey, clientCA)
+	defer ts.Stop()
+	got, err := telejob.ProbeServerCertificate(context.Background(), ts.address, crt1, key1, serverCA)
+	require.NoError(t, err)
+	require.Len(t, got.Chain, 1)
+	require.Equal(t, "server", got.Chain[0].Subject.CommonName)
+	require.Equal(t, "server-ca", got.Chain[0].Issuer.CommonName)
+	require.NoError(t, got.VerifyErr)
+
+	// The chain is returned even if untrusted, with the verification error.
+	ts = newTestServer(t, noIPServerCrt, noIPServerKey, clientCA)
+	defer ts.Stop()
+	got, err = telejob.ProbeServerCertificate(context.Background(), ts.address, crt1, key1, serverCA)
+	require.NoError(t, err)
+	require.Equal(t, []string{"localhost"}, got.Chain[0].DNSNames)
+	require.Empty(t, got.Chain[0].IPAddresses)
+	require.ErrorContains(t, got.VerifyErr, "doesn't contain any IP SANs")
+
+	_, err = telejob.ProbeServerCertificate(context.Background(), "localhost", crt1, key1, serverCA)
+	require.ErrorIs(t, err, telejob.ErrClientConn)
+}
+
 func TestCredsBadClient(t *testing.T) {
 	t.Parallel()
 	ts := newTestServer(t, serverCrt, serverKey, clientCA)
@@ -71,6 +107,37 @@ func TestCredsBadClient(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestCredsRequiredClientEKU(t *testing.T) {
+	t.Parallel()
+	// Without the option, certificates without extended key usage are accepted.
+	ts := newTestServer(t, serverCrt, serverKey, clientCA)
+	defer ts.Stop()
+	client, err := telejob.NewClient(ts.address, noEKUCrt, noEKUKey, serverCA)
+	require.NoError(t, err)
+	_, err = client.Status(context.Background(), &pb.StatusRequest{Id: "1"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	ts = newTestServerWithOptions(t, telejob.WithRequiredClientEKU())
+	defer ts.Stop()
+	client, err = telejob.NewClient(ts.address, noEKUCrt, noEKUKey, serverCA)
+	require.NoError(t, err)
+	_, err = client.Status(context.Background(), &pb.StatusRequest{Id: "1"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	client, err = telejob.NewClient(ts.address, crt1, key1, serverCA)
+	require.NoError(t, err)
+	_, err = client.Status(context.Background(), &pb.StatusRequest{Id: "1"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	// client1 has no custom extended key usage.
+	ts = newTestServerWithOptions(t, telejob.WithRequiredClientEKU(asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}))
+	defer ts.Stop()
+	client, err = telejob.NewClient(ts.address, crt1, key1, serverCA)
+	require.NoError(t, err)
+	_, err = client.Status(context.Background(), &pb.StatusRequest{Id: "1"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
 func TestCredsPlainText(t *testing.T) {
 	t.Parallel()
 	ts := newTestServer(t, serverCrt, serverKey, clientCA)
@@ -89,3 +156,79 @@ func TestCredsPlainText(t *testing.T) {
 	_, err = client.Start(context.Background(), &pb.StartRequest{Command: "true"})
 	require.NoError(t, err)
 }
+
+func TestCredsIntermediateChain(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	root, rootKey := writeTestCert(t, dir, "root", nil, nil)
+	inter, interKey := writeTestCert(t, dir, "intermediate", root, rootKey)
+	writeTestCert(t, dir, "leaf", inter, interKey)
+	writeTestCert(t, dir, "other", nil, nil)
+	rootFile := filepath.Join(dir, "root.crt")
+	interFile := filepath.Join(dir, "intermediate.crt")
+	leafFile, leafKeyFile := filepath.Join(dir, "leaf.crt"), filepath.Join(dir, "leaf.key")
+
+	ts := newTestServer(t, serverCrt, serverKey, rootFile)
+	defer ts.Stop()
+
+	client, err := telejob.NewClient(ts.address, leafFile, leafKeyFile, serverCA, telejob.WithClientIntermediates(interFile))
+	require.NoError(t, err)
+	_, err = client.Status(context.Background(), &pb.StatusRequest{Id: "1"})
+	require.Equal(t, codes.NotFound, status.Code(err)) // authenticated.
+
+	// Without the intermediate, the leaf does not chain to the root CA.
+	client, err = telejob.NewClient(ts.address, leafFile, leafKeyFile, serverCA)
+	require.NoError(t, err)
+	_, err = client.Status(context.Background(), &pb.StatusRequest{Id: "1"})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	// Intermediates that did not sign the leaf are rejected locally.
+	_, err = telejob.NewClient(ts.address, leafFile, leafKeyFile, serverCA, telejob.WithClientIntermediates(filepath.Join(dir, "other.crt")))
+	require.ErrorIs(t, err, telejob.ErrCertLoad)
+	require.ErrorContains(t, err, `certificate "CN=leaf" is not signed by intermediate "CN=other"`)
+
+	_, err = telejob.NewClient(ts.address, leafFile, leafKeyFile, serverCA, telejob.WithClientIntermediates(filepath.Join(dir, "leaf.key")))
+	require.ErrorIs(t, err, telejob.ErrCertLoad)
+}
+
+// writeTestCert writes the certificate and key files <name>.crt and
+// <name>.key to dir. The certificate is a self-signed CA certificate if
+// parent is nil, an intermediate CA certificate if name contains
+// "intermediate" and a client certificate otherwise.
+func writeTestCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	switch {
+	case parent == nil || name == "intermediate":
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	default:
+		tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		tmpl.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0o600))
+	return cert, key
+}
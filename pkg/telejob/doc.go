@@ -8,26 +8,47 @@
 //
 // The [Client] created with [NewClient] provides a convenient way to
 // interact with the Telejob server. It establishes and closes secure
-// connections using mTLS.
+// connections using mTLS. [Client.Tail] streams a job's output over channels
+// for programs embedding the client.
 //
 // ## Server
 //
 // The [Server] created with [NewServer] manages the gRPC server and the
 // underlying job controller. It provides methods for starting and stopping the
-// server, as well as managing jobs.
+// server, as well as managing jobs. Use [NewServerWithOptions] for further
+// server configuration with [ServerOption] values.
 //
 // ## Security
 //
 // The package enforces mTLS authentication for all communication between the
 // client and server. It uses TLS version 1.3 and requires valid certificates
-// for both the client and server.
+// for both the client and server. Optionally, client certificates must contain
+// specific extended key usages, see [WithRequiredClientEKU].
+//
+// Certificates issued by intermediate CAs are presented together with their
+// intermediate certificates, set with [WithClientIntermediates] and
+// [WithServerIntermediates]. The chain is checked when loaded, so that a
+// wrong or misordered intermediate is reported before connecting.
+//
+// Clients created with [WithSessionCache] resume TLS sessions to skip the
+// full handshake on further connections. Servers can share session ticket
+// keys between replicas with [WithSessionTicketKeys] or disable resumption
+// with [WithoutSessionResumption].
 //
 // ## Service
 //
 // The Service implements the generated gRPC interface pb.TelejobServer. It
-// requires that the [job.Controller] is initialized and that job owners are
-// passed via the context using the [OwnerKey]. It is a lower integration point
-// than the [Server] type for custom security setup or testing.
+// requires that a [JobController], such as the [job.Controller], is
+// initialized and that job owners are passed via the context using the
+// [OwnerKey]. It is a lower integration point than the [Server] type for
+// custom security setup, alternative job backends or testing.
+//
+// ## HTTP Gateway
+//
+// Servers created with [WithHTTPGateway] also serve the read-only Status and
+// List RPCs as JSON over HTTPS, at /v1/jobs/{id} and /v1/jobs, for tools that
+// poll job status without gRPC. The gateway uses the same mTLS setup and
+// authorizes clients as the owner of their certificate's common name.
 //
 // # Example Usage
 //
@@ -49,6 +70,15 @@
 //	}
 //	jobID := resp.GetId()
 //
+//	// print the job's output until it terminates
+//	output, errs := client.Tail(context.Background(), jobID)
+//	for chunk := range output {
+//		os.Stdout.Write(chunk)
+//	}
+//	if err := <-errs; err != nil {
+//		// handle error
+//	}
+//
 // Server:
 //
 //	server, err := NewServer("localhost:8443", "server.crt", "server.key", "client-ca.crt")
@@ -0,0 +1,194 @@
+package telejob
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/juliaogris/telejob/pkg/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// gatewayShutdownTimeout is the time granted to in-flight gateway requests
+// when the server is stopped.
+const gatewayShutdownTimeout = 2 * time.Second
+
+// httpGateway serves the read-only Status and List RPCs of a [Service] as
+// JSON over HTTPS, for tools that do not speak gRPC, see [WithHTTPGateway].
+// It uses the server's TLS configuration, so that clients authenticate with
+// the same certificates as gRPC clients and are authorized as the same owner.
+//
+// The gateway serves the following endpoints:
+//
+//	GET /v1/jobs/{id}                          Status of the job with the given ID.
+//	GET /v1/jobs?running_only=true&label=k=v   List, labels may be repeated.
+//
+// Responses are the JSON encoding of the RPC responses, errors the JSON
+// encoding of the gRPC status, such as {"code":5, "message":"..."}.
+type httpGateway struct {
+	service *Service
+	auth    *authenticator
+	lis     net.Listener
+	server  *http.Server
+}
+
+// newStartedHTTPGateway listens on addr and serves the gateway for the given
+// service until close is called.
+func newStartedHTTPGateway(addr string, service *Service, auth *authenticator, tlsConfig *tls.Config) (*httpGateway, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen for HTTP gateway: %w", err)
+	}
+	g := &httpGateway{service: service, auth: auth, lis: lis}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/jobs/{id}", g.handleStatus)
+	mux.HandleFunc("GET /v1/jobs", g.handleList)
+	g.server = &http.Server{
+		Handler:           mux,
+		TLSConfig:         tlsConfig.Clone(),
+		ReadHeaderTimeout: 10 * time.Second, //nolint:mnd // generous for a local API.
+	}
+	go func() {
+		if err := g.server.ServeTLS(lis, "", ""); !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP gateway stopped", "err", err)
+		}
+	}()
+	return g, nil
+}
+
+// addr returns the address the gateway listens on.
+func (g *httpGateway) addr() string {
+	return g.lis.Addr().String()
+}
+
+// close gracefully stops the gateway, cutting off requests that take longer
+// than gatewayShutdownTimeout.
+func (g *httpGateway) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), gatewayShutdownTimeout)
+	defer cancel()
+	if err := g.server.Shutdown(ctx); err != nil {
+		slog.Error("cannot shut down HTTP gateway", "err", err)
+	}
+}
+
+func (g *httpGateway) handleStatus(w http.ResponseWriter, r *http.Request) {
+	ctx, err := g.authenticate(r)
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	resp, err := g.service.Status(ctx, &pb.StatusRequest{Id: r.PathValue("id")})
+	writeGatewayResponse(w, resp, err)
+}
+
+func (g *httpGateway) handleList(w http.ResponseWriter, r *http.Request) {
+	ctx, err := g.authenticate(r)
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	req, err := gatewayListRequest(r)
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	resp, err := g.service.List(ctx, req)
+	writeGatewayResponse(w, resp, err)
+}
+
+// authenticate returns the request's context with the identity of the
+// client's verified certificate, like the gRPC interceptors do.
+func (g *httpGateway) authenticate(r *http.Request) (context.Context, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "%v: no peer certificates", ErrCommonName)
+	}
+	cert := r.TLS.PeerCertificates[0]
+	if err := g.auth.verifyEKU(cert); err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "%v", err)
+	}
+	return g.auth.withIdentity(r.Context(), newIdentity(cert)), nil
+}
+
+// gatewayListRequest converts the query parameters running_only and label of
+// a list request to a pb.ListRequest.
+func gatewayListRequest(r *http.Request) (*pb.ListRequest, error) {
+	query := r.URL.Query()
+	req := &pb.ListRequest{}
+	switch query.Get("running_only") {
+	case "", "false":
+	case "true":
+		req.RunningOnly = true
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid running_only %q", query.Get("running_only"))
+	}
+	for _, label := range query["label"] {
+		k, v, ok := strings.Cut(label, "=")
+		if !ok || k == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid label %q: expected KEY=VALUE", label)
+		}
+		if req.Labels == nil {
+			req.Labels = map[string]string{}
+		}
+		req.Labels[k] = v
+	}
+	return req, nil
+}
+
+// writeGatewayResponse writes the JSON encoding of resp, or of the gRPC
+// status of err if not nil.
+func writeGatewayResponse(w http.ResponseWriter, resp proto.Message, err error) {
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	writeGatewayJSON(w, http.StatusOK, resp)
+}
+
+// writeGatewayError writes the JSON encoding of the gRPC status of err with
+// the corresponding HTTP status code.
+func writeGatewayError(w http.ResponseWriter, err error) {
+	s := status.Convert(err)
+	writeGatewayJSON(w, httpStatusCode(s.Code()), s.Proto())
+}
+
+func writeGatewayJSON(w http.ResponseWriter, code int, msg proto.Message) {
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err := w.Write(b); err != nil {
+		slog.Debug("cannot write HTTP gateway response", "err", err)
+	}
+}
+
+// httpStatusCode maps a gRPC status code to an HTTP status code.
+func httpStatusCode(code codes.Code) int {
+	switch code { //nolint:exhaustive // other codes are internal server errors.
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,117 @@
+package telejob_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/juliaogris/telejob/pkg/job"
+	"github.com/juliaogris/telejob/pkg/pb"
+	"github.com/juliaogris/telejob/pkg/telejob"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHTTPGateway(t *testing.T) {
+	t.Parallel()
+	ts := newTestServerWithOptions(t, telejob.WithHTTPGateway("127.0.0.1:0"))
+	defer ts.Stop()
+	client, err := telejob.NewClient(ts.address, crt1, key1, serverCA)
+	require.NoError(t, err)
+	ctx := context.Background()
+	startResp, err := client.Start(ctx, &pb.StartRequest{Command: "sh", Arguments: []string{"-c", "exit 3"}, Labels: map[string]string{"env": "ci"}})
+	require.NoError(t, err)
+	id := startResp.GetId()
+	var want *pb.StatusResponse
+	require.Eventually(t, func() bool {
+		want, err = client.Status(ctx, &pb.StatusRequest{Id: id})
+		require.NoError(t, err)
+		return want.GetJobStatus().GetState() == pb.State_STATE_STOPPED
+	}, time.Second, 10*time.Millisecond)
+
+	httpClient := newGatewayClient(t, crt1, key1)
+	base := "https://" + ts.GatewayAddr() + "/v1/jobs"
+	got := &pb.StatusResponse{}
+	require.Equal(t, http.StatusOK, getGatewayJSON(t, httpClient, base+"/"+id, got))
+	require.True(t, proto.Equal(want, got), "gRPC: %v\nHTTP: %v", want, got)
+
+	wantList, err := client.List(ctx, &pb.ListRequest{Labels: map[string]string{"env": "ci"}})
+	require.NoError(t, err)
+	gotList := &pb.ListResponse{}
+	require.Equal(t, http.StatusOK, getGatewayJSON(t, httpClient, base+"?label=env=ci", gotList))
+	require.True(t, proto.Equal(wantList, gotList), "gRPC: %v\nHTTP: %v", wantList, gotList)
+	require.Len(t, gotList.GetJobs(), 1)
+	require.Equal(t, http.StatusOK, getGatewayJSON(t, httpClient, base+"?running_only=true", gotList))
+	require.Empty(t, gotList.GetJobs())
+	require.Equal(t, http.StatusBadRequest, getGatewayJSON(t, httpClient, base+"?label=env", gotList))
+
+	// Jobs of other owners are not found, as with gRPC.
+	otherClient := newGatewayClient(t, crt2, key2)
+	require.Equal(t, http.StatusNotFound, getGatewayJSON(t, otherClient, base+"/"+id, got))
+	require.Equal(t, http.StatusOK, getGatewayJSON(t, otherClient, base, gotList))
+	require.Empty(t, gotList.GetJobs())
+
+	// The gateway is read-only and requires client certificates.
+	resp, err := httpClient.Post(base, "application/json", nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	noCertClient := newGatewayClient(t, "", "")
+	_, err = noCertClient.Get(base) //nolint:noctx // test request.
+	require.Error(t, err)
+}
+
+func TestHTTPGatewayDisabled(t *testing.T) {
+	t.Parallel()
+	// The server is not served, so that stopping it right away does not
+	// race with Serve.
+	jobOpts := []job.Option{job.WithCgroup(fmt.Sprintf("/sys/fs/cgroup/telejob-%d", rand.Uint64()))} //nolint:gosec // G404: Use of weak random number generator
+	server, err := telejob.NewServerWithOptions(serverCrt, serverKey, clientCA, telejob.WithJobOptions(jobOpts...))
+	require.NoError(t, err)
+	defer server.Stop()
+	require.Empty(t, server.GatewayAddr())
+}
+
+// newGatewayClient returns an HTTP client trusting the test server CA and
+// authenticating with the given client certificate, if any.
+func newGatewayClient(t *testing.T, certFile, keyFile string) *http.Client {
+	t.Helper()
+	b, err := os.ReadFile(serverCA)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(b))
+	tlsConfig := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS13}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		require.NoError(t, err)
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	t.Cleanup(httpClient.CloseIdleConnections)
+	return httpClient
+}
+
+// getGatewayJSON gets the url and decodes the JSON response body into msg. It
+// returns the HTTP status code.
+func getGatewayJSON(t *testing.T, client *http.Client, url string, msg proto.Message) int {
+	t.Helper()
+	resp, err := client.Get(url) //nolint:noctx // test request.
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	if resp.StatusCode == http.StatusOK {
+		proto.Reset(msg)
+		require.NoError(t, protojson.Unmarshal(b, msg))
+	}
+	return resp.StatusCode
+}
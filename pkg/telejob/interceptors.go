@@ -2,7 +2,10 @@ package telejob
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/asn1"
 	"fmt"
+	"slices"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -11,45 +14,93 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-// unaryInterceptorCN is a unary interceptor that extracts the common name from
-// the client's certificate and adds it to the context.
-func unaryInterceptorCN(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
-	cn, err := extractCommonName(ctx)
+// authenticator authenticates clients by their verified TLS certificate and
+// optionally requires extended key usages on it.
+//
+// The TLS handshake already rejects client certificates whose extended key
+// usages do not permit client authentication, but it accepts certificates
+// without extended key usage extension. The stricter checks are performed in
+// the interceptors, rather than in a VerifyPeerCertificate callback, so that
+// clients receive an Unauthenticated status instead of a connection error.
+//
+// Clients whose common name is contained in operators are assigned the
+// [RoleOperator].
+type authenticator struct {
+	requireClientEKU bool
+	requiredEKUOIDs  []asn1.ObjectIdentifier
+	operators        []string
+}
+
+// unaryInterceptorCN is a unary interceptor that extracts the identity from
+// the client's certificate and adds it, its common name as owner and the
+// client's role to the context.
+func (a *authenticator) unaryInterceptorCN(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	identity, err := a.extractIdentity(ctx)
 	if err != nil {
 		return nil, status.Errorf(codes.Unauthenticated, "%v", err)
 	}
-	ctx = context.WithValue(ctx, OwnerKey{}, cn)
+	ctx = a.withIdentity(ctx, identity)
 	return handler(ctx, req)
 }
 
-// streamInterceptorCN is a stream interceptor that extracts the common name
-// from the client's certificate and adds it to the context.
-func streamInterceptorCN(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+// streamInterceptorCN is a stream interceptor that extracts the identity from
+// the client's certificate and adds it, its common name as owner and the
+// client's role to the context.
+func (a *authenticator) streamInterceptorCN(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 	ctx := stream.Context()
-	cn, err := extractCommonName(ctx)
+	identity, err := a.extractIdentity(ctx)
 	if err != nil {
 		return status.Errorf(codes.Unauthenticated, "%v", err)
 	}
-	ctx = context.WithValue(ctx, OwnerKey{}, cn)
+	ctx = a.withIdentity(ctx, identity)
 	wrapped := &wrappedServerStream{ServerStream: stream, ctx: ctx}
 	return handler(srv, wrapped)
 }
 
-// extractCommonName extracts the common name from the client's certificate.
-func extractCommonName(ctx context.Context) (string, error) {
+// withIdentity adds the client's identity, its common name as owner and the
+// client's role, if any, to the context.
+func (a *authenticator) withIdentity(ctx context.Context, identity Identity) context.Context {
+	ctx = context.WithValue(ctx, IdentityKey{}, identity)
+	ctx = context.WithValue(ctx, OwnerKey{}, identity.CommonName)
+	if slices.Contains(a.operators, identity.CommonName) {
+		ctx = context.WithValue(ctx, RoleKey{}, RoleOperator)
+	}
+	return ctx
+}
+
+// extractIdentity extracts the identity from the client's certificate after
+// verifying its extended key usages.
+func (a *authenticator) extractIdentity(ctx context.Context) (Identity, error) {
 	peer, ok := peer.FromContext(ctx)
 	if !ok {
-		return "", fmt.Errorf("%w: cannot get peer from context", ErrCommonName)
+		return Identity{}, fmt.Errorf("%w: cannot get peer from context", ErrCommonName)
 	}
 	tlsInfo, ok := peer.AuthInfo.(credentials.TLSInfo)
 	if !ok {
-		return "", fmt.Errorf("%w: cannot get TLSInfo from peer", ErrCommonName)
+		return Identity{}, fmt.Errorf("%w: cannot get TLSInfo from peer", ErrCommonName)
 	}
 	peerCerts := tlsInfo.State.PeerCertificates
 	if len(peerCerts) == 0 {
-		return "", fmt.Errorf("%w: no peer certificates", ErrCommonName)
+		return Identity{}, fmt.Errorf("%w: no peer certificates", ErrCommonName)
+	}
+	if err := a.verifyEKU(peerCerts[0]); err != nil {
+		return Identity{}, err
+	}
+	return newIdentity(peerCerts[0]), nil
+}
+
+// verifyEKU checks that the certificate contains the required extended key
+// usages.
+func (a *authenticator) verifyEKU(cert *x509.Certificate) error {
+	if a.requireClientEKU && !slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageClientAuth) {
+		return fmt.Errorf("%w: client authentication required", ErrExtKeyUsage)
+	}
+	for _, oid := range a.requiredEKUOIDs {
+		if !slices.ContainsFunc(cert.UnknownExtKeyUsage, oid.Equal) {
+			return fmt.Errorf("%w: %v required", ErrExtKeyUsage, oid)
+		}
 	}
-	return peerCerts[0].Subject.CommonName, nil
+	return nil
 }
 
 // wrappedServerStream is a wrapper around grpc.ServerStream that allows
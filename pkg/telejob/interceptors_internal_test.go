@@ -0,0 +1,46 @@
+package telejob
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+func TestInterceptorIdentity(t *testing.T) {
+	t.Parallel()
+	uri, err := url.Parse("spiffe://example.org/ci/deployer")
+	require.NoError(t, err)
+	cert := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "client1", Organization: []string{"Example"}},
+		Issuer:  pkix.Name{CommonName: "client-ca"},
+		URIs:    []*url.URL{uri},
+	}
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+
+	a := &authenticator{}
+	handler := func(ctx context.Context, _ any) (any, error) {
+		identity, ok := IdentityFromContext(ctx)
+		require.True(t, ok)
+		require.Equal(t, "client1", identity.CommonName)
+		require.Equal(t, []string{"Example"}, identity.Subject.Organization)
+		require.Equal(t, "client-ca", identity.Issuer.CommonName)
+		require.Equal(t, []*url.URL{uri}, identity.URIs)
+		require.Equal(t, "client1", extractOwner(ctx))
+		return "ok", nil
+	}
+	resp, err := a.unaryInterceptorCN(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	require.NoError(t, err)
+	require.Equal(t, "ok", resp)
+
+	_, ok := IdentityFromContext(context.Background())
+	require.False(t, ok)
+}
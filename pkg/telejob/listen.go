@@ -0,0 +1,44 @@
+package telejob
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"syscall"
+	"time"
+)
+
+// listenBackoff is the initial and maxListenBackoff the maximum delay between
+// attempts of [ListenWithRetry].
+const (
+	listenBackoff    = 50 * time.Millisecond
+	maxListenBackoff = time.Second
+)
+
+// ListenWithRetry listens on the TCP address like [net.Listen]. If the address
+// is already in use, for example by a previous server instance that is still
+// shutting down during a rolling restart, it retries with exponential backoff
+// until timeout has elapsed. Other errors, such as permission denied, are
+// permanent and returned immediately. If timeout is not positive, it makes a
+// single attempt.
+func ListenWithRetry(address string, timeout time.Duration) (net.Listener, error) {
+	deadline := time.Now().Add(timeout)
+	backoff := listenBackoff
+	for attempt := 1; ; attempt++ {
+		lis, err := net.Listen("tcp", address)
+		if err == nil {
+			return lis, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, fmt.Errorf("cannot listen: %w", err)
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("cannot listen after %d attempts: %w", attempt, err)
+		}
+		slog.Warn("retrying listen on address in use", "address", address, "attempt", attempt, "err", err)
+		time.Sleep(min(backoff, remaining))
+		backoff = min(2*backoff, maxListenBackoff)
+	}
+}
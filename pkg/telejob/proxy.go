@@ -0,0 +1,100 @@
+package telejob
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// parseProxyURL parses the URL of an HTTP CONNECT proxy. Only the http scheme
+// is supported, the port defaults to 80.
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProxy, err)
+	}
+	if proxyURL.Scheme != "http" || proxyURL.Hostname() == "" {
+		return nil, fmt.Errorf("%w: expected http://HOST[:PORT], got %q", ErrProxy, rawURL)
+	}
+	if proxyURL.Port() == "" {
+		proxyURL.Host = net.JoinHostPort(proxyURL.Hostname(), "80")
+	}
+	return proxyURL, nil
+}
+
+// proxyDialer returns a gRPC context dialer that connects to addresses
+// through the HTTP CONNECT proxy at proxyURL. The TLS handshake with the
+// server is performed by gRPC on the returned tunnelled connection.
+func proxyDialer(proxyURL *url.URL) func(context.Context, string) (net.Conn, error) {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", proxyURL.Host)
+		if err != nil {
+			return nil, fmt.Errorf("%w: cannot dial %q: %w", ErrProxy, proxyURL.Host, err)
+		}
+		tunnel, err := connectTunnel(ctx, conn, proxyURL, addr)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return tunnel, nil
+	}
+}
+
+// connectTunnel sends a CONNECT request for addr on the proxy connection and
+// returns the tunnelled connection once the proxy has accepted it.
+func connectTunnel(ctx context.Context, conn net.Conn, proxyURL *url.URL, addr string) (net.Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, fmt.Errorf("%w: cannot set deadline: %w", ErrProxy, err)
+		}
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("%w: cannot send CONNECT request: %w", ErrProxy, err)
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot read CONNECT response: %w", ErrProxy, err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: CONNECT to %q failed: %s", ErrProxy, addr, resp.Status)
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, fmt.Errorf("%w: cannot reset deadline: %w", ErrProxy, err)
+	}
+	if r.Buffered() > 0 {
+		// The server may have sent data right after the CONNECT response.
+		return &bufferedConn{Conn: conn, r: r}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn whose reads are served from a bufio.Reader
+// holding data already read from the connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Read reads from the buffered reader.
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p) //nolint:wrapcheck // transparent wrapper of the connection.
+}
@@ -0,0 +1,30 @@
+package telejob
+
+import "strings"
+
+// CommandLine returns the command and its arguments as a single line, quoted
+// for a POSIX shell, so that it can be copied into a shell to run the same
+// argv. Words consisting only of letters, digits and the characters
+// "@%+=:,./-_" are not quoted, all others are single-quoted. The server sets
+// it as the command_line of job statuses, so that all clients render
+// commands identically.
+func CommandLine(command string, args []string) string {
+	words := make([]string, 0, 1+len(args))
+	words = append(words, shellQuote(command))
+	for _, arg := range args {
+		words = append(words, shellQuote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// shellQuote quotes s as a single word for a POSIX shell. Single quotes
+// within s end the quoted string, are escaped and start a new one.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./-_") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,33 @@
+package telejob_test
+
+import (
+	"testing"
+
+	"github.com/juliaogris/telejob/pkg/telejob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandLine(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		command string
+		args    []string
+		want    string
+	}{
+		"plain":          {command: "ls", args: []string{"-la", "/tmp"}, want: "ls -la /tmp"},
+		"no arguments":   {command: "true", want: "true"},
+		"safe chars":     {command: "env", args: []string{"KEY=a,b:c@d%e+f_g.h/i"}, want: "env KEY=a,b:c@d%e+f_g.h/i"},
+		"spaces":         {command: "grep", args: []string{"hello world", "file name"}, want: "grep 'hello world' 'file name'"},
+		"single quotes":  {command: "echo", args: []string{"it's"}, want: `echo 'it'\''s'`},
+		"double quotes":  {command: "echo", args: []string{`say "hi"`}, want: `echo 'say "hi"'`},
+		"shell chars":    {command: "sh", args: []string{"-c", "echo $HOME; ls *"}, want: "sh -c 'echo $HOME; ls *'"},
+		"empty argument": {command: "printf", args: []string{""}, want: "printf ''"},
+		"newline":        {command: "echo", args: []string{"a\nb"}, want: "echo 'a\nb'"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tc.want, telejob.CommandLine(tc.command, tc.args))
+		})
+	}
+}
@@ -1,71 +1,627 @@
 package telejob
 
 import (
+	"bytes"
 	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
+	"net/url"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/juliaogris/telejob/pkg/job"
 	"github.com/juliaogris/telejob/pkg/pb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // Service implements the generated gRPC interface pb.TelejobServer.
 //
-// It requires that the [job.Controller] is initialized and that job owners
+// It requires that the [JobController] is initialized and that job owners
 // are passed via the context using the [OwnerKey]. It is a lower integration
 // point than the Server type for custom security setup or testing.
 //
-// It implements the gRPC layer to access [job.Controller] methods to:
+// It implements the gRPC layer to access [JobController] methods to:
 //   - Start jobs.
-//   - Stop jobs.
+//   - Stop jobs, also of other owners with the [RoleOperator].
+//   - Resume jobs started paused.
 //   - Retrieve job status.
+//   - Describe jobs for auditing, with redacted environment values unless
+//     the caller has the [RoleOperator].
+//   - List jobs.
+//   - Stream job logs.
+//   - Watch status changes of the jobs of all owners with the [RoleOperator].
+//
+// If LogHeartbeat is positive, Logs sends a heartbeat response whenever no
+// log data has been sent for the given duration, so that clients and proxies
+// can tell idle streams from dead ones.
+//
+// If MaxLogStreams is positive, it limits the number of concurrently open
+// Logs and Attach streams across all clients and jobs, as each stream holds a
+// log reader and follower goroutines. Streams beyond the limit are rejected
+// with a ResourceExhausted gRPC error.
+//
+// If EnableDebug is set, operators can retrieve internal counters with the
+// Debug RPC.
 type Service struct {
-	Controller *job.Controller
+	Controller    JobController
+	LogHeartbeat  time.Duration
+	MaxLogStreams int
+	EnableDebug   bool
+
+	logStreams atomic.Int64 // number of open Logs and Attach streams
+}
+
+// JobController is the job backend used by the [Service]. The
+// [job.Controller] is the default implementation, alternative implementations
+// can be used for remote executors or for testing.
+//
+// Implementations are expected to return errors wrapping the sentinel errors
+// of the job package, such as [job.ErrJobNotFound], so that the Service can
+// map them to the appropriate gRPC status codes.
+type JobController interface {
+	StartJobContext(ctx context.Context, owner string, opts job.StartOptions) (string, error)
+	Stop(owner, id string, opts ...job.StopOption) error
+	Resume(owner, id string) error
+	ForceStop(operator, id string) error
+	AggregateUsage() (job.Usage, error)
+	DebugStats() job.DebugStats
+	Status(owner, id string) (job.Status, error)
+	StatusBatch(owner string, ids []string) map[string]job.StatusResult
+	Describe(owner, id string) (job.Description, error)
+	ForceDescribe(operator, id string) (job.Description, error)
+	Stats(owner, id string) (job.JobStats, error)
+	EffectiveLimits(opts job.StartOptions) (job.Limits, error)
+	WriteInput(owner, id string, data []byte) error
+	AttachInput(owner, id string) (io.WriteCloser, error)
+	List(owner string) []job.Status
+	LogsReader(ctx context.Context, owner, id string, opts ...job.LogsOption) (io.Reader, error)
+	WatchAll(ctx context.Context) <-chan job.Event
+}
+
+var _ JobController = (*job.Controller)(nil)
+
+// CodeHinter is implemented by errors that carry their own gRPC status code.
+//
+// For errors returned by the [JobController], the Service uses the code of
+// the first error in the error tree implementing CodeHinter, see [errors.As].
+// Otherwise, it falls back to its mapping of the job package's sentinel
+// errors. This allows JobController implementations to add errors with
+// specific status codes without extending the Service's mapping.
+type CodeHinter interface {
+	GRPCCode() codes.Code
 }
 
 // OwnerKey is the key used to store the job owner in the context.
 type OwnerKey struct{}
 
+// IdentityKey is the key used to store the client's [Identity] in the
+// context. It is set alongside the [OwnerKey] by the [Server]'s interceptors.
+type IdentityKey struct{}
+
+// Identity is the identity of a client as stated by its verified TLS
+// certificate. The CommonName is used as job owner, the remaining fields are
+// available to custom authorization or labelling logic.
+type Identity struct {
+	CommonName     string
+	Subject        pkix.Name
+	Issuer         pkix.Name
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+}
+
+// newIdentity returns the identity stated by the given certificate.
+func newIdentity(cert *x509.Certificate) Identity {
+	return Identity{
+		CommonName:     cert.Subject.CommonName,
+		Subject:        cert.Subject,
+		Issuer:         cert.Issuer,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		IPAddresses:    cert.IPAddresses,
+		URIs:           cert.URIs,
+	}
+}
+
+// IdentityFromContext returns the client's identity stored in the context
+// with the [IdentityKey], if any.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(IdentityKey{}).(Identity)
+	return identity, ok
+}
+
+// RoleKey is the key used to store the [Role] of the client in the context.
+// Clients without role in the context have no special privileges.
+type RoleKey struct{}
+
+// Role is an authorization role of a client.
+type Role string
+
+// RoleOperator permits operator RPCs, such as ForceStop, which act on jobs of
+// all owners.
+const RoleOperator Role = "operator"
+
+// Capabilities returns the names of the RPCs implemented by the Service, as
+// listed in the Telejob service description, so that clients can check for
+// RPCs added in later versions.
+func (s *Service) Capabilities(context.Context, *pb.CapabilitiesRequest) (*pb.CapabilitiesResponse, error) {
+	desc := pb.Telejob_ServiceDesc
+	rpcs := make([]string, 0, len(desc.Methods)+len(desc.Streams))
+	for _, m := range desc.Methods {
+		rpcs = append(rpcs, m.MethodName)
+	}
+	for _, stream := range desc.Streams {
+		rpcs = append(rpcs, stream.StreamName)
+	}
+	slices.Sort(rpcs)
+	return &pb.CapabilitiesResponse{Rpcs: rpcs}, nil
+}
+
 // Start creates a new job with the given command and arguments. It extracts the
-// owner from the context and uses the [job.Controller] to start the job. If
+// owner from the context and uses the [JobController] to start the job. If
 // the command is empty or an error occurs, it returns an appropriate gRPC
 // error.
+//
+// If the request sets unique and a running job of the owner has the same
+// labels, it returns an AlreadyExists gRPC error with the running job's ID in
+// a ResourceInfo error detail.
+//
+// The context is passed to the [JobController], so that a client deadline
+// expiring during the job's cgroup and process setup aborts the setup with a
+// DeadlineExceeded gRPC error, or Canceled if the client cancels the call.
+//
+// If the request sets stop_at_deadline, the job is stopped once the deadline
+// of the context expires. The context's cancellation after Start returns does
+// not affect the job.
 func (s *Service) Start(ctx context.Context, req *pb.StartRequest) (*pb.StartResponse, error) {
+	return s.start(ctx, req)
+}
+
+// StartStream assembles a start request from a client stream and starts the
+// job like [Service.Start]. The first message of the stream must contain the
+// start request, all subsequent messages chunks of stdin and environment
+// variables. If the assembled stdin and environment exceed
+// [MaxStartStreamBytes], it returns a ResourceExhausted gRPC error.
+func (s *Service) StartStream(stream pb.Telejob_StartStreamServer) error {
+	msg, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("cannot receive start request: %w", err)
+	}
+	req := msg.GetStart()
+	if req == nil {
+		return status.Errorf(codes.InvalidArgument, "first message must be a start request")
+	}
+	size := len(req.GetStdin())
+	for _, env := range req.GetEnv() {
+		size += len(env)
+	}
+	for {
+		if size > MaxStartStreamBytes {
+			return status.Errorf(codes.ResourceExhausted, "start stream exceeds %d bytes", MaxStartStreamBytes)
+		}
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cannot receive start chunk: %w", err)
+		}
+		chunk := msg.GetChunk()
+		if chunk == nil {
+			return status.Errorf(codes.InvalidArgument, "subsequent messages must be chunks")
+		}
+		size += len(chunk.GetStdin())
+		for _, env := range chunk.GetEnv() {
+			size += len(env)
+		}
+		req.Stdin = append(req.Stdin, chunk.GetStdin()...)
+		req.Env = append(req.Env, chunk.GetEnv()...)
+	}
+	resp, err := s.start(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	if err := stream.SendAndClose(resp); err != nil {
+		return fmt.Errorf("%w: cannot send start response: %w", ErrStreamSend, err)
+	}
+	return nil
+}
+
+// start starts a job for the given request, shared by Start and StartStream.
+func (s *Service) start(ctx context.Context, req *pb.StartRequest) (*pb.StartResponse, error) {
 	owner := extractOwner(ctx)
-	command := req.GetCommand()
-	arguments := req.GetArguments()
-	if len(command) == 0 {
-		return nil, status.Errorf(codes.InvalidArgument, "empty command")
+	opts, err := startOptions(req)
+	if err != nil {
+		return nil, err
+	}
+	deadline, hasDeadline := ctx.Deadline()
+	if req.GetStopAtDeadline() && !hasDeadline {
+		return nil, status.Errorf(codes.InvalidArgument, "stop at deadline requested without deadline")
+	}
+	if delay := time.Until(opts.NotBefore); delay > 0 {
+		// Timeouts of scheduled jobs count from not_before.
+		deadline = deadline.Add(delay)
 	}
-	id, err := s.Controller.Start(owner, command, arguments...)
+	id, err := s.Controller.StartJobContext(ctx, owner, opts)
 	if err != nil {
-		if errors.Is(err, job.ErrCommand) {
-			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
-		}
-		return nil, status.Errorf(codes.Internal, "%v", err)
+		return nil, startStatusError(err, owner)
+	}
+	if req.GetStopAtDeadline() {
+		s.stopAt(owner, id, deadline)
 	}
 	return &pb.StartResponse{Id: id}, nil
 }
 
+// startStatusError converts an error starting a job of the given owner, or
+// computing its limits, to a gRPC status error.
+func startStatusError(err error, owner string) error {
+	var hinter CodeHinter
+	var dupErr *job.DuplicateJobError
+	var tooManyErr *job.TooManyJobsError
+	switch {
+	case errors.As(err, &hinter):
+		return status.Errorf(hinter.GRPCCode(), "%v", err)
+	case errors.As(err, &dupErr):
+		return duplicateJobStatusError(dupErr, owner)
+	case errors.As(err, &tooManyErr):
+		return tooManyJobsStatusError(tooManyErr)
+	case errors.Is(err, job.ErrAdmission):
+		return admissionStatusError(err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Errorf(codes.DeadlineExceeded, "%v", err)
+	case errors.Is(err, context.Canceled):
+		return status.Errorf(codes.Canceled, "%v", err)
+	case errors.Is(err, job.ErrCommand), errors.Is(err, job.ErrArgsTooLarge), errors.Is(err, job.ErrMount),
+		errors.Is(err, job.ErrLimits), errors.Is(err, job.ErrRootfs):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	case errors.Is(err, job.ErrController), errors.Is(err, job.ErrCredential):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	case errors.Is(err, job.ErrShutdown):
+		return status.Errorf(codes.Unavailable, "%v", err)
+	}
+	return status.Errorf(codes.Internal, "%v", err)
+}
+
+// startOptions converts a start request to job start options. It returns an
+// InvalidArgument gRPC error for empty commands.
+func startOptions(req *pb.StartRequest) (job.StartOptions, error) {
+	command := req.GetCommand()
+	if strings.TrimSpace(command) == "" {
+		return job.StartOptions{}, status.Errorf(codes.InvalidArgument, "empty command %q", command)
+	}
+	var notBefore time.Time
+	if req.GetNotBefore() != nil {
+		if err := req.GetNotBefore().CheckValid(); err != nil {
+			return job.StartOptions{}, status.Errorf(codes.InvalidArgument, "invalid not_before: %v", err)
+		}
+		notBefore = req.GetNotBefore().AsTime()
+	}
+	return job.StartOptions{
+		Command: command,
+		Argv0:   req.GetArgv0(),
+		Paused:  req.GetStartPaused(),
+		Args:    req.GetArguments(),
+		Labels:  req.GetLabels(),
+		Unique:  req.GetUnique(),
+		Env:     req.GetEnv(),
+		Stdin:   req.GetStdin(),
+
+		NotBefore:     notBefore,
+		DiscardOutput: req.GetDiscardOutput(),
+		Tty:           req.GetTty(),
+		Mounts:        jobMounts(req.GetMounts()),
+	}, nil
+}
+
+// jobMounts converts the mounts of a start request to job mounts.
+func jobMounts(mounts []*pb.Mount) []job.Mount {
+	if len(mounts) == 0 {
+		return nil
+	}
+	result := make([]job.Mount, len(mounts))
+	for i, m := range mounts {
+		result[i] = job.Mount{Source: m.GetSource(), Target: m.GetTarget(), ReadOnly: m.GetReadOnly()}
+	}
+	return result
+}
+
+// ExplainLimits returns the effective limits a job started with the given
+// request would run with, as computed by the [JobController], without
+// starting the job. Start requests carry no limits, so these are the server's
+// limits as applied by the controller. It helps users debug limits that do
+// not have the expected effect, for example as the server lacks a cgroup
+// controller. Errors are reported like for Start.
+func (s *Service) ExplainLimits(ctx context.Context, req *pb.StartRequest) (*pb.ExplainLimitsResponse, error) {
+	opts, err := startOptions(req)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := s.Controller.EffectiveLimits(opts)
+	if err != nil {
+		return nil, startStatusError(err, extractOwner(ctx))
+	}
+	return pbLimits(limits), nil
+}
+
+// pbLimits converts job limits to their protobuf representation.
+func pbLimits(limits job.Limits) *pb.ExplainLimitsResponse {
+	return &pb.ExplainLimitsResponse{
+		Cpus:          limits.CPUs,
+		MemoryKib:     limits.MemoryKiB,
+		MemoryHighKib: limits.MemoryHighKiB,
+		MemoryMinKib:  limits.MemoryMinKiB,
+		OomGroup:      limits.OOMGroup,
+		Io:            limits.IO,
+		Rlimits:       limits.Rlimits,
+		MaxCpuSeconds: limits.MaxCPUSeconds,
+	}
+}
+
+// stopAt stops the job with the given ID once the deadline has passed. Jobs
+// that have already terminated by then are left untouched.
+func (s *Service) stopAt(owner, id string, deadline time.Time) {
+	time.AfterFunc(time.Until(deadline), func() {
+		slog.Info("stopping job at deadline", "id", id)
+		if err := s.Controller.Stop(owner, id); err != nil && !errors.Is(err, job.ErrJobNotRunning) {
+			slog.Error("cannot stop job at deadline", "id", id, "err", err)
+		}
+	})
+}
+
 // Stop stops the job with the given ID. It extracts the owner from the context
-// and uses the [job.Controller] to stop the job. If an error occurs, it
-// returns an appropriate gRPC error.
+// and uses the [JobController] to stop the job, optionally with the requested
+// signal. If an error occurs, it returns an appropriate gRPC error. If the job
+// has already terminated, the response reports it with already_terminated
+// rather than failing, so that stopping remains idempotent.
 func (s *Service) Stop(ctx context.Context, req *pb.StopRequest) (*pb.StopResponse, error) {
 	owner := extractOwner(ctx)
-	if err := s.Controller.Stop(owner, req.GetId()); err != nil {
+	var opts []job.StopOption
+	if req.GetSignal() != "" {
+		sig, err := job.ParseSignal(req.GetSignal())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		opts = append(opts, job.WithSignal(sig))
+	}
+	err := s.Controller.Stop(owner, req.GetId(), opts...)
+	if errors.Is(err, job.ErrJobNotRunning) {
+		return &pb.StopResponse{AlreadyTerminated: true}, nil
+	}
+	if err != nil {
 		return nil, statusError(err, req.GetId())
 	}
 	return &pb.StopResponse{}, nil
 }
 
+// Resume resumes the job with the given ID, started paused. It extracts the
+// owner from the context and uses the [JobController] to resume the job. If
+// the job is not paused, it returns a FailedPrecondition gRPC error.
+func (s *Service) Resume(ctx context.Context, req *pb.ResumeRequest) (*pb.ResumeResponse, error) {
+	owner := extractOwner(ctx)
+	if err := s.Controller.Resume(owner, req.GetId()); err != nil {
+		return nil, statusError(err, req.GetId())
+	}
+	return &pb.ResumeResponse{}, nil
+}
+
+// WriteInput writes the request's data to the terminal of the job with the
+// given ID, started with tty. If the job has no terminal or is not running,
+// it returns a FailedPrecondition gRPC error.
+func (s *Service) WriteInput(ctx context.Context, req *pb.WriteInputRequest) (*pb.WriteInputResponse, error) {
+	owner := extractOwner(ctx)
+	if err := s.Controller.WriteInput(owner, req.GetId(), req.GetData()); err != nil {
+		return nil, statusError(err, req.GetId())
+	}
+	return &pb.WriteInputResponse{}, nil
+}
+
+// Attach streams the logs of the job with the ID of the first request, like
+// Logs with default options, and writes the data of the requests to the job's
+// terminal, for interactive sessions. The terminal's input is claimed with
+// the first data received and released when the client closes its side of
+// the stream. Data that cannot be written, for example as the input is
+// claimed by another session, is dropped and reported in a response with
+// input_error, without ending the stream. The stream ends when the job's
+// output ends.
+func (s *Service) Attach(stream pb.Telejob_AttachServer) error {
+	ctx := stream.Context()
+	owner := extractOwner(ctx)
+	req, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("cannot receive attach request: %w", err)
+	}
+	id := req.GetId()
+	release, err := s.acquireLogStream()
+	if err != nil {
+		return err
+	}
+	defer release()
+	reader, err := s.Controller.LogsReader(ctx, owner, id)
+	if err != nil {
+		return statusError(err, id)
+	}
+	inputErrs := make(chan error, 1)
+	dropped := make(chan error)
+	go func() {
+		inputErrs <- s.attachInput(ctx, stream, owner, id, req.GetData(), dropped)
+	}()
+	reads := readLogs(ctx, reader)
+	for {
+		select {
+		case err := <-inputErrs:
+			if err != nil {
+				return err
+			}
+			inputErrs = nil // input has ended, keep streaming output.
+		case err := <-dropped:
+			if err := stream.Send(&pb.LogsResponse{InputError: err.Error()}); err != nil {
+				slog.Error("cannot send attach stream", "err", err)
+				return fmt.Errorf("%w: cannot send attach stream: %w", ErrStreamSend, err)
+			}
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case r := <-reads:
+			switch {
+			case errors.Is(r.err, io.EOF):
+				return nil
+			case errors.Is(r.err, job.ErrLogTruncated):
+				return status.Errorf(codes.OutOfRange, "%v", r.err)
+			case r.err != nil:
+				return status.Errorf(codes.Internal, "error reading logs: %v", r.err)
+			}
+			if err := stream.Send(r.resp); err != nil {
+				slog.Error("cannot send attach stream", "err", err)
+				return fmt.Errorf("%w: cannot send attach stream: %w", ErrStreamSend, err)
+			}
+		}
+	}
+}
+
+// attachInput writes data and the data of the following requests of the
+// attach stream to the job's terminal until the client closes its side of the
+// stream or the job terminates. The terminal's input is claimed with the first
+// data and released on return. Data that cannot be written is dropped and its
+// error sent to dropped; a claim rejected as another session holds it is
+// retried with the next data.
+func (s *Service) attachInput(ctx context.Context, stream pb.Telejob_AttachServer, owner, id string, data []byte, dropped chan<- error) error {
+	var input io.WriteCloser
+	defer func() {
+		if input != nil {
+			_ = input.Close()
+		}
+	}()
+	for {
+		if len(data) > 0 {
+			var err error
+			if input == nil {
+				input, err = s.Controller.AttachInput(owner, id)
+			}
+			if err == nil {
+				_, err = input.Write(data)
+			}
+			if errors.Is(err, job.ErrJobNotRunning) {
+				return nil // the output stream ends with the job.
+			} else if err != nil {
+				select {
+				case dropped <- err:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot receive attach request: %w", err)
+		}
+		data = req.GetData()
+	}
+}
+
+// ForceStop stops the job with the given ID regardless of its owner. It
+// requires the [RoleOperator] in the context and returns a PermissionDenied
+// gRPC error otherwise. Like Stop, it reports already terminated jobs in the
+// response.
+func (s *Service) ForceStop(ctx context.Context, req *pb.ForceStopRequest) (*pb.ForceStopResponse, error) {
+	operator := extractOwner(ctx)
+	if extractRole(ctx) != RoleOperator {
+		slog.Warn("force stop denied", "client", operator, "id", req.GetId())
+		return nil, status.Errorf(codes.PermissionDenied, "force stop requires the %s role", RoleOperator)
+	}
+	err := s.Controller.ForceStop(operator, req.GetId())
+	if errors.Is(err, job.ErrJobNotRunning) {
+		return &pb.ForceStopResponse{AlreadyTerminated: true}, nil
+	}
+	if err != nil {
+		return nil, statusError(err, req.GetId())
+	}
+	return &pb.ForceStopResponse{}, nil
+}
+
+// Usage returns the resource usage summed over the running jobs of all
+// owners. It requires the [RoleOperator] in the context and returns a
+// PermissionDenied gRPC error otherwise.
+func (s *Service) Usage(ctx context.Context, _ *pb.UsageRequest) (*pb.UsageResponse, error) {
+	if extractRole(ctx) != RoleOperator {
+		return nil, status.Errorf(codes.PermissionDenied, "usage requires the %s role", RoleOperator)
+	}
+	usage, err := s.Controller.AggregateUsage()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get usage: %v", err)
+	}
+	return &pb.UsageResponse{
+		RunningJobs: int64(usage.RunningJobs),
+		MemoryBytes: usage.MemoryBytes,
+		Cpu:         durationpb.New(usage.CPU),
+	}, nil
+}
+
+// Debug returns internal counters for diagnosing leaks, such as dangling log
+// readers. It returns an Unimplemented gRPC error unless EnableDebug is set
+// and requires the [RoleOperator] in the context.
+func (s *Service) Debug(ctx context.Context, _ *pb.DebugRequest) (*pb.DebugResponse, error) {
+	if !s.EnableDebug {
+		return nil, status.Errorf(codes.Unimplemented, "debug is not enabled")
+	}
+	if extractRole(ctx) != RoleOperator {
+		return nil, status.Errorf(codes.PermissionDenied, "debug requires the %s role", RoleOperator)
+	}
+	stats := s.Controller.DebugStats()
+	return &pb.DebugResponse{
+		LogDispatchers: int64(stats.LogDispatchers),
+		LogFollowers:   int64(stats.LogFollowers),
+		Goroutines:     int64(runtime.NumGoroutine()),
+	}, nil
+}
+
+// WatchAll streams an event whenever a job of any owner starts or terminates.
+// It requires the [RoleOperator] in the context and returns a
+// PermissionDenied gRPC error otherwise. If the watcher falls too far behind
+// and is disconnected by the [JobController], it returns a ResourceExhausted
+// gRPC error.
+//
+// The response headers are sent as soon as the watcher is subscribed, so that
+// clients can wait for the subscription by reading the headers.
+func (s *Service) WatchAll(_ *pb.WatchAllRequest, stream pb.Telejob_WatchAllServer) error {
+	ctx := stream.Context()
+	if extractRole(ctx) != RoleOperator {
+		return status.Errorf(codes.PermissionDenied, "watch all requires the %s role", RoleOperator)
+	}
+	events := s.Controller.WatchAll(ctx)
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return fmt.Errorf("%w: cannot send watch stream header: %w", ErrStreamSend, err)
+	}
+	for e := range events {
+		resp := &pb.WatchAllResponse{Owner: e.Owner, JobStatus: pbJobStatus(e.Status)}
+		if err := stream.Send(resp); err != nil {
+			slog.Error("cannot send watch stream", "err", err)
+			return fmt.Errorf("%w: cannot send watch stream: %w", ErrStreamSend, err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err() //nolint:wrapcheck // gRPC status errors must not be wrapped.
+	}
+	return status.Errorf(codes.ResourceExhausted, "watcher too slow, events have been missed")
+}
+
 // Status retrieves the status of the job with the given ID. It extracts the
-// owner from the context and uses the [job.Controller] to get the job status.
+// owner from the context and uses the [JobController] to get the job status.
 // If an error occurs, it returns an appropriate gRPC error.
 func (s *Service) Status(ctx context.Context, req *pb.StatusRequest) (*pb.StatusResponse, error) {
 	owner := extractOwner(ctx)
@@ -76,45 +632,345 @@ func (s *Service) Status(ctx context.Context, req *pb.StatusRequest) (*pb.Status
 	return &pb.StatusResponse{JobStatus: pbJobStatus(js)}, nil
 }
 
+// StatusBatch returns the statuses of the jobs with the given IDs of the owner
+// extracted from the context by ID. Errors querying a job are reported in the
+// job's result with the gRPC status code Status would return for it. It
+// returns an InvalidArgument gRPC error for more than [MaxStatusBatchIDs]
+// IDs.
+func (s *Service) StatusBatch(ctx context.Context, req *pb.StatusBatchRequest) (*pb.StatusBatchResponse, error) {
+	if len(req.GetIds()) > MaxStatusBatchIDs {
+		return nil, status.Errorf(codes.InvalidArgument, "%d ids exceed the maximum of %d", len(req.GetIds()), MaxStatusBatchIDs)
+	}
+	owner := extractOwner(ctx)
+	results := s.Controller.StatusBatch(owner, req.GetIds())
+	resp := &pb.StatusBatchResponse{Results: make(map[string]*pb.StatusBatchResult, len(results))}
+	for id, r := range results {
+		if r.Err != nil {
+			st := status.Convert(statusError(r.Err, id))
+			resp.Results[id] = &pb.StatusBatchResult{ErrorCode: int32(st.Code()), Error: st.Message()} //nolint:gosec // gRPC codes are small.
+			continue
+		}
+		resp.Results[id] = &pb.StatusBatchResult{JobStatus: pbJobStatus(r.Status)}
+	}
+	return resp, nil
+}
+
+// Describe returns the environment, limits and namespaces of the job with the
+// given ID of the owner extracted from the context, also after the job has
+// terminated. Environment values are redacted unless the context has the
+// [RoleOperator], as they may contain secrets. Operators may describe jobs
+// of any owner, which is audit-logged like ForceStop.
+func (s *Service) Describe(ctx context.Context, req *pb.DescribeRequest) (*pb.DescribeResponse, error) {
+	owner := extractOwner(ctx)
+	redact := extractRole(ctx) != RoleOperator
+	describe := s.Controller.Describe
+	if !redact {
+		describe = s.Controller.ForceDescribe
+	}
+	d, err := describe(owner, req.GetId())
+	if err != nil {
+		return nil, statusError(err, req.GetId())
+	}
+	env := make([]*pb.EnvVar, len(d.Env))
+	for i, kv := range d.Env {
+		key, value, _ := strings.Cut(kv, "=")
+		if redact {
+			value = ""
+		}
+		env[i] = &pb.EnvVar{Key: key, Value: value}
+	}
+	return &pb.DescribeResponse{
+		JobStatus:   pbJobStatus(d.Status),
+		Env:         env,
+		EnvRedacted: redact,
+		Limits:      pbLimits(d.Limits),
+		Namespaces:  d.Namespaces,
+	}, nil
+}
+
+// Stats returns the resource usage of the running job with the given ID of
+// the owner extracted from the context. It returns a FailedPrecondition gRPC
+// error if the job has terminated.
+func (s *Service) Stats(ctx context.Context, req *pb.StatsRequest) (*pb.StatsResponse, error) {
+	owner := extractOwner(ctx)
+	stats, err := s.Controller.Stats(owner, req.GetId())
+	if err != nil {
+		return nil, statusError(err, req.GetId())
+	}
+	return &pb.StatsResponse{
+		MemoryCurrentBytes: stats.MemoryCurrent,
+		MemoryPeakBytes:    stats.MemoryPeak,
+		Cpu:                durationpb.New(stats.CPU),
+		IoReadBytes:        stats.IOReadBytes,
+		IoWriteBytes:       stats.IOWriteBytes,
+		PidsCurrent:        stats.PidsCurrent,
+	}, nil
+}
+
+// List returns the statuses of the jobs of the owner extracted from the
+// context. If the request sets running_only, terminated jobs are omitted. If
+// the request sets labels, jobs without all of these labels are omitted.
+func (s *Service) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	owner := extractOwner(ctx)
+	var jobs []*pb.JobStatus
+	for _, js := range s.Controller.List(owner) {
+		if req.GetRunningOnly() && !js.Running || !matchLabels(js.Labels, req.GetLabels()) {
+			continue
+		}
+		jobs = append(jobs, pbJobStatus(js))
+	}
+	return &pb.ListResponse{Jobs: jobs}, nil
+}
+
+// matchLabels reports whether labels contains all key-value pairs of the
+// selector. An empty selector matches all labels.
+func matchLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
 // Logs streams the logs of the job with the given ID to the provided gRPC
-// server stream. Log data is retrieved from the [job.Controller] and sent in
+// server stream. Log data is retrieved from the [JobController] and sent in
 // chunks of [LogChunkSize] bytes.
+//
+// If the request sets from_start and the beginning of the log has been
+// discarded, it returns an OutOfRange gRPC error. If the request sets
+// follow_only, only log data written after the request is streamed. If the
+// request sets an offset, the log is streamed from this offset, with the same
+// error as from_start if data at the offset has been discarded.
+//
+// If the reader returned by the [JobController] implements [job.StreamReader],
+// each chunk is tagged with the output stream it was written to and its
+// offset in the log.
+//
+// If the request sets squeeze_blank_lines, runs of blank lines are collapsed
+// into a single blank line, separately for each output stream.
 func (s *Service) Logs(req *pb.LogsRequest, stream pb.Telejob_LogsServer) error {
 	ctx := stream.Context()
 	owner := extractOwner(ctx)
-	reader, err := s.Controller.LogsReader(ctx, owner, req.GetId())
+	if req.GetFromStart() && req.GetFollowOnly() {
+		return status.Errorf(codes.InvalidArgument, "from_start and follow_only are mutually exclusive")
+	}
+	if req.GetOffset() > 0 && req.GetFollowOnly() {
+		return status.Errorf(codes.InvalidArgument, "offset and follow_only are mutually exclusive")
+	}
+	release, err := s.acquireLogStream()
+	if err != nil {
+		return err
+	}
+	defer release()
+	var opts []job.LogsOption
+	if req.GetFromStart() {
+		opts = append(opts, job.FromStart())
+	}
+	if req.GetFollowOnly() {
+		opts = append(opts, job.FollowOnly())
+	}
+	if req.GetOffset() > 0 {
+		opts = append(opts, job.FromOffset(req.GetOffset()))
+	}
+	reader, err := s.Controller.LogsReader(ctx, owner, req.GetId(), opts...)
 	if err != nil {
 		return statusError(err, req.GetId())
 	}
-	p := make([]byte, LogChunkSize)
+	reads := readLogs(ctx, reader)
+	var squeezers map[pb.Stream]*blankLineSqueezer
+	if req.GetSqueezeBlankLines() {
+		squeezers = map[pb.Stream]*blankLineSqueezer{}
+	}
+	var timer *time.Timer
+	var heartbeat <-chan time.Time // nil, and never ready, without heartbeats.
+	if s.LogHeartbeat > 0 {
+		timer = time.NewTimer(s.LogHeartbeat)
+		defer timer.Stop()
+		heartbeat = timer.C
+	}
 	for {
-		n, err := reader.Read(p)
-		switch {
-		case errors.Is(err, io.EOF):
-			return nil
-		case err != nil:
-			return status.Errorf(codes.Internal, "error reading logs: %v", err)
-		case n == 0:
-			continue
+		var resp *pb.LogsResponse
+		select {
+		case <-heartbeat:
+			resp = &pb.LogsResponse{Heartbeat: true}
+		case r := <-reads:
+			switch {
+			case errors.Is(r.err, io.EOF):
+				return nil
+			case errors.Is(r.err, job.ErrLogTruncated):
+				return status.Errorf(codes.OutOfRange, "%v", r.err)
+			case r.err != nil:
+				return status.Errorf(codes.Internal, "error reading logs: %v", r.err)
+			}
+			resp = r.resp
+			if squeezers != nil {
+				if resp.Chunk = squeeze(squeezers, resp); len(resp.GetChunk()) == 0 {
+					continue
+				}
+			}
 		}
-		resp := &pb.LogsResponse{Chunk: p[:n]}
 		if err := stream.Send(resp); err != nil {
 			slog.Error("cannot send log stream", "err", err)
 			return fmt.Errorf("%w: cannot send log stream: %w", ErrStreamSend, err)
 		}
+		if timer != nil {
+			timer.Reset(s.LogHeartbeat)
+		}
 	}
 }
 
+// acquireLogStream counts a new log stream against MaxLogStreams and returns
+// the function that releases it once the stream has ended. If the limit has
+// been reached, it returns a ResourceExhausted gRPC error.
+func (s *Service) acquireLogStream() (func(), error) {
+	if s.MaxLogStreams <= 0 {
+		return func() {}, nil
+	}
+	if s.logStreams.Add(1) > int64(s.MaxLogStreams) {
+		s.logStreams.Add(-1)
+		return nil, status.Errorf(codes.ResourceExhausted, "too many log streams, limit is %d", s.MaxLogStreams)
+	}
+	return func() { s.logStreams.Add(-1) }, nil
+}
+
+// GetLogs returns the log of the job with the given ID written so far, up to
+// [MaxGetLogsBytes], in a single response. It reads the log with the same
+// [JobController] reader as Logs, but does not wait for further output.
+//
+// If the request sets a tail, only the last tail bytes of the log are
+// returned. If it sets an offset, the log is returned from this offset, with
+// an OutOfRange gRPC error if data at the offset has been discarded.
+func (s *Service) GetLogs(ctx context.Context, req *pb.GetLogsRequest) (*pb.GetLogsResponse, error) {
+	owner := extractOwner(ctx)
+	if req.GetOffset() > 0 && req.GetTail() > 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "offset and tail are mutually exclusive")
+	}
+	opts := []job.LogsOption{job.NoFollow()}
+	if req.GetOffset() > 0 {
+		opts = append(opts, job.FromOffset(req.GetOffset()))
+	}
+	if req.GetTail() > 0 {
+		opts = append(opts, job.Tail(min(req.GetTail(), MaxGetLogsBytes)))
+	}
+	reader, err := s.Controller.LogsReader(ctx, owner, req.GetId(), opts...)
+	if err != nil {
+		return nil, statusError(err, req.GetId())
+	}
+	resp := &pb.GetLogsResponse{Offset: req.GetOffset()}
+	streamReader, _ := reader.(job.StreamReader)
+	// One byte beyond the limit tells whether more log data follows.
+	data := make([]byte, 0, min(MaxGetLogsBytes+1, LogChunkSize))
+	for len(data) <= MaxGetLogsBytes {
+		if len(data) == cap(data) {
+			data = slices.Grow(data, min(cap(data), MaxGetLogsBytes+1-cap(data)))
+		}
+		n, err := reader.Read(data[len(data):cap(data)])
+		if n > 0 && len(data) == 0 && streamReader != nil {
+			resp.Offset = streamReader.Offset()
+		}
+		data = data[:len(data)+n]
+		switch {
+		case errors.Is(err, io.EOF):
+			resp.Data = data
+			return resp, nil
+		case errors.Is(err, job.ErrLogTruncated):
+			return nil, status.Errorf(codes.OutOfRange, "%v", err)
+		case err != nil:
+			return nil, status.Errorf(codes.Internal, "error reading logs: %v", err)
+		}
+	}
+	resp.Data, resp.Truncated = data[:MaxGetLogsBytes], true
+	return resp, nil
+}
+
+// squeeze returns the chunk of resp squeezed by the blankLineSqueezer of its
+// output stream, creating it if needed.
+func squeeze(squeezers map[pb.Stream]*blankLineSqueezer, resp *pb.LogsResponse) []byte {
+	s, ok := squeezers[resp.GetStream()]
+	if !ok {
+		s = &blankLineSqueezer{}
+		squeezers[resp.GetStream()] = s
+	}
+	return s.squeeze(resp.GetChunk())
+}
+
+// logRead is the result of a read by readLogs, either a response with log
+// data or a read error.
+type logRead struct {
+	resp *pb.LogsResponse
+	err  error
+}
+
+// readLogs reads log chunks of up to LogChunkSize bytes from reader and sends
+// them to the returned channel, until reading fails or ctx is done. The
+// reading error is the last value sent.
+func readLogs(ctx context.Context, reader io.Reader) <-chan logRead {
+	reads := make(chan logRead)
+	streamReader, _ := reader.(job.StreamReader)
+	go func() {
+		p := make([]byte, LogChunkSize)
+		for {
+			n, err := reader.Read(p)
+			var r logRead
+			switch {
+			case err != nil:
+				r.err = err
+			case n == 0:
+				continue
+			default:
+				r.resp = &pb.LogsResponse{Chunk: bytes.Clone(p[:n])}
+				if streamReader != nil {
+					r.resp.Stream = pbStream(streamReader.Stream())
+					r.resp.Offset = streamReader.Offset()
+				}
+			}
+			select {
+			case reads <- r:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return reads
+}
+
 // pbJobStatus converts a job.Status to a pb.JobStatus.
 func pbJobStatus(s job.Status) *pb.JobStatus {
 	return &pb.JobStatus{
-		Id:        s.ID,
-		Command:   s.Command,
-		Arguments: s.Args,
-		Started:   pbTimestamp(s.Started),
-		State:     pbState(s.Running),
-		Stopped:   pbTimestamp(s.Stopped),
-		ExitCode:  int64(s.ExitCode),
+		Id:                  s.ID,
+		Command:             s.Command,
+		Arguments:           s.Args,
+		CommandLine:         CommandLine(s.Command, s.Args),
+		Started:             pbTimestamp(s.Started),
+		State:               pbState(s),
+		Stopped:             pbTimestamp(s.Stopped),
+		ExitCode:            int64(s.ExitCode),
+		Labels:              s.Labels,
+		ProcessCount:        int64(s.ProcessCount),
+		MaxBufferedLogBytes: int64(s.MaxBufferedLogBytes),
+		OutputDigest:        s.OutputDigest,
+		IoReadBytes:         s.IOReadBytes,
+		IoWriteBytes:        s.IOWriteBytes,
+		NearMemoryLimit:     s.NearMemoryLimit,
+		Paused:              s.Paused,
+		TerminationReason:   pbTerminationReason(s.TerminationReason),
+	}
+}
+
+// pbTerminationReason converts a job.TerminationReason to a
+// pb.TerminationReason.
+func pbTerminationReason(r job.TerminationReason) pb.TerminationReason {
+	switch r {
+	case job.TerminationCPULimit:
+		return pb.TerminationReason_TERMINATION_REASON_CPU_LIMIT
+	case job.TerminationTimeout:
+		return pb.TerminationReason_TERMINATION_REASON_TIMEOUT
+	default:
+		return pb.TerminationReason_TERMINATION_REASON_UNSPECIFIED
 	}
 }
 
@@ -127,28 +983,110 @@ func pbTimestamp(t time.Time) *timestamppb.Timestamp {
 	return timestamppb.New(t)
 }
 
-// pbState converts a boolean running state to a pb.State.
-func pbState(running bool) pb.State {
-	if running {
+// pbState converts the running and scheduled state of a job to a pb.State.
+func pbState(s job.Status) pb.State {
+	switch {
+	case s.Scheduled:
+		return pb.State_STATE_SCHEDULED
+	case s.Running:
 		return pb.State_STATE_RUNNING
+	default:
+		return pb.State_STATE_STOPPED
+	}
+}
+
+// pbStream converts a job.Stream to a pb.Stream.
+func pbStream(s job.Stream) pb.Stream {
+	switch s {
+	case job.Stdout:
+		return pb.Stream_STREAM_STDOUT
+	case job.Stderr:
+		return pb.Stream_STREAM_STDERR
+	default:
+		return pb.Stream_STREAM_UNSPECIFIED
+	}
+}
+
+// duplicateJobStatusError converts a DuplicateJobError to an AlreadyExists
+// gRPC status error with the running job's ID in a ResourceInfo detail.
+func duplicateJobStatusError(err *job.DuplicateJobError, owner string) error {
+	st := status.New(codes.AlreadyExists, err.Error())
+	info := &errdetails.ResourceInfo{
+		ResourceType: "job",
+		ResourceName: err.ID,
+		Owner:        owner,
+		Description:  "running job with the same labels",
 	}
-	return pb.State_STATE_STOPPED
+	if stWithDetails, detailsErr := st.WithDetails(info); detailsErr == nil {
+		st = stWithDetails
+	}
+	return st.Err() //nolint:wrapcheck // gRPC status errors must not be wrapped.
+}
+
+// tooManyJobsStatusError converts a TooManyJobsError to a ResourceExhausted
+// gRPC status error with a RetryInfo detail, telling clients how long to wait
+// before retrying.
+func tooManyJobsStatusError(err *job.TooManyJobsError) error {
+	st := status.New(codes.ResourceExhausted, err.Error())
+	info := &errdetails.RetryInfo{RetryDelay: durationpb.New(err.RetryAfter)}
+	if stWithDetails, detailsErr := st.WithDetails(info); detailsErr == nil {
+		st = stWithDetails
+	}
+	return st.Err() //nolint:wrapcheck // gRPC status errors must not be wrapped.
 }
 
-// statusError converts a job error to a gRPC status error.
+// admissionStatusError converts an error of a rejected job admission to a
+// gRPC status error. Admission hooks can choose the status code by returning
+// an error with a GRPCStatus method, such as the errors created by the grpc
+// status package. It defaults to PermissionDenied.
+func admissionStatusError(err error) error {
+	code := codes.PermissionDenied
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		code = grpcErr.GRPCStatus().Code()
+	}
+	return status.Errorf(code, "%v", err)
+}
+
+// statusError converts a job error to a gRPC status error. The status code
+// is taken from a [CodeHinter] in the error tree, if any.
 func statusError(err error, id string) error {
 	if err == nil {
 		return nil
 	}
+	var hinter CodeHinter
+	if errors.As(err, &hinter) {
+		return status.Errorf(hinter.GRPCCode(), "job %q: %v", id, err)
+	}
 	if errors.Is(err, job.ErrJobNotFound) {
 		return status.Errorf(codes.NotFound, "job %q not found", id)
 	}
 	if errors.Is(err, job.ErrUnauthorized) {
 		return status.Errorf(codes.PermissionDenied, "no ownership of job %q", id)
 	}
+	if errors.Is(err, job.ErrJobNotPaused) {
+		return status.Errorf(codes.FailedPrecondition, "job %q is not paused", id)
+	}
+	if errors.Is(err, job.ErrJobNotRunning) {
+		return status.Errorf(codes.FailedPrecondition, "job %q is not running", id)
+	}
+	if errors.Is(err, job.ErrNoOutput) {
+		return status.Errorf(codes.FailedPrecondition, "output of job %q not captured", id)
+	}
+	if errors.Is(err, job.ErrNoTerminal) {
+		return status.Errorf(codes.FailedPrecondition, "job %q has no terminal", id)
+	}
+	if errors.Is(err, job.ErrInputAttached) {
+		return status.Errorf(codes.FailedPrecondition, "input of job %q already attached", id)
+	}
 	return status.Errorf(codes.Internal, "job %q: %v", id, err)
 }
 
 func extractOwner(ctx context.Context) string {
 	return ctx.Value(OwnerKey{}).(string) //nolint:forcetypeassert // enforced by UnaryInterceptor
 }
+
+func extractRole(ctx context.Context) Role {
+	role, _ := ctx.Value(RoleKey{}).(Role)
+	return role
+}
@@ -2,17 +2,26 @@ package telejob_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand/v2"
 	"net"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/juliaogris/telejob/pkg/job"
 	"github.com/juliaogris/telejob/pkg/pb"
 	"github.com/juliaogris/telejob/pkg/telejob"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestServiceDirectly(t *testing.T) {
@@ -63,6 +72,831 @@ func TestServiceWithCustomServer(t *testing.T) {
 	require.Equal(t, "true", statusResp.GetJobStatus().GetCommand())
 }
 
+func TestServiceErrorMapping(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]struct {
+		err  error
+		want codes.Code
+	}{
+		"not found":    {err: fmt.Errorf("%w: %q", job.ErrJobNotFound, "1"), want: codes.NotFound},
+		"unauthorized": {err: job.ErrUnauthorized, want: codes.PermissionDenied},
+		"not paused":   {err: job.ErrJobNotPaused, want: codes.FailedPrecondition},
+		"no output":    {err: job.ErrNoOutput, want: codes.FailedPrecondition},
+		"no terminal":  {err: job.ErrNoTerminal, want: codes.FailedPrecondition},
+		"attached":     {err: job.ErrInputAttached, want: codes.FailedPrecondition},
+		"internal":     {err: errors.New("boom"), want: codes.Internal},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			service := &telejob.Service{Controller: &fakeController{err: tc.err}}
+			ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+			_, err := service.Stop(ctx, &pb.StopRequest{Id: "1"})
+			require.Equal(t, tc.want, status.Code(err))
+			_, err = service.Status(ctx, &pb.StatusRequest{Id: "1"})
+			require.Equal(t, tc.want, status.Code(err))
+			_, err = service.Resume(ctx, &pb.ResumeRequest{Id: "1"})
+			require.Equal(t, tc.want, status.Code(err))
+			_, err = service.WriteInput(ctx, &pb.WriteInputRequest{Id: "1", Data: []byte("x")})
+			require.Equal(t, tc.want, status.Code(err))
+			stream := &fakeLogsServer{ctx: ctx, sent: make(chan *pb.LogsResponse)}
+			err = service.Logs(&pb.LogsRequest{Id: "1"}, stream)
+			require.Equal(t, tc.want, status.Code(err))
+		})
+	}
+
+	service := &telejob.Service{Controller: &fakeController{err: job.ErrCommand}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	_, err := service.Start(ctx, &pb.StartRequest{Command: "true"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	service = &telejob.Service{Controller: &fakeController{err: job.ErrArgsTooLarge}}
+	_, err = service.Start(ctx, &pb.StartRequest{Command: "true"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	service = &telejob.Service{Controller: &fakeController{err: job.ErrLimits}}
+	_, err = service.Start(ctx, &pb.StartRequest{Command: "true"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	service = &telejob.Service{Controller: &fakeController{err: job.ErrRootfs}}
+	_, err = service.Start(ctx, &pb.StartRequest{Command: "true"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	service = &telejob.Service{Controller: &fakeController{err: job.ErrController}}
+	_, err = service.Start(ctx, &pb.StartRequest{Command: "true"})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	service = &telejob.Service{Controller: &fakeController{err: job.ErrCredential}}
+	_, err = service.Start(ctx, &pb.StartRequest{Command: "true"})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	service = &telejob.Service{Controller: &fakeController{err: job.ErrShutdown}}
+	_, err = service.Start(ctx, &pb.StartRequest{Command: "true"})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	service = &telejob.Service{Controller: &fakeController{}}
+	_, err = service.Start(ctx, &pb.StartRequest{Command: " "})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = service.Start(ctx, &pb.StartRequest{Command: "true", NotBefore: &timestamppb.Timestamp{Nanos: -1}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	resp, err := service.Start(ctx, &pb.StartRequest{Command: "true", Arguments: []string{""}})
+	require.NoError(t, err)
+	require.Equal(t, "fake-id", resp.GetId())
+}
+
+// quotaError is a custom job controller error carrying its own gRPC code.
+type quotaError struct{}
+
+func (quotaError) Error() string        { return "quota exceeded" }
+func (quotaError) GRPCCode() codes.Code { return codes.FailedPrecondition }
+
+func TestServiceCodeHinter(t *testing.T) {
+	t.Parallel()
+	var _ telejob.CodeHinter = quotaError{}
+	errs := []error{
+		quotaError{},
+		fmt.Errorf("wrapped: %w", quotaError{}),
+		fmt.Errorf("%w: %w", job.ErrJobNotFound, quotaError{}), // hint takes precedence
+	}
+	for _, e := range errs {
+		service := &telejob.Service{Controller: &fakeController{err: e}}
+		ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+		_, err := service.Start(ctx, &pb.StartRequest{Command: "true"})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err), e)
+		require.Contains(t, status.Convert(err).Message(), "quota exceeded")
+		_, err = service.Stop(ctx, &pb.StopRequest{Id: "1"})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err), e)
+		_, err = service.Status(ctx, &pb.StatusRequest{Id: "1"})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err), e)
+	}
+}
+
+func TestServiceStopAtDeadline(t *testing.T) {
+	t.Parallel()
+	stopped := make(chan string, 1)
+	service := &telejob.Service{Controller: &fakeController{stopped: stopped}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+
+	_, err := service.Start(ctx, &pb.StartRequest{Command: "sleep", Arguments: []string{"100"}, StopAtDeadline: true})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	resp, err := service.Start(ctx, &pb.StartRequest{Command: "sleep", Arguments: []string{"100"}, StopAtDeadline: true})
+	require.NoError(t, err)
+	select {
+	case id := <-stopped:
+		require.Equal(t, resp.GetId(), id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("job not stopped at deadline")
+	}
+
+	// The deadline of a scheduled job counts from not_before.
+	ctx, cancel = context.WithTimeout(context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner"), 100*time.Millisecond)
+	defer cancel()
+	notBefore := timestamppb.New(time.Now().Add(300 * time.Millisecond))
+	_, err = service.Start(ctx, &pb.StartRequest{Command: "sleep", Arguments: []string{"100"}, StopAtDeadline: true, NotBefore: notBefore})
+	require.NoError(t, err)
+	select {
+	case <-stopped:
+		t.Fatal("scheduled job stopped before not_before")
+	case <-time.After(300 * time.Millisecond):
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduled job not stopped at shifted deadline")
+	}
+}
+
+func TestServiceStartDeadline(t *testing.T) {
+	t.Parallel()
+	service := &telejob.Service{Controller: &fakeController{slowSetup: true}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := service.Start(ctx, &pb.StartRequest{Command: "true"})
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	require.Less(t, time.Since(start), time.Second)
+
+	ctx, cancel = context.WithCancel(context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner"))
+	cancel()
+	_, err = service.Start(ctx, &pb.StartRequest{Command: "true"})
+	require.Equal(t, codes.Canceled, status.Code(err))
+}
+
+func TestServiceStartUnique(t *testing.T) {
+	t.Parallel()
+	service := &telejob.Service{Controller: &fakeController{err: &job.DuplicateJobError{ID: "7"}}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	req := &pb.StartRequest{Command: "true", Labels: map[string]string{"app": "deploy"}, Unique: true}
+	_, err := service.Start(ctx, req)
+	st := status.Convert(err)
+	require.Equal(t, codes.AlreadyExists, st.Code())
+	require.Len(t, st.Details(), 1)
+	info, ok := st.Details()[0].(*errdetails.ResourceInfo)
+	require.True(t, ok)
+	require.Equal(t, "7", info.GetResourceName())
+}
+
+func TestServiceStartTooManyJobs(t *testing.T) {
+	t.Parallel()
+	service := &telejob.Service{Controller: &fakeController{err: &job.TooManyJobsError{Max: 1, RetryAfter: 3 * time.Second}}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	_, err := service.Start(ctx, &pb.StartRequest{Command: "true"})
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 1)
+	info, ok := st.Details()[0].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	require.Equal(t, 3*time.Second, info.GetRetryDelay().AsDuration())
+}
+
+func TestServiceStartAdmission(t *testing.T) {
+	t.Parallel()
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	service := &telejob.Service{Controller: &fakeController{err: fmt.Errorf("%w: %w", job.ErrAdmission, errors.New("forbidden"))}}
+	_, err := service.Start(ctx, &pb.StartRequest{Command: "rm"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	quotaErr := status.Error(codes.ResourceExhausted, "quota exceeded")
+	service = &telejob.Service{Controller: &fakeController{err: fmt.Errorf("%w: %w", job.ErrAdmission, quotaErr)}}
+	_, err = service.Start(ctx, &pb.StartRequest{Command: "true"})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Contains(t, status.Convert(err).Message(), "quota exceeded")
+}
+
+func TestServiceUsageRole(t *testing.T) {
+	t.Parallel()
+	service := &telejob.Service{Controller: &fakeController{}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	_, err := service.Usage(ctx, &pb.UsageRequest{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	ctx = context.WithValue(ctx, telejob.RoleKey{}, telejob.RoleOperator)
+	resp, err := service.Usage(ctx, &pb.UsageRequest{})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), resp.GetRunningJobs())
+	require.Equal(t, uint64(3000), resp.GetMemoryBytes())
+	require.Equal(t, time.Second, resp.GetCpu().AsDuration())
+}
+
+func TestServiceStopAlreadyTerminated(t *testing.T) {
+	t.Parallel()
+	service := &telejob.Service{Controller: &fakeController{err: job.ErrJobNotRunning}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	resp, err := service.Stop(ctx, &pb.StopRequest{Id: "1"})
+	require.NoError(t, err)
+	require.True(t, resp.GetAlreadyTerminated())
+
+	ctx = context.WithValue(ctx, telejob.RoleKey{}, telejob.RoleOperator)
+	forceResp, err := service.ForceStop(ctx, &pb.ForceStopRequest{Id: "1"})
+	require.NoError(t, err)
+	require.True(t, forceResp.GetAlreadyTerminated())
+
+	// Other mutations of terminated jobs fail.
+	_, err = service.Resume(ctx, &pb.ResumeRequest{Id: "1"})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	service = &telejob.Service{Controller: &fakeController{}}
+	resp, err = service.Stop(ctx, &pb.StopRequest{Id: "1"})
+	require.NoError(t, err)
+	require.False(t, resp.GetAlreadyTerminated())
+}
+
+func TestServiceStats(t *testing.T) {
+	t.Parallel()
+	service := &telejob.Service{Controller: &fakeController{}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	resp, err := service.Stats(ctx, &pb.StatsRequest{Id: "1"})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000), resp.GetMemoryCurrentBytes())
+	require.Equal(t, uint64(2000), resp.GetMemoryPeakBytes())
+	require.Equal(t, time.Second, resp.GetCpu().AsDuration())
+	require.Equal(t, uint64(3), resp.GetIoReadBytes())
+	require.Equal(t, uint64(4), resp.GetIoWriteBytes())
+	require.Equal(t, uint64(5), resp.GetPidsCurrent())
+
+	service = &telejob.Service{Controller: &fakeController{err: job.ErrJobNotRunning}}
+	_, err = service.Stats(ctx, &pb.StatsRequest{Id: "1"})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestServiceExplainLimits(t *testing.T) {
+	t.Parallel()
+	service := &telejob.Service{Controller: &fakeController{}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	resp, err := service.ExplainLimits(ctx, &pb.StartRequest{Command: "sleep", Arguments: []string{"100"}})
+	require.NoError(t, err)
+	require.InDelta(t, 0.5, resp.GetCpus(), 0)
+	require.Equal(t, uint64(2000), resp.GetMemoryKib())
+	require.Zero(t, resp.GetMemoryHighKib())
+	require.Equal(t, map[string]uint64{"nofile": 64}, resp.GetRlimits())
+
+	_, err = service.ExplainLimits(ctx, &pb.StartRequest{Command: " "})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	service = &telejob.Service{Controller: &fakeController{err: job.ErrController}}
+	_, err = service.ExplainLimits(ctx, &pb.StartRequest{Command: "sleep"})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// Errors are mapped like for Start.
+	service = &telejob.Service{Controller: &fakeController{err: job.ErrLimits}}
+	_, err = service.ExplainLimits(ctx, &pb.StartRequest{Command: "sleep"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	service = &telejob.Service{Controller: &fakeController{err: errors.New("boom")}}
+	_, err = service.ExplainLimits(ctx, &pb.StartRequest{Command: "sleep"})
+	require.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestServiceStatusBatch(t *testing.T) {
+	t.Parallel()
+	service := &telejob.Service{Controller: &fakeController{}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	resp, err := service.StatusBatch(ctx, &pb.StatusBatchRequest{Ids: []string{"1", "missing", "foreign"}})
+	require.NoError(t, err)
+	results := resp.GetResults()
+	require.Len(t, results, 3)
+	require.Equal(t, "1", results["1"].GetJobStatus().GetId())
+	require.Zero(t, results["1"].GetErrorCode())
+	require.Nil(t, results["missing"].GetJobStatus())
+	require.Equal(t, int32(codes.NotFound), results["missing"].GetErrorCode())
+	require.Equal(t, `job "missing" not found`, results["missing"].GetError())
+	require.Equal(t, int32(codes.PermissionDenied), results["foreign"].GetErrorCode())
+
+	ids := make([]string, telejob.MaxStatusBatchIDs+1)
+	_, err = service.StatusBatch(ctx, &pb.StatusBatchRequest{Ids: ids})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServiceDescribe(t *testing.T) {
+	t.Parallel()
+	service := &telejob.Service{Controller: &fakeController{}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	resp, err := service.Describe(ctx, &pb.DescribeRequest{Id: "1"})
+	require.NoError(t, err)
+	require.Equal(t, "1", resp.GetJobStatus().GetId())
+	require.Equal(t, pb.State_STATE_STOPPED, resp.GetJobStatus().GetState())
+	require.True(t, resp.GetEnvRedacted())
+	var keys []string
+	for _, e := range resp.GetEnv() {
+		keys = append(keys, e.GetKey())
+		require.Empty(t, e.GetValue())
+	}
+	require.Equal(t, []string{"PATH", "API_TOKEN"}, keys)
+	require.InDelta(t, 0.5, resp.GetLimits().GetCpus(), 0)
+	require.Equal(t, uint64(2000), resp.GetLimits().GetMemoryKib())
+	require.Equal(t, []string{"mnt"}, resp.GetNamespaces())
+	_, err = service.Describe(ctx, &pb.DescribeRequest{Id: "foreign"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Operators describe jobs of any owner.
+	ctx = context.WithValue(ctx, telejob.RoleKey{}, telejob.RoleOperator)
+	resp, err = service.Describe(ctx, &pb.DescribeRequest{Id: "1"})
+	require.NoError(t, err)
+	require.False(t, resp.GetEnvRedacted())
+	require.Equal(t, "secret", resp.GetEnv()[1].GetValue())
+	resp, err = service.Describe(ctx, &pb.DescribeRequest{Id: "foreign"})
+	require.NoError(t, err)
+	require.Equal(t, "foreign", resp.GetJobStatus().GetId())
+
+	service = &telejob.Service{Controller: &fakeController{err: job.ErrJobNotFound}}
+	_, err = service.Describe(ctx, &pb.DescribeRequest{Id: "1"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServiceCapabilities(t *testing.T) {
+	t.Parallel()
+	service := &telejob.Service{Controller: &fakeController{}}
+	resp, err := service.Capabilities(context.Background(), &pb.CapabilitiesRequest{})
+	require.NoError(t, err)
+	rpcs := resp.GetRpcs()
+	require.Subset(t, rpcs, []string{"Capabilities", "Start", "Stop", "Status", "Logs", "List", "WatchAll"})
+	require.IsIncreasing(t, rpcs)
+}
+
+func TestServiceList(t *testing.T) {
+	t.Parallel()
+	service := &telejob.Service{Controller: &fakeController{}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	resp, err := service.List(ctx, &pb.ListRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.GetJobs(), 2)
+
+	resp, err = service.List(ctx, &pb.ListRequest{RunningOnly: true})
+	require.NoError(t, err)
+	require.Len(t, resp.GetJobs(), 1)
+	require.Equal(t, "1", resp.GetJobs()[0].GetId())
+	require.Equal(t, pb.State_STATE_RUNNING, resp.GetJobs()[0].GetState())
+	require.Equal(t, []string{"-c", "echo 'hi there'"}, resp.GetJobs()[0].GetArguments())
+	require.Equal(t, `sh -c 'echo '\''hi there'\'''`, resp.GetJobs()[0].GetCommandLine())
+
+	resp, err = service.List(ctx, &pb.ListRequest{Labels: map[string]string{"env": "ci"}})
+	require.NoError(t, err)
+	require.Len(t, resp.GetJobs(), 2)
+	resp, err = service.List(ctx, &pb.ListRequest{Labels: map[string]string{"env": "ci", "team": "a"}})
+	require.NoError(t, err)
+	require.Len(t, resp.GetJobs(), 1)
+	require.Equal(t, "1", resp.GetJobs()[0].GetId())
+	resp, err = service.List(ctx, &pb.ListRequest{Labels: map[string]string{"env": "prod"}})
+	require.NoError(t, err)
+	require.Empty(t, resp.GetJobs())
+}
+
+func TestServiceStopSignal(t *testing.T) {
+	t.Parallel()
+	stopped := make(chan string, 1)
+	service := &telejob.Service{Controller: &fakeController{stopped: stopped}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	_, err := service.Stop(ctx, &pb.StopRequest{Id: "1", Signal: "STOP"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Empty(t, stopped)
+
+	_, err = service.Stop(ctx, &pb.StopRequest{Id: "1", Signal: "INT"})
+	require.NoError(t, err)
+	require.Equal(t, "1", <-stopped)
+}
+
+func TestServiceDebug(t *testing.T) {
+	t.Parallel()
+	service := &telejob.Service{Controller: &fakeController{}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	ctx = context.WithValue(ctx, telejob.RoleKey{}, telejob.RoleOperator)
+	_, err := service.Debug(ctx, &pb.DebugRequest{})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+
+	service.EnableDebug = true
+	_, err = service.Debug(context.WithValue(ctx, telejob.RoleKey{}, telejob.Role("")), &pb.DebugRequest{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	resp, err := service.Debug(ctx, &pb.DebugRequest{})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), resp.GetLogDispatchers())
+	require.Equal(t, int64(1), resp.GetLogFollowers())
+	require.Positive(t, resp.GetGoroutines())
+}
+
+func TestServiceWatchAll(t *testing.T) {
+	t.Parallel()
+	service := &telejob.Service{Controller: &fakeController{}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	stream := &fakeWatchAllServer{ctx: ctx}
+	err := service.WatchAll(&pb.WatchAllRequest{}, stream)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	require.Empty(t, stream.sent)
+
+	// The fake controller disconnects the watcher after two events.
+	stream.ctx = context.WithValue(ctx, telejob.RoleKey{}, telejob.RoleOperator)
+	err = service.WatchAll(&pb.WatchAllRequest{}, stream)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Len(t, stream.sent, 2)
+	require.Equal(t, "owner1", stream.sent[0].GetOwner())
+	require.Equal(t, pb.State_STATE_RUNNING, stream.sent[0].GetJobStatus().GetState())
+	require.Equal(t, "owner2", stream.sent[1].GetOwner())
+	require.Equal(t, pb.State_STATE_STOPPED, stream.sent[1].GetJobStatus().GetState())
+	require.Equal(t, int64(3), stream.sent[1].GetJobStatus().GetExitCode())
+}
+
+func TestServiceForceStopRole(t *testing.T) {
+	t.Parallel()
+	stopped := make(chan string, 1)
+	service := &telejob.Service{Controller: &fakeController{stopped: stopped}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	_, err := service.ForceStop(ctx, &pb.ForceStopRequest{Id: "1"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	require.Empty(t, stopped)
+
+	ctx = context.WithValue(ctx, telejob.RoleKey{}, telejob.RoleOperator)
+	_, err = service.ForceStop(ctx, &pb.ForceStopRequest{Id: "1"})
+	require.NoError(t, err)
+	require.Equal(t, "1", <-stopped)
+}
+
+func TestServiceLogsInvalidArgument(t *testing.T) {
+	t.Parallel()
+	service := &telejob.Service{Controller: &fakeController{}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	stream := &fakeLogsServer{ctx: ctx, sent: make(chan *pb.LogsResponse)}
+	for _, req := range []*pb.LogsRequest{
+		{Id: "1", FromStart: true, FollowOnly: true},
+		{Id: "1", Offset: 10, FollowOnly: true},
+	} {
+		err := service.Logs(req, stream)
+		require.Equal(t, codes.InvalidArgument, status.Code(err), req.String())
+	}
+}
+
+func TestServiceLogHeartbeat(t *testing.T) {
+	t.Parallel()
+	logs, logsWriter := io.Pipe()
+	interval := 50 * time.Millisecond
+	service := &telejob.Service{Controller: &fakeController{logs: logs}, LogHeartbeat: interval}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	stream := &fakeLogsServer{ctx: ctx, sent: make(chan *pb.LogsResponse)}
+	done := make(chan error, 1)
+	go func() { done <- service.Logs(&pb.LogsRequest{Id: "1"}, stream) }()
+
+	last := time.Now()
+	for range 3 {
+		resp := <-stream.sent
+		require.True(t, resp.GetHeartbeat())
+		require.Empty(t, resp.GetChunk())
+		require.GreaterOrEqual(t, time.Since(last), interval)
+		last = time.Now()
+	}
+	_, err := logsWriter.Write([]byte("hello"))
+	require.NoError(t, err)
+	resp := <-stream.sent
+	require.False(t, resp.GetHeartbeat())
+	require.Equal(t, "hello", string(resp.GetChunk()))
+	require.NoError(t, logsWriter.Close())
+	require.NoError(t, <-done)
+}
+
+func TestServiceMaxLogStreams(t *testing.T) {
+	t.Parallel()
+	controller := &pipeLogsController{writers: make(chan *io.PipeWriter)}
+	service := &telejob.Service{Controller: controller, MaxLogStreams: 2}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	streams := make([]*fakeLogsServer, 2)
+	writers := make([]*io.PipeWriter, 2)
+	done := make(chan error, 2)
+	for i := range streams {
+		streams[i] = &fakeLogsServer{ctx: ctx, sent: make(chan *pb.LogsResponse)}
+		go func() { done <- service.Logs(&pb.LogsRequest{Id: "1"}, streams[i]) }()
+		writers[i] = <-controller.writers
+	}
+
+	stream := &fakeLogsServer{ctx: ctx, sent: make(chan *pb.LogsResponse)}
+	err := service.Logs(&pb.LogsRequest{Id: "1"}, stream)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// Open streams continue and release their slot once they end.
+	for i, w := range writers {
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+		require.Equal(t, "hello", string((<-streams[i].sent).GetChunk()))
+		require.NoError(t, w.Close())
+		require.NoError(t, <-done)
+	}
+	go func() { done <- service.Logs(&pb.LogsRequest{Id: "1"}, stream) }()
+	require.NoError(t, (<-controller.writers).Close())
+	require.NoError(t, <-done)
+}
+
+func TestServiceStartStream(t *testing.T) {
+	t.Parallel()
+	service := &telejob.Service{Controller: &fakeController{}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	start := &pb.StartStreamRequest{Payload: &pb.StartStreamRequest_Start{Start: &pb.StartRequest{Command: "cat", Stdin: []byte("a")}}}
+	chunk := &pb.StartStreamRequest{Payload: &pb.StartStreamRequest_Chunk{Chunk: &pb.StartChunk{Stdin: []byte("b"), Env: []string{"K=V"}}}}
+	stream := &fakeStartStreamServer{ctx: ctx, reqs: []*pb.StartStreamRequest{start, chunk}}
+	require.NoError(t, service.StartStream(stream))
+	require.Equal(t, "fake-id", stream.resp.GetId())
+
+	// The environment of the start request counts towards the limit.
+	env := "K=" + strings.Repeat("x", telejob.MaxStartStreamBytes)
+	start = &pb.StartStreamRequest{Payload: &pb.StartStreamRequest_Start{Start: &pb.StartRequest{Command: "cat", Env: []string{env}}}}
+	stream = &fakeStartStreamServer{ctx: ctx, reqs: []*pb.StartStreamRequest{start}}
+	err := service.StartStream(stream)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestServiceAttachInputDropped(t *testing.T) {
+	t.Parallel()
+	controller := &pipeLogsController{
+		fakeController: fakeController{err: fmt.Errorf("%w: %q", job.ErrInputAttached, "1")},
+		writers:        make(chan *io.PipeWriter),
+	}
+	service := &telejob.Service{Controller: controller}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	stream := &fakeAttachServer{
+		fakeLogsServer: fakeLogsServer{ctx: ctx, sent: make(chan *pb.LogsResponse)},
+		reqs:           make(chan *pb.AttachRequest, 2),
+	}
+	stream.reqs <- &pb.AttachRequest{Id: "1", Data: []byte("x")}
+	done := make(chan error, 1)
+	go func() { done <- service.Attach(stream) }()
+	w := <-controller.writers
+
+	// Input rejected as another session holds the claim is reported and
+	// retried with the next data, while the output continues.
+	require.Contains(t, (<-stream.sent).GetInputError(), job.ErrInputAttached.Error())
+	stream.reqs <- &pb.AttachRequest{Data: []byte("y")}
+	require.Contains(t, (<-stream.sent).GetInputError(), job.ErrInputAttached.Error())
+	_, err := w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string((<-stream.sent).GetChunk()))
+	close(stream.reqs)
+	require.NoError(t, w.Close())
+	require.NoError(t, <-done)
+}
+
+func TestServiceLogsSqueezeBlankLines(t *testing.T) {
+	t.Parallel()
+	const logs = "a\n\n\n  \n b  \n\t\n\n\r\nc\n\n\n"
+	for squeeze, want := range map[bool]string{
+		false: logs,
+		true:  "a\n\n b  \n\t\nc\n\n",
+	} {
+		service := &telejob.Service{Controller: &fakeController{logs: strings.NewReader(logs)}}
+		ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+		stream := &fakeLogsServer{ctx: ctx, sent: make(chan *pb.LogsResponse)}
+		done := make(chan error, 1)
+		go func() {
+			done <- service.Logs(&pb.LogsRequest{Id: "1", SqueezeBlankLines: squeeze}, stream)
+			close(stream.sent)
+		}()
+		var got strings.Builder
+		for resp := range stream.sent {
+			got.Write(resp.GetChunk())
+		}
+		require.NoError(t, <-done)
+		require.Equal(t, want, got.String())
+	}
+}
+
+func TestServiceGetLogsTruncated(t *testing.T) {
+	t.Parallel()
+	logs := strings.Repeat("x", telejob.MaxGetLogsBytes) + "more"
+	service := &telejob.Service{Controller: &fakeController{logs: strings.NewReader(logs)}}
+	ctx := context.WithValue(context.Background(), telejob.OwnerKey{}, "test-owner")
+	resp, err := service.GetLogs(ctx, &pb.GetLogsRequest{Id: "1"})
+	require.NoError(t, err)
+	require.Equal(t, logs[:telejob.MaxGetLogsBytes], string(resp.GetData()))
+	require.True(t, resp.GetTruncated())
+
+	service = &telejob.Service{Controller: &fakeController{logs: strings.NewReader("short")}}
+	resp, err = service.GetLogs(ctx, &pb.GetLogsRequest{Id: "1"})
+	require.NoError(t, err)
+	require.Equal(t, "short", string(resp.GetData()))
+	require.False(t, resp.GetTruncated())
+}
+
+// fakeLogsServer is a pb.Telejob_LogsServer sending responses to sent.
+type fakeLogsServer struct {
+	grpc.ServerStream
+	ctx  context.Context //nolint:containedctx // returned by Context.
+	sent chan *pb.LogsResponse
+}
+
+func (f *fakeLogsServer) Context() context.Context { return f.ctx }
+
+func (f *fakeLogsServer) Send(resp *pb.LogsResponse) error {
+	f.sent <- resp
+	return nil
+}
+
+// fakeStartStreamServer is a pb.Telejob_StartStreamServer receiving reqs and
+// recording the response.
+type fakeStartStreamServer struct {
+	grpc.ServerStream
+	ctx  context.Context //nolint:containedctx // returned by Context.
+	reqs []*pb.StartStreamRequest
+	resp *pb.StartResponse
+}
+
+func (f *fakeStartStreamServer) Context() context.Context { return f.ctx }
+
+func (f *fakeStartStreamServer) Recv() (*pb.StartStreamRequest, error) {
+	if len(f.reqs) == 0 {
+		return nil, io.EOF
+	}
+	req := f.reqs[0]
+	f.reqs = f.reqs[1:]
+	return req, nil
+}
+
+func (f *fakeStartStreamServer) SendAndClose(resp *pb.StartResponse) error {
+	f.resp = resp
+	return nil
+}
+
+// fakeAttachServer is a pb.Telejob_AttachServer receiving the requests of
+// reqs, until it is closed, and sending responses to sent.
+type fakeAttachServer struct {
+	fakeLogsServer
+	reqs chan *pb.AttachRequest
+}
+
+func (f *fakeAttachServer) Recv() (*pb.AttachRequest, error) {
+	req, ok := <-f.reqs
+	if !ok {
+		return nil, io.EOF
+	}
+	return req, nil
+}
+
+// fakeWatchAllServer is a pb.Telejob_WatchAllServer collecting sent
+// responses.
+type fakeWatchAllServer struct {
+	grpc.ServerStream
+	ctx  context.Context //nolint:containedctx // returned by Context.
+	sent []*pb.WatchAllResponse
+}
+
+func (f *fakeWatchAllServer) Context() context.Context { return f.ctx }
+
+func (f *fakeWatchAllServer) SendHeader(metadata.MD) error { return nil }
+
+func (f *fakeWatchAllServer) Send(resp *pb.WatchAllResponse) error {
+	f.sent = append(f.sent, resp)
+	return nil
+}
+
+// fakeController is a telejob.JobController that does not run any processes.
+// All methods fail with err if it is set. If stopped is set, the IDs of
+// stopped jobs are sent to it. If logs is set, it is returned by LogsReader.
+type fakeController struct {
+	err       error
+	stopped   chan<- string
+	logs      io.Reader
+	slowSetup bool // StartJobContext blocks until ctx is done, like a hanging cgroup setup
+}
+
+func (f *fakeController) StartJobContext(ctx context.Context, _ string, _ job.StartOptions) (string, error) {
+	if f.slowSetup {
+		<-ctx.Done()
+		return "", fmt.Errorf("%w: setup of job cgroup aborted: %w", job.ErrCgroup, context.Cause(ctx))
+	}
+	if f.err != nil {
+		return "", f.err
+	}
+	return "fake-id", nil
+}
+
+func (f *fakeController) Stop(_, id string, _ ...job.StopOption) error {
+	if f.stopped != nil {
+		f.stopped <- id
+	}
+	return f.err
+}
+
+func (f *fakeController) Resume(_, _ string) error {
+	return f.err
+}
+
+func (f *fakeController) WriteInput(_, _ string, _ []byte) error {
+	return f.err
+}
+
+func (f *fakeController) AttachInput(_, _ string) (io.WriteCloser, error) {
+	return nil, f.err
+}
+
+func (f *fakeController) ForceStop(_, id string) error {
+	return f.Stop("", id)
+}
+
+func (f *fakeController) AggregateUsage() (job.Usage, error) {
+	if f.err != nil {
+		return job.Usage{}, f.err
+	}
+	return job.Usage{RunningJobs: 2, MemoryBytes: 3000, CPU: time.Second}, nil
+}
+
+func (f *fakeController) DebugStats() job.DebugStats {
+	return job.DebugStats{LogDispatchers: 3, LogFollowers: 1}
+}
+
+func (f *fakeController) List(_ string) []job.Status {
+	return []job.Status{
+		{ID: "1", Command: "sh", Args: []string{"-c", "echo 'hi there'"}, Running: true, Labels: map[string]string{"env": "ci", "team": "a"}},
+		{ID: "2", Labels: map[string]string{"env": "ci"}},
+	}
+}
+
+func (f *fakeController) Status(_, id string) (job.Status, error) {
+	if f.err != nil {
+		return job.Status{}, f.err
+	}
+	return job.Status{ID: id}, nil
+}
+
+func (f *fakeController) StatusBatch(_ string, ids []string) map[string]job.StatusResult {
+	results := map[string]job.StatusResult{}
+	for _, id := range ids {
+		switch {
+		case f.err != nil:
+			results[id] = job.StatusResult{Err: f.err}
+		case id == "missing":
+			results[id] = job.StatusResult{Err: fmt.Errorf("%w: %q", job.ErrJobNotFound, id)}
+		case id == "foreign":
+			results[id] = job.StatusResult{Err: fmt.Errorf("%w: %q", job.ErrUnauthorized, id)}
+		default:
+			results[id] = job.StatusResult{Status: job.Status{ID: id}}
+		}
+	}
+	return results
+}
+
+func (f *fakeController) Describe(_, id string) (job.Description, error) {
+	if id == "foreign" {
+		return job.Description{}, fmt.Errorf("%w: %q", job.ErrUnauthorized, id)
+	}
+	return f.ForceDescribe("", id)
+}
+
+func (f *fakeController) ForceDescribe(_, id string) (job.Description, error) {
+	if f.err != nil {
+		return job.Description{}, f.err
+	}
+	return job.Description{
+		Status:     job.Status{ID: id, ExitCode: 0, Stopped: time.Now()},
+		Env:        []string{"PATH=/bin", "API_TOKEN=secret"},
+		Limits:     job.Limits{CPUs: 0.5, MemoryKiB: 2000},
+		Namespaces: []string{"mnt"},
+	}, nil
+}
+
+func (f *fakeController) Stats(_, _ string) (job.JobStats, error) {
+	if f.err != nil {
+		return job.JobStats{}, f.err
+	}
+	return job.JobStats{MemoryCurrent: 1000, MemoryPeak: 2000, CPU: time.Second, IOReadBytes: 3, IOWriteBytes: 4, PidsCurrent: 5}, nil
+}
+
+func (f *fakeController) EffectiveLimits(_ job.StartOptions) (job.Limits, error) {
+	if f.err != nil {
+		return job.Limits{}, f.err
+	}
+	return job.Limits{CPUs: 0.5, MemoryKiB: 2000, Rlimits: map[string]uint64{"nofile": 64}}, nil
+}
+
+func (f *fakeController) LogsReader(_ context.Context, _, _ string, _ ...job.LogsOption) (io.Reader, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.logs != nil {
+		return f.logs, nil
+	}
+	return strings.NewReader(""), nil
+}
+
+// WatchAll returns a closed channel with a start event of owner1 and a
+// termination event of owner2, as if the watcher had been disconnected.
+func (f *fakeController) WatchAll(_ context.Context) <-chan job.Event {
+	events := make(chan job.Event, 2)
+	events <- job.Event{Owner: "owner1", Status: job.Status{ID: "1", Running: true, ExitCode: job.NotTerminated}}
+	events <- job.Event{Owner: "owner2", Status: job.Status{ID: "2", ExitCode: 3}}
+	close(events)
+	return events
+}
+
+// pipeLogsController is a fakeController that returns a new pipe for each
+// log reader and sends its writer to writers.
+type pipeLogsController struct {
+	fakeController
+	writers chan *io.PipeWriter
+}
+
+func (p *pipeLogsController) LogsReader(_ context.Context, _, _ string, _ ...job.LogsOption) (io.Reader, error) {
+	r, w := io.Pipe()
+	p.writers <- w
+	return r, nil
+}
+
 func newTestController(t *testing.T) *job.Controller {
 	t.Helper()
 	opts := []job.Option{
@@ -0,0 +1,57 @@
+package telejob
+
+import "bytes"
+
+// blankLineSqueezer collapses runs of consecutive blank lines of a log
+// stream into a single blank line, for the squeeze_blank_lines option of log
+// requests. A line is blank if it contains only spaces, tabs and carriage
+// returns. Non-blank lines are passed through unchanged.
+//
+// Log chunks may end within a line. A line that is blank so far is held back
+// until it ends or turns out to be non-blank, so that whitespace-only output
+// at the end of the log is trimmed.
+type blankLineSqueezer struct {
+	held      []byte // start of the current line while it is blank so far.
+	inContent bool   // the current line is known to be non-blank.
+	prevBlank bool   // the previous line was blank.
+}
+
+// squeeze returns the squeezed output for the next chunk of the log stream.
+// The result may be empty.
+func (s *blankLineSqueezer) squeeze(chunk []byte) []byte {
+	out := make([]byte, 0, len(s.held)+len(chunk))
+	for len(chunk) > 0 {
+		line, rest, complete := bytes.Cut(chunk, []byte{'\n'})
+		chunk = rest
+		if !s.inContent && !isBlank(line) {
+			out = append(out, s.held...)
+			s.held = s.held[:0]
+			s.inContent = true
+		}
+		switch {
+		case s.inContent:
+			out = append(out, line...)
+			if complete {
+				out = append(out, '\n')
+				s.inContent, s.prevBlank = false, false
+			}
+		case !complete:
+			s.held = append(s.held, line...)
+		case s.prevBlank:
+			s.held = s.held[:0] // drop repeated blank line.
+		default:
+			out = append(out, s.held...)
+			out = append(out, line...)
+			out = append(out, '\n')
+			s.held = s.held[:0]
+			s.prevBlank = true
+		}
+	}
+	return out
+}
+
+// isBlank reports whether line contains only spaces, tabs and carriage
+// returns.
+func isBlank(line []byte) bool {
+	return len(bytes.Trim(line, " \t\r")) == 0
+}
@@ -0,0 +1,40 @@
+package telejob
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlankLineSqueezer(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		in   string
+		want string
+	}{
+		"no blank lines":   {in: "a\nb\n", want: "a\nb\n"},
+		"single blank":     {in: "a\n\nb\n", want: "a\n\nb\n"},
+		"blank run":        {in: "a\n\n\n\nb\n", want: "a\n\nb\n"},
+		"whitespace lines": {in: "a\n \n\t\r\n  \nb\n", want: "a\n \nb\n"},
+		"leading blanks":   {in: "\n\n\na\n", want: "\na\n"},
+		"content spaces":   {in: "  a  \n\n\n  b", want: "  a  \n\n  b"},
+		"trailing blanks":  {in: "a\n\n\n\n   ", want: "a\n\n"},
+		"unterminated":     {in: "a", want: "a"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			// The output is independent of how the log is split into chunks.
+			for size := 1; size <= len(tc.in); size++ {
+				s := &blankLineSqueezer{}
+				var got []byte
+				for in := []byte(tc.in); len(in) > 0; {
+					n := min(size, len(in))
+					got = append(got, s.squeeze(in[:n])...)
+					in = in[n:]
+				}
+				require.Equal(t, tc.want, string(got), "chunk size %d", size)
+			}
+		})
+	}
+}
@@ -1,11 +1,17 @@
 package telejob_test
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand/v2"
 	"net"
+	"net/http"
 	"reflect"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -36,6 +42,9 @@ const (
 	noIPCrt = "testdata/client-no-ip.crt"
 	noIPKey = "testdata/client-no-ip.key"
 
+	noEKUCrt = "testdata/client-no-eku.crt"
+	noEKUKey = "testdata/client-no-eku.key"
+
 	noIPServerCrt = "testdata/server-no-ip.crt"
 	noIPServerKey = "testdata/server-no-ip.key"
 )
@@ -92,6 +101,477 @@ func TestServiceSimple(t *testing.T) {
 	require.Eventually(t, fn, time.Second, 10*time.Millisecond, statusFromPB(statusResp.GetJobStatus()))
 }
 
+func TestNewClientAddress(t *testing.T) {
+	t.Parallel()
+	for _, address := range []string{
+		"localhost:8443",
+		"127.0.0.1:8443",
+		"[::1]:8443",
+		":8443",
+		"localhost:https",
+		"dns:///telejob.example.com:8443",
+		"dns://8.8.8.8/telejob.example.com:8443",
+		"passthrough:///localhost:8443",
+		"unix:telejob.sock",
+		"unix:///run/telejob.sock",
+		"unix-abstract:telejob",
+	} {
+		client, err := telejob.NewClient(address, crt1, key1, serverCA)
+		require.NoError(t, err, address)
+		require.NoError(t, client.Close())
+	}
+	for _, address := range []string{
+		"",
+		"localhost",
+		"localhost:",
+		"localhost:0",
+		"dns:///localhost",
+		"localhost:65536",
+		"::1:8443",
+		"https://localhost:8443",
+		"unix:",
+		"unix://",
+	} {
+		_, err := telejob.NewClient(address, crt1, key1, serverCA)
+		require.ErrorIs(t, err, telejob.ErrAddress, address)
+	}
+}
+
+func TestClientWithProxy(t *testing.T) {
+	t.Parallel()
+	ts := newTestServer(t, serverCrt, serverKey, clientCA)
+	defer ts.Stop()
+	proxyAddr, connects := startConnectProxy(t)
+
+	client, err := telejob.NewClient(ts.address, crt1, key1, serverCA, telejob.WithProxy("http://"+proxyAddr))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, client.Close()) }()
+	_, err = client.Status(context.Background(), &pb.StatusRequest{Id: "1"})
+	require.Equal(t, codes.NotFound, status.Code(err)) // reached the server.
+	require.Equal(t, ts.address, <-connects)
+
+	_, err = telejob.NewClient(ts.address, crt1, key1, serverCA, telejob.WithProxy("socks5://"+proxyAddr))
+	require.ErrorIs(t, err, telejob.ErrProxy)
+}
+
+func TestClientConnectBackoff(t *testing.T) {
+	t.Parallel()
+	// The listener accepts connections but never completes a TLS handshake,
+	// so that each connection attempt lasts until its timeout.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close() //nolint:errcheck // test cleanup.
+	accepts := make(chan time.Time, 10)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			accepts <- time.Now()
+			go func() {
+				_, _ = io.Copy(io.Discard, conn) // until the client gives up.
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	minConnectTimeout := 300 * time.Millisecond
+	client, err := telejob.NewClient(lis.Addr().String(), crt1, key1, serverCA, telejob.WithConnectBackoff(telejob.ConnectBackoff{
+		BaseDelay:         10 * time.Millisecond,
+		MaxDelay:          10 * time.Millisecond,
+		MinConnectTimeout: minConnectTimeout,
+	}))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, client.Close()) }()
+	go func() { _, _ = client.Status(context.Background(), &pb.StatusRequest{Id: "1"}) }()
+
+	first := <-accepts
+	select {
+	case second := <-accepts:
+		// The default minimum connect timeout would be 20s.
+		require.GreaterOrEqual(t, second.Sub(first), minConnectTimeout)
+		require.Less(t, second.Sub(first), 5*minConnectTimeout)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reconnection attempt")
+	}
+}
+
+// startConnectProxy starts a minimal HTTP CONNECT proxy and returns its
+// address. The target address of each CONNECT request is sent to the returned
+// channel.
+func startConnectProxy(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = lis.Close() })
+	connects := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go proxyConn(conn, connects)
+		}
+	}()
+	return lis.Addr().String(), connects
+}
+
+func proxyConn(conn net.Conn, connects chan<- string) {
+	defer conn.Close()
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil || req.Method != http.MethodConnect {
+		return
+	}
+	connects <- req.Host
+	target, err := net.Dial("tcp", req.Host)
+	if err != nil {
+		_, _ = io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return
+	}
+	defer target.Close()
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return
+	}
+	go func() { _, _ = io.Copy(target, conn) }()
+	_, _ = io.Copy(conn, target)
+}
+
+func TestServerReady(t *testing.T) {
+	t.Parallel()
+	cgroup := fmt.Sprintf("/sys/fs/cgroup/telejob-%d", rand.Uint64()) //nolint:gosec // G404: Use of weak random number generator
+	server, err := telejob.NewServer(serverCrt, serverKey, clientCA, job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	defer server.Stop()
+	select {
+	case <-server.Ready():
+		t.Fatal("server ready before serving")
+	default:
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = server.Serve(lis) }()
+	select {
+	case <-server.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not ready")
+	}
+
+	client, err := telejob.NewClient(lis.Addr().String(), crt1, key1, serverCA)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, client.Close()) }()
+	_, err = client.Status(context.Background(), &pb.StatusRequest{Id: "1"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServerStopAfter(t *testing.T) {
+	t.Parallel()
+	cgroup := fmt.Sprintf("/sys/fs/cgroup/telejob-%d", rand.Uint64()) //nolint:gosec // G404: Use of weak random number generator
+	server, err := telejob.NewServer(serverCrt, serverKey, clientCA, job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(lis) }()
+
+	client, err := telejob.NewClient(lis.Addr().String(), crt1, key1, serverCA)
+	require.NoError(t, err)
+	_, err = client.Start(context.Background(), &pb.StartRequest{Command: "sleep", Arguments: []string{"100"}})
+	require.NoError(t, err)
+
+	server.StopAfter(100 * time.Millisecond)
+	select {
+	case err := <-serveErr:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not stopped after max uptime")
+	}
+	require.NoDirExists(t, cgroup)
+}
+
+func TestServerServeContext(t *testing.T) {
+	t.Parallel()
+	cgroup := fmt.Sprintf("/sys/fs/cgroup/telejob-%d", rand.Uint64()) //nolint:gosec // G404: Use of weak random number generator
+	server, err := telejob.NewServer(serverCrt, serverKey, clientCA, job.WithCgroup(cgroup))
+	require.NoError(t, err)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.ServeContext(ctx, lis) }()
+
+	client, err := telejob.NewClient(lis.Addr().String(), crt1, key1, serverCA)
+	require.NoError(t, err)
+	_, err = client.Start(context.Background(), &pb.StartRequest{Command: "sleep", Arguments: []string{"100"}})
+	require.NoError(t, err)
+
+	cancel()
+	select {
+	case err := <-serveErr:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not stopped after context cancellation")
+	}
+	require.NoDirExists(t, cgroup) // StopAll has run
+	_, err = client.Status(context.Background(), &pb.StatusRequest{Id: "1"})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestClientRequireRPC(t *testing.T) {
+	t.Parallel()
+	ts := newTestServer(t, serverCrt, serverKey, clientCA)
+	defer ts.Stop()
+	client, err := telejob.NewClient(ts.address, crt1, key1, serverCA)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, client.RequireRPC(ctx, "Logs"))
+	require.NoError(t, client.RequireRPC(ctx, "WatchAll"))
+	require.ErrorIs(t, client.RequireRPC(ctx, "Teleport"), telejob.ErrUnsupported)
+}
+
+func TestListenWithRetry(t *testing.T) {
+	t.Parallel()
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := taken.Addr().String()
+
+	_, err = telejob.ListenWithRetry(address, 0)
+	require.ErrorIs(t, err, syscall.EADDRINUSE)
+	_, err = telejob.ListenWithRetry(address, 100*time.Millisecond)
+	require.ErrorIs(t, err, syscall.EADDRINUSE)
+
+	// The port is freed shortly after the initial conflict.
+	time.AfterFunc(200*time.Millisecond, func() { taken.Close() })
+	lis, err := telejob.ListenWithRetry(address, 10*time.Second)
+	require.NoError(t, err)
+	require.Equal(t, address, lis.Addr().String())
+	require.NoError(t, lis.Close())
+
+	// Permanent errors are not retried.
+	start := time.Now()
+	_, err = telejob.ListenWithRetry("127.0.0.1:http-invalid", 10*time.Second)
+	require.Error(t, err)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestServerWatchAll(t *testing.T) {
+	t.Parallel()
+	ts := newTestServerWithOptions(t, telejob.WithOperators("client2"))
+	defer ts.Stop()
+	client1, err := telejob.NewClient(ts.address, crt1, key1, serverCA)
+	require.NoError(t, err)
+	client2, err := telejob.NewClient(ts.address, crt2, key2, serverCA)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client1.WatchAll(ctx, &pb.WatchAllRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err = client2.WatchAll(ctx, &pb.WatchAllRequest{})
+	require.NoError(t, err)
+	_, err = stream.Header() // subscribed
+	require.NoError(t, err)
+	resp1, err := client1.Start(ctx, &pb.StartRequest{Command: "true"})
+	require.NoError(t, err)
+	resp2, err := client2.Start(ctx, &pb.StartRequest{Command: "false"})
+	require.NoError(t, err)
+
+	got := map[string][]string{} // job ID: owner and states
+	for range 4 {
+		resp, err := stream.Recv()
+		require.NoError(t, err)
+		js := resp.GetJobStatus()
+		if len(got[js.GetId()]) == 0 {
+			got[js.GetId()] = append(got[js.GetId()], resp.GetOwner())
+		}
+		got[js.GetId()] = append(got[js.GetId()], fmt.Sprintf("%s/%d", js.GetState(), js.GetExitCode()))
+	}
+	want := map[string][]string{
+		resp1.GetId(): {"client1", "STATE_RUNNING/-2", "STATE_STOPPED/0"},
+		resp2.GetId(): {"client2", "STATE_RUNNING/-2", "STATE_STOPPED/1"},
+	}
+	require.Equal(t, want, got)
+}
+
+func TestServerForceStop(t *testing.T) {
+	t.Parallel()
+	ts := newTestServerWithOptions(t, telejob.WithOperators("client2"))
+	defer ts.Stop()
+	owner, err := telejob.NewClient(ts.address, crt1, key1, serverCA)
+	require.NoError(t, err)
+	operator, err := telejob.NewClient(ts.address, crt2, key2, serverCA)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	startResp, err := owner.Start(ctx, &pb.StartRequest{Command: "sleep", Arguments: []string{"100"}})
+	require.NoError(t, err)
+	id := startResp.GetId()
+
+	// Only the operator role permits stopping jobs of other owners.
+	_, err = operator.Stop(ctx, &pb.StopRequest{Id: id})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = owner.ForceStop(ctx, &pb.ForceStopRequest{Id: id})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = operator.ForceStop(ctx, &pb.ForceStopRequest{Id: id})
+	require.NoError(t, err)
+	stopped := func() bool {
+		statusResp, err := owner.Status(ctx, &pb.StatusRequest{Id: id})
+		require.NoError(t, err)
+		return statusResp.GetJobStatus().GetState() == pb.State_STATE_STOPPED
+	}
+	require.Eventually(t, stopped, time.Second, 10*time.Millisecond)
+}
+
+func TestServerStartStdin(t *testing.T) {
+	t.Parallel()
+	ts := newTestServer(t, serverCrt, serverKey, clientCA)
+	defer ts.Stop()
+	client, err := telejob.NewClient(ts.address, crt1, key1, serverCA)
+	require.NoError(t, err)
+
+	// Larger than gRPC's default maximum message size of 4MB.
+	const size = 5*1024*1024 + 3
+	ctx := context.Background()
+	stdin := strings.NewReader(strings.Repeat("x", size))
+	req := &pb.StartRequest{Command: "sh", Arguments: []string{"-c", "echo $GREETING; wc -c"}, Env: []string{"GREETING=hello"}}
+	startResp, err := client.StartStdin(ctx, req, stdin)
+	require.NoError(t, err)
+
+	stream, err := client.Logs(ctx, &pb.LogsRequest{Id: startResp.GetId()})
+	require.NoError(t, err)
+	var out strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		out.Write(resp.GetChunk())
+	}
+	require.Equal(t, fmt.Sprintf("hello\n%d\n", size), out.String())
+}
+
+func TestClientTail(t *testing.T) {
+	t.Parallel()
+	ts := newTestServer(t, serverCrt, serverKey, clientCA)
+	defer ts.Stop()
+	client, err := telejob.NewClient(ts.address, crt1, key1, serverCA)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	startResp, err := client.Start(ctx, &pb.StartRequest{Command: "echo", Arguments: []string{"hello"}})
+	require.NoError(t, err)
+	output, errs := client.Tail(ctx, startResp.GetId())
+	var out strings.Builder
+	for chunk := range output {
+		out.Write(chunk)
+	}
+	require.Equal(t, "hello\n", out.String())
+	require.NoError(t, <-errs)
+	_, ok := <-output
+	require.False(t, ok)
+
+	output, errs = client.Tail(ctx, "bogus")
+	_, ok = <-output
+	require.False(t, ok)
+	require.Equal(t, codes.NotFound, status.Code(<-errs))
+}
+
+func TestServerAttach(t *testing.T) {
+	t.Parallel()
+	ts := newTestServer(t, serverCrt, serverKey, clientCA)
+	defer ts.Stop()
+	client, err := telejob.NewClient(ts.address, crt1, key1, serverCA)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	startResp, err := client.Start(ctx, &pb.StartRequest{Command: "cat", Tty: true})
+	require.NoError(t, err)
+	id := startResp.GetId()
+	defer func() { _, _ = client.Stop(ctx, &pb.StopRequest{Id: id}) }()
+
+	stream, err := client.Attach(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.AttachRequest{Id: id, Data: []byte("hello\n")}))
+	// The terminal echoes the line, then cat writes it back.
+	var out strings.Builder
+	for out.String() != "hello\r\nhello\r\n" {
+		resp, err := stream.Recv()
+		require.NoError(t, err)
+		out.Write(resp.GetChunk())
+	}
+
+	// A second session may follow the output, but not send input. Its input
+	// is reported as dropped and its output continues.
+	stream2, err := client.Attach(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream2.Send(&pb.AttachRequest{Id: id, Data: []byte("x")}))
+	resp, err := stream2.Recv()
+	for err == nil && resp.GetInputError() == "" {
+		resp, err = stream2.Recv()
+	}
+	require.NoError(t, err)
+	require.Contains(t, resp.GetInputError(), job.ErrInputAttached.Error())
+	require.NoError(t, stream.Send(&pb.AttachRequest{Data: []byte("again\n")}))
+	out.Reset()
+	for !strings.Contains(out.String(), "again\r\nagain\r\n") {
+		resp, err := stream2.Recv()
+		require.NoError(t, err)
+		out.Write(resp.GetChunk())
+	}
+	require.NoError(t, stream2.CloseSend())
+
+	// End of transmission makes cat exit, which ends the stream.
+	require.NoError(t, stream.Send(&pb.AttachRequest{Data: []byte{0x04}}))
+	require.NoError(t, stream.CloseSend())
+	for {
+		_, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+	}
+}
+
+func TestServerGetLogs(t *testing.T) {
+	t.Parallel()
+	ts := newTestServer(t, serverCrt, serverKey, clientCA)
+	defer ts.Stop()
+	client, err := telejob.NewClient(ts.address, crt1, key1, serverCA)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	startResp, err := client.Start(ctx, &pb.StartRequest{Command: "sh", Arguments: []string{"-c", "seq 1 1000; sleep 100"}})
+	require.NoError(t, err)
+	id := startResp.GetId()
+	defer func() { _, _ = client.Stop(ctx, &pb.StopRequest{Id: id}) }()
+
+	// GetLogs does not wait for further output of the running job.
+	var resp *pb.GetLogsResponse
+	require.Eventually(t, func() bool {
+		resp, err = client.GetLogs(ctx, &pb.GetLogsRequest{Id: id, Tail: 13})
+		require.NoError(t, err)
+		return len(resp.GetData()) == 13
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, "998\n999\n1000\n", string(resp.GetData()))
+	require.Equal(t, uint64(3880), resp.GetOffset())
+	require.False(t, resp.GetTruncated())
+
+	resp, err = client.GetLogs(ctx, &pb.GetLogsRequest{Id: id, Offset: 3888})
+	require.NoError(t, err)
+	require.Equal(t, "1000\n", string(resp.GetData()))
+	require.Equal(t, uint64(3888), resp.GetOffset())
+
+	_, err = client.GetLogs(ctx, &pb.GetLogsRequest{Id: id, Offset: 1, Tail: 1})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
 func TestServiceNotFound(t *testing.T) {
 	t.Parallel()
 	ts := newTestServer(t, serverCrt, serverKey, clientCA)
@@ -172,18 +652,31 @@ type testServer struct {
 
 func newTestServer(t *testing.T, serverCrt, serverKey, clientCA string) *testServer {
 	t.Helper()
-	opts := []job.Option{
+	return newTestServerWithCerts(t, serverCrt, serverKey, clientCA)
+}
+
+func newTestServerWithOptions(t *testing.T, opts ...telejob.ServerOption) *testServer {
+	t.Helper()
+	return newTestServerWithCerts(t, serverCrt, serverKey, clientCA, opts...)
+}
+
+func newTestServerWithCerts(t *testing.T, serverCrt, serverKey, clientCA string, opts ...telejob.ServerOption) *testServer {
+	t.Helper()
+	jobOpts := []job.Option{
 		//nolint:gosec // G404: Use of weak random number generator
 		job.WithCgroup(fmt.Sprintf("/sys/fs/cgroup/telejob-%d", rand.Uint64())),
 	}
-	server, err := telejob.NewServer(serverCrt, serverKey, clientCA, opts...)
+	opts = append([]telejob.ServerOption{telejob.WithJobOptions(jobOpts...)}, opts...)
+	server, err := telejob.NewServerWithOptions(serverCrt, serverKey, clientCA, opts...)
 	require.NoError(t, err)
 	lis, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err)
-	go func() {
-		if err := server.Serve(lis); err != nil {
-			t.Errorf("cannot start test server %v", err)
-		}
-	}()
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(lis) }()
+	select {
+	case <-server.Ready():
+	case err := <-serveErr:
+		t.Fatalf("cannot start test server: %v", err)
+	}
 	return &testServer{Server: server, address: lis.Addr().String()}
 }